@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -26,7 +27,7 @@ func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	// Load configuration
-	cfg := config.MustLoad()
+	cfg := config.MustLoad(config.Services, config.Workers)
 
 	// Initialize Tracer
 	shutdown, err := telemetry.InitTracer("chat-svc", cfg.OtelCollectorURL)
@@ -74,6 +75,11 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to declare exchanges")
 	}
 
+	// Declare the dead letter queue before the shared queue that routes to it
+	if err := rmqClient.DeclareDeadLetterQueue(); err != nil {
+		log.Fatal().Err(err).Msg("failed to declare dead letter queue")
+	}
+
 	// Declare shared chat queue
 	if err := rmqClient.DeclareSharedChatQueue(); err != nil {
 		log.Fatal().Err(err).Msg("failed to declare shared chat queue")
@@ -81,10 +87,14 @@ func main() {
 
 	// Initialize Repositories
 	chatRepo := postgres.NewChatRepository(db)
+	userRepo := postgres.NewUserRepository(db)
+	blockRepo := postgres.NewBlockRepository(db)
 	cacheRepo := redis.NewCacheRepository(redisClient)
 
 	// Initialize Service
-	svc := chatService.NewService(chatRepo, cacheRepo, rmqClient)
+	svc := chatService.NewService(chatRepo, userRepo, blockRepo, cacheRepo, rmqClient)
+	// Scheduled messages are checked again on dispatch, which needs the media bucket
+	svc.SetMediaBaseURL(cfg.ObjectStorePublicEndpoint + "/" + cfg.ObjectStoreBucket)
 
 	log.Info().Msg("chat service started, waiting for messages...")
 
@@ -95,9 +105,20 @@ func main() {
 	// Start a worker pool
 	numWorkers := 10
 	for i := 0; i < numWorkers; i++ {
-		go runWorker(ctx, i, svc, rmqClient)
+		go runWorker(ctx, i, svc, rmqClient, cfg)
 	}
 
+	go logDeadLetters(ctx, rmqClient)
+
+	// Purge messages past their retention. Media is deleted by the gateway's cleanup job.
+	go svc.RunRetention(ctx, cfg.RetentionInterval, cfg.MessageRetentionDays)
+
+	// Delete disappearing messages once their chat's TTL has passed
+	go svc.RunExpiry(ctx, cfg.MessageExpiryInterval)
+
+	// Send scheduled messages once their time has come
+	go svc.RunScheduler(ctx, cfg.ScheduledDispatchInterval)
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -111,7 +132,7 @@ func main() {
 	log.Info().Msg("chat service exited")
 }
 
-func runWorker(ctx context.Context, workerID int, svc *chatService.Service, rmqClient *rabbitmq.Client) {
+func runWorker(ctx context.Context, workerID int, svc *chatService.Service, rmqClient *rabbitmq.Client, cfg *config.Config) {
 	logger := log.With().Int("worker_id", workerID).Logger()
 	logger.Info().Msg("worker started")
 
@@ -123,6 +144,7 @@ func runWorker(ctx context.Context, workerID int, svc *chatService.Service, rmqC
 		return
 	}
 
+	failures := 0 // consecutive processing failures, drives the retry backoff
 	for {
 		select {
 		case <-ctx.Done():
@@ -134,16 +156,19 @@ func runWorker(ctx context.Context, workerID int, svc *chatService.Service, rmqC
 				return
 			}
 			
+			// Carry the publisher's request ID into this message's logs
+			msgCtx := rabbitmq.ContextWithDelivery(ctx, delivery)
+			msgLogger := telemetry.Logger(msgCtx).With().Int("worker_id", workerID).Logger()
+
 			// Process message
 			var payload struct {
-				UUID   string `json:"uuid"`
 				ChatID int64  `json:"chatId"`
 				UserID int64  `json:"userId"`
 				Body   string `json:"body"`
 			}
 
 			if err := json.Unmarshal(delivery.Body, &payload); err != nil {
-				logger.Error().Err(err).Msg("failed to parse message payload")
+				msgLogger.Error().Err(err).Msg("failed to parse message payload")
 				delivery.Nack(false, false)
 				continue
 			}
@@ -154,13 +179,58 @@ func runWorker(ctx context.Context, workerID int, svc *chatService.Service, rmqC
 				Body:   payload.Body,
 			}
 
-			if err := svc.ProcessMessage(ctx, msg, payload.UUID); err != nil {
-				logger.Error().Err(err).Msg("failed to process message")
-				delivery.Nack(false, true)
+			// Bound each message so a stuck dependency can't freeze the worker
+			procCtx, cancelProc := context.WithTimeout(msgCtx, cfg.WorkerProcessTimeout)
+			err := svc.ProcessMessage(procCtx, msg)
+			timedOut := errors.Is(procCtx.Err(), context.DeadlineExceeded)
+			cancelProc()
+
+			if err != nil {
+				failures++
+				retries := rabbitmq.RetryCount(delivery)
+				if retries >= cfg.WorkerMaxRetries {
+					// Poison message: dead-letter it instead of blocking the worker forever
+					msgLogger.Error().Err(err).Int("retries", retries).Msg("giving up on message, dead-lettering")
+					delivery.Nack(false, false)
+					continue
+				}
+
+				delay := rabbitmq.RetryBackoff(failures, cfg.WorkerRetryBackoff, cfg.WorkerRetryBackoffMax)
+				msgLogger.Error().Err(err).Bool("timed_out", timedOut).Int("retries", retries).Dur("retry_in", delay).Msg("failed to process message")
+				if err := rmqClient.RetryAfter(ctx, delivery, delay); err != nil {
+					msgLogger.Error().Err(err).Msg("failed to schedule retry")
+				}
 				continue
 			}
+			failures = 0
 
 			delivery.Ack(false)
 		}
 	}
 }
+
+// logDeadLetters logs every dead-lettered chat message with its payload, so it
+// can be inspected and replayed by hand, and acks it
+func logDeadLetters(ctx context.Context, rmqClient *rabbitmq.Client) {
+	msgs, err := rmqClient.ConsumeDeadLetterQueue("chat-dead-letters")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to start consuming dead letter queue")
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d, ok := <-msgs:
+			if !ok {
+				return
+			}
+			telemetry.Logger(rabbitmq.ContextWithDelivery(ctx, d)).Error().
+				Int("retries", rabbitmq.RetryCount(d)).
+				Bytes("payload", d.Body).
+				Msg("chat message dead-lettered")
+			d.Ack(false)
+		}
+	}
+}
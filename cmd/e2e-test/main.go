@@ -77,16 +77,13 @@ func main() {
 	fmt.Println("\n[Test] Admin sending 'Hello' message...")
 	msgID := sendMessage(adminWS, chatID, "Hello World")
 
+	fmt.Printf("✅ Admin received Delivered ack with msgId %d\n", msgID)
+
 	// Verify Member received Message
 	select {
 	case msg := <-memberMsgs:
-		if msg["type"] == "Message" && int64(msg["chatId"].(float64)) == chatID && msg["body"] == "Hello World" {
+		if msg["type"] == "Message" && int64(msg["chat_id"].(float64)) == chatID && int64(msg["id"].(float64)) == msgID {
 			fmt.Println("✅ Member received Message")
-			// Capture msgId for Read Receipt test
-			msgID = int64(msg["msgId"].(float64))
-			if msgID == 0 {
-				panic("Received msgId is 0")
-			}
 		} else {
 			panic(fmt.Sprintf("Unexpected message: %v", msg))
 		}
@@ -177,7 +174,8 @@ func registerDevice(token, deviceToken, platform string) {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
+	// 200 means the token was already registered, e.g. on a re-run
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
 		panic(fmt.Sprintf("Failed to register device: %d", resp.StatusCode))
 	}
 	fmt.Println("✅ Device registered")
@@ -287,24 +285,35 @@ func sendReadReceipt(conn *websocket.Conn, chatID, msgID int64) {
 	conn.WriteJSON(msg)
 }
 
+// sendMessage sends text and waits for the server's Delivered ack, returning
+// the assigned message ID. It reads conn directly, so call it before a reader
+// goroutine owns the connection.
 func sendMessage(conn *websocket.Conn, chatID int64, text string) int64 {
-	// We don't know the msgID yet, it's assigned by server.
-	// But for the test we need it.
-	// Actually, the server sends back a "Delivered" ack with msgId.
-	// Or the "Message" event to others has it.
-	// Let's assume we get it from the receiver's "Message" event for now.
-	// But wait, we need it to send the Read receipt.
-	// So the test flow is: Admin sends -> Member receives (gets ID) -> Member sends Read(ID).
-	// So sendMessage doesn't return ID immediately.
-	// We'll return 0 and let the caller extract it from receiver.
-	// Wait, the caller (main) extracts it from memberMsgs.
-	
+	uuid := fmt.Sprintf("%d", time.Now().UnixNano())
 	msg := map[string]any{
 		"type":   "SendMessage",
-		"uuid":   fmt.Sprintf("%d", time.Now().UnixNano()),
+		"uuid":   uuid,
 		"chatId": chatID,
 		"body":   text,
 	}
-	conn.WriteJSON(msg)
-	return 0 // Placeholder, actual ID comes from events
+	if err := conn.WriteJSON(msg); err != nil {
+		panic(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		var event map[string]any
+		if err := conn.ReadJSON(&event); err != nil {
+			panic(fmt.Sprintf("Timeout waiting for Delivered ack: %v", err))
+		}
+		// Other events, like the author's own copy of the message, are skipped
+		if event["type"] == "Delivered" && event["uuid"] == uuid {
+			msgID := int64(event["msgId"].(float64))
+			if msgID == 0 {
+				panic("Delivered ack has msgId 0")
+			}
+			return msgID
+		}
+	}
 }
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -19,12 +21,16 @@ import (
 	authService "github.com/ambarg/mini-telegram/internal/service/auth"
 	chatService "github.com/ambarg/mini-telegram/internal/service/chat"
 	mediaService "github.com/ambarg/mini-telegram/internal/service/media"
+	userService "github.com/ambarg/mini-telegram/internal/service/user"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
 	"github.com/ambarg/mini-telegram/internal/websocket"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
 
 	docs "github.com/ambarg/mini-telegram/docs"
 	swaggerFiles "github.com/swaggo/files"
@@ -49,13 +55,28 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// deliveryTracer traces the broadcast of messages to local connections
+var deliveryTracer = otel.Tracer("github.com/ambarg/mini-telegram/cmd/gateway")
+
 func main() {
 	// Setup logger
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	// Load configuration
-	cfg := config.MustLoad()
+	cfg := config.MustLoad(config.Services, config.Gateway)
+
+	// Initialize Tracer. Unlike the workers the gateway keeps serving, untraced,
+	// when the collector is unreachable.
+	if shutdown, err := telemetry.InitTracer("gateway", cfg.OtelCollectorURL); err != nil {
+		log.Warn().Err(err).Msg("failed to initialize tracer, continuing without tracing")
+	} else {
+		defer func() {
+			if err := shutdown(context.Background()); err != nil {
+				log.Error().Err(err).Msg("failed to shutdown tracer")
+			}
+		}()
+	}
 
 	// Set Gin mode
 	gin.SetMode(cfg.GinMode)
@@ -109,6 +130,7 @@ func main() {
 	// Initialize Repositories
 	userRepo := postgres.NewUserRepository(db)
 	chatRepo := postgres.NewChatRepository(db)
+	blockRepo := postgres.NewBlockRepository(db)
 	cacheRepo := redis.NewCacheRepository(redisClient)
 	mediaRepo, err := s3.New(context.Background(), cfg)
 	if err != nil {
@@ -116,15 +138,36 @@ func main() {
 	}
 
 	// Initialize Services
-	authSvc := authService.NewService(userRepo, auth.NewService(privateKey))
-	chatSvc := chatService.NewService(chatRepo, cacheRepo, rmqClient)
-	mediaSvc := mediaService.NewService(mediaRepo)
+	jwtSvc := auth.NewService(privateKey)
+	authSvc := authService.NewService(userRepo, cacheRepo, jwtSvc, cfg.AccountReactivationWindow, auth.PasswordPolicy{
+		MinLength:        cfg.PasswordMinLength,
+		RequireMixedCase: cfg.PasswordRequireMixedCase,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		RejectCommon:     cfg.PasswordRejectCommon,
+	})
+	jwtSvc.SetTokenVersions(authSvc)
+	mediaBaseURL := cfg.ObjectStorePublicEndpoint + "/" + cfg.ObjectStoreBucket
+	chatSvc := chatService.NewService(chatRepo, userRepo, blockRepo, cacheRepo, rmqClient)
+	chatSvc.SetEditWindow(cfg.MessageEditWindow)
+	chatSvc.SetMediaBaseURL(mediaBaseURL)
+	mediaSvc := mediaService.NewService(mediaRepo, chatRepo, cacheRepo, mediaService.Config{
+		URLExpiry:           cfg.UploadURLExpiry,
+		DownloadURLExpiry:   cfg.DownloadURLExpiry,
+		CleanupGrace:        cfg.MediaCleanupGracePeriod,
+		UploadsPerMinute:    cfg.UploadURLRateLimit,
+		MaxUploadSize:       cfg.MaxUploadSize,
+		MaxFileSize:         cfg.MaxFileSize,
+		AllowedContentTypes: cfg.UploadContentTypes,
+		PublicURL:           mediaBaseURL,
+	})
+	userSvc := userService.NewService(userRepo, chatRepo, blockRepo, cacheRepo)
 
 	// Initialize Handlers
 	authHandler := httpHandler.NewAuthHandler(authSvc)
 	chatHandler := httpHandler.NewChatHandler(chatSvc)
 	mediaHandler := httpHandler.NewMediaHandler(mediaSvc)
-	userHandler := httpHandler.NewUserHandler(cacheRepo, userRepo)
+	userHandler := httpHandler.NewUserHandler(cacheRepo, userRepo, userSvc)
 
 	// Create WebSocket hub
 	hub := websocket.NewHub(log.Logger)
@@ -135,17 +178,27 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to declare delivery queue")
 	}
+	if err := rmqClient.DeclarePresenceFanoutBinding(queueName); err != nil {
+		log.Fatal().Err(err).Msg("failed to bind delivery queue to presence fanout")
+	}
 
 	// Initialize WebSocket Handler
-	wsHandler := httpHandler.NewWebSocketHandler(hub, chatSvc, auth.NewService(privateKey), cacheRepo, rmqClient, queueName)
+	wsHandler := httpHandler.NewWebSocketHandler(hub, chatSvc, jwtSvc, cacheRepo, rmqClient, queueName,
+		httpHandler.CompressionConfig{Enabled: cfg.WSCompression, Threshold: cfg.WSCompressionThreshold}, cfg.WSMaxMessageSize, cfg.MsgRateLimit,
+		httpHandler.HeartbeatConfig{PodID: podID, TTL: cfg.ConnTTL, Interval: cfg.PingInterval})
+	debugHandler := httpHandler.NewDebugHandler(hub)
+	adminHandler := httpHandler.NewAdminHandler(hub, rmqClient, cacheRepo, cfg.AnnounceRateLimit)
 
 	// Start RabbitMQ Consumer for Delivery
-	msgs, err := rmqClient.ConsumeDeliveryQueue(queueName, "gateway-"+podID)
+	consumerTag := "gateway-" + podID
+	msgs, err := rmqClient.ConsumeDeliveryQueue(queueName, consumerTag)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start delivery consumer")
 	}
 
+	deliveryDone := make(chan struct{})
 	go func() {
+		defer close(deliveryDone)
 		for d := range msgs {
 			var msg map[string]any
 			if err := json.Unmarshal(d.Body, &msg); err != nil {
@@ -154,14 +207,98 @@ func main() {
 				continue
 			}
 
+			// Presence changes reach every gateway; forward them to the
+			// local users who share a chat with the subject
+			if msg["type"] == "Presence" {
+				subjectID, _ := msg["userId"].(float64)
+				recipients, err := chatSvc.PresenceRecipients(context.Background(), int64(subjectID), hub.GetConnectedUserIDs())
+				if err != nil {
+					log.Error().Err(err).Int64("user_id", int64(subjectID)).Msg("failed to resolve presence recipients")
+				} else {
+					hub.Broadcast(recipients, d.Body)
+				}
+				d.Ack(false)
+				continue
+			}
+
+			// Message events use snake_case keys, the other events camelCase
 			chatID, ok := msg["chatId"].(float64)
+			if !ok {
+				chatID, ok = msg["chat_id"].(float64)
+			}
 			if !ok {
 				d.Ack(false)
 				continue
 			}
 
 			// Broadcast to chat members connected to this gateway
-			hub.BroadcastToChat(int64(chatID), d.Body)
+			switch msg["type"] {
+			case "Typing", "StopTyping":
+				// Not echoed back to their subject
+				subjectID, _ := msg["userId"].(float64)
+				hub.BroadcastToChatExcept(int64(chatID), d.Body, int64(subjectID))
+			case "Message":
+				_, span := deliveryTracer.Start(rabbitmq.ContextWithDelivery(context.Background(), d), "gateway.deliver")
+
+				// The author's devices get exactly one copy, marked self, so
+				// their other devices show the sent message right away. The
+				// device it was sent from already shows it unless echo is on.
+				authorID, _ := msg["user_id"].(float64)
+				body := d.Body
+				excluded := []int64{int64(authorID)}
+				var skipDevices []string
+				if origin, ok := msg[chatService.OriginDeviceKey].(string); ok {
+					delete(msg, chatService.OriginDeviceKey)
+					body, _ = json.Marshal(msg)
+					if !cfg.WSEchoToOrigin {
+						skipDevices = append(skipDevices, origin)
+					}
+				}
+
+				// Members who blocked the author get no copy at all
+				blocked := make(map[int64]bool)
+				if ids, ok := msg[chatService.BlockedUserIDsKey].([]any); ok {
+					delete(msg, chatService.BlockedUserIDsKey)
+					body, _ = json.Marshal(msg)
+					for _, id := range ids {
+						userID, _ := id.(float64)
+						blocked[int64(userID)] = true
+						excluded = append(excluded, int64(userID))
+					}
+				}
+
+				// Members who muted the chat still get the message, marked
+				// muted, without learning who else muted it
+				if muted, ok := msg[chatService.MutedUserIDsKey].([]any); ok {
+					delete(msg, chatService.MutedUserIDsKey)
+					body, _ = json.Marshal(msg)
+					msg["muted"] = true
+					mutedPayload, _ := json.Marshal(msg)
+					delete(msg, "muted")
+					for _, id := range muted {
+						userID, _ := id.(float64)
+						if int64(userID) == int64(authorID) || blocked[int64(userID)] {
+							continue
+						}
+						excluded = append(excluded, int64(userID))
+						hub.SendToUser(int64(userID), mutedPayload)
+					}
+				}
+
+				hub.BroadcastToChatExcept(int64(chatID), body, excluded...)
+				msg["self"] = true
+				if selfPayload, err := json.Marshal(msg); err == nil {
+					hub.SendToUserExcept(int64(authorID), selfPayload, skipDevices...)
+				}
+				if createdAt, ok := msg["created_at"].(string); ok {
+					if sentAt, err := time.Parse(time.RFC3339Nano, createdAt); err == nil {
+						websocket.ObserveDeliveryLatency(sentAt)
+					}
+				}
+				span.End()
+			default:
+				hub.BroadcastToChat(int64(chatID), d.Body)
+			}
 			d.Ack(false)
 		}
 	}()
@@ -169,45 +306,61 @@ func main() {
 	// Setup Router
 	r := gin.Default()
 	r.Use(otelgin.Middleware("gateway"))
+	r.Use(telemetry.RequestIDMiddleware())
 
 	// CORS Setup
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"}, // Allow local dev and docker web
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", telemetry.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", telemetry.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	// Health check
 	r.GET("/v1/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
+		if !rmqClient.Healthy() {
+			// Still serving, but messages can't be delivered until the broker is back
+			c.JSON(503, gin.H{"status": "degraded", "rabbitmq": "down"})
+			return
+		}
+		c.JSON(200, gin.H{"status": "ok", "rabbitmq": "up"})
 	})
 
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	// Swagger
 	docs.SwaggerInfo.BasePath = "/v1"
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// WebSocket route
-	r.GET("/v1/ws", wsHandler.HandleWS)
+	r.GET("/v1/ws", httpHandler.RateLimitByIP(cacheRepo, "ws", cfg.WSRateLimit), wsHandler.HandleWS)
 
 	// Auth routes
 	authGroup := r.Group("/v1/auth")
 	{
-		authGroup.POST("/register", authHandler.Register)
-		authGroup.POST("/login", authHandler.Login)
+		loginLimit := httpHandler.RateLimitByIP(cacheRepo, "login", cfg.LoginRateLimit)
+		authGroup.POST("/register", loginLimit, authHandler.Register)
+		authGroup.POST("/login", loginLimit, authHandler.Login)
 		authGroup.POST("/refresh", authHandler.Refresh)
+		authGroup.POST("/logout", authHandler.Logout)
+		authGroup.GET("/verify", authHandler.VerifyEmail)
 	}
 
 	// Protected routes
 	protected := r.Group("/v1")
-	jwtMiddleware := auth.NewService(privateKey).JWTMiddleware()
+	jwtMiddleware := jwtSvc.JWTMiddleware()
 	protected.Use(jwtMiddleware)
 	{
+		protected.POST("/auth/logout-all", authHandler.LogoutAll)
+		protected.POST("/auth/resend-verification", authHandler.ResendVerification)
+
 		// Chat routes
 		protected.GET("/chats", chatHandler.GetChats)
 		protected.POST("/chats", chatHandler.CreateChat)
+		protected.GET("/chats/:id", chatHandler.GetChat)
 		protected.PATCH("/chats/:id", chatHandler.UpdateGroupInfo)
 		protected.POST("/chats/:id/invite", chatHandler.InviteToChat)
 		protected.DELETE("/chats/:id/members/:userId", chatHandler.KickMember)
@@ -216,32 +369,86 @@ func main() {
 		protected.POST("/chats/:id/members/:userId/demote", chatHandler.DemoteMember)
 		protected.GET("/chats/:id/messages", chatHandler.GetMessages)
 		protected.POST("/chats/:id/messages", chatHandler.SendMessage)
+		protected.GET("/chats/:id/messages/:msgId", chatHandler.GetMessage)
+		protected.PATCH("/chats/:id/messages/:msgId", chatHandler.EditMessage)
+		protected.DELETE("/chats/:id/messages/:msgId", chatHandler.DeleteMessage)
+		protected.POST("/chats/:id/messages/:msgId/forward", chatHandler.ForwardMessage)
+		protected.GET("/chats/:id/scheduled", chatHandler.GetScheduledMessages)
+		protected.DELETE("/chats/:id/scheduled/:scheduledId", chatHandler.CancelScheduledMessage)
+		protected.POST("/messages/batch", chatHandler.GetMessagesBatch)
 		protected.POST("/chats/:id/read", chatHandler.MarkRead) // New route
+		protected.PATCH("/chats/:id/notifications", chatHandler.UpdateNotificationSettings)
+		protected.POST("/chats/:id/archive", chatHandler.ArchiveChat)
+		protected.DELETE("/chats/:id/archive", chatHandler.UnarchiveChat)
+		protected.PUT("/chats/:id/ttl", chatHandler.SetMessageTTL)
+		protected.POST("/chats/:id/mute", chatHandler.MuteChat)
+		protected.DELETE("/chats/:id/mute", chatHandler.UnmuteChat)
 		protected.GET("/chats/:id/members", chatHandler.GetChatMembers)
 		
 		// Reaction routes
 		protected.POST("/chats/:id/messages/:msgId/reactions", chatHandler.AddReaction)
 		protected.DELETE("/chats/:id/messages/:msgId/reactions/:emoji", chatHandler.RemoveReaction)
 		
+		// Pin routes
+		protected.GET("/chats/:id/pins", chatHandler.GetPinnedMessages)
+		protected.POST("/chats/:id/messages/:msgId/pin", chatHandler.PinMessage)
+		protected.DELETE("/chats/:id/messages/:msgId/pin", chatHandler.UnpinMessage)
+		
 		// Thread routes
 		protected.GET("/chats/:id/messages/:msgId/replies", chatHandler.GetThreadReplies)
+
+		// Folder routes
+		protected.GET("/folders", chatHandler.ListFolders)
+		protected.POST("/folders", chatHandler.CreateFolder)
+		protected.PUT("/folders/:id", chatHandler.RenameFolder)
+		protected.DELETE("/folders/:id", chatHandler.DeleteFolder)
+		protected.PUT("/folders/:id/chats/:chatId", chatHandler.AddChatToFolder)
+		protected.DELETE("/folders/:id/chats/:chatId", chatHandler.RemoveChatFromFolder)
 		
 		protected.POST("/devices", chatHandler.RegisterDevice)
 
 		// Media routes
 		protected.POST("/uploads/presigned", mediaHandler.GetUploadURL)
+		protected.GET("/uploads/presigned", mediaHandler.GetDownloadURL)
+		protected.POST("/uploads/multipart", mediaHandler.InitiateMultipartUpload)
+		protected.POST("/uploads/multipart/parts", mediaHandler.PresignUploadParts)
+		protected.POST("/uploads/multipart/complete", mediaHandler.CompleteMultipartUpload)
+		protected.POST("/uploads/multipart/abort", mediaHandler.AbortMultipartUpload)
 
 		// User routes
 		protected.GET("/users/me", userHandler.GetProfile)
 		protected.PATCH("/users/me", userHandler.UpdateProfile)
+		protected.DELETE("/users/me", userHandler.DeactivateAccount)
+		protected.POST("/users/me/password", authHandler.ChangePassword)
+		protected.GET("/users/me/unread", chatHandler.GetUnreadSummary)
+		protected.GET("/users/:id", userHandler.GetUserProfile)
 		protected.GET("/users/:id/presence", userHandler.GetUserPresence)
+		protected.POST("/users/presence", userHandler.GetPresenceBatch)
+		protected.GET("/users/blocks", userHandler.ListBlocks)
+		protected.POST("/users/:id/block", userHandler.BlockUser)
+		protected.DELETE("/users/:id/block", userHandler.UnblockUser)
 		protected.GET("/users", userHandler.SearchUsers)
+
+		// Operator routes, gated by the is_admin token claim
+		debugGroup := protected.Group("/debug", auth.RequireAdmin())
+		debugGroup.GET("/hub", debugHandler.GetHubStats)
+		adminGroup := protected.Group("/admin", auth.RequireAdmin())
+		adminGroup.POST("/announce", adminHandler.Announce)
 	}
 
+	// Remove media of deleted messages once their grace period has passed
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go mediaSvc.RunCleanup(cleanupCtx, cfg.MediaCleanupInterval)
+
 	// Start server
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: r,
+	}
 	go func() {
 		log.Info().Int("port", cfg.Port).Msg("starting gateway server")
-		if err := r.Run(fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal().Err(err).Msg("failed to start server")
 		}
 	}()
@@ -252,4 +459,26 @@ func main() {
 	<-quit
 
 	log.Info().Msg("shutting down server...")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// Stop accepting requests and upgrades, and let in-flight requests finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("server shutdown did not complete")
+	}
+
+	// Shutdown doesn't track upgraded connections. Ask clients to reconnect
+	// elsewhere; each disconnect marks its user offline. Connections still open
+	// when the timeout runs out are closed.
+	hub.Drain(shutdownCtx)
+
+	// Nobody is left to deliver to
+	if err := rmqClient.CancelConsumer(consumerTag); err != nil {
+		log.Error().Err(err).Msg("failed to cancel delivery consumer")
+	}
+	select {
+	case <-deliveryDone:
+	case <-shutdownCtx.Done():
+	}
+	log.Info().Msg("gateway exited")
 }
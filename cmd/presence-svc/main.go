@@ -14,6 +14,7 @@ import (
 	"github.com/ambarg/mini-telegram/internal/repository/redis"
 	"github.com/ambarg/mini-telegram/internal/service/presence"
 	"github.com/ambarg/mini-telegram/internal/telemetry"
+	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -24,7 +25,7 @@ func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	// Load configuration
-	cfg := config.MustLoad()
+	cfg := config.MustLoad(config.Services)
 
 	// Initialize Tracer
 	shutdown, err := telemetry.InitTracer("presence-svc", cfg.OtelCollectorURL)
@@ -81,6 +82,10 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to declare read receipt queue")
 	}
 
+	if err := rmqClient.DeclareDeliveredReceiptQueue(); err != nil {
+		log.Fatal().Err(err).Msg("failed to declare delivered receipt queue")
+	}
+
 	// Initialize Repositories
 	chatRepo := postgres.NewChatRepository(db)
 	cacheRepo := redis.NewCacheRepository(redisClient)
@@ -95,7 +100,8 @@ func main() {
 	// Start read receipt workers
 	numReadReceiptWorkers := 3
 	for i := 0; i < numReadReceiptWorkers; i++ {
-		go runReadReceiptWorker(ctx, i, svc, rmqClient)
+		go runReceiptWorker(ctx, i, "read", rmqClient.ConsumeReadReceiptQueue, svc.ProcessReadReceipt)
+		go runReceiptWorker(ctx, i, "delivered", rmqClient.ConsumeDeliveredReceiptQueue, svc.ProcessDeliveredReceipt)
 	}
 
 	// Start batch processor
@@ -116,15 +122,19 @@ func main() {
 	log.Info().Msg("presence service exited")
 }
 
-func runReadReceiptWorker(ctx context.Context, workerID int, svc *presence.Service, rmqClient *rabbitmq.Client) {
-	logger := log.With().Int("worker_id", workerID).Logger()
-	logger.Info().Msg("read receipt worker started")
+// runReceiptWorker feeds one receipt queue, read or delivered, into the
+// presence service's batches
+func runReceiptWorker(ctx context.Context, workerID int, kind string,
+	consume func(consumerTag string) (<-chan amqp.Delivery, error),
+	process func(ctx context.Context, payload []byte) error) {
+	logger := log.With().Int("worker_id", workerID).Str("receipt", kind).Logger()
+	logger.Info().Msg("receipt worker started")
 
-	consumerTag := fmt.Sprintf("receipt-worker-%d", workerID)
+	consumerTag := fmt.Sprintf("%s-receipt-worker-%d", kind, workerID)
 
-	msgs, err := rmqClient.ConsumeReadReceiptQueue(consumerTag)
+	msgs, err := consume(consumerTag)
 	if err != nil {
-		logger.Error().Err(err).Msg("failed to start consuming read receipts")
+		logger.Error().Err(err).Msg("failed to start consuming receipts")
 		return
 	}
 
@@ -139,8 +149,8 @@ func runReadReceiptWorker(ctx context.Context, workerID int, svc *presence.Servi
 				return
 			}
 			
-			if err := svc.ProcessReadReceipt(ctx, delivery.Body); err != nil {
-				logger.Error().Err(err).Msg("failed to process read receipt")
+			if err := process(ctx, delivery.Body); err != nil {
+				logger.Error().Err(err).Msg("failed to process receipt")
 				delivery.Nack(false, false) // Retry? Or drop? For now retry
 			} else {
 				delivery.Ack(false)
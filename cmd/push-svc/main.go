@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
@@ -23,7 +24,7 @@ func main() {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	// Load configuration
-	cfg := config.MustLoad()
+	cfg := config.MustLoad(config.Services, config.Workers)
 
 	// Initialize Tracer
 	shutdown, err := telemetry.InitTracer("push-svc", cfg.OtelCollectorURL)
@@ -73,10 +74,38 @@ func main() {
 
 	// Initialize Repositories
 	chatRepo := postgres.NewChatRepository(db)
+	blockRepo := postgres.NewBlockRepository(db)
 	cacheRepo := redis.NewCacheRepository(redisClient)
 
+	// Initialize push providers
+	var fcm push.Sender
+	if cfg.FCMCredentialsPath != "" {
+		fcm, err = push.NewFCMClient(cfg.FCMCredentialsPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize FCM client")
+		}
+	} else {
+		log.Warn().Msg("FCM_CREDENTIALS_PATH not set, Android and web pushes will only be logged")
+	}
+
+	var apns push.Sender
+	if cfg.APNSKeyPath != "" {
+		apns, err = push.NewAPNSClient(push.APNSConfig{
+			KeyPath: cfg.APNSKeyPath,
+			KeyID:   cfg.APNSKeyID,
+			TeamID:  cfg.APNSTeamID,
+			Topic:   cfg.APNSTopic,
+			Sandbox: cfg.APNSSandbox,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize APNS client")
+		}
+	} else {
+		log.Warn().Msg("APNS_KEY_PATH not set, iOS pushes will only be logged")
+	}
+
 	// Initialize Service
-	svc := push.NewService(chatRepo, cacheRepo)
+	svc := push.NewService(chatRepo, blockRepo, cacheRepo, fcm, apns)
 
 	// Start consumer
 	msgs, err := rmqClient.ConsumeSharedChatQueue("push-svc")
@@ -86,16 +115,33 @@ func main() {
 
 	log.Info().Msg("push-svc started")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Process messages
 	go func() {
+		failures := 0 // consecutive timeouts, drives the retry backoff
 		for d := range msgs {
-			ctx := context.Background()
-			if err := svc.ProcessPushNotification(ctx, d.Body); err != nil {
+			// Bound each message so a stuck dependency can't freeze the consumer
+			procCtx, cancelProc := context.WithTimeout(ctx, cfg.WorkerProcessTimeout)
+			err := svc.ProcessPushNotification(procCtx, d.Body)
+			timedOut := errors.Is(procCtx.Err(), context.DeadlineExceeded)
+			cancelProc()
+
+			if err != nil && timedOut {
+				// A slow dependency is transient, so retry later
+				failures++
+				delay := rabbitmq.RetryBackoff(failures, cfg.WorkerRetryBackoff, cfg.WorkerRetryBackoffMax)
+				log.Error().Err(err).Dur("retry_in", delay).Msg("push notification timed out")
+				rabbitmq.NackAfter(ctx, d, delay)
+				continue
+			}
+			failures = 0
+
+			if err != nil {
 				log.Error().Err(err).Msg("failed to process push notification")
-				d.Ack(false) // Ack anyway to prevent loop for now, or Nack if retryable
-			} else {
-				d.Ack(false)
 			}
+			d.Ack(false) // Ack other failures to prevent a redelivery loop
 		}
 	}()
 
@@ -105,6 +151,7 @@ func main() {
 	<-quit
 
 	log.Info().Msg("shutting down push-svc...")
+	cancel()
 	
 	// Give workers time to finish
 	time.Sleep(2 * time.Second)
@@ -0,0 +1,2 @@
+ALTER TABLE chat_members DROP CONSTRAINT IF EXISTS chat_members_notification_level_check;
+ALTER TABLE chat_members DROP COLUMN IF EXISTS notification_level;
@@ -0,0 +1,6 @@
+-- Per-member notification preference: all, mentions_only or none
+ALTER TABLE chat_members
+ADD COLUMN IF NOT EXISTS notification_level VARCHAR(20) NOT NULL DEFAULT 'all';
+
+ALTER TABLE chat_members ADD CONSTRAINT chat_members_notification_level_check
+    CHECK (notification_level IN ('all', 'mentions_only', 'none'));
@@ -0,0 +1,2 @@
+-- Soft account deletion: deactivated users keep their rows so message history stays intact
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS show_last_seen;
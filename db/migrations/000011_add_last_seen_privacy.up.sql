@@ -0,0 +1,2 @@
+-- Privacy: users may hide their last-seen timestamp from others
+ALTER TABLE users ADD COLUMN IF NOT EXISTS show_last_seen BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1 @@
+ALTER TABLE chat_members DROP COLUMN IF EXISTS archived_at;
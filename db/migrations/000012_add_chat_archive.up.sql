@@ -0,0 +1,3 @@
+-- Per-member archive flag; NULL means the chat is shown in the main list
+ALTER TABLE chat_members
+ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE;
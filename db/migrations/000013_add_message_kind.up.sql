@@ -0,0 +1,7 @@
+-- System messages record group events (joins, leaves, renames, role changes) inline in history
+ALTER TABLE messages
+ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'user',
+ADD COLUMN IF NOT EXISTS meta JSONB;
+
+ALTER TABLE messages ADD CONSTRAINT messages_kind_check
+    CHECK (kind IN ('user', 'system'));
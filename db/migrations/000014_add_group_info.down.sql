@@ -0,0 +1,4 @@
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_post_policy_check;
+ALTER TABLE chats DROP COLUMN IF EXISTS post_policy;
+ALTER TABLE chats DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE chats DROP COLUMN IF EXISTS description;
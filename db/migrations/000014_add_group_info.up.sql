@@ -0,0 +1,8 @@
+-- Group metadata beyond the title, and who may post (all members or admins only)
+ALTER TABLE chats
+ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS post_policy VARCHAR(10) NOT NULL DEFAULT 'all';
+
+ALTER TABLE chats ADD CONSTRAINT chats_post_policy_check
+    CHECK (post_policy IN ('all', 'admins'));
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_messages_chat_id ON messages(chat_id);
+DROP INDEX IF EXISTS idx_messages_chat_id_id;
@@ -0,0 +1,7 @@
+-- Migration 015: indexes for keyset pagination
+-- Message history pages with WHERE chat_id = ? AND id < ? ORDER BY id DESC,
+-- which this index serves as a bounded range scan at any depth.
+CREATE INDEX IF NOT EXISTS idx_messages_chat_id_id ON messages(chat_id, id DESC);
+
+-- The composite index covers every lookup the single-column one served
+DROP INDEX IF EXISTS idx_messages_chat_id;
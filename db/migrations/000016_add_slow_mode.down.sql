@@ -0,0 +1,2 @@
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_slow_mode_seconds_check;
+ALTER TABLE chats DROP COLUMN IF EXISTS slow_mode_seconds;
@@ -0,0 +1,5 @@
+-- Minimum seconds between consecutive messages from a non-admin member, 0 disables
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS slow_mode_seconds INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE chats ADD CONSTRAINT chats_slow_mode_seconds_check
+    CHECK (slow_mode_seconds BETWEEN 0 AND 3600);
@@ -0,0 +1,10 @@
+-- Messages pinned to the top of a chat; the newest pin is shown as the chat banner
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    chat_id BIGINT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    msg_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    pinned_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    pinned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, msg_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_chat_pinned_at ON pinned_messages(chat_id, pinned_at DESC);
@@ -0,0 +1,2 @@
+-- Operators allowed to use admin endpoints such as announcements and diagnostics
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
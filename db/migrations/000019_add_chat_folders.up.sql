@@ -0,0 +1,16 @@
+-- Per-user folders grouping chats in the inbox; never shared between users
+CREATE TABLE IF NOT EXISTS folders (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS chat_folders (
+    folder_id BIGINT NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    chat_id BIGINT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    PRIMARY KEY (folder_id, chat_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_folders_chat_id ON chat_folders(chat_id);
@@ -0,0 +1,2 @@
+-- Quoted text of the parent captured at send time, so replies still render after the parent is gone
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_snippet VARCHAR(200) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_allow_mentions;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_end;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_start;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,5 @@
+-- Daily do-not-disturb window for pushes, as HH:MM in the user's timezone; empty disables
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dnd_start VARCHAR(5) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dnd_end VARCHAR(5) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS dnd_allow_mentions BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_created_at;
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_retention_days_check;
+ALTER TABLE chats DROP COLUMN IF EXISTS retention_days;
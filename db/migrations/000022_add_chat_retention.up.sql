@@ -0,0 +1,8 @@
+-- Days to keep a chat's messages before the retention job purges them, 0 uses the global default
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS retention_days INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE chats ADD CONSTRAINT chats_retention_days_check
+    CHECK (retention_days BETWEEN 0 AND 3650);
+
+-- Lets the purge scan expired messages without walking each chat's full history
+CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
@@ -0,0 +1,2 @@
+-- Set when the author edits a message's body
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE;
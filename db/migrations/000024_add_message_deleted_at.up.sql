@@ -0,0 +1,2 @@
+-- Soft delete: retracted messages stay for moderation but are hidden from members
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
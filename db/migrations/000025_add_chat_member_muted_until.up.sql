@@ -0,0 +1,2 @@
+-- Per-chat mute: no pushes for the member until this time
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP WITH TIME ZONE;
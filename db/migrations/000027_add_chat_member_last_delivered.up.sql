@@ -0,0 +1,3 @@
+-- Highest message ID a member's devices have received, the delivered
+-- counterpart of last_read_msg_id
+ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS last_delivered_msg_id BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Backs the per-message reply counts in history pages and thread lookups
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to_id ON messages(reply_to_id) WHERE reply_to_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_msg_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS forwarded_from_chat_id;
@@ -0,0 +1,4 @@
+-- Where a forwarded message was copied from. No foreign key: the original may be
+-- deleted or purged while its forwards live on.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_chat_id BIGINT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS forwarded_from_msg_id BIGINT;
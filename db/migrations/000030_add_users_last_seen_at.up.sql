@@ -0,0 +1,2 @@
+-- When the user last went offline, kept so last seen survives the Redis presence key
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+-- Tokens carry the version current when they were issued; bumping it signs the
+-- user out everywhere
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
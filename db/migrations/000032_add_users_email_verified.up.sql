@@ -0,0 +1,4 @@
+-- New accounts must verify their email before creating chats. Existing accounts
+-- predate verification, so they are treated as verified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET email_verified = TRUE;
@@ -0,0 +1,3 @@
+-- Client-reported attachment details ({mime, size, width, height, name}) so
+-- media can be rendered without fetching it first
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS media_meta JSONB;
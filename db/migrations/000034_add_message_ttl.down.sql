@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_messages_expires_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chats_message_ttl_seconds_check;
+ALTER TABLE chats DROP COLUMN IF EXISTS message_ttl_seconds;
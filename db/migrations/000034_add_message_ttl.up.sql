@@ -0,0 +1,11 @@
+-- Disappearing messages: a chat's TTL stamps each new message with the time the
+-- expiry sweeper deletes it
+ALTER TABLE chats ADD COLUMN IF NOT EXISTS message_ttl_seconds INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE chats ADD CONSTRAINT chats_message_ttl_seconds_check
+    CHECK (message_ttl_seconds BETWEEN 0 AND 604800);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+
+-- The sweeper only ever looks at messages that expire
+CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Messages held back until send_at, when chat-svc's dispatcher sends them like
+-- any other message
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    media_url TEXT NOT NULL DEFAULT '',
+    media_meta JSONB,
+    reply_to_id BIGINT,
+    reply_snippet VARCHAR(200) NOT NULL DEFAULT '',
+    send_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_send_at ON scheduled_messages(send_at);
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_chat_user ON scheduled_messages(chat_id, user_id, send_at);
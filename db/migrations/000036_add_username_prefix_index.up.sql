@@ -0,0 +1,2 @@
+-- User search matches a case-insensitive username prefix
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops);
@@ -0,0 +1,16 @@
+-- The object key a message's media_url resolves to. It is only set for the
+-- sender's own upload to the chat, or copied from the source of a forward, so
+-- media references are counted and authorized by key rather than by URL.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS media_key TEXT NOT NULL DEFAULT '';
+
+UPDATE messages m SET media_key = k.key
+FROM (
+    SELECT id, substring(media_url FROM '(?:^|/)(uploads/[0-9]+/[0-9]+/[^/?#]+)$') AS key
+    FROM messages
+    WHERE media_url LIKE '%uploads/%'
+) k
+WHERE k.id = m.id
+  AND (k.key LIKE 'uploads/' || m.chat_id || '/' || m.user_id || '/%'
+       OR k.key LIKE 'uploads/' || m.forwarded_from_chat_id || '/%');
+
+CREATE INDEX IF NOT EXISTS idx_messages_media_key ON messages(media_key) WHERE media_key <> '';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_chat_members_archived;
@@ -0,0 +1,2 @@
+-- Every new message checks whether anyone archived its chat; few members ever do
+CREATE INDEX IF NOT EXISTS idx_chat_members_archived ON chat_members (chat_id) WHERE archived_at IS NOT NULL;
@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,21 +17,38 @@ const (
 	AccessTokenLifetime = 15 * time.Minute
 	// RefreshTokenLifetime is 7 days
 	RefreshTokenLifetime = 7 * 24 * time.Hour
+	// VerificationTokenLifetime is 24 hours
+	VerificationTokenLifetime = 24 * time.Hour
 	// BcryptCost is the bcrypt cost factor (≈250ms on 2GHz core)
 	BcryptCost = 12
 	// Issuer is the JWT issuer
 	Issuer = "minitelegram"
+	// PurposeVerifyEmail marks email verification tokens
+	PurposeVerifyEmail = "verify_email"
 )
 
 // Claims represents JWT claims
 type Claims struct {
 	jwt.RegisteredClaims
+	IsAdmin      bool   `json:"is_admin,omitempty"` // operator role, access tokens only
+	TokenVersion int64  `json:"ver,omitempty"`      // user's token version when issued
+	Email        string `json:"email,omitempty"`    // address being verified, verification tokens only
+	Purpose      string `json:"purpose,omitempty"`  // set on single-purpose tokens, which can't authenticate
 }
 
+// TokenVersions looks up users' current token versions
+type TokenVersions interface {
+	TokenVersion(ctx context.Context, userID int64) (int64, error)
+}
+
+// ErrTokenRevoked is returned by Authenticate for tokens issued under an older token version
+var ErrTokenRevoked = errors.New("token has been revoked")
+
 // Service handles authentication
 type Service struct {
 	privateKey *ecdsa.PrivateKey
 	publicKey  *ecdsa.PublicKey
+	versions   TokenVersions // nil skips the token version check
 }
 
 // NewService creates a new authentication service
@@ -39,6 +59,11 @@ func NewService(privateKey *ecdsa.PrivateKey) *Service {
 	}
 }
 
+// SetTokenVersions makes Authenticate reject tokens whose version is no longer current
+func (s *Service) SetTokenVersions(versions TokenVersions) {
+	s.versions = versions
+}
+
 // HashPassword hashes a password using bcrypt
 func HashPassword(password string) (string, error) {
 	if len(password) < 8 {
@@ -57,8 +82,8 @@ func VerifyPassword(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-// GenerateAccessToken generates a JWT access token
-func (s *Service) GenerateAccessToken(userID int64) (string, error) {
+// GenerateAccessToken generates a JWT access token under the user's current token version
+func (s *Service) GenerateAccessToken(userID int64, isAdmin bool, tokenVersion int64) (string, error) {
 	now := time.Now()
 	claims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
@@ -67,6 +92,8 @@ func (s *Service) GenerateAccessToken(userID int64) (string, error) {
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenLifetime)),
 		},
+		IsAdmin:      isAdmin,
+		TokenVersion: tokenVersion,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
@@ -78,16 +105,19 @@ func (s *Service) GenerateAccessToken(userID int64) (string, error) {
 	return tokenString, nil
 }
 
-// GenerateRefreshToken generates a JWT refresh token
-func (s *Service) GenerateRefreshToken(userID int64) (string, error) {
+// GenerateRefreshToken generates a JWT refresh token with a unique ID (jti), so
+// it can be revoked on its own, and the user's current token version
+func (s *Service) GenerateRefreshToken(userID, tokenVersion int64) (string, error) {
 	now := time.Now()
 	claims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			Subject:   fmt.Sprintf("%d", userID),
 			Issuer:    Issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(RefreshTokenLifetime)),
 		},
+		TokenVersion: tokenVersion,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
@@ -99,6 +129,46 @@ func (s *Service) GenerateRefreshToken(userID int64) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateVerificationToken generates a short-lived JWT proving control of email
+func (s *Service) GenerateVerificationToken(userID int64, email string) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprintf("%d", userID),
+			Issuer:    Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(VerificationTokenLifetime)),
+		},
+		Email:   email,
+		Purpose: PurposeVerifyEmail,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	tokenString, err := token.SignedString(s.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verification token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// ValidateVerificationToken validates an email verification token and returns
+// the user ID and email address it was issued for
+func (s *Service) ValidateVerificationToken(tokenString string) (int64, string, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+	if claims.Purpose != PurposeVerifyEmail {
+		return 0, "", fmt.Errorf("not a verification token")
+	}
+	userID, err := ExtractUserID(claims)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, claims.Email, nil
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
@@ -125,6 +195,33 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// Authenticate validates an access token and returns its claims and user ID,
+// rejecting tokens issued before the user's token version was last bumped
+func (s *Service) Authenticate(ctx context.Context, tokenString string) (*Claims, int64, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, 0, err
+	}
+	if claims.Purpose != "" {
+		return nil, 0, fmt.Errorf("token cannot be used for authentication")
+	}
+	userID, err := ExtractUserID(claims)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if s.versions != nil {
+		version, err := s.versions.TokenVersion(ctx, userID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to check token version: %w", err)
+		}
+		if claims.TokenVersion != version {
+			return nil, 0, ErrTokenRevoked
+		}
+	}
+	return claims, userID, nil
+}
+
 // ExtractUserID extracts user ID from claims
 func ExtractUserID(claims *Claims) (int64, error) {
 	var userID int64
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -61,7 +62,7 @@ func TestGenerateAndValidateToken(t *testing.T) {
 
 	// Generate access token
 	userID := int64(12345)
-	token, err := service.GenerateAccessToken(userID)
+	token, err := service.GenerateAccessToken(userID, false, 0)
 	require.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -116,7 +117,7 @@ func TestGenerateRefreshToken(t *testing.T) {
 	service := NewService(privateKey)
 
 	userID := int64(67890)
-	refreshToken, err := service.GenerateRefreshToken(userID)
+	refreshToken, err := service.GenerateRefreshToken(userID, 3)
 	require.NoError(t, err)
 	assert.NotEmpty(t, refreshToken)
 
@@ -127,4 +128,58 @@ func TestGenerateRefreshToken(t *testing.T) {
 	extractedUserID, err := ExtractUserID(claims)
 	require.NoError(t, err)
 	assert.Equal(t, userID, extractedUserID)
+	assert.Equal(t, int64(3), claims.TokenVersion)
+
+	// Every refresh token gets its own ID so it can be revoked alone
+	other, err := service.GenerateRefreshToken(userID, 3)
+	require.NoError(t, err)
+	otherClaims, err := service.ValidateToken(other)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.ID)
+	assert.NotEqual(t, claims.ID, otherClaims.ID)
+}
+
+func TestGenerateAccessToken_AdminClaim(t *testing.T) {
+	privateKey, err := GeneratePrivateKey()
+	require.NoError(t, err)
+	service := NewService(privateKey)
+
+	for _, isAdmin := range []bool{true, false} {
+		token, err := service.GenerateAccessToken(1, isAdmin, 0)
+		require.NoError(t, err)
+
+		claims, err := service.ValidateToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, isAdmin, claims.IsAdmin)
+	}
+}
+
+// fixedVersions reports the same token version for every user
+type fixedVersions int64
+
+func (v fixedVersions) TokenVersion(ctx context.Context, userID int64) (int64, error) {
+	return int64(v), nil
+}
+
+func TestAuthenticate_TokenVersion(t *testing.T) {
+	privateKey, err := GeneratePrivateKey()
+	require.NoError(t, err)
+	service := NewService(privateKey)
+	ctx := context.Background()
+
+	token, err := service.GenerateAccessToken(42, false, 1)
+	require.NoError(t, err)
+
+	// Without a version source only the signature is checked
+	_, userID, err := service.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), userID)
+
+	service.SetTokenVersions(fixedVersions(1))
+	_, _, err = service.Authenticate(ctx, token)
+	assert.NoError(t, err)
+
+	service.SetTokenVersions(fixedVersions(2))
+	_, _, err = service.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -19,26 +20,25 @@ func (s *Service) JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := s.ValidateToken(tokenString)
-		if err != nil {
+		claims, userID, err := s.Authenticate(c.Request.Context(), tokenString)
+		if errors.Is(err, ErrTokenRevoked) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"code":    "INVALID_TOKEN",
-				"message": "invalid or expired token",
+				"code":    "TOKEN_REVOKED",
+				"message": "token has been revoked",
 			})
 			return
 		}
-
-		userID, err := ExtractUserID(claims)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"code":    "INVALID_TOKEN",
-				"message": "invalid user ID in token",
+				"message": "invalid or expired token",
 			})
 			return
 		}
 
-		// Store user ID in context
+		// Store user ID and role in context
 		c.Set("uid", userID)
+		c.Set("is_admin", claims.IsAdmin)
 		c.Next()
 	}
 }
@@ -70,3 +70,23 @@ func GetUserID(c *gin.Context) (int64, bool) {
 	userID, ok := uid.(int64)
 	return userID, ok
 }
+
+// IsAdmin reports whether the authenticated user's token carries the admin role
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool("is_admin")
+}
+
+// RequireAdmin only lets users whose token carries the admin role through.
+// It must run after JWTMiddleware.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code":    "FORBIDDEN",
+				"message": "admin access required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxPasswordLength is the longest password bcrypt can hash in full
+const MaxPasswordLength = 72
+
+// Password policy violations
+var (
+	ErrPasswordTooShort    = errors.New("password is too short")
+	ErrPasswordTooLong     = fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+	ErrPasswordNoMixedCase = errors.New("password must contain both upper and lower case letters")
+	ErrPasswordNoDigit     = errors.New("password must contain a digit")
+	ErrPasswordNoSymbol    = errors.New("password must contain a symbol")
+	ErrPasswordTooCommon   = errors.New("password is too common")
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+func parseCommonPasswords(list string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength        int
+	RequireMixedCase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	RejectCommon     bool
+}
+
+// DefaultPasswordPolicy only enforces the historical 8 character minimum
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8}
+}
+
+// Validate returns the first rule the password violates, or nil.
+// A MinLength below 8 is raised to 8, since HashPassword rejects anything shorter.
+func (p PasswordPolicy) Validate(password string) error {
+	minLength := max(p.MinLength, 8)
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, minLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireMixedCase && !(hasUpper && hasLower) {
+		return ErrPasswordNoMixedCase
+	}
+	if p.RequireDigit && !hasDigit {
+		return ErrPasswordNoDigit
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return ErrPasswordNoSymbol
+	}
+	if p.RejectCommon {
+		if _, ok := commonPasswords[strings.ToLower(password)]; ok {
+			return ErrPasswordTooCommon
+		}
+	}
+	return nil
+}
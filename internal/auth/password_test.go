@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:        12,
+		RequireMixedCase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		RejectCommon:     true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantErr  error
+	}{
+		{
+			name:     "default accepts 8 characters",
+			policy:   DefaultPasswordPolicy(),
+			password: "password",
+		},
+		{
+			name:     "default rejects 7 characters",
+			policy:   DefaultPasswordPolicy(),
+			password: "passwor",
+			wantErr:  ErrPasswordTooShort,
+		},
+		{
+			name:     "min length below 8 is raised",
+			policy:   PasswordPolicy{MinLength: 4},
+			password: "abcdefg",
+			wantErr:  ErrPasswordTooShort,
+		},
+		{
+			name:     "min length counts characters not bytes",
+			policy:   PasswordPolicy{MinLength: 8},
+			password: "пароль12",
+		},
+		{
+			name:     "custom min length",
+			policy:   PasswordPolicy{MinLength: 12},
+			password: "elevenchars",
+			wantErr:  ErrPasswordTooShort,
+		},
+		{
+			name:     "longer than bcrypt limit",
+			policy:   DefaultPasswordPolicy(),
+			password: strings.Repeat("a", MaxPasswordLength+1),
+			wantErr:  ErrPasswordTooLong,
+		},
+		{
+			name:     "mixed case required",
+			policy:   PasswordPolicy{RequireMixedCase: true},
+			password: "alllowercase",
+			wantErr:  ErrPasswordNoMixedCase,
+		},
+		{
+			name:     "mixed case satisfied",
+			policy:   PasswordPolicy{RequireMixedCase: true},
+			password: "MixedCase",
+		},
+		{
+			name:     "digit required",
+			policy:   PasswordPolicy{RequireDigit: true},
+			password: "NoDigitsHere",
+			wantErr:  ErrPasswordNoDigit,
+		},
+		{
+			name:     "digit satisfied",
+			policy:   PasswordPolicy{RequireDigit: true},
+			password: "OneDigit1",
+		},
+		{
+			name:     "symbol required",
+			policy:   PasswordPolicy{RequireSymbol: true},
+			password: "NoSymbols123",
+			wantErr:  ErrPasswordNoSymbol,
+		},
+		{
+			name:     "symbol satisfied",
+			policy:   PasswordPolicy{RequireSymbol: true},
+			password: "Symbol$123",
+		},
+		{
+			name:     "common password rejected",
+			policy:   PasswordPolicy{RejectCommon: true},
+			password: "password123",
+			wantErr:  ErrPasswordTooCommon,
+		},
+		{
+			name:     "common password match ignores case",
+			policy:   PasswordPolicy{RejectCommon: true},
+			password: "PassWord123",
+			wantErr:  ErrPasswordTooCommon,
+		},
+		{
+			name:     "common password allowed when not rejecting",
+			policy:   DefaultPasswordPolicy(),
+			password: "password123",
+		},
+		{
+			name:     "strict policy accepts strong password",
+			policy:   strict,
+			password: "Correct-Horse-9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordsLoaded(t *testing.T) {
+	assert.NotEmpty(t, commonPasswords)
+	_, ok := commonPasswords["qwerty123"]
+	assert.True(t, ok)
+	for pw := range commonPasswords {
+		assert.False(t, strings.HasPrefix(pw, "#"), "comment parsed as password: %q", pw)
+	}
+}
@@ -7,66 +7,174 @@ import (
 	"github.com/kelseyhightower/envconfig"
 )
 
-// Config holds application configuration
+// Config holds application configuration. It is split into sections so each
+// binary only has to provide the environment variables it uses; fields of
+// sections that weren't loaded are left zero.
 type Config struct {
-	// Server
-	GinMode string `envconfig:"GIN_MODE" default:"release"`
-	Port    int    `envconfig:"PORT" default:"8080"`
+	DatabaseConfig
+	ServiceConfig
+	GatewayConfig
+	WorkerConfig
+}
 
-	// Database
+// DatabaseConfig is loaded by every binary
+type DatabaseConfig struct {
 	DSN             string        `envconfig:"DSN" required:"true"`
 	MaxOpenConns    int           `envconfig:"DB_MAX_OPEN_CONNS" default:"25"`
 	MaxIdleConns    int           `envconfig:"DB_MAX_IDLE_CONNS" default:"5"`
 	ConnMaxLifetime time.Duration `envconfig:"DB_CONN_MAX_LIFETIME" default:"5m"`
+	PostgresTimeout time.Duration `envconfig:"POSTGRES_TIMEOUT" default:"5s"`
+}
 
+// ServiceConfig is shared by the gateway and the background services
+type ServiceConfig struct {
 	// Redis
-	RedisAddr     string `envconfig:"REDIS_ADDR" required:"true"`
-	RedisPassword string `envconfig:"REDIS_PASSWORD" default:""`
-	RedisDB       int    `envconfig:"REDIS_DB" default:"0"`
+	RedisAddr     string        `envconfig:"REDIS_ADDR" required:"true"`
+	RedisPassword string        `envconfig:"REDIS_PASSWORD" default:""`
+	RedisDB       int           `envconfig:"REDIS_DB" default:"0"`
+	RedisTimeout  time.Duration `envconfig:"REDIS_TIMEOUT" default:"2s"`
 
 	// RabbitMQ
 	AMQPURL string `envconfig:"AMQP_URL" required:"true"`
 
+	// Observability
+	OtelCollectorURL string `envconfig:"OTEL_COLLECTOR_URL" default:"localhost:4317"`
+}
+
+// GatewayConfig covers the HTTP and WebSocket API
+type GatewayConfig struct {
+	// Server
+	GinMode         string        `envconfig:"GIN_MODE" default:"release"`
+	Port            int           `envconfig:"PORT" default:"8080"`
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"15s"` // grace period for in-flight requests and WebSocket connections on SIGTERM
+
 	// JWT
 	JWTPrivateKeyPath string `envconfig:"JWT_PRIVATE_KEY_PATH" required:"true"`
 
-	// Timeouts
-	RedisTimeout    time.Duration `envconfig:"REDIS_TIMEOUT" default:"2s"`
-	PostgresTimeout time.Duration `envconfig:"POSTGRES_TIMEOUT" default:"5s"`
+	// Accounts
+	AccountReactivationWindow time.Duration `envconfig:"ACCOUNT_REACTIVATION_WINDOW" default:"720h"` // deactivated accounts can log back in within this window
+
+	// Password policy. The defaults keep the historical 8 character minimum only.
+	PasswordMinLength        int  `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordRequireMixedCase bool `envconfig:"PASSWORD_REQUIRE_MIXED_CASE" default:"false"`
+	PasswordRequireDigit     bool `envconfig:"PASSWORD_REQUIRE_DIGIT" default:"false"`
+	PasswordRequireSymbol    bool `envconfig:"PASSWORD_REQUIRE_SYMBOL" default:"false"`
+	PasswordRejectCommon     bool `envconfig:"PASSWORD_REJECT_COMMON" default:"false"` // reject passwords on the embedded denylist
 
-	// Connection Registry
+	// Connection Registry. Open WebSocket connections refresh their presence and
+	// registry keys every PingInterval, which must stay below ConnTTL.
 	ConnTTL      time.Duration `envconfig:"CONN_TTL" default:"35s"`
 	PingInterval time.Duration `envconfig:"PING_INTERVAL" default:"30s"`
 
-	// Observability
-	OtelCollectorURL string `envconfig:"OTEL_COLLECTOR_URL" default:"localhost:4317"`
-
 	// Rate Limiting
-	LoginRateLimit int `envconfig:"LOGIN_RATE_LIMIT" default:"5"` // requests per minute per IP
-	WSRateLimit    int `envconfig:"WS_RATE_LIMIT" default:"20"`   // connections per minute per IP
-	AllowedOrigins []string `envconfig:"ALLOWED_ORIGINS" default:"http://localhost:3000,http://localhost:5173"`
+	LoginRateLimit     int `envconfig:"LOGIN_RATE_LIMIT" default:"5"`       // requests per minute per IP
+	WSRateLimit        int `envconfig:"WS_RATE_LIMIT" default:"20"`         // connections per minute per IP
+	UploadURLRateLimit int `envconfig:"UPLOAD_URL_RATE_LIMIT" default:"30"` // presigned upload URLs per minute per user, 0 disables
+	AnnounceRateLimit  int `envconfig:"ANNOUNCE_RATE_LIMIT" default:"5"`    // admin announcements per minute per admin, 0 disables
+	MsgRateLimit       int `envconfig:"MSG_RATE_LIMIT" default:"60"`        // WebSocket messages sent per minute per user, 0 disables
+
+	// WebSocket compression (permessage-deflate). Batches and history replays
+	// compress well; single small messages gain little and still cost CPU per frame.
+	WSCompression          bool     `envconfig:"WS_COMPRESSION" default:"false"`
+	WSCompressionThreshold int      `envconfig:"WS_COMPRESSION_THRESHOLD" default:"1024"` // bytes; smaller frames are sent uncompressed
+	WSMaxMessageSize       int64    `envconfig:"WS_MAX_MESSAGE_SIZE" default:"8192"`      // bytes; larger inbound messages close the connection (1008)
+	AllowedOrigins         []string `envconfig:"ALLOWED_ORIGINS" default:"http://localhost:3000,http://localhost:5173"`
+	// Whether a message sent over the WebSocket is also delivered back to the
+	// device that sent it. Clients that render sent messages optimistically
+	// would show it twice; the author's other devices get it either way.
+	WSEchoToOrigin bool `envconfig:"WS_ECHO_TO_ORIGIN" default:"false"`
 
 	// Object Storage (S3/MinIO)
-	ObjectStoreEndpoint       string `envconfig:"OBJECT_STORE_ENDPOINT" default:"http://minio:9000"`
-	ObjectStorePublicEndpoint string `envconfig:"OBJECT_STORE_PUBLIC_ENDPOINT" default:"http://localhost:9000"`
-	ObjectStoreRegion         string `envconfig:"OBJECT_STORE_REGION" default:"us-east-1"`
-	ObjectStoreBucket         string `envconfig:"OBJECT_STORE_BUCKET" default:"chat-media"`
-	ObjectStoreAccessKey      string `envconfig:"OBJECT_STORE_ACCESS_KEY" default:"minioadmin"`
-	ObjectStoreSecretKey      string `envconfig:"OBJECT_STORE_SECRET_KEY" default:"minioadmin"`
+	ObjectStoreEndpoint       string        `envconfig:"OBJECT_STORE_ENDPOINT" default:"http://minio:9000"`
+	ObjectStorePublicEndpoint string        `envconfig:"OBJECT_STORE_PUBLIC_ENDPOINT" default:"http://localhost:9000"`
+	ObjectStoreRegion         string        `envconfig:"OBJECT_STORE_REGION" default:"us-east-1"`
+	ObjectStoreBucket         string        `envconfig:"OBJECT_STORE_BUCKET" default:"chat-media"`
+	ObjectStoreAccessKey      string        `envconfig:"OBJECT_STORE_ACCESS_KEY" default:"minioadmin"`
+	ObjectStoreSecretKey      string        `envconfig:"OBJECT_STORE_SECRET_KEY" default:"minioadmin"`
+	UploadURLExpiry           time.Duration `envconfig:"UPLOAD_URL_EXPIRY" default:"15m"`          // lifetime of presigned upload URLs
+	DownloadURLExpiry         time.Duration `envconfig:"DOWNLOAD_URL_EXPIRY" default:"1h"`         // lifetime of presigned download URLs
+	MaxUploadSize             int64         `envconfig:"MAX_UPLOAD_SIZE" default:"2147483648"`     // bytes; total size limit of multipart uploads
+	MaxFileSize               int64         `envconfig:"MAX_FILE_SIZE" default:"104857600"`        // bytes; size limit of single-request uploads
+	// Content types that may be uploaded; "type/*" allows every subtype. SVG is
+	// left out by default because it can carry scripts.
+	UploadContentTypes []string `envconfig:"UPLOAD_CONTENT_TYPES" default:"image/jpeg,image/png,image/gif,image/webp,image/heic,video/mp4,video/webm,video/quicktime,audio/mpeg,audio/ogg,audio/mp4,application/pdf"`
+	MediaCleanupGracePeriod   time.Duration `envconfig:"MEDIA_CLEANUP_GRACE_PERIOD" default:"24h"` // delay before deleting media of deleted messages
+	MediaCleanupInterval      time.Duration `envconfig:"MEDIA_CLEANUP_INTERVAL" default:"5m"`
+
+	// Messages
+	MessageEditWindow time.Duration `envconfig:"MESSAGE_EDIT_WINDOW" default:"48h"` // how long authors may edit a sent message
+}
+
+// WorkerConfig covers the background services consuming from RabbitMQ
+type WorkerConfig struct {
+	// A message whose processing exceeds the timeout is requeued after an
+	// exponential backoff between the two bounds.
+	WorkerProcessTimeout  time.Duration `envconfig:"WORKER_PROCESS_TIMEOUT" default:"10s"`
+	WorkerRetryBackoff    time.Duration `envconfig:"WORKER_RETRY_BACKOFF" default:"500ms"`
+	WorkerRetryBackoffMax time.Duration `envconfig:"WORKER_RETRY_BACKOFF_MAX" default:"30s"`
+	WorkerMaxRetries      int           `envconfig:"WORKER_MAX_RETRIES" default:"5"` // chat messages failing more often go to the dead letter queue
+
+	// Message retention, enforced by chat-svc. Chats can override the default days.
+	MessageRetentionDays int           `envconfig:"MESSAGE_RETENTION_DAYS" default:"0"` // 0 keeps messages forever unless a chat sets its own retention
+	RetentionInterval    time.Duration `envconfig:"RETENTION_INTERVAL" default:"1h"`
+	// How often chat-svc deletes disappearing messages whose TTL has passed. They
+	// are hidden from history as soon as they expire.
+	MessageExpiryInterval time.Duration `envconfig:"MESSAGE_EXPIRY_INTERVAL" default:"10s"`
+	// How often chat-svc sends scheduled messages that have become due
+	ScheduledDispatchInterval time.Duration `envconfig:"SCHEDULED_DISPATCH_INTERVAL" default:"5s"`
+
+	// Push notifications. A provider without credentials only logs what it would send.
+	FCMCredentialsPath string `envconfig:"FCM_CREDENTIALS_PATH"` // Firebase service account JSON
+	APNSKeyPath        string `envconfig:"APNS_KEY_PATH"`        // .p8 token signing key
+	APNSKeyID          string `envconfig:"APNS_KEY_ID"`
+	APNSTeamID         string `envconfig:"APNS_TEAM_ID"`
+	APNSTopic          string `envconfig:"APNS_TOPIC"`                   // iOS app bundle ID
+	APNSSandbox        bool   `envconfig:"APNS_SANDBOX" default:"false"` // send to the development environment
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
+// Section names a part of Config beyond the database settings every binary loads
+type Section int
+
+const (
+	// Services loads ServiceConfig
+	Services Section = iota
+	// Gateway loads GatewayConfig
+	Gateway
+	// Workers loads WorkerConfig
+	Workers
+)
+
+// Load loads the database settings and the given sections from environment variables
+func Load(sections ...Section) (*Config, error) {
 	var cfg Config
-	if err := envconfig.Process("", &cfg); err != nil {
+	if err := envconfig.Process("", &cfg.DatabaseConfig); err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	for _, section := range sections {
+		var spec any
+		switch section {
+		case Services:
+			spec = &cfg.ServiceConfig
+		case Gateway:
+			spec = &cfg.GatewayConfig
+		case Workers:
+			spec = &cfg.WorkerConfig
+		default:
+			return nil, fmt.Errorf("unknown config section %d", section)
+		}
+		if err := envconfig.Process("", spec); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		if section == Gateway && (cfg.PingInterval <= 0 || cfg.PingInterval >= cfg.ConnTTL) {
+			return nil, fmt.Errorf("PING_INTERVAL (%s) must be positive and below CONN_TTL (%s)", cfg.PingInterval, cfg.ConnTTL)
+		}
+	}
 	return &cfg, nil
 }
 
 // MustLoad loads configuration and panics on error
-func MustLoad() *Config {
-	cfg, err := Load()
+func MustLoad(sections ...Section) *Config {
+	cfg, err := Load(sections...)
 	if err != nil {
 		panic(err)
 	}
@@ -5,17 +5,57 @@ import (
 	"time"
 )
 
+// Presence is a user's online state as stored in the cache
+type Presence struct {
+	Online   bool  `json:"online"`
+	LastSeen int64 `json:"lastSeen"`
+}
+
+// TokenVersionCacheTTL bounds how long a token version bump can go unnoticed
+// if updating the cached copy fails
+const TokenVersionCacheTTL = 5 * time.Minute
+
 // CacheRepository defines the interface for caching and ephemeral data
 type CacheRepository interface {
 	// Presence
 	SetPresence(ctx context.Context, userID int64, online bool, ttl time.Duration) error
 	GetPresence(ctx context.Context, userID int64) (online bool, lastSeen int64, err error)
+	GetPresences(ctx context.Context, userIDs []int64) (map[int64]Presence, error)
 
 	// Group Members Caching
 	AddGroupMembers(ctx context.Context, chatID int64, userIDs []int64) error
 	GetGroupMembers(ctx context.Context, chatID int64) ([]int64, error)
 	RemoveGroupMember(ctx context.Context, chatID, userID int64) error
 
+	// Contacts (users sharing a chat) for presence fan-out
+	SetContacts(ctx context.Context, userID int64, contactIDs []int64, ttl time.Duration) error
+	GetContacts(ctx context.Context, userID int64) (contactIDs []int64, found bool, err error)
+
+	// Unread badge summaries
+	SetUnreadSummary(ctx context.Context, userID int64, summary *UnreadSummary, ttl time.Duration) error
+	GetUnreadSummary(ctx context.Context, userID int64) (summary *UnreadSummary, found bool, err error)
+	InvalidateUnreadSummaries(ctx context.Context, userIDs []int64) error
+
+	// Token revocation: a denylist of refresh token IDs, and cached copies of
+	// users' token versions
+	RevokeToken(ctx context.Context, jti string, ttl time.Duration) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// SetTokenVersion ignores versions older than the one already cached
+	SetTokenVersion(ctx context.Context, userID, version int64, ttl time.Duration) error
+	GetTokenVersion(ctx context.Context, userID int64) (version int64, found bool, err error)
+
+	// Rate Limiting
+	TakeToken(ctx context.Context, key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+	AcquireSlowMode(ctx context.Context, chatID, userID int64, interval time.Duration) (retryAfter time.Duration, err error)
+
+	// Media Cleanup Queue
+	ScheduleMediaCleanup(ctx context.Context, objectKey string, deletedAt time.Time) error
+	ClaimMediaCleanups(ctx context.Context, deletedBefore time.Time, limit int64) ([]string, error)
+
+	// Content types uploads were presigned with, to check message media metadata against
+	SetUploadContentType(ctx context.Context, objectKey, contentType string, ttl time.Duration) error
+	GetUploadContentType(ctx context.Context, objectKey string) (contentType string, found bool, err error)
+
 	// Connection Tracking (Gateway)
 	RegisterConnection(ctx context.Context, userID int64, device, gwPodIP string, ttl time.Duration) error
 	UnregisterConnection(ctx context.Context, userID int64, device string) error
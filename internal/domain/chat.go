@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -20,27 +21,155 @@ const (
 	RoleMember Role = "member"
 )
 
+// PostPolicy controls who may send messages in a group
+type PostPolicy string
+
+const (
+	PostPolicyAll    PostPolicy = "all"
+	PostPolicyAdmins PostPolicy = "admins"
+)
+
+// Valid reports whether p is a known post policy
+func (p PostPolicy) Valid() bool {
+	return p == PostPolicyAll || p == PostPolicyAdmins
+}
+
+// Group info limits
+const (
+	MaxChatTitleLength       = 128
+	MaxChatDescriptionLength = 255
+	MaxSlowModeSeconds       = 3600
+	MaxRetentionDays         = 3650
+	MaxMessageTTLSeconds     = 7 * 24 * 3600
+)
+
+// GroupInfoUpdate holds the group fields to change; nil fields are left as is
+type GroupInfoUpdate struct {
+	Title       *string
+	Description *string
+	AvatarURL   *string
+	PostPolicy  *PostPolicy
+	SlowModeSeconds *int
+	RetentionDays   *int
+}
+
+// NotificationLevel controls which messages in a chat trigger a push for a member
+type NotificationLevel string
+
+const (
+	NotificationAll          NotificationLevel = "all"
+	NotificationMentionsOnly NotificationLevel = "mentions_only"
+	NotificationNone         NotificationLevel = "none"
+)
+
+// Valid reports whether l is a known notification level
+func (l NotificationLevel) Valid() bool {
+	switch l {
+	case NotificationAll, NotificationMentionsOnly, NotificationNone:
+		return true
+	}
+	return false
+}
+
+// MutedForever is the muted_until of a chat muted without a duration
+var MutedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
 // Chat represents a chat room
 
 type Chat struct {
-	ID        int64     `json:"id"`
-	Type      int16     `json:"type"`
-	Title     string    `json:"title,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	Name        string    `json:"name,omitempty"`        // Computed field
-	Online      bool      `json:"online,omitempty"`      // Computed field for private chats
-	UnreadCount int64     `json:"unreadCount"`           // Computed field
-	LastMessage *Message  `json:"lastMessage,omitempty"` // Computed field
+	ID                int64      `json:"id"`
+	Type              int16      `json:"type"`
+	Title             string     `json:"title,omitempty"`
+	Description       string     `json:"description,omitempty"`
+	AvatarURL         string     `json:"avatar_url,omitempty"`
+	PostPolicy        PostPolicy `json:"post_policy,omitempty"`
+	SlowModeSeconds   int        `json:"slow_mode_seconds,omitempty"`   // minimum gap between a non-admin's messages, 0 disables
+	RetentionDays     int        `json:"retention_days,omitempty"`      // days messages are kept, 0 uses the global default
+	MessageTTLSeconds int        `json:"message_ttl_seconds,omitempty"` // new messages disappear this long after sending, 0 disables
+	CreatedAt         time.Time  `json:"created_at"`
+	Name              string     `json:"name,omitempty"`        // Computed field
+	Online            bool       `json:"online,omitempty"`      // Computed field for private chats
+	UnreadCount       int64      `json:"unreadCount"`           // Computed field
+	LastMessage       *Message   `json:"lastMessage,omitempty"` // Computed field
+	LastActivityAt    time.Time  `json:"lastActivityAt"`        // Computed field: newest message or creation time
+	Archived          bool       `json:"archived"`              // Computed field: archived by the requesting user
+}
+
+// ChatDetails is a single chat as seen by one member, including where to
+// resume reading
+type ChatDetails struct {
+	Chat
+	LastReadMsgID    int64  `json:"lastReadMsgId"`
+	FirstUnreadMsgID *int64 `json:"firstUnreadMsgId,omitempty"` // nil when everything is read
+	PinnedMessage    *PinnedMessage `json:"pinnedMessage,omitempty"` // most recent pin, for the chat banner
+	MutedUntil       *time.Time     `json:"mutedUntil,omitempty"`    // set while the caller has the chat muted
+	MemberCount      int64          `json:"memberCount"`
+	Role             Role           `json:"role"` // the caller's role in the chat
+}
+
+// ChatCursor marks a position in a user's chat list ordered by last activity
+type ChatCursor struct {
+	LastActivityAt time.Time
+	ChatID         int64
+}
+
+// ChatListOptions filters and paginates a user's chat list
+type ChatListOptions struct {
+	Limit    int
+	Cursor   *ChatCursor // nil starts from the most recently active chat
+	Type     int16       // 0 matches every chat type
+	FolderID int64       // 0 matches chats in any or no folder
+	// IncludeArchived also returns chats the user has archived
+	IncludeArchived bool
 }
 
 // ChatMember represents a user in a chat
 type ChatMember struct {
-	ChatID        int64     `json:"chat_id"`
-	UserID        int64     `json:"user_id"`
-	Role          Role      `json:"role"`
-	LastReadMsgID int64     `json:"last_read_msg_id"`
-	JoinedAt      time.Time `json:"joined_at"`
-	User          *User     `json:"user,omitempty"`
+	ChatID             int64             `json:"chat_id"`
+	UserID             int64             `json:"user_id"`
+	Role               Role              `json:"role"`
+	LastReadMsgID      int64             `json:"last_read_msg_id"`
+	LastDeliveredMsgID int64             `json:"last_delivered_msg_id"`
+	NotificationLevel  NotificationLevel `json:"notification_level"`
+	ArchivedAt         *time.Time        `json:"archived_at,omitempty"`
+	MutedUntil         *time.Time        `json:"muted_until,omitempty"`
+	JoinedAt           time.Time         `json:"joined_at"`
+	User               *User             `json:"user,omitempty"`
+}
+
+// IsMuted reports whether the member has muted the chat at now
+func (m ChatMember) IsMuted(now time.Time) bool {
+	return m.MutedUntil != nil && m.MutedUntil.After(now)
+}
+
+// MessageKind distinguishes user-authored messages from generated group events
+type MessageKind string
+
+const (
+	MessageKindUser   MessageKind = "user"
+	MessageKindSystem MessageKind = "system"
+)
+
+// System message events, stored in Message.Meta under "event"
+const (
+	SystemEventMemberJoined   = "member_joined"
+	SystemEventMemberLeft     = "member_left"
+	SystemEventMemberRemoved  = "member_removed"
+	SystemEventTitleChanged   = "title_changed"
+	SystemEventMemberPromoted = "member_promoted"
+	SystemEventMemberDemoted  = "member_demoted"
+)
+
+// MaxReplySnippetLen caps the quoted parent text stored on a reply, in characters
+const MaxReplySnippetLen = 200
+
+// ReplySnippetOf shortens a parent message body to a reply snippet
+func ReplySnippetOf(body string) string {
+	runes := []rune(body)
+	if len(runes) <= MaxReplySnippetLen {
+		return body
+	}
+	return string(runes[:MaxReplySnippetLen])
 }
 
 // Message represents a chat message
@@ -49,11 +178,63 @@ type Message struct {
 	ChatID    int64      `json:"chat_id"`
 	UserID    int64      `json:"user_id"`
 	Body      string     `json:"body"`
+	Kind      MessageKind     `json:"kind"`
+	Meta      json.RawMessage `json:"meta,omitempty"` // Structured payload for system messages
 	MediaURL  string     `json:"media_url,omitempty"`
+	MediaMeta *MediaMeta `json:"media_meta,omitempty"` // describes MediaURL, as reported by the sender
+	// MediaKey is the object key MediaURL resolves to. It is set only for the
+	// sender's own upload to the chat, or copied from a forwarded message.
+	MediaKey  string     `json:"-"`
 	ReplyToID *int64     `json:"reply_to_id,omitempty"`
+	// ReplySnippet is the quoted parent text; when the sender omits it, it is
+	// hydrated from the parent while that still exists
+	ReplySnippet string  `json:"reply_snippet,omitempty"`
+	ForwardedFrom *ForwardedFrom `json:"forwarded_from,omitempty"` // set on copies made by forwarding
 	Reactions []Reaction `json:"reactions,omitempty"`
+	// ReplyCount and LastReplyAt summarise the message's thread; they are only
+	// populated when listing history
+	ReplyCount  int64      `json:"reply_count"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
-	Status    int16      `json:"status"` // 1=Sent, 2=Read
+	EditedAt  *time.Time `json:"edited_at,omitempty"` // nil until the author edits the body
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // set on soft-deleted messages, which only admins can list
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // set in chats with a message TTL; the message disappears then
+	Status    int16      `json:"status"` // 1=Sent, 2=Delivered, 3=Read
+	// OriginDevice is the author's device that sent the message over the
+	// WebSocket. It only travels with the delivery event and is never stored.
+	OriginDevice string `json:"-"`
+}
+
+// ChatUnread is the number of unread messages a user has in one chat
+type ChatUnread struct {
+	ChatID int64 `json:"chat_id"`
+	Count  int64 `json:"count"`
+}
+
+// UnreadSummary is a user's unread total for the app badge, with the chats
+// that have unread messages
+type UnreadSummary struct {
+	Total int64        `json:"total"`
+	Chats []ChatUnread `json:"chats"`
+}
+
+// ForwardedFrom identifies the original message a forward was copied from
+type ForwardedFrom struct {
+	ChatID int64 `json:"chat_id"`
+	MsgID  int64 `json:"msg_id"`
+}
+
+// MaxMediaNameLength caps the original file name stored in MediaMeta, in characters
+const MaxMediaNameLength = 255
+
+// MediaMeta describes a message attachment so clients can lay it out before
+// downloading it. Width and Height are only set for images and videos.
+type MediaMeta struct {
+	Mime   string `json:"mime"`
+	Size   int64  `json:"size"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Name   string `json:"name,omitempty"`
 }
 
 // Receipt status
@@ -88,27 +269,142 @@ type Reaction struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// ReactionSummary maps each emoji on a message to the IDs of the users who reacted with it
+type ReactionSummary map[string][]int64
+
+// SummarizeReactions groups reactions by emoji, keeping their order within each group
+func SummarizeReactions(reactions []Reaction) ReactionSummary {
+	summary := make(ReactionSummary)
+	for _, r := range reactions {
+		summary[r.Emoji] = append(summary[r.Emoji], r.UserID)
+	}
+	return summary
+}
+
+// Folder limits
+const (
+	MaxFoldersPerUser = 20
+	MaxFolderNameLen  = 64
+)
+
+// Folder is one of a user's private groupings of chats in their inbox
+type Folder struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"userId"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ChatCount   int64     `json:"chatCount"`   // Computed field
+	UnreadCount int64     `json:"unreadCount"` // Computed: unread messages across the folder's chats
+}
+
+// MaxPinnedMessages caps how many messages a chat can have pinned at once
+const MaxPinnedMessages = 10
+
+// PinnedMessage is a message pinned to the top of a chat
+type PinnedMessage struct {
+	ChatID    int64     `json:"chatId"`
+	MessageID int64     `json:"messageId"`
+	PinnedBy  int64     `json:"pinnedBy"`
+	PinnedAt  time.Time `json:"pinnedAt"`
+	Message   *Message  `json:"message,omitempty"`
+}
+
+// Scheduling limits
+const (
+	MaxScheduledPerUserChat = 100                  // pending scheduled messages per user in one chat
+	MaxScheduleAhead        = 365 * 24 * time.Hour // how far in the future a message may be scheduled
+)
+
+// ScheduledMessage is a message held back until SendAt
+type ScheduledMessage struct {
+	ID           int64      `json:"id"`
+	ChatID       int64      `json:"chatId"`
+	UserID       int64      `json:"userId"`
+	Body         string     `json:"body"`
+	MediaURL     string     `json:"mediaUrl,omitempty"`
+	MediaMeta    *MediaMeta `json:"mediaMeta,omitempty"`
+	ReplyToID    *int64     `json:"replyToId,omitempty"`
+	ReplySnippet string     `json:"replySnippet,omitempty"`
+	SendAt       time.Time  `json:"sendAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Message returns the message to send when sm is due
+func (sm ScheduledMessage) Message() *Message {
+	return &Message{
+		ChatID:       sm.ChatID,
+		UserID:       sm.UserID,
+		Body:         sm.Body,
+		Kind:         MessageKindUser,
+		MediaURL:     sm.MediaURL,
+		MediaMeta:    sm.MediaMeta,
+		ReplyToID:    sm.ReplyToID,
+		ReplySnippet: sm.ReplySnippet,
+	}
+}
+
 // ChatRepository defines the interface for chat data access
 type ChatRepository interface {
-	CreateChat(ctx context.Context, chat *Chat, memberIDs []int64) (*Chat, error)
+	CreateChat(ctx context.Context, chat *Chat, ownerID int64, memberIDs []int64) (*Chat, error) // adds the owner and members in the same transaction
 	GetChat(ctx context.Context, chatID int64) (*Chat, error)
 	UpdateChat(ctx context.Context, chat *Chat) error
 	GetUserChats(ctx context.Context, userID int64) ([]Chat, error)
+	ListUserChats(ctx context.Context, userID int64, opts ChatListOptions) ([]Chat, error)
 	AddMember(ctx context.Context, chatID, userID int64, role Role) error
 	RemoveMember(ctx context.Context, chatID, userID int64) error
 	UpdateMemberRole(ctx context.Context, chatID, userID int64, role Role) error
 	GetChatMembers(ctx context.Context, chatID int64) ([]ChatMember, error)
+	CountMembers(ctx context.Context, chatID int64) (int64, error)
+	GetContactIDs(ctx context.Context, userID int64) ([]int64, error)
 	IsMember(ctx context.Context, chatID, userID int64) (bool, error)
 	GetMemberRole(ctx context.Context, chatID, userID int64) (Role, error)
+	GetMember(ctx context.Context, chatID, userID int64) (*ChatMember, error)
+	GetFirstUnread(ctx context.Context, chatID, userID int64) (*int64, error)
+	CountUnreadMessages(ctx context.Context, userID int64) (int64, error)
+	// GetUnreadCounts returns userID's unread count in every chat that has unread messages
+	GetUnreadCounts(ctx context.Context, userID int64) ([]ChatUnread, error)
+	UpdateNotificationLevel(ctx context.Context, chatID, userID int64, level NotificationLevel) error
+	SetArchivedAt(ctx context.Context, chatID, userID int64, archivedAt *time.Time) error
+	SetMutedUntil(ctx context.Context, chatID, userID int64, mutedUntil *time.Time) error
+	GetMutedMemberIDs(ctx context.Context, chatID int64, now time.Time) ([]int64, error)
+	// HasArchivedMembers reports whether any member has chatID archived
+	HasArchivedMembers(ctx context.Context, chatID int64) (bool, error)
+	UnarchiveForAll(ctx context.Context, chatID int64) error
 	
 	CreateMessage(ctx context.Context, msg *Message) error
-	GetMessageHistory(ctx context.Context, chatID int64, limit int) ([]Message, error)
+	// GetMessageHistory and GetMessagesAfter leave out messages from users viewerID has blocked
+	GetMessageHistory(ctx context.Context, chatID, viewerID, beforeID int64, limit int, includeDeleted bool) ([]Message, error)
+	GetMessagesAfter(ctx context.Context, chatID, viewerID, afterID int64, limit int) ([]Message, error)
+	GetLastMessage(ctx context.Context, chatID int64) (*Message, error)
+	GetMessage(ctx context.Context, msgID int64) (*Message, error)
+	// UpdateMessage saves an edited message's body and edited_at
+	UpdateMessage(ctx context.Context, msg *Message) error
+	// SoftDeleteMessage marks a message deleted and reports whether it wasn't already
+	SoftDeleteMessage(ctx context.Context, msgID int64, at time.Time) (bool, error)
+	GetMessagesByIDs(ctx context.Context, ids []int64) ([]Message, error)
+	// CountMessagesWithMedia counts live messages whose media key is objectKey
+	CountMessagesWithMedia(ctx context.Context, objectKey string) (int64, error)
+	// CanAccessMedia reports whether userID belongs to a chat with a live message
+	// whose validated media key is objectKey
+	CanAccessMedia(ctx context.Context, userID int64, objectKey string) (bool, error)
+	// PurgeExpiredMessages permanently deletes up to limit messages older than
+	// their chat's retention (defaultDays for chats without an override, 0
+	// meaning keep forever), skipping pinned ones. It returns how many were
+	// deleted and the media keys they referenced.
+	PurgeExpiredMessages(ctx context.Context, defaultDays, limit int) (int64, []string, error)
+	// DeleteExpiredMessages permanently deletes up to limit messages whose
+	// expires_at has passed and returns them, with DeletedAt set on those that
+	// had already been soft-deleted
+	DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) ([]Message, error)
 	
 	CreateReceipt(ctx context.Context, receipt *Receipt) error
 	UpdateLastReadMessage(ctx context.Context, chatID, userID, msgID int64) error
+	MarkDelivered(ctx context.Context, chatID, userID, msgID int64) error
 	
-	AddDeviceToken(ctx context.Context, token *DeviceToken) error
-	GetDeviceTokens(ctx context.Context, userID int64) ([]string, error)
+	AddDeviceToken(ctx context.Context, token *DeviceToken) (created bool, err error)
+	GetDeviceTokens(ctx context.Context, userID int64) ([]DeviceToken, error)
+	RemoveDeviceToken(ctx context.Context, token string) error
+	RemoveUserDeviceTokens(ctx context.Context, userID int64) error
 	GetPrivateChatBetweenUsers(ctx context.Context, userA, userB int64) (*Chat, error)
 
 	// Reactions
@@ -117,7 +413,31 @@ type ChatRepository interface {
 	RemoveAllUserReactions(ctx context.Context, msgID, userID int64) error
 	GetReactions(ctx context.Context, msgID int64) ([]Reaction, error)
 
+	// Pins
+	PinMessage(ctx context.Context, pin *PinnedMessage) error
+	UnpinMessage(ctx context.Context, chatID, msgID int64) (removed bool, err error)
+	GetPinnedMessages(ctx context.Context, chatID int64) ([]PinnedMessage, error)
+
+	// Folders
+	CreateFolder(ctx context.Context, folder *Folder) error
+	GetFolder(ctx context.Context, folderID int64) (*Folder, error)
+	RenameFolder(ctx context.Context, folderID int64, name string) error
+	DeleteFolder(ctx context.Context, folderID int64) error
+	// ListFolders returns userID's folders, oldest first, with chat and unread counts
+	ListFolders(ctx context.Context, userID int64) ([]Folder, error)
+	AddChatToFolder(ctx context.Context, folderID, chatID int64) error
+	RemoveChatFromFolder(ctx context.Context, folderID, chatID int64) (removed bool, err error)
+
+	// Scheduled messages
+	CreateScheduledMessage(ctx context.Context, sm *ScheduledMessage) error
+	// ListScheduledMessages returns userID's pending messages in chatID, soonest first
+	ListScheduledMessages(ctx context.Context, chatID, userID int64) ([]ScheduledMessage, error)
+	DeleteScheduledMessage(ctx context.Context, chatID, userID, id int64) (removed bool, err error)
+	// ClaimDueScheduledMessages removes and returns up to limit messages due at
+	// now. Each is claimed by exactly one caller.
+	ClaimDueScheduledMessages(ctx context.Context, now time.Time, limit int) ([]ScheduledMessage, error)
+
 	// Threads
-	GetThreadReplies(ctx context.Context, parentMsgID int64, limit int) ([]Message, error)
+	GetThreadReplies(ctx context.Context, chatID, parentMsgID int64, limit int) ([]Message, error)
 	GetReplyCount(ctx context.Context, msgID int64) (int64, error)
 }
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidInput is returned when a request is well-formed but not allowed
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrRateLimited is returned when a caller exceeds a rate limit
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrPermissionDenied is returned when the caller's role doesn't allow an action
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// RateLimitError is an ErrRateLimited that says when the caller may retry
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// SlowModeError rejects a message sent before a chat's slow-mode interval has
+// passed. It unwraps to a RateLimitError with the same RetryAfter.
+type SlowModeError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("slow mode is enabled, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *SlowModeError) Unwrap() error {
+	return &RateLimitError{RetryAfter: e.RetryAfter}
+}
@@ -1,9 +1,40 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
+
+// PresignedRequest is a signed request a client can perform directly against object storage
+type PresignedRequest struct {
+	URL    string
+	Method string
+	// Headers must be sent exactly as given or the signature check fails
+	Headers map[string]string
+}
+
+// UploadPart is one uploaded part of a multipart upload
+type UploadPart struct {
+	Number int32
+	ETag   string
+	Size   int64 // only known for parts listed from storage
+}
 
 // MediaRepository defines the interface for object storage operations
 type MediaRepository interface {
-	// GeneratePresignedURL generates a presigned URL for uploading a file
-	GeneratePresignedURL(ctx context.Context, objectName string, contentType string, expiry int64) (string, error)
+	// GeneratePresignedURL generates a presigned URL for uploading a file of
+	// exactly size bytes; storage rejects a body of any other length
+	GeneratePresignedURL(ctx context.Context, objectName string, contentType string, size int64, expiry time.Duration) (*PresignedRequest, error)
+	// GeneratePresignedGetURL generates a presigned URL for downloading a private file
+	GeneratePresignedGetURL(ctx context.Context, objectName string, expiry time.Duration) (*PresignedRequest, error)
+	// DeleteObject removes an object; deleting a missing object is not an error
+	DeleteObject(ctx context.Context, objectName string) error
+
+	// Multipart uploads, for large files uploaded and retried part by part
+	InitiateMultipartUpload(ctx context.Context, objectName string, contentType string) (uploadID string, err error)
+	PresignUploadPart(ctx context.Context, objectName, uploadID string, partNumber int32, expiry time.Duration) (*PresignedRequest, error)
+	// ListUploadedParts returns the parts storage has received, ordered by number
+	ListUploadedParts(ctx context.Context, objectName, uploadID string) ([]UploadPart, error)
+	CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, parts []UploadPart) error
+	AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error
 }
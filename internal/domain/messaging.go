@@ -9,6 +9,7 @@ type MessageBroker interface {
 
 	PublishToDeliveryExchange(ctx context.Context, chatID int64, payload []byte) error
 	PublishReadReceipt(ctx context.Context, payload []byte) error
+	PublishDeliveredReceipt(ctx context.Context, payload []byte) error
 	PublishTypingEvent(ctx context.Context, chatID int64, payload []byte) error
 	PublishPresenceEvent(ctx context.Context, payload []byte) error
 	
@@ -2,18 +2,113 @@ package domain
 
 import (
 	"context"
+	"fmt"
 	"time"
+	_ "time/tzdata" // Quiet hours resolve user timezones even on images without zoneinfo
 )
 
+// DeletedAccountName is shown in place of a deactivated user's name
+const DeletedAccountName = "Deleted Account"
+
 // User represents a registered user
 type User struct {
-	ID           int64     `json:"id"`
-	Email        string    `json:"email"`
-	Username     string    `json:"username,omitempty"`
-	AvatarURL    string    `json:"avatar_url,omitempty"`
-	Bio          string    `json:"bio,omitempty"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            int64      `json:"id"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Username      string     `json:"username,omitempty"`
+	AvatarURL     string     `json:"avatar_url,omitempty"`
+	Bio           string     `json:"bio,omitempty"`
+	PasswordHash  string     `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	ShowLastSeen  bool       `json:"show_last_seen"`
+	LastSeenAt    *time.Time `json:"-"` // when the user last went offline; shown through presence only
+	TokenVersion  int64      `json:"-"` // tokens issued under an older version are rejected
+	IsAdmin       bool       `json:"is_admin,omitempty"` // operator role, carried in the access token
+
+	// Quiet hours: pushes are suppressed daily from DNDStart to DNDEnd (HH:MM
+	// in Timezone). Empty bounds disable them.
+	Timezone         string `json:"timezone,omitempty"`
+	DNDStart         string `json:"dnd_start,omitempty"`
+	DNDEnd           string `json:"dnd_end,omitempty"`
+	DNDAllowMentions bool   `json:"dnd_allow_mentions"` // mentions still push during quiet hours
+}
+
+// PublicProfile is what any user may see of another: never the email or credentials
+type PublicProfile struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Bio       string `json:"bio,omitempty"`
+}
+
+// PublicProfile projects u onto the fields other users may see
+func (u *User) PublicProfile() PublicProfile {
+	return PublicProfile{ID: u.ID, Username: u.Username, AvatarURL: u.AvatarURL, Bio: u.Bio}
+}
+
+// IsDeactivated reports whether the account has been deactivated
+func (u *User) IsDeactivated() bool {
+	return u.DeactivatedAt != nil
+}
+
+// Anonymized returns a copy of a deactivated user safe to show to other members
+func (u *User) Anonymized() *User {
+	return &User{
+		ID:            u.ID,
+		Username:      DeletedAccountName,
+		CreatedAt:     u.CreatedAt,
+		DeactivatedAt: u.DeactivatedAt,
+	}
+}
+
+// ValidateQuietHours checks the timezone and that both quiet-hour bounds are
+// valid HH:MM times or both empty
+func (u *User) ValidateQuietHours() error {
+	if _, err := time.LoadLocation(u.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q: %w", u.Timezone, ErrInvalidInput)
+	}
+	if (u.DNDStart == "") != (u.DNDEnd == "") {
+		return fmt.Errorf("dnd_start and dnd_end must be set together: %w", ErrInvalidInput)
+	}
+	for _, clock := range []string{u.DNDStart, u.DNDEnd} {
+		if _, err := minuteOfDay(clock); clock != "" && err != nil {
+			return fmt.Errorf("invalid quiet hours time %q, want HH:MM: %w", clock, ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+// InQuietHours reports whether now falls in the user's quiet hours. A window
+// whose end is before its start wraps past midnight; equal bounds are empty.
+func (u *User) InQuietHours(now time.Time) bool {
+	start, err := minuteOfDay(u.DNDStart)
+	if err != nil {
+		return false
+	}
+	end, err := minuteOfDay(u.DNDEnd)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
 }
 
 // UserRepository defines the interface for user data access
@@ -21,7 +116,31 @@ type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByID(ctx context.Context, id int64) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
-	SearchUsers(ctx context.Context, query string, limit, offset int) ([]User, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]User, error)
+	// SearchUsers pages through users whose username starts with query, leaving
+	// out requesterID and anyone they blocked or who blocked them
+	SearchUsers(ctx context.Context, requesterID int64, query string, limit int, afterID int64) ([]User, error)
 	Update(ctx context.Context, user *User) error
+	SetDeactivatedAt(ctx context.Context, id int64, at *time.Time) error
+	SetLastSeenAt(ctx context.Context, id int64, at time.Time) error
+	SetEmailVerified(ctx context.Context, id int64) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	IncrTokenVersion(ctx context.Context, id int64) (int64, error) // returns the new version
+}
+
+// Block records that BlockerID blocked BlockedID
+type Block struct {
+	BlockerID int64     `json:"blocker_id"`
+	BlockedID int64     `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlockRepository defines the interface for user block data access
+type BlockRepository interface {
+	Block(ctx context.Context, blockerID, blockedID int64) error // no-op if already blocked
+	Unblock(ctx context.Context, blockerID, blockedID int64) error
+	ListBlocks(ctx context.Context, blockerID int64) ([]Block, error)
+	IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
+	GetBlockerIDs(ctx context.Context, blockedID int64) ([]int64, error) // users who blocked blockedID
 }
 
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/auth"
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	ws "github.com/ambarg/mini-telegram/internal/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operator-only endpoints
+type AdminHandler struct {
+	hub               *ws.Hub
+	broker            domain.MessageBroker
+	cacheRepo         domain.CacheRepository
+	announcementLimit int // per admin per minute, 0 disables
+}
+
+func NewAdminHandler(hub *ws.Hub, broker domain.MessageBroker, cacheRepo domain.CacheRepository, announcementLimit int) *AdminHandler {
+	return &AdminHandler{
+		hub:               hub,
+		broker:            broker,
+		cacheRepo:         cacheRepo,
+		announcementLimit: announcementLimit,
+	}
+}
+
+type AnnounceRequest struct {
+	Body   string `json:"body" binding:"required,max=4096"`
+	ChatID int64  `json:"chatId" binding:"min=0"` // 0 announces to every connected user
+}
+
+// Announce godoc
+// @Summary      Send an announcement
+// @Description  Push an Announcement event to one chat, or with no chatId to every user connected to this gateway (Admin only)
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body AnnounceRequest true "Announcement"
+// @Success      202  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Router       /admin/announce [post]
+func (h *AdminHandler) Announce(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	ctx := c.Request.Context()
+
+	var req AnnounceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if h.announcementLimit > 0 {
+		allowed, retryAfter, err := h.cacheRepo.TakeToken(ctx, fmt.Sprintf("announce:%d", userID), h.announcementLimit, time.Minute)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !allowed {
+			respondError(c, &domain.RateLimitError{RetryAfter: retryAfter})
+			return
+		}
+	}
+
+	event := map[string]any{
+		"type":   "Announcement",
+		"body":   req.Body,
+		"sentAt": time.Now().Unix(),
+	}
+
+	logger := telemetry.Logger(ctx)
+	if req.ChatID != 0 {
+		// Through the delivery exchange, so members on every gateway get it
+		event["chatId"] = req.ChatID
+		payload, _ := json.Marshal(event)
+		if err := h.broker.PublishToDeliveryExchange(ctx, req.ChatID, payload); err != nil {
+			respondError(c, err)
+			return
+		}
+		// Every announcement is logged for audit, including its full text
+		logger.Info().Str("audit", "announcement").Int64("admin_id", userID).
+			Int64("chat_id", req.ChatID).Str("body", req.Body).Msg("announcement sent")
+		c.JSON(http.StatusAccepted, gin.H{"chatId": req.ChatID})
+		return
+	}
+
+	payload, _ := json.Marshal(event)
+	recipients := 0
+	for _, uid := range h.hub.GetConnectedUserIDs() {
+		if h.hub.SendToUser(uid, payload) > 0 {
+			recipients++
+		}
+	}
+	logger.Info().Str("audit", "announcement").Int64("admin_id", userID).
+		Int("recipients", recipients).Str("body", req.Body).Msg("announcement sent")
+	c.JSON(http.StatusAccepted, gin.H{"recipients": recipients})
+}
@@ -10,7 +10,7 @@ import (
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"` // length and strength are checked by the password policy
 }
 
 type LoginRequest struct {
@@ -18,6 +18,12 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ChangePasswordRequest is the request body for changing the caller's password
+type ChangePasswordRequest struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"` // length and strength are checked by the password policy
+}
+
 type AuthHandler struct {
 	service *authService.Service
 }
@@ -40,7 +46,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -77,7 +83,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -111,7 +117,7 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := h.service.RefreshToken(refreshToken)
+	accessToken, err := h.service.RefreshToken(c.Request.Context(), refreshToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -122,6 +128,126 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 	})
 }
 
+// Logout godoc
+// @Summary      Logout
+// @Description  Revoke the refresh token cookie and clear it
+// @Tags         auth
+// @Success      204  "No Content"
+// @Failure      500  {object}  map[string]string
+// @Router       /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if refreshToken, err := c.Cookie("refreshToken"); err == nil && refreshToken != "" {
+		if err := h.service.Logout(c.Request.Context(), refreshToken); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	h.clearRefreshTokenCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary      Logout from all devices
+// @Description  Revoke every access and refresh token issued to the caller, including the one making the request, and clear the cookie
+// @Tags         auth
+// @Security     BearerAuth
+// @Success      204  "No Content"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.LogoutAll(c.Request.Context(), userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.clearRefreshTokenCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email
+// @Description  Mark the account a verification token was sent for as verified
+// @Tags         auth
+// @Produce      json
+// @Param        token  query  string  true  "Verification token"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /auth/verify [get]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	if err := h.service.VerifyEmail(c.Request.Context(), token); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerification godoc
+// @Summary      Resend verification email
+// @Description  Send the caller a new email verification token. Limited to a few requests per hour.
+// @Tags         auth
+// @Security     BearerAuth
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Router       /auth/resend-verification [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.ResendVerification(c.Request.Context(), userID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ChangePassword godoc
+// @Summary      Change password
+// @Description  Replace the caller's password. Every existing session is signed out; the response carries fresh tokens for this one.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body ChangePasswordRequest true "Change Password Request"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /users/me/password [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	resp, err := h.service.ChangePassword(c.Request.Context(), userID, req.OldPassword, req.NewPassword)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.setRefreshTokenCookie(c, resp.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken":  resp.AccessToken,
+		"refreshToken": resp.RefreshToken,
+	})
+}
+
 func (h *AuthHandler) setRefreshTokenCookie(c *gin.Context, token string) {
 	c.SetCookie("refreshToken", token, int(auth.RefreshTokenLifetime.Seconds()), "/", "", true, true)
 }
+
+func (h *AuthHandler) clearRefreshTokenCookie(c *gin.Context) {
+	c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/ambarg/mini-telegram/internal/auth"
 	"github.com/ambarg/mini-telegram/internal/domain"
@@ -12,7 +13,7 @@ import (
 
 type CreateChatRequest struct {
 	Type      int16   `json:"type" binding:"required,oneof=1 2"`
-	MemberIDs []int64 `json:"memberIds" binding:"required,min=1"`
+	MemberIDs []int64 `json:"memberIds" binding:"required,min=1,max=200"`
 	Title     string  `json:"title"`
 }
 
@@ -27,13 +28,27 @@ type DeviceRequest struct {
 
 // SendMessageRequest is the request body for sending a message
 type SendMessageRequest struct {
-	Body     string `json:"body" binding:"required"`
-	MediaURL string `json:"mediaUrl"`
+	Body         string            `json:"body" binding:"required"`
+	MediaURL     string            `json:"mediaUrl"`
+	MediaMeta    *domain.MediaMeta `json:"mediaMeta"` // size, mime and dimensions of the attachment at MediaURL
+	ReplyToID    *int64            `json:"replyToId"`
+	ReplySnippet string            `json:"replySnippet"` // Quoted parent text, defaults to the start of the parent's body
+	SendAt       *time.Time        `json:"sendAt"`       // Schedules the message for later delivery instead of sending it now
 }
 
-// UpdateGroupRequest is the request body for updating group info
+// EditMessageRequest is the request body for editing a message
+type EditMessageRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// UpdateGroupRequest is the request body for updating group info; omitted fields are left unchanged
 type UpdateGroupRequest struct {
-	Title string `json:"title" binding:"required"`
+	Title       *string `json:"title" binding:"omitempty,min=1,max=128"`
+	Description *string `json:"description" binding:"omitempty,max=255"`
+	AvatarURL   *string `json:"avatarUrl"`
+	PostPolicy  *string `json:"postPolicy" binding:"omitempty,oneof=all admins"`
+	SlowModeSeconds *int `json:"slowModeSeconds" binding:"omitempty,min=0,max=3600"`
+	RetentionDays   *int `json:"retentionDays" binding:"omitempty,min=0,max=3650"` // 0 uses the server default
 }
 
 // MarkReadRequest is the request body for marking a chat as read
@@ -41,11 +56,39 @@ type MarkReadRequest struct {
 	LastReadID int64 `json:"lastReadId" binding:"required"`
 }
 
+// NotificationSettingsRequest is the request body for changing a chat's notification level
+type NotificationSettingsRequest struct {
+	Level string `json:"level" binding:"required,oneof=all mentions_only none"`
+}
+
+// MessageTTLRequest is the request body for setting a chat's disappearing message timer
+type MessageTTLRequest struct {
+	// Seconds after sending that new messages disappear, up to a week; 0 turns it off
+	Seconds *int `json:"seconds" binding:"required,min=0,max=604800"`
+}
+
+// MuteRequest is the optional request body for muting a chat
+type MuteRequest struct {
+	// DurationSeconds limits the mute (up to a year); without it the chat stays muted until unmuted
+	DurationSeconds int64 `json:"durationSeconds" binding:"omitempty,min=1,max=31536000"`
+}
+
 // ReactionRequest is the request body for adding a reaction
 type ReactionRequest struct {
 	Emoji string `json:"emoji" binding:"required"`
 }
 
+// PinRequest is the optional request body for pinning a message
+type PinRequest struct {
+	// ReplaceOldest unpins the oldest pin when the chat is at the pin limit
+	ReplaceOldest bool `json:"replaceOldest"`
+}
+
+// FolderRequest is the request body for creating or renaming a folder
+type FolderRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
 type ChatHandler struct {
 	service *chat.Service
 }
@@ -71,38 +114,135 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 	var req CreateChatRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	chat, err := h.service.CreateChat(c.Request.Context(), userID, req.Type, req.MemberIDs, req.Title)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"chatId": chat.ID})
 }
 
+// ChatListResponse is one page of the user's chat list
+type ChatListResponse struct {
+	Chats      []domain.Chat `json:"chats"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// MessagePageResponse is one page of a chat's message history, newest first
+type MessagePageResponse struct {
+	Messages []domain.Message `json:"messages"`
+	// NextCursor is the beforeId of the next, older page; omitted on the oldest page
+	NextCursor int64 `json:"nextCursor,omitempty"`
+}
+
 // GetChats godoc
 // @Summary      Get user chats
-// @Description  Get all chats for the authenticated user
+// @Description  Get a page of the authenticated user's chats, most recently active first
 // @Tags         chats
 // @Produce      json
 // @Security     BearerAuth
-// @Success      200  {array}   domain.Chat
+// @Param        limit   query     int     false "Page size (default 50, max 100)"
+// @Param        cursor  query     string  false "Cursor from a previous page's nextCursor"
+// @Param        type    query     string  false "Filter by chat type" Enums(direct, group)
+// @Param        archived query    bool    false "Include archived chats"
+// @Param        folderId query    int64   false "Only chats in this folder of the caller's"
+// @Success      200  {object}  ChatListResponse
+// @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /chats [get]
 func (h *ChatHandler) GetChats(c *gin.Context) {
 	userID, _ := auth.GetUserID(c)
 
-	chats, err := h.service.GetUserChats(c.Request.Context(), userID)
+	var opts domain.ChatListOptions
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		opts.Limit = parsed
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := chat.DecodeChatCursor(cursor)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		opts.Cursor = decoded
+	}
+
+	switch c.Query("type") {
+	case "":
+	case "direct":
+		opts.Type = domain.ChatTypeDirect
+	case "group":
+		opts.Type = domain.ChatTypeGroup
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be direct or group"})
+		return
+	}
+
+	if archived := c.Query("archived"); archived != "" {
+		include, err := strconv.ParseBool(archived)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid archived flag"})
+			return
+		}
+		opts.IncludeArchived = include
+	}
+
+	if folder := c.Query("folderId"); folder != "" {
+		folderID, err := strconv.ParseInt(folder, 10, 64)
+		if err != nil || folderID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+			return
+		}
+		opts.FolderID = folderID
+	}
+
+	chats, nextCursor, err := h.service.ListUserChats(c.Request.Context(), userID, opts)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ChatListResponse{Chats: chats, NextCursor: nextCursor})
+}
+
+// GetChat godoc
+// @Summary      Get chat details
+// @Description  Get a chat's title, avatar and type with its member count, the caller's role, last read message and first unread message
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      200  {object}  domain.ChatDetails
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /chats/{id} [get]
+func (h *ChatHandler) GetChat(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+
+	details, err := h.service.GetChatDetails(c.Request.Context(), chatID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, chats)
+	c.JSON(http.StatusOK, details)
 }
 
 // GetChatMembers godoc
@@ -114,6 +254,7 @@ func (h *ChatHandler) GetChats(c *gin.Context) {
 // @Param        id   path      int64  true  "Chat ID"
 // @Success      200  {array}   domain.ChatMember
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /chats/{id}/members [get]
 func (h *ChatHandler) GetChatMembers(c *gin.Context) {
@@ -127,7 +268,7 @@ func (h *ChatHandler) GetChatMembers(c *gin.Context) {
 
 	members, err := h.service.GetChatMembers(c.Request.Context(), chatID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -141,9 +282,13 @@ func (h *ChatHandler) GetChatMembers(c *gin.Context) {
 // @Produce      json
 // @Security     BearerAuth
 // @Param        id     path      int64  true  "Chat ID"
-// @Param        limit  query     int    false "Limit"
-// @Success      200  {array}   domain.Message
+// @Param        limit     query     int    false "Page size (default 50, max 100)"
+// @Param        beforeId  query     int64  false "Only messages older than this ID, from a previous page's nextCursor"
+// @Param        includeDeleted query bool false "Include soft-deleted messages (group admins only)"
+// @Success      200  {object}  MessagePageResponse
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /chats/{id}/messages [get]
 func (h *ChatHandler) GetMessages(c *gin.Context) {
@@ -153,24 +298,165 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
-	limit := 50
+	limit := chat.DefaultMessagePageSize
 	if l := c.Query("limit"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
 			limit = parsed
 		}
 	}
 
+	var beforeID int64
+	if b := c.Query("beforeId"); b != "" {
+		beforeID, err = strconv.ParseInt(b, 10, 64)
+		if err != nil || beforeID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid beforeId"})
+			return
+		}
+	}
+
+	var includeDeleted bool
+	if v := c.Query("includeDeleted"); v != "" {
+		includeDeleted, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid includeDeleted flag"})
+			return
+		}
+	}
+
+	userID, _ := auth.GetUserID(c)
+
+	msgs, nextCursor, err := h.service.GetMessages(c.Request.Context(), chatID, userID, beforeID, limit, includeDeleted)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MessagePageResponse{Messages: msgs, NextCursor: nextCursor})
+}
+
+// GetMessage godoc
+// @Summary      Get a message
+// @Description  Get a single message of a chat by ID
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Success      200  {object}  domain.Message
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId} [get]
+func (h *ChatHandler) GetMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+
+	msg, err := h.service.GetMessage(c.Request.Context(), chatID, msgID, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// MessagesBatchRequest lists the message IDs to resolve
+type MessagesBatchRequest struct {
+	IDs []int64 `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// GetMessagesBatch godoc
+// @Summary      Get messages by IDs
+// @Description  Resolve up to 100 message IDs across chats; messages in chats the caller isn't a member of are omitted
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body MessagesBatchRequest true "Message IDs"
+// @Success      200  {array}   domain.Message
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /messages/batch [post]
+func (h *ChatHandler) GetMessagesBatch(c *gin.Context) {
+	var req MessagesBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
 	userID, _ := auth.GetUserID(c)
 
-	msgs, err := h.service.GetMessages(c.Request.Context(), chatID, userID, limit)
+	msgs, err := h.service.GetMessagesByIDs(c.Request.Context(), userID, req.IDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, msgs)
 }
 
+// ForwardRequest lists the chats to forward a message to
+type ForwardRequest struct {
+	ChatIDs []int64 `json:"chatIds" binding:"required,min=1,max=10"`
+}
+
+// ForwardMessage godoc
+// @Summary      Forward a message
+// @Description  Copy a message into up to 10 chats the caller is a member of. The copies record the original in forwarded_from.
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Source Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Param        request body ForwardRequest true "Target chats"
+// @Success      201  {array}   domain.Message
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId}/forward [post]
+func (h *ChatHandler) ForwardMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	var req ForwardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	msgs, err := h.service.ForwardMessage(c.Request.Context(), chatID, msgID, req.ChatIDs, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, msgs)
+}
+
 // SendMessage godoc
 // @Summary      Send a message
 // @Description  Send a message to a chat
@@ -182,6 +468,8 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 // @Param        request body SendMessageRequest true "Message Body"
 // @Success      201  {object}  map[string]int64
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
 // @Router       /chats/{id}/messages [post]
 func (h *ChatHandler) SendMessage(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -190,33 +478,182 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Body     string `json:"body" binding:"required"`
-		MediaURL string `json:"mediaUrl"`
-	}
+	var req SendMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	userID, _ := auth.GetUserID(c)
 
 	msg := &domain.Message{
-		ChatID:   chatID,
-		UserID:   userID,
-		Body:     req.Body,
-		MediaURL: req.MediaURL,
+		ChatID:       chatID,
+		UserID:       userID,
+		Body:         req.Body,
+		MediaURL:     req.MediaURL,
+		MediaMeta:    req.MediaMeta,
+		ReplyToID:    req.ReplyToID,
+		ReplySnippet: req.ReplySnippet,
+	}
+
+	if req.SendAt != nil {
+		scheduled, err := h.service.ScheduleMessage(c.Request.Context(), msg, *req.SendAt)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, scheduled)
+		return
 	}
 
-	// We pass empty clientUUID for REST API for now
-	if err := h.service.ProcessMessage(c.Request.Context(), msg, ""); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.ProcessMessage(c.Request.Context(), msg); err != nil {
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"messageId": msg.ID})
 }
 
+// GetScheduledMessages godoc
+// @Summary      List scheduled messages
+// @Description  Get the caller's messages in a chat that are waiting for their send time, soonest first
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      200  {array}   domain.ScheduledMessage
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/scheduled [get]
+func (h *ChatHandler) GetScheduledMessages(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	messages, err := h.service.ListScheduledMessages(c.Request.Context(), chatID, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// CancelScheduledMessage godoc
+// @Summary      Cancel a scheduled message
+// @Description  Delete one of the caller's scheduled messages before it is sent
+// @Tags         chats
+// @Security     BearerAuth
+// @Param        id           path      int64  true  "Chat ID"
+// @Param        scheduledId  path      int64  true  "Scheduled message ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/scheduled/{scheduledId} [delete]
+func (h *ChatHandler) CancelScheduledMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	scheduledID, err := strconv.ParseInt(c.Param("scheduledId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scheduled message ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.CancelScheduledMessage(c.Request.Context(), chatID, userID, scheduledID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// EditMessage godoc
+// @Summary      Edit a message
+// @Description  Replace the body of one of the caller's own messages within the edit window
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Param        request body EditMessageRequest true "New body"
+// @Success      200  {object}  domain.Message
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId} [patch]
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	msg, err := h.service.EditMessage(c.Request.Context(), chatID, msgID, userID, req.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// DeleteMessage godoc
+// @Summary      Delete a message
+// @Description  Soft-delete a message. Authors can delete their own messages, group admins any message.
+// @Tags         chats
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId} [delete]
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.DeleteMessage(c.Request.Context(), chatID, msgID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // InviteToChat godoc
 // @Summary      Invite user to chat
 // @Description  Add a user to an existing chat
@@ -239,12 +676,12 @@ func (h *ChatHandler) InviteToChat(c *gin.Context) {
 	var req InviteRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	if err := h.service.AddMember(c.Request.Context(), chatID, req.UserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -271,7 +708,7 @@ func (h *ChatHandler) LeaveChat(c *gin.Context) {
 	userID, _ := auth.GetUserID(c)
 
 	if err := h.service.RemoveMember(c.Request.Context(), chatID, userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -280,7 +717,7 @@ func (h *ChatHandler) LeaveChat(c *gin.Context) {
 
 // KickMember godoc
 // @Summary      Kick member from chat
-// @Description  Remove a user from chat (Admin only)
+// @Description  Remove a user from chat (Admin only). The last admin can't be removed.
 // @Tags         chats
 // @Produce      json
 // @Security     BearerAuth
@@ -288,6 +725,7 @@ func (h *ChatHandler) LeaveChat(c *gin.Context) {
 // @Param        userId  path      int64  true  "User ID"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
 // @Router       /chats/{id}/members/{userId} [delete]
 func (h *ChatHandler) KickMember(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -302,18 +740,9 @@ func (h *ChatHandler) KickMember(c *gin.Context) {
 		return
 	}
 
-	// We pass the caller's ID implicitly via context or explicitly if we updated service signature.
-	// But wait, RemoveMember in service doesn't take actorID yet.
-	// For this task, we should probably update RemoveMember to take actorID to enforce admin check there too,
-	// OR do the check here.
-	// The implementation plan said "Update RemoveMember (Kick) to check for admin privileges".
-	// I didn't update RemoveMember signature in service.go to take actorID, I just added a TODO comment.
-	// Let's fix that oversight. I should have updated RemoveMember signature.
-	// But since I didn't, I'll skip the check here for now or rely on the service to fail if I update it later.
-	// Actually, let's implement the new handlers first.
-
-	if err := h.service.RemoveMember(c.Request.Context(), chatID, targetUserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.KickMember(c.Request.Context(), chatID, userID, targetUserID); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -322,7 +751,7 @@ func (h *ChatHandler) KickMember(c *gin.Context) {
 
 // UpdateGroupInfo godoc
 // @Summary      Update group info
-// @Description  Update group title (Admin only)
+// @Description  Update group title, description, avatar, post policy or slow mode (Admin only)
 // @Tags         chats
 // @Accept       json
 // @Produce      json
@@ -331,6 +760,7 @@ func (h *ChatHandler) KickMember(c *gin.Context) {
 // @Param        request body UpdateGroupRequest true "Update Request"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
 // @Router       /chats/{id} [patch]
 func (h *ChatHandler) UpdateGroupInfo(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -339,17 +769,27 @@ func (h *ChatHandler) UpdateGroupInfo(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Title string `json:"title" binding:"required"`
-	}
+	var req UpdateGroupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
+	update := domain.GroupInfoUpdate{
+		Title:       req.Title,
+		Description: req.Description,
+		AvatarURL:   req.AvatarURL,
+		SlowModeSeconds: req.SlowModeSeconds,
+		RetentionDays:   req.RetentionDays,
+	}
+	if req.PostPolicy != nil {
+		policy := domain.PostPolicy(*req.PostPolicy)
+		update.PostPolicy = &policy
+	}
+
 	actorID, _ := auth.GetUserID(c)
-	if err := h.service.UpdateGroupInfo(c.Request.Context(), chatID, actorID, req.Title); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.UpdateGroupInfo(c.Request.Context(), chatID, actorID, update); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -366,6 +806,7 @@ func (h *ChatHandler) UpdateGroupInfo(c *gin.Context) {
 // @Param        userId  path      int64  true  "User ID"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
 // @Router       /chats/{id}/members/{userId}/promote [post]
 func (h *ChatHandler) PromoteMember(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -382,7 +823,7 @@ func (h *ChatHandler) PromoteMember(c *gin.Context) {
 
 	actorID, _ := auth.GetUserID(c)
 	if err := h.service.PromoteMember(c.Request.Context(), chatID, actorID, targetUserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -399,6 +840,7 @@ func (h *ChatHandler) PromoteMember(c *gin.Context) {
 // @Param        userId  path      int64  true  "User ID"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
 // @Router       /chats/{id}/members/{userId}/demote [post]
 func (h *ChatHandler) DemoteMember(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -415,7 +857,7 @@ func (h *ChatHandler) DemoteMember(c *gin.Context) {
 
 	actorID, _ := auth.GetUserID(c)
 	if err := h.service.DemoteMember(c.Request.Context(), chatID, actorID, targetUserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -424,12 +866,13 @@ func (h *ChatHandler) DemoteMember(c *gin.Context) {
 
 // RegisterDevice godoc
 // @Summary      Register device for push
-// @Description  Register a device token for push notifications
+// @Description  Register a device token for push notifications. Re-registering a known token refreshes it and returns 200.
 // @Tags         devices
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
 // @Param        request body DeviceRequest true "Device Registration Request"
+// @Success      200  "OK"
 // @Success      201  "Created"
 // @Failure      400  {object}  map[string]string
 // @Router       /devices [post]
@@ -439,16 +882,21 @@ func (h *ChatHandler) RegisterDevice(c *gin.Context) {
 	var req DeviceRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	if err := h.service.RegisterDevice(c.Request.Context(), userID, req.Token, req.Platform); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	created, err := h.service.RegisterDevice(c.Request.Context(), userID, req.Token, req.Platform)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.Status(http.StatusCreated)
+	if created {
+		c.Status(http.StatusCreated)
+	} else {
+		c.Status(http.StatusOK)
+	}
 }
 
 // MarkRead godoc
@@ -474,31 +922,334 @@ func (h *ChatHandler) MarkRead(c *gin.Context) {
 		LastReadID int64 `json:"lastReadId" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	userID, _ := auth.GetUserID(c)
 	if err := h.service.MarkChatRead(c.Request.Context(), chatID, userID, req.LastReadID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
-// AddReaction godoc
-// @Summary      Add reaction
-// @Description  Add an emoji reaction to a message
+// UpdateNotificationSettings godoc
+// @Summary      Update chat notification settings
+// @Description  Choose which messages in a chat trigger push notifications (all, mentions_only, none)
 // @Tags         chats
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        id      path      int64  true  "Chat ID"
-// @Param        msgId   path      int64  true  "Message ID"
-// @Param        request body ReactionRequest true "Reaction Request"
-// @Success      201  {object}  domain.Reaction
+// @Param        id   path      int64  true  "Chat ID"
+// @Param        request body NotificationSettingsRequest true "Notification Settings"
+// @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Router       /chats/{id}/notifications [patch]
+func (h *ChatHandler) UpdateNotificationSettings(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	var req NotificationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.SetNotificationLevel(c.Request.Context(), chatID, userID, domain.NotificationLevel(req.Level)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SetMessageTTL godoc
+// @Summary      Set disappearing messages
+// @Description  Make new messages in a chat disappear a number of seconds after they are sent. Any member of a direct chat may set it, in groups only admins.
+// @Tags         chats
+// @Accept       json
+// @Security     BearerAuth
+// @Param        id       path      int64              true  "Chat ID"
+// @Param        request  body      MessageTTLRequest  true  "Timer"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/ttl [put]
+func (h *ChatHandler) SetMessageTTL(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	var req MessageTTLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.SetMessageTTL(c.Request.Context(), chatID, userID, *req.Seconds); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// MuteChat godoc
+// @Summary      Mute chat
+// @Description  Stop push notifications for a chat, for a duration or until unmuted. Messages are still delivered over the WebSocket, marked muted.
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      int64        true   "Chat ID"
+// @Param        request  body      MuteRequest  false  "Mute duration"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/mute [post]
+func (h *ChatHandler) MuteChat(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	var req MuteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	until := domain.MutedForever
+	if req.DurationSeconds > 0 {
+		until = time.Now().Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.MuteChat(c.Request.Context(), chatID, userID, until); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnmuteChat godoc
+// @Summary      Unmute chat
+// @Description  Turn push notifications for a chat back on
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/mute [delete]
+func (h *ChatHandler) UnmuteChat(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.UnmuteChat(c.Request.Context(), chatID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ArchiveChat godoc
+// @Summary      Archive chat
+// @Description  Hide a chat from the main chat list until a new message arrives
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/archive [post]
+func (h *ChatHandler) ArchiveChat(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.ArchiveChat(c.Request.Context(), chatID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnarchiveChat godoc
+// @Summary      Unarchive chat
+// @Description  Return an archived chat to the main chat list
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/archive [delete]
+func (h *ChatHandler) UnarchiveChat(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.UnarchiveChat(c.Request.Context(), chatID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PinMessage godoc
+// @Summary      Pin a message
+// @Description  Pin a message to the top of the chat (Admin only in groups). At the pin limit, set replaceOldest to unpin the oldest pin instead of failing.
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Param        request body PinRequest false "Pin Request"
+// @Success      200  {object}  domain.PinnedMessage
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId}/pin [post]
+func (h *ChatHandler) PinMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	var req PinRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	userID, _ := auth.GetUserID(c)
+	pin, err := h.service.PinMessage(c.Request.Context(), chatID, msgID, userID, req.ReplaceOldest)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pin)
+}
+
+// UnpinMessage godoc
+// @Summary      Unpin a message
+// @Description  Remove a message from the chat's pins (Admin only in groups)
+// @Tags         chats
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/messages/{msgId}/pin [delete]
+func (h *ChatHandler) UnpinMessage(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	msgID, err := strconv.ParseInt(c.Param("msgId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.UnpinMessage(c.Request.Context(), chatID, msgID, userID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPinnedMessages godoc
+// @Summary      List pinned messages
+// @Description  Get a chat's pinned messages, most recently pinned first
+// @Tags         chats
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Chat ID"
+// @Success      200  {array}   domain.PinnedMessage
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /chats/{id}/pins [get]
+func (h *ChatHandler) GetPinnedMessages(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	pins, err := h.service.GetPinnedMessages(c.Request.Context(), chatID, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pins)
+}
+
+// AddReaction godoc
+// @Summary      Add reaction
+// @Description  Add an emoji reaction to a message, replacing the caller's previous one, and return the message's reactions by emoji
+// @Tags         chats
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Chat ID"
+// @Param        msgId   path      int64  true  "Message ID"
+// @Param        request body ReactionRequest true "Reaction Request"
+// @Success      201  {object}  domain.ReactionSummary
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Router       /chats/{id}/messages/{msgId}/reactions [post]
 func (h *ChatHandler) AddReaction(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -515,31 +1266,33 @@ func (h *ChatHandler) AddReaction(c *gin.Context) {
 
 	var req ReactionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	userID, _ := auth.GetUserID(c)
-	reaction, err := h.service.AddReaction(c.Request.Context(), chatID, msgID, userID, req.Emoji)
+	reactions, err := h.service.AddReaction(c.Request.Context(), chatID, msgID, userID, req.Emoji)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, reaction)
+	c.JSON(http.StatusCreated, reactions)
 }
 
 // RemoveReaction godoc
 // @Summary      Remove reaction
-// @Description  Remove an emoji reaction from a message
+// @Description  Remove an emoji reaction from a message and return the message's remaining reactions by emoji
 // @Tags         chats
 // @Produce      json
 // @Security     BearerAuth
 // @Param        id      path      int64   true  "Chat ID"
 // @Param        msgId   path      int64   true  "Message ID"
 // @Param        emoji   path      string  true  "Emoji"
-// @Success      204  "No Content"
+// @Success      200  {object}  domain.ReactionSummary
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Router       /chats/{id}/messages/{msgId}/reactions/{emoji} [delete]
 func (h *ChatHandler) RemoveReaction(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -561,12 +1314,13 @@ func (h *ChatHandler) RemoveReaction(c *gin.Context) {
 	}
 
 	userID, _ := auth.GetUserID(c)
-	if err := h.service.RemoveReaction(c.Request.Context(), chatID, msgID, userID, emoji); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	reactions, err := h.service.RemoveReaction(c.Request.Context(), chatID, msgID, userID, emoji)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusOK, reactions)
 }
 
 // GetThreadReplies godoc
@@ -580,6 +1334,8 @@ func (h *ChatHandler) RemoveReaction(c *gin.Context) {
 // @Param        limit   query     int    false "Limit"
 // @Success      200  {array}   domain.Message
 // @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Router       /chats/{id}/messages/{msgId}/replies [get]
 func (h *ChatHandler) GetThreadReplies(c *gin.Context) {
 	chatID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -604,10 +1360,207 @@ func (h *ChatHandler) GetThreadReplies(c *gin.Context) {
 	userID, _ := auth.GetUserID(c)
 	replies, err := h.service.GetThreadReplies(c.Request.Context(), chatID, msgID, userID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, replies)
 }
 
+
+// GetUnreadSummary godoc
+// @Summary      Get unread summary
+// @Description  Get the caller's total unread messages for the app badge, with per-chat counts for chats that have unread messages
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  domain.UnreadSummary
+// @Failure      500  {object}  map[string]string
+// @Router       /users/me/unread [get]
+func (h *ChatHandler) GetUnreadSummary(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	summary, err := h.service.GetUnreadSummary(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ListFolders godoc
+// @Summary      List folders
+// @Description  Get the caller's chat folders, oldest first, with chat and unread counts
+// @Tags         folders
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   domain.Folder
+// @Failure      500  {object}  map[string]string
+// @Router       /folders [get]
+func (h *ChatHandler) ListFolders(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	folders, err := h.service.ListFolders(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folders)
+}
+
+// CreateFolder godoc
+// @Summary      Create folder
+// @Description  Create a chat folder visible only to the caller
+// @Tags         folders
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body FolderRequest true "Folder"
+// @Success      201  {object}  domain.Folder
+// @Failure      400  {object}  map[string]string
+// @Router       /folders [post]
+func (h *ChatHandler) CreateFolder(c *gin.Context) {
+	var req FolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	folder, err := h.service.CreateFolder(c.Request.Context(), userID, req.Name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, folder)
+}
+
+// RenameFolder godoc
+// @Summary      Rename folder
+// @Description  Rename one of the caller's folders
+// @Tags         folders
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Folder ID"
+// @Param        request body FolderRequest true "Folder"
+// @Success      200  {object}  domain.Folder
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /folders/{id} [put]
+func (h *ChatHandler) RenameFolder(c *gin.Context) {
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+		return
+	}
+
+	var req FolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	folder, err := h.service.RenameFolder(c.Request.Context(), userID, folderID, req.Name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// DeleteFolder godoc
+// @Summary      Delete folder
+// @Description  Delete one of the caller's folders. Its chats are kept.
+// @Tags         folders
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "Folder ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /folders/{id} [delete]
+func (h *ChatHandler) DeleteFolder(c *gin.Context) {
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.DeleteFolder(c.Request.Context(), userID, folderID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AddChatToFolder godoc
+// @Summary      Add chat to folder
+// @Description  File a chat the caller belongs to under one of their folders
+// @Tags         folders
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Folder ID"
+// @Param        chatId  path      int64  true  "Chat ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /folders/{id}/chats/{chatId} [put]
+func (h *ChatHandler) AddChatToFolder(c *gin.Context) {
+	folderID, chatID, ok := parseFolderChatIDs(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.AddChatToFolder(c.Request.Context(), userID, folderID, chatID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveChatFromFolder godoc
+// @Summary      Remove chat from folder
+// @Description  Take a chat out of one of the caller's folders
+// @Tags         folders
+// @Security     BearerAuth
+// @Param        id      path      int64  true  "Folder ID"
+// @Param        chatId  path      int64  true  "Chat ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /folders/{id}/chats/{chatId} [delete]
+func (h *ChatHandler) RemoveChatFromFolder(c *gin.Context) {
+	folderID, chatID, ok := parseFolderChatIDs(c)
+	if !ok {
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.RemoveChatFromFolder(c.Request.Context(), userID, folderID, chatID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseFolderChatIDs reads the :id and :chatId path params, writing a 400 if either is invalid
+func parseFolderChatIDs(c *gin.Context) (folderID, chatID int64, ok bool) {
+	folderID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid folder ID"})
+		return 0, 0, false
+	}
+	chatID, err = strconv.ParseInt(c.Param("chatId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid chat ID"})
+		return 0, 0, false
+	}
+	return folderID, chatID, true
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"net/http"
+
+	ws "github.com/ambarg/mini-telegram/internal/websocket"
+	"github.com/gin-gonic/gin"
+)
+
+// debugBusiestChats is how many of the most subscribed chats GetHubStats lists
+const debugBusiestChats = 20
+
+// DebugHandler exposes operator diagnostics for this gateway
+type DebugHandler struct {
+	hub *ws.Hub
+}
+
+func NewDebugHandler(hub *ws.Hub) *DebugHandler {
+	return &DebugHandler{hub: hub}
+}
+
+// GetHubStats godoc
+// @Summary      WebSocket hub state
+// @Description  Connection and subscription counts for this gateway pod, with its busiest chats (Admin only)
+// @Tags         debug
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  websocket.HubStats
+// @Failure      403  {object}  map[string]string
+// @Router       /debug/hub [get]
+func (h *DebugHandler) GetHubStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Stats(debugBusiestChats))
+}
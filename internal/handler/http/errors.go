@@ -0,0 +1,97 @@
+package http
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// errCodeValidation marks a 400 whose fields map explains which inputs were rejected
+const errCodeValidation = "VALIDATION"
+
+func init() {
+	// Report validation failures under the JSON/query names clients send,
+	// not the Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// statusForError maps service errors to HTTP status codes
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondError writes err as a JSON error with the matching status code
+func respondError(c *gin.Context, err error) {
+	var rateErr *domain.RateLimitError
+	if errors.As(err, &rateErr) {
+		// Retry-After is whole seconds; round up so clients never retry too early
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+	}
+	c.JSON(statusForError(err), gin.H{"error": err.Error()})
+}
+
+// respondBindError writes a 400 for a failed ShouldBind*. Validation failures
+// list each rejected field with the rule it broke, e.g. {"email": "required",
+// "password": "min=8"}; anything else, such as malformed JSON, gets a generic message.
+func respondBindError(c *gin.Context, err error) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	fields := make(map[string]string, len(verrs))
+	for _, fe := range verrs {
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+		fields[fieldPath(fe)] = rule
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "validation failed",
+		"code":   errCodeValidation,
+		"fields": fields,
+	})
+}
+
+// fieldPath is the field's path below the request struct, e.g. "memberIds[2]"
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
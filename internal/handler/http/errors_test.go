@@ -0,0 +1,75 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bindAndRespond(t *testing.T, body string) (int, map[string]any) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	var req CreateChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+	}
+
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestRespondBindError_ValidationFields(t *testing.T) {
+	code, resp := bindAndRespond(t, `{"type":3}`)
+
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, errCodeValidation, resp["code"])
+	fields, ok := resp["fields"].(map[string]any)
+	require.True(t, ok, "fields missing: %v", resp)
+	assert.Equal(t, map[string]any{"type": "oneof=1 2", "memberIds": "required"}, fields)
+}
+
+func TestRespondBindError_MalformedJSON(t *testing.T) {
+	code, resp := bindAndRespond(t, `{"type":`)
+
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalid request body", resp["error"])
+	assert.NotContains(t, resp, "fields")
+}
+
+func TestStatusForError(t *testing.T) {
+	assert.Equal(t, http.StatusForbidden, statusForError(fmt.Errorf("only admins can pin messages: %w", domain.ErrPermissionDenied)))
+	assert.Equal(t, http.StatusNotFound, statusForError(fmt.Errorf("chat 1 not found: %w", domain.ErrNotFound)))
+	assert.Equal(t, http.StatusBadRequest, statusForError(fmt.Errorf("bad title: %w", domain.ErrInvalidInput)))
+	assert.Equal(t, http.StatusInternalServerError, statusForError(errors.New("connection refused")))
+}
+
+func TestRespondError_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, err := range []error{
+		fmt.Errorf("chat 7: %w", domain.ErrNotFound),
+		fmt.Errorf("message 42: %w", domain.ErrNotFound),
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondError(c, err)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, err.Error(), resp["error"])
+	}
+}
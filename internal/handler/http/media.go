@@ -2,8 +2,10 @@ package http
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/ambarg/mini-telegram/internal/auth"
+	"github.com/ambarg/mini-telegram/internal/domain"
 	"github.com/ambarg/mini-telegram/internal/service/media"
 	"github.com/gin-gonic/gin"
 )
@@ -19,36 +21,279 @@ func NewMediaHandler(service *media.Service) *MediaHandler {
 type UploadRequest struct {
 	Filename    string `json:"filename" binding:"required"`
 	ContentType string `json:"contentType" binding:"required"`
+	Size        int64  `json:"size" binding:"required,gt=0"` // file size in bytes; the upload must match it exactly
+	// ChatID scopes the upload to a chat the caller belongs to; omit for user-scoped files like avatars
+	ChatID int64 `json:"chatId"`
+}
+
+// UploadURLResponse tells the client how to PUT the file; Headers must match exactly
+type UploadURLResponse struct {
+	UploadURL string            `json:"uploadUrl"`
+	ObjectKey string            `json:"objectKey"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	// DownloadURL is the object's URL after upload; send it as the message's mediaUrl
+	DownloadURL string `json:"downloadUrl"`
 }
 
 // GetUploadURL godoc
 // @Summary      Get presigned upload URL
-// @Description  Get a URL to upload a file directly to object storage
+// @Description  Get a URL to upload a file directly to object storage. Only allowed content types up to the size limit are accepted.
 // @Tags         media
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
 // @Param        request body UploadRequest true "Upload Request"
-// @Success      200  {object}  map[string]string
+// @Success      200  {object}  UploadURLResponse
 // @Failure      400  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
 // @Router       /uploads/presigned [post]
 func (h *MediaHandler) GetUploadURL(c *gin.Context) {
 	userID, _ := auth.GetUserID(c)
 
 	var req UploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	upload, err := h.service.GetUploadURL(c.Request.Context(), userID, req.ChatID, req.Filename, req.ContentType, req.Size)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UploadURLResponse{
+		UploadURL:   upload.URL,
+		ObjectKey:   upload.ObjectKey,
+		Method:      upload.Method,
+		Headers:     upload.Headers,
+		ExpiresAt:   upload.ExpiresAt,
+		DownloadURL: upload.DownloadURL,
+	})
+}
+
+// DownloadURLResponse is a short-lived URL for reading a private object
+type DownloadURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// GetDownloadURL godoc
+// @Summary      Get presigned download URL
+// @Description  Get a short-lived URL to read a private object. Only the uploader and members of a chat with a message referencing the object may read it.
+// @Tags         media
+// @Produce      json
+// @Security     BearerAuth
+// @Param        key  query     string  true  "Object key"
+// @Success      200  {object}  DownloadURLResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /uploads/presigned [get]
+func (h *MediaHandler) GetDownloadURL(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
 		return
 	}
 
-	url, objectKey, err := h.service.GetUploadURL(c.Request.Context(), userID, req.Filename, req.ContentType)
+	download, err := h.service.GetDownloadURL(c.Request.Context(), userID, key)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"uploadUrl": url,
-		"objectKey": objectKey,
+	c.JSON(http.StatusOK, DownloadURLResponse{
+		URL:       download.URL,
+		ExpiresAt: download.ExpiresAt,
 	})
 }
+
+type InitiateMultipartRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"contentType" binding:"required"`
+	ChatID      int64  `json:"chatId"`
+	Size        int64  `json:"size" binding:"required,gt=0"` // total file size in bytes
+}
+
+// MultipartUploadResponse tells the client how to split the file; parts are numbered from 1
+type MultipartUploadResponse struct {
+	UploadID  string `json:"uploadId"`
+	ObjectKey string `json:"objectKey"`
+	PartSize  int64  `json:"partSize"`
+	PartCount int    `json:"partCount"`
+}
+
+// InitiateMultipartUpload godoc
+// @Summary      Start a multipart upload
+// @Description  Start a resumable upload of a large file in parts
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body InitiateMultipartRequest true "Upload Request"
+// @Success      200  {object}  MultipartUploadResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Router       /uploads/multipart [post]
+func (h *MediaHandler) InitiateMultipartUpload(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+
+	var req InitiateMultipartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	upload, err := h.service.InitiateMultipartUpload(c.Request.Context(), userID, req.ChatID, req.Filename, req.ContentType, req.Size)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, MultipartUploadResponse{
+		UploadID:  upload.UploadID,
+		ObjectKey: upload.ObjectKey,
+		PartSize:  upload.PartSize,
+		PartCount: upload.PartCount,
+	})
+}
+
+type PresignPartsRequest struct {
+	ObjectKey   string  `json:"objectKey" binding:"required"`
+	UploadID    string  `json:"uploadId" binding:"required"`
+	PartNumbers []int32 `json:"partNumbers" binding:"required,min=1,max=100"`
+}
+
+type PartURLResponse struct {
+	PartNumber int32             `json:"partNumber"`
+	UploadURL  string            `json:"uploadUrl"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	ExpiresAt  time.Time         `json:"expiresAt"`
+}
+
+type PresignPartsResponse struct {
+	Parts []PartURLResponse `json:"parts"`
+}
+
+// PresignUploadParts godoc
+// @Summary      Get presigned part URLs
+// @Description  Presign up to 100 parts of a multipart upload. Request a part again to retry it.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body PresignPartsRequest true "Parts"
+// @Success      200  {object}  PresignPartsResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /uploads/multipart/parts [post]
+func (h *MediaHandler) PresignUploadParts(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+
+	var req PresignPartsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	urls, err := h.service.PresignUploadParts(c.Request.Context(), userID, req.ObjectKey, req.UploadID, req.PartNumbers)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	resp := PresignPartsResponse{Parts: make([]PartURLResponse, len(urls))}
+	for i, u := range urls {
+		resp.Parts[i] = PartURLResponse{
+			PartNumber: u.Number,
+			UploadURL:  u.URL,
+			Method:     u.Method,
+			Headers:    u.Headers,
+			ExpiresAt:  u.ExpiresAt,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type CompletedPartRequest struct {
+	PartNumber int32  `json:"partNumber" binding:"required"`
+	ETag       string `json:"etag" binding:"required"` // ETag response header of the part's PUT
+}
+
+type CompleteMultipartRequest struct {
+	ObjectKey string                 `json:"objectKey" binding:"required"`
+	UploadID  string                 `json:"uploadId" binding:"required"`
+	Parts     []CompletedPartRequest `json:"parts" binding:"required,min=1,dive"`
+}
+
+// CompleteMultipartUpload godoc
+// @Summary      Complete a multipart upload
+// @Description  Assemble the uploaded parts into the final object. Uploads breaking the size limits are aborted.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body CompleteMultipartRequest true "Uploaded parts"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /uploads/multipart/complete [post]
+func (h *MediaHandler) CompleteMultipartUpload(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+
+	var req CompleteMultipartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	parts := make([]domain.UploadPart, len(req.Parts))
+	for i, p := range req.Parts {
+		parts[i] = domain.UploadPart{Number: p.PartNumber, ETag: p.ETag}
+	}
+
+	if err := h.service.CompleteMultipartUpload(c.Request.Context(), userID, req.ObjectKey, req.UploadID, parts); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"objectKey": req.ObjectKey})
+}
+
+type AbortMultipartRequest struct {
+	ObjectKey string `json:"objectKey" binding:"required"`
+	UploadID  string `json:"uploadId" binding:"required"`
+}
+
+// AbortMultipartUpload godoc
+// @Summary      Abort a multipart upload
+// @Description  Discard an unfinished upload and its parts
+// @Tags         media
+// @Accept       json
+// @Security     BearerAuth
+// @Param        request body AbortMultipartRequest true "Upload"
+// @Success      204
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /uploads/multipart/abort [post]
+func (h *MediaHandler) AbortMultipartUpload(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+
+	var req AbortMultipartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.service.AbortMultipartUpload(c.Request.Context(), userID, req.ObjectKey, req.UploadID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,11 @@
+package http
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var messagesSent = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gateway_msg_sent_total",
+	Help: "Messages accepted from WebSocket clients on this gateway",
+})
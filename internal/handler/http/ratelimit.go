@@ -0,0 +1,37 @@
+package http
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RateLimitByIP allows each client IP limit requests per minute to the routes
+// it guards; name keeps the buckets of different routes apart. A limit of 0
+// disables it.
+func RateLimitByIP(cacheRepo domain.CacheRepository, name string, limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		key := fmt.Sprintf("%s:%s", name, c.ClientIP())
+		allowed, retryAfter, err := cacheRepo.TakeToken(c.Request.Context(), key, limit, time.Minute)
+		if err != nil {
+			// Fail open so a Redis outage doesn't also lock everyone out of logging in
+			log.Warn().Err(err).Str("limiter", name).Msg("rate limit check failed")
+			c.Next()
+			return
+		}
+		if !allowed {
+			respondError(c, &domain.RateLimitError{RetryAfter: retryAfter})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
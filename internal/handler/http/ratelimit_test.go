@@ -0,0 +1,54 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketCache hands out a fixed number of tokens per key
+type bucketCache struct {
+	domain.CacheRepository
+	remaining map[string]int
+}
+
+func (b *bucketCache) TakeToken(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	if _, ok := b.remaining[key]; !ok {
+		b.remaining[key] = limit
+	}
+	if b.remaining[key] == 0 {
+		return false, 1500 * time.Millisecond, nil
+	}
+	b.remaining[key]--
+	return true, 0, nil
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := &bucketCache{remaining: map[string]int{}}
+	r := gin.New()
+	r.POST("/login", RateLimitByIP(cache, "login", 2), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, do("10.0.0.1").Code)
+	w := do("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	// Other clients have their own bucket
+	assert.Equal(t, http.StatusOK, do("10.0.0.2").Code)
+}
@@ -1,35 +1,47 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/ambarg/mini-telegram/internal/auth"
 	"github.com/ambarg/mini-telegram/internal/domain"
 	"github.com/ambarg/mini-telegram/internal/repository/redis"
+	"github.com/ambarg/mini-telegram/internal/service/user"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
 	cacheRepo *redis.CacheRepository
 	userRepo  domain.UserRepository
+	service   *user.Service
 }
 
-func NewUserHandler(cacheRepo *redis.CacheRepository, userRepo domain.UserRepository) *UserHandler {
+func NewUserHandler(cacheRepo *redis.CacheRepository, userRepo domain.UserRepository, service *user.Service) *UserHandler {
 	return &UserHandler{
 		cacheRepo: cacheRepo,
 		userRepo:  userRepo,
+		service:   service,
 	}
 }
 
+// PresenceBatchRequest is the request body for a batch presence lookup
+type PresenceBatchRequest struct {
+	UserIDs []int64 `json:"userIds" binding:"required,min=1,max=100"`
+}
+
 // GetUserPresence godoc
 // @Summary      Get user presence
-// @Description  Get online status and last seen timestamp for a user
+// @Description  Get online status and last seen timestamp for a user. Last seen is kept in the database once the live status expires. Users who blocked the caller always appear offline.
 // @Tags         users
 // @Produce      json
 // @Security     BearerAuth
 // @Param        id   path      int64  true  "User ID"
-// @Success      200  {object}  map[string]any
+// @Success      200  {object}  domain.Presence
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Router       /users/{id}/presence [get]
 func (h *UserHandler) GetUserPresence(c *gin.Context) {
 	targetUserID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -38,43 +50,197 @@ func (h *UserHandler) GetUserPresence(c *gin.Context) {
 		return
 	}
 
-	online, lastSeen, err := h.cacheRepo.GetPresence(c.Request.Context(), targetUserID)
+	userID, _ := auth.GetUserID(c)
+	presence, err := h.service.GetPresence(c.Request.Context(), userID, targetUserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, presence)
+}
+
+// GetPresenceBatch godoc
+// @Summary      Get presence for many users
+// @Description  Get online status and last seen timestamps for up to 100 users in one call
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body PresenceBatchRequest true "User IDs"
+// @Success      200  {object}  map[string]domain.Presence
+// @Failure      400  {object}  map[string]string
+// @Router       /users/presence [post]
+func (h *UserHandler) GetPresenceBatch(c *gin.Context) {
+	var req PresenceBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	presences, err := h.service.GetPresences(c.Request.Context(), userID, req.UserIDs)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, presences)
+}
+
+// BlockUser godoc
+// @Summary      Block user
+// @Description  Block a user: they can no longer start a direct chat with the caller, the caller stops receiving their messages and their presence hides the caller's
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "User ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /users/{id}/block [post]
+func (h *UserHandler) BlockUser(c *gin.Context) {
+	targetUserID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.BlockUser(c.Request.Context(), userID, targetUserID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnblockUser godoc
+// @Summary      Unblock user
+// @Description  Lift a block. Unblocking a user who isn't blocked succeeds.
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "User ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Router       /users/{id}/block [delete]
+func (h *UserHandler) UnblockUser(c *gin.Context) {
+	targetUserID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"online":   online,
-		"lastSeen": lastSeen,
-	})
+	userID, _ := auth.GetUserID(c)
+	if err := h.service.UnblockUser(c.Request.Context(), userID, targetUserID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListBlocks godoc
+// @Summary      List blocked users
+// @Description  List the users the caller has blocked, most recent first
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}   domain.Block
+// @Router       /users/blocks [get]
+func (h *UserHandler) ListBlocks(c *gin.Context) {
+	userID, _ := auth.GetUserID(c)
+	blocks, err := h.service.ListBlocks(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, blocks)
+}
+
+// UserSearchResponse is one page of user search results
+type UserSearchResponse struct {
+	Users   []domain.PublicProfile `json:"users"`
+	HasMore bool                   `json:"hasMore"`
+	// NextCursor is the afterId of the next page; omitted on the last page
+	NextCursor int64 `json:"nextCursor,omitempty"`
 }
 
 // SearchUsers godoc
 // @Summary      Search users
-// @Description  Search users by email or username
+// @Description  Search users by username prefix. Only public profile fields are returned; the caller and users blocked either way are left out.
 // @Tags         users
 // @Produce      json
 // @Security     BearerAuth
-// @Param        q    query     string  true  "Search Query"
-// @Success      200  {array}   domain.User
+// @Param        q        query     string  true   "Username prefix, at least 3 characters"
+// @Param        limit    query     int     false  "Page size (default 20, max 50)"
+// @Param        afterId  query     int64   false  "Only users after this ID, from a previous page's nextCursor"
+// @Success      200  {object}  UserSearchResponse
 // @Failure      400  {object}  map[string]string
 // @Router       /users [get]
 func (h *UserHandler) SearchUsers(c *gin.Context) {
-	query := c.Query("q")
-	if len(query) < 3 {
-		c.JSON(http.StatusOK, []domain.User{})
+	var limit int
+	if l := c.Query("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	var afterID int64
+	if a := c.Query("afterId"); a != "" {
+		parsed, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid afterId"})
+			return
+		}
+		afterID = parsed
+	}
+
+	userID, _ := auth.GetUserID(c)
+	users, hasMore, err := h.service.SearchUsers(c.Request.Context(), userID, c.Query("q"), limit, afterID)
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	// Default limit=20, offset=0 for now, or read from query params if needed
-	users, err := h.userRepo.SearchUsers(c.Request.Context(), query, 20, 0)
+	resp := UserSearchResponse{Users: users, HasMore: hasMore}
+	if hasMore {
+		resp.NextCursor = users[len(users)-1].ID
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetUserProfile godoc
+// @Summary      Get a user's public profile
+// @Description  Get another user's username, avatar and bio. Users who blocked the caller are not found.
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      int64  true  "User ID"
+// @Success      200  {object}  domain.PublicProfile
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /users/{id} [get]
+func (h *UserHandler) GetUserProfile(c *gin.Context) {
+	targetUserID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	userID, _ := auth.GetUserID(c)
+	profile, err := h.service.GetPublicProfile(c.Request.Context(), userID, targetUserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
 }
 
 // GetProfile godoc
@@ -93,9 +259,9 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByID(c.Request.Context(), userID.(int64))
+	user, err := h.getUser(c, userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -103,14 +269,20 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 }
 
 type UpdateProfileRequest struct {
-	Username  *string `json:"username"`
-	AvatarURL *string `json:"avatar_url"`
-	Bio       *string `json:"bio"`
+	Username     *string `json:"username" binding:"omitempty,max=50"`
+	AvatarURL    *string `json:"avatar_url"`
+	Bio          *string `json:"bio"`
+	ShowLastSeen *bool   `json:"show_last_seen"`
+	// Quiet hours for pushes; "" clears dnd_start/dnd_end
+	Timezone         *string `json:"timezone" binding:"omitempty,max=64"`
+	DNDStart         *string `json:"dnd_start"`
+	DNDEnd           *string `json:"dnd_end"`
+	DNDAllowMentions *bool   `json:"dnd_allow_mentions"`
 }
 
 // UpdateProfile godoc
 // @Summary      Update current user profile
-// @Description  Update the profile of the authenticated user (username, avatar, bio)
+// @Description  Update the profile of the authenticated user (username, avatar, bio, quiet hours)
 // @Tags         users
 // @Accept       json
 // @Produce      json
@@ -119,6 +291,7 @@ type UpdateProfileRequest struct {
 // @Success      200  {object}  domain.User
 // @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
 // @Router       /users/me [patch]
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	userID, exists := c.Get("uid")
@@ -129,14 +302,14 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 	var req UpdateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	// Get existing user
-	user, err := h.userRepo.GetByID(c.Request.Context(), userID.(int64))
+	user, err := h.getUser(c, userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -150,13 +323,68 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	if req.Bio != nil {
 		user.Bio = *req.Bio
 	}
+	if req.ShowLastSeen != nil {
+		user.ShowLastSeen = *req.ShowLastSeen
+	}
+	if req.Timezone != nil {
+		user.Timezone = *req.Timezone
+	}
+	if req.DNDStart != nil {
+		user.DNDStart = *req.DNDStart
+	}
+	if req.DNDEnd != nil {
+		user.DNDEnd = *req.DNDEnd
+	}
+	if req.DNDAllowMentions != nil {
+		user.DNDAllowMentions = *req.DNDAllowMentions
+	}
+	if err := user.ValidateQuietHours(); err != nil {
+		respondError(c, err)
+		return
+	}
 
 	// Save
 	if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = domain.ErrNotFound
+		}
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, user)
 }
 
+// DeactivateAccount godoc
+// @Summary      Deactivate current user account
+// @Description  Soft-delete the authenticated user's account. Logging in again within the grace window reactivates it.
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Success      204  "No Content"
+// @Failure      401  {object}  map[string]string
+// @Router       /users/me [delete]
+func (h *UserHandler) DeactivateAccount(c *gin.Context) {
+	userID, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.service.DeactivateAccount(c.Request.Context(), userID.(int64)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.SetCookie("refreshToken", "", -1, "/", "", true, true)
+	c.Status(http.StatusNoContent)
+}
+
+// getUser loads a user, translating a missing row into domain.ErrNotFound
+func (h *UserHandler) getUser(c *gin.Context, userID int64) (*domain.User, error) {
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	return user, err
+}
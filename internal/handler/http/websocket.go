@@ -3,6 +3,9 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"time"
 
@@ -11,10 +14,13 @@ import (
 	"github.com/ambarg/mini-telegram/internal/rabbitmq"
 	"github.com/ambarg/mini-telegram/internal/repository/redis"
 	"github.com/ambarg/mini-telegram/internal/service/chat"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
 	ws "github.com/ambarg/mini-telegram/internal/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WebSocketHandler struct {
@@ -24,26 +30,62 @@ type WebSocketHandler struct {
 	cacheRepo *redis.CacheRepository
 	rmqClient *rabbitmq.Client
 	queueName string // Gateway's delivery queue name
+	upgrader  websocket.Upgrader
+
+	compressThreshold int // -1 when compression is disabled
+	maxMessageSize    int64
+	messageRateLimit  int // messages per minute per user, 0 disables
+	heartbeat         HeartbeatConfig
+}
+
+// HeartbeatConfig controls the Redis presence and connection registry entries
+// of client connections. They expire after TTL unless refreshed, which open
+// connections do every Interval, so Interval must be shorter than TTL.
+type HeartbeatConfig struct {
+	PodID    string // recorded as the gateway holding the connection
+	TTL      time.Duration
+	Interval time.Duration
+}
+
+// CompressionConfig controls permessage-deflate on client connections
+type CompressionConfig struct {
+	Enabled bool
+	// Threshold is the smallest outgoing frame, in bytes, worth compressing
+	Threshold int
 }
 
-func NewWebSocketHandler(hub *ws.Hub, chatSvc *chat.Service, authSvc *auth.Service, cacheRepo *redis.CacheRepository, rmqClient *rabbitmq.Client, queueName string) *WebSocketHandler {
-	return &WebSocketHandler{
+func NewWebSocketHandler(hub *ws.Hub, chatSvc *chat.Service, authSvc *auth.Service, cacheRepo *redis.CacheRepository, rmqClient *rabbitmq.Client, queueName string, compression CompressionConfig, maxMessageSize int64, messageRateLimit int, heartbeat HeartbeatConfig) *WebSocketHandler {
+	h := &WebSocketHandler{
 		hub:       hub,
 		chatSvc:   chatSvc,
 		authSvc:   authSvc,
 		cacheRepo: cacheRepo,
 		rmqClient: rmqClient,
 		queueName: queueName,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			EnableCompression: compression.Enabled,
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		compressThreshold: -1,
+		maxMessageSize:    maxMessageSize,
+		messageRateLimit:  messageRateLimit,
+		heartbeat:         heartbeat,
 	}
+	if compression.Enabled {
+		h.compressThreshold = compression.Threshold
+	}
+	return h
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
+// tracer starts the trace of each message sent over a WebSocket
+var tracer = otel.Tracer("github.com/ambarg/mini-telegram/internal/handler/http")
+
+// pingMinInterval is the minimum spacing between answered application pings
+const pingMinInterval = time.Second
 
 func (h *WebSocketHandler) HandleWS(c *gin.Context) {
 	// 1. Authenticate
@@ -62,20 +104,14 @@ func (h *WebSocketHandler) HandleWS(c *gin.Context) {
 		return
 	}
 
-	claims, err := h.authSvc.ValidateToken(token)
+	_, userID, err := h.authSvc.Authenticate(c.Request.Context(), token)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 		return
 	}
 
-	userID, err := auth.ExtractUserID(claims)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token subject"})
-		return
-	}
-
 	// 2. Upgrade connection
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to upgrade websocket")
 		return
@@ -88,7 +124,9 @@ func (h *WebSocketHandler) HandleWS(c *gin.Context) {
 		device = "web"
 	}
 
-	wsHandler := ws.NewHandler(conn, userID, device, log.Logger)
+	wsHandler := ws.NewHandler(conn, userID, device, *telemetry.Logger(c.Request.Context()))
+	wsHandler.SetCompressionThreshold(h.compressThreshold)
+	wsHandler.SetReadLimit(h.maxMessageSize)
 	h.hub.Register(wsHandler)
 
 	// 4. Subscribe to user's chats
@@ -102,54 +140,266 @@ func (h *WebSocketHandler) HandleWS(c *gin.Context) {
 			if err := h.rmqClient.BindDeliveryQueue(h.queueName, chat.ID); err != nil {
 				log.Error().Err(err).Int64("chat_id", chat.ID).Msg("failed to bind delivery queue")
 			}
-			
-			// Broadcast Online Status
-			if err := h.rmqClient.PublishUserStatus(ctx, chat.ID, userID, "online"); err != nil {
-				log.Error().Err(err).Int64("chat_id", chat.ID).Msg("failed to publish online status")
-			}
 		}
 	}
 
-	// Set Online in Redis
-	if err := h.cacheRepo.SetPresence(ctx, userID, true, 5*time.Minute); err != nil {
-		log.Error().Err(err).Msg("failed to set presence")
+	// Broadcast Online Status to every gateway
+	if err := h.chatSvc.PublishPresence(ctx, userID, true); err != nil {
+		log.Error().Err(err).Msg("failed to publish online status")
+	}
+
+	// Set Online in Redis and keep it fresh while the connection lasts
+	h.refreshConnection(ctx, wsHandler)
+
+	// Frames outlive the upgrade request, so keep only its correlation ID
+	connCtx := context.Background()
+	if id := telemetry.RequestIDFromContext(ctx); id != "" {
+		connCtx = telemetry.WithRequestID(connCtx, id)
 	}
 
 	// 5. Start Pumps
 	go wsHandler.WritePump(50 * time.Second)
+	go h.runHeartbeat(connCtx, wsHandler)
 	go func() {
 		wsHandler.ReadPump(func(msg []byte) error {
-			return h.handleMessage(userID, msg)
+			if err := h.handleMessage(connCtx, wsHandler, msg); err != nil {
+				h.sendError(wsHandler, msg, err)
+				return err
+			}
+			return nil
 		})
 		
 		// Cleanup on disconnect
-		disconnectCtx := context.Background()
-		h.hub.Unregister(userID, device)
+		disconnectCtx := connCtx
 		
 		// Set Offline in Redis
 		if err := h.cacheRepo.SetPresence(disconnectCtx, userID, false, 0); err != nil {
 			log.Error().Err(err).Msg("failed to set presence offline")
 		}
+		if err := h.cacheRepo.UnregisterConnection(disconnectCtx, userID, device); err != nil {
+			log.Error().Err(err).Msg("failed to unregister connection")
+		}
 
 		// Broadcast Offline Status
-		// We need to fetch chats again or cache them. Fetching is safer.
-		userChats, err := h.chatSvc.GetUserChats(disconnectCtx, userID)
-		if err == nil {
-			for _, chat := range userChats {
-				if err := h.rmqClient.PublishUserStatus(disconnectCtx, chat.ID, userID, "offline"); err != nil {
-					log.Error().Err(err).Int64("chat_id", chat.ID).Msg("failed to publish offline status")
-				}
-			}
+		if err := h.chatSvc.PublishPresence(disconnectCtx, userID, false); err != nil {
+			log.Error().Err(err).Msg("failed to publish offline status")
 		}
+
+		// Unregister last: a draining hub waits for this, so the offline
+		// status is out before the gateway exits
+		h.hub.Unregister(wsHandler)
 	}()
 }
 	
 
 
-func (h *WebSocketHandler) handleMessage(userID int64, payload []byte) error {
+// runHeartbeat refreshes the connection's presence and registry entries until
+// it closes, so a long-lived socket isn't reported offline when they expire
+func (h *WebSocketHandler) runHeartbeat(ctx context.Context, conn *ws.Handler) {
+	ticker := time.NewTicker(h.heartbeat.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-ticker.C:
+			h.refreshConnection(ctx, conn)
+		}
+	}
+}
+
+// refreshConnection marks the connection's user online and records the
+// connection in Redis, both for another TTL
+func (h *WebSocketHandler) refreshConnection(ctx context.Context, conn *ws.Handler) {
+	// Don't resurrect a connection whose disconnect cleanup has started
+	if conn.Context().Err() != nil {
+		return
+	}
+	if err := h.cacheRepo.SetPresence(ctx, conn.UserID(), true, h.heartbeat.TTL); err != nil {
+		log.Error().Err(err).Msg("failed to set presence")
+	}
+	if err := h.cacheRepo.RegisterConnection(ctx, conn.UserID(), conn.Device(), h.heartbeat.PodID, h.heartbeat.TTL); err != nil {
+		log.Error().Err(err).Msg("failed to register connection")
+	}
+}
+
+// WebSocket error codes sent to clients in "Error" frames
+const (
+	wsErrInvalidPayload   = "invalid_payload"
+	wsErrUnknownType      = "unknown_type"
+	wsErrNotMember        = "not_member"
+	wsErrForbidden        = "permission_denied"
+	wsErrRateLimited      = "rate_limited"
+	wsErrSlowMode         = "slow_mode"
+	wsErrValidationFailed = "validation_failed"
+	wsErrNotFound         = "not_found"
+	wsErrInternal         = "internal_error"
+)
+
+// wsError is a client-facing failure for an inbound WebSocket frame
+type wsError struct {
+	code    string
+	message string
+}
+
+func (e *wsError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func newWSError(code, message string) error {
+	return &wsError{code: code, message: message}
+}
+
+// sendError reports a failed frame back to the connection that sent it,
+// echoing its uuid/seq so the client can correlate the rejection
+func (h *WebSocketHandler) sendError(conn *ws.Handler, payload []byte, err error) {
+	var ref struct {
+		UUID string `json:"uuid"`
+		Seq  any    `json:"seq"`
+	}
+	_ = json.Unmarshal(payload, &ref)
+
+	code, message := wsErrInternal, "internal error"
+	var retryAfter time.Duration
+	var wsErr *wsError
+	var slowErr *domain.SlowModeError
+	var rateErr *domain.RateLimitError
+	switch {
+	case errors.As(err, &wsErr):
+		code, message = wsErr.code, wsErr.message
+	case errors.As(err, &slowErr):
+		code, message, retryAfter = wsErrSlowMode, err.Error(), slowErr.RetryAfter
+	case errors.As(err, &rateErr):
+		code, message, retryAfter = wsErrRateLimited, err.Error(), rateErr.RetryAfter
+	case errors.Is(err, domain.ErrNotFound):
+		code, message = wsErrNotFound, err.Error()
+	case errors.Is(err, domain.ErrInvalidInput):
+		code, message = wsErrValidationFailed, err.Error()
+	case errors.Is(err, domain.ErrPermissionDenied):
+		code, message = wsErrForbidden, err.Error()
+	}
+
+	frame := map[string]any{
+		"type":    "Error",
+		"code":    code,
+		"message": message,
+		"uuid":    ref.UUID,
+	}
+	if ref.Seq != nil {
+		frame["seq"] = ref.Seq
+	}
+	if retryAfter > 0 {
+		// Whole seconds, rounded up like the HTTP Retry-After header
+		frame["retryAfter"] = int(math.Ceil(retryAfter.Seconds()))
+	}
+	if err := conn.SendJSON(frame); err != nil {
+		log.Warn().Err(err).Int64("user_id", conn.UserID()).Msg("failed to send websocket error frame")
+	}
+}
+
+// takeMessageToken charges a sent message against userID's per-minute budget,
+// which is shared by all of the user's connections across gateway pods
+func (h *WebSocketHandler) takeMessageToken(ctx context.Context, userID int64) error {
+	if h.messageRateLimit <= 0 {
+		return nil
+	}
+	allowed, retryAfter, err := h.cacheRepo.TakeToken(ctx, fmt.Sprintf("msg:%d", userID), h.messageRateLimit, time.Minute)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &domain.RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Sync limits: how many chats one request may cover, and how many catch-up
+// pages are streamed per chat before the client has to continue with CatchUp.
+// Together they keep a Sync well within the connection's send buffer.
+const (
+	maxSyncChats        = 50
+	maxSyncPagesPerChat = 2
+)
+
+// handleSync backfills what a reconnecting client missed in several chats at
+// once. Each chat is subscribed before its history is read, so messages sent
+// in between arrive live rather than being lost; clients dedupe by message ID.
+// Every chat gets Sync frames shaped like CatchUp responses, and a final
+// SyncDone lists the chats skipped because the user is no longer a member.
+func (h *WebSocketHandler) handleSync(ctx context.Context, conn *ws.Handler, payload []byte, uuid any) error {
+	userID := conn.UserID()
+
+	var req struct {
+		Chats []struct {
+			ChatID        int64 `json:"chatId"`
+			LastSeenMsgID int64 `json:"lastSeenMsgId"`
+		} `json:"chats"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return newWSError(wsErrInvalidPayload, "chats must be a list of {chatId, lastSeenMsgId}")
+	}
+	if len(req.Chats) == 0 || len(req.Chats) > maxSyncChats {
+		return newWSError(wsErrValidationFailed, fmt.Sprintf("chats must list between 1 and %d chats", maxSyncChats))
+	}
+
+	skipped := []int64{}
+	for _, c := range req.Chats {
+		if c.ChatID <= 0 || c.LastSeenMsgID < 0 {
+			return newWSError(wsErrValidationFailed, "chatId must be positive and lastSeenMsgId not negative")
+		}
+
+		isMember, err := h.chatSvc.IsMember(ctx, c.ChatID, userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			skipped = append(skipped, c.ChatID)
+			continue
+		}
+		h.hub.Subscribe(userID, c.ChatID)
+		if err := h.rmqClient.BindDeliveryQueue(h.queueName, c.ChatID); err != nil {
+			return err
+		}
+
+		afterID := c.LastSeenMsgID
+		for page := 0; page < maxSyncPagesPerChat; page++ {
+			messages, hasMore, err := h.chatSvc.CatchUp(ctx, c.ChatID, userID, afterID)
+			if err != nil {
+				return err
+			}
+			if len(messages) > 0 {
+				afterID = messages[len(messages)-1].ID
+			}
+			if err := conn.SendJSON(map[string]any{
+				"type":        "Sync",
+				"chatId":      c.ChatID,
+				"messages":    messages,
+				"hasMore":     hasMore,
+				"nextAfterId": afterID,
+				"uuid":        uuid,
+			}); err != nil {
+				return err
+			}
+			if !hasMore {
+				break
+			}
+		}
+	}
+
+	return conn.SendJSON(map[string]any{
+		"type":    "SyncDone",
+		"skipped": skipped,
+		"uuid":    uuid,
+	})
+}
+
+func (h *WebSocketHandler) handleMessage(ctx context.Context, conn *ws.Handler, payload []byte) error {
+	userID := conn.UserID()
+
 	var msg map[string]any
 	if err := json.Unmarshal(payload, &msg); err != nil {
-		return err
+		return newWSError(wsErrInvalidPayload, "malformed JSON")
 	}
 
 	// Inject UserID if missing
@@ -161,22 +411,60 @@ func (h *WebSocketHandler) handleMessage(userID int64, payload []byte) error {
 	}
 
 	msgType, _ := msg["type"].(string)
-	ctx := context.Background()
 
 	switch msgType {
 	case "SendMessage":
+		// Each message gets its own trace, linked to the connection's request
+		ctx, span := tracer.Start(ctx, "ws.SendMessage", trace.WithNewRoot(), trace.WithLinks(trace.LinkFromContext(ctx)))
+		defer span.End()
+
 		chatID, _ := msg["chatId"].(float64)
 		body, _ := msg["body"].(string)
 		uuid, _ := msg["uuid"].(string)
+		replySnippet, _ := msg["replySnippet"].(string)
+		if chatID <= 0 || body == "" {
+			return newWSError(wsErrValidationFailed, "chatId and body are required")
+		}
+		if err := h.takeMessageToken(ctx, userID); err != nil {
+			return err
+		}
+
+		isMember, err := h.chatSvc.IsMember(ctx, int64(chatID), userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return newWSError(wsErrNotMember, "not a member of this chat")
+		}
 
 		domainMsg := &domain.Message{
-			ChatID:    int64(chatID),
-			UserID:    userID,
-			Body:      body,
-			CreatedAt: time.Now(),
+			ChatID:       int64(chatID),
+			UserID:       userID,
+			Body:         body,
+			ReplySnippet: replySnippet,
+			CreatedAt:    time.Now(),
+			OriginDevice: conn.Device(),
+		}
+		if replyTo, ok := msg["replyToId"].(float64); ok && replyTo > 0 {
+			replyToID := int64(replyTo)
+			domainMsg.ReplyToID = &replyToID
+		}
+
+		if err := h.chatSvc.ProcessMessage(ctx, domainMsg); err != nil {
+			return err
 		}
+		messagesSent.Inc()
 
-		return h.chatSvc.ProcessMessage(ctx, domainMsg, uuid)
+		// Only the sending connection learns which ID its message was given
+		if uuid == "" {
+			return nil
+		}
+		return conn.SendJSON(map[string]any{
+			"type":   "Delivered",
+			"uuid":   uuid,
+			"chatId": domainMsg.ChatID,
+			"msgId":  domainMsg.ID,
+		})
 
 	case "Subscribe":
 		chatID, _ := msg["chatId"].(float64)
@@ -184,22 +472,135 @@ func (h *WebSocketHandler) handleMessage(userID int64, payload []byte) error {
 
 		// Verify membership
 		isMember, err := h.chatSvc.IsMember(ctx, cID, userID)
-		if err != nil || !isMember {
-			return nil // Ignore or return error
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return newWSError(wsErrNotMember, "not a member of this chat")
 		}
 
 		h.hub.Subscribe(userID, cID)
 		return h.rmqClient.BindDeliveryQueue(h.queueName, cID)
 
-	case "Typing":
+	case "CatchUp":
+		// Resends what a client missed after detecting a gap; clients page with nextAfterId while hasMore is set
+		chatID, _ := msg["chatId"].(float64)
+		afterID, _ := msg["afterId"].(float64)
+		if chatID <= 0 {
+			return newWSError(wsErrValidationFailed, "chatId is required")
+		}
+
+		isMember, err := h.chatSvc.IsMember(ctx, int64(chatID), userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return newWSError(wsErrNotMember, "not a member of this chat")
+		}
+
+		messages, hasMore, err := h.chatSvc.CatchUp(ctx, int64(chatID), userID, int64(afterID))
+		if err != nil {
+			return err
+		}
+		nextAfterID := int64(afterID)
+		if len(messages) > 0 {
+			nextAfterID = messages[len(messages)-1].ID
+		}
+		return conn.SendJSON(map[string]any{
+			"type":        "CatchUp",
+			"chatId":      int64(chatID),
+			"messages":    messages,
+			"hasMore":     hasMore,
+			"nextAfterId": nextAfterID,
+			"uuid":        msg["uuid"],
+		})
+
+	case "Sync":
+		return h.handleSync(ctx, conn, payload, msg["uuid"])
+
+	case "Typing", "StopTyping":
 		chatID, _ := msg["chatId"].(float64)
+		if chatID <= 0 {
+			return newWSError(wsErrValidationFailed, "chatId is required")
+		}
+
+		// Typing is frequent, so membership comes from the cached member set
+		isMember, err := h.chatSvc.IsMemberCached(ctx, int64(chatID), userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return newWSError(wsErrNotMember, "not a member of this chat")
+		}
+
+		event := map[string]any{
+			"type":   msgType,
+			"chatId": int64(chatID),
+			"userId": userID,
+		}
+		if msgType == "Typing" {
+			// Clients clear the indicator at stopAt unless another Typing renews it
+			name, err := h.chatSvc.DisplayName(ctx, userID)
+			if err != nil {
+				return err
+			}
+			event["name"] = name
+			event["stopAt"] = time.Now().Add(chat.TypingTimeout)
+		}
+		typingPayload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
 		// Publish typing event
-		return h.rmqClient.PublishTypingEvent(ctx, int64(chatID), newPayload)
+		return h.rmqClient.PublishTypingEvent(ctx, int64(chatID), typingPayload)
+
+	case "GetChatPresence":
+		// Online members for a group header's "N online", in place of per-member presence polling
+		chatID, _ := msg["chatId"].(float64)
+		if chatID <= 0 {
+			return newWSError(wsErrValidationFailed, "chatId is required")
+		}
+
+		isMember, err := h.chatSvc.IsMemberCached(ctx, int64(chatID), userID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			return newWSError(wsErrNotMember, "not a member of this chat")
+		}
+
+		online, err := h.chatSvc.OnlineMembers(ctx, int64(chatID), userID)
+		if err != nil {
+			return err
+		}
+		return conn.SendJSON(map[string]any{
+			"type":   "ChatPresence",
+			"chatId": int64(chatID),
+			"online": online,
+		})
 
 	case "Read":
 		// Publish read receipt
 		return h.rmqClient.PublishReadReceipt(ctx, newPayload)
-	}
 
-	return nil
+	case "DeliveryReceipt":
+		// A message reached this device; the presence service records it
+		return h.rmqClient.PublishDeliveredReceipt(ctx, newPayload)
+
+	case "Ping":
+		// Answered locally; excess pings are rejected rather than queued
+		if !conn.AllowPing(pingMinInterval) {
+			return newWSError(wsErrRateLimited, "ping rate exceeded")
+		}
+		return conn.SendJSON(map[string]any{
+			"type":     "Pong",
+			"clientTs": msg["ts"],
+			"serverTs": time.Now().UnixMilli(),
+			"rttMs":    conn.RTT().Milliseconds(),
+		})
+
+	default:
+		return newWSError(wsErrUnknownType, "unknown message type: "+msgType)
+	}
 }
@@ -2,16 +2,65 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
 )
 
-// Client wraps RabbitMQ connection and channel
+const (
+	reconnectBackoff    = 500 * time.Millisecond
+	reconnectBackoffMax = 30 * time.Second
+
+	sharedChatQueue    = "chat.messages"
+	deadLetterExchange = "chat.dlx"
+	deadLetterQueue    = "chat.messages.dead"
+
+	// Not "delivery.*", which names the per-gateway delivery queues
+	deliveredReceiptQueue = "delivered.receipts"
+)
+
+// ErrNotConnected is returned while the client is reconnecting to the broker
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+// Client wraps RabbitMQ connection and channel. When the broker drops the
+// connection it re-dials in the background, re-declares what was declared
+// through it and resumes its consumers.
 type Client struct {
+	url     string
+	healthy atomic.Bool
+	done    chan struct{}
+
+	mu      sync.RWMutex // guards conn and channel, swapped on reconnect
 	conn    *amqp.Connection
 	channel *amqp.Channel
+
+	topologyMu sync.Mutex
+	topology   []declaration // replayed in order after a reconnect
+	declared   map[string]bool
+	consumers  []*consumer
+}
+
+// declaration is an idempotent exchange, queue or binding setup step
+type declaration struct {
+	key string
+	fn  func(ch *amqp.Channel) error
+}
+
+// consumer forwards deliveries into out across reconnects, so callers can
+// keep ranging over the channel they got from a Consume method
+type consumer struct {
+	queue     string
+	tag       string
+	exclusive bool
+	out       chan amqp.Delivery
+
+	mu     sync.Mutex // held by the goroutine currently forwarding
+	closed bool
 }
 
 // Config holds RabbitMQ configuration
@@ -21,32 +70,59 @@ type Config struct {
 
 // New creates a new RabbitMQ client
 func New(cfg Config) (*Client, error) {
-	conn, err := amqp.Dial(cfg.URL)
+	conn, channel, err := dial(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		url:      cfg.URL,
+		done:     make(chan struct{}),
+		conn:     conn,
+		channel:  channel,
+		declared: make(map[string]bool),
+	}
+	c.healthy.Store(true)
+	go c.watch(conn, channel)
+
+	return c, nil
+}
+
+// dial opens a connection and a channel with the client's QoS applied
+func dial(url string) (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
 	}
 
 	channel, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %w", err)
+		return nil, nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
 	// Set prefetch count for fair dispatch
 	if err := channel.Qos(20, 0, false); err != nil {
 		channel.Close()
 		conn.Close()
-		return nil, fmt.Errorf("failed to set QoS: %w", err)
+		return nil, nil, fmt.Errorf("failed to set QoS: %w", err)
 	}
 
-	return &Client{
-		conn:    conn,
-		channel: channel,
-	}, nil
+	return conn, channel, nil
 }
 
 // Close closes the RabbitMQ connection
 func (c *Client) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+		close(c.done)
+	}
+	c.healthy.Store(false)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.channel != nil {
 		c.channel.Close()
 	}
@@ -56,10 +132,230 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Healthy reports whether the client currently holds an open broker connection
+func (c *Client) Healthy() bool {
+	return c.healthy.Load()
+}
+
+// currentChannel returns the open channel, or ErrNotConnected mid-reconnect
+func (c *Client) currentChannel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.channel == nil || c.channel.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return c.channel, nil
+}
+
+// watch waits for the connection or channel to close and reconnects,
+// until Close is called
+func (c *Client) watch(conn *amqp.Connection, channel *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chanClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-c.done:
+			return
+		case reason = <-connClosed:
+		case reason = <-chanClosed:
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		c.healthy.Store(false)
+		log.Warn().Interface("reason", reason).Msg("RabbitMQ connection lost, reconnecting")
+		conn.Close() // a dead channel on a live connection is replaced with a fresh connection too
+
+		var ok bool
+		if conn, channel, ok = c.reconnect(); !ok {
+			return
+		}
+	}
+}
+
+// reconnect re-dials with exponential backoff, replays the declared topology
+// and resumes consumers. It gives up only when the client is closed.
+func (c *Client) reconnect() (*amqp.Connection, *amqp.Channel, bool) {
+	for attempt := 1; ; attempt++ {
+		delay := RetryBackoff(attempt, reconnectBackoff, reconnectBackoffMax)
+		select {
+		case <-c.done:
+			return nil, nil, false
+		case <-time.After(delay):
+		}
+
+		conn, channel, err := dial(c.url)
+		if err == nil {
+			err = c.restore(channel)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			log.Error().Err(err).Int("attempt", attempt).Msg("RabbitMQ reconnect failed")
+			continue
+		}
+
+		c.mu.Lock()
+		select {
+		case <-c.done:
+			// Closed while dialing; don't leak the new connection
+			c.mu.Unlock()
+			conn.Close()
+			return nil, nil, false
+		default:
+		}
+		c.conn, c.channel = conn, channel
+		c.mu.Unlock()
+
+		c.healthy.Store(true)
+		log.Info().Int("attempt", attempt).Msg("RabbitMQ reconnected")
+		return conn, channel, true
+	}
+}
+
+// restore re-declares the recorded topology on channel and restarts consumers
+func (c *Client) restore(channel *amqp.Channel) error {
+	c.topologyMu.Lock()
+	defer c.topologyMu.Unlock()
+
+	for _, d := range c.topology {
+		if err := d.fn(channel); err != nil {
+			return err
+		}
+	}
+
+	for _, cons := range c.consumers {
+		msgs, err := channel.Consume(cons.queue, cons.tag, false, cons.exclusive, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("failed to resume consumer %s: %w", cons.tag, err)
+		}
+		go c.forward(cons, msgs)
+	}
+	return nil
+}
+
+// declare runs fn on the current channel and records it for replay after a
+// reconnect. Steps are recorded once per key.
+func (c *Client) declare(key string, fn func(ch *amqp.Channel) error) error {
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+	if err := fn(ch); err != nil {
+		return err
+	}
+
+	c.topologyMu.Lock()
+	defer c.topologyMu.Unlock()
+	if !c.declared[key] {
+		c.declared[key] = true
+		c.topology = append(c.topology, declaration{key: key, fn: fn})
+	}
+	return nil
+}
+
+// consume starts a manually acked consumer that survives reconnects
+func (c *Client) consume(queue, tag string, exclusive bool) (<-chan amqp.Delivery, error) {
+	c.topologyMu.Lock()
+	defer c.topologyMu.Unlock()
+
+	ch, err := c.currentChannel()
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := ch.Consume(
+		queue,     // queue
+		tag,       // consumer tag
+		false,     // auto-ack (we'll manually ack for reliability)
+		exclusive, // exclusive
+		false,     // no-local
+		false,     // no-wait
+		nil,       // args
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cons := &consumer{queue: queue, tag: tag, exclusive: exclusive, out: make(chan amqp.Delivery)}
+	c.consumers = append(c.consumers, cons)
+	go c.forward(cons, msgs)
+
+	return cons.out, nil
+}
+
+// forward copies deliveries from one channel's consumer into cons.out until
+// that channel closes. Once the client is closed it closes cons.out so
+// callers' range loops end as they did before reconnects existed.
+func (c *Client) forward(cons *consumer, msgs <-chan amqp.Delivery) {
+	cons.mu.Lock()
+	defer cons.mu.Unlock()
+
+	for d := range msgs {
+		if !cons.closed {
+			cons.out <- d
+		}
+	}
+
+	select {
+	case <-c.done:
+		if !cons.closed {
+			cons.closed = true
+			close(cons.out)
+		}
+	default:
+	}
+}
+
+// CancelConsumer stops the consumer with tag, which is then not resumed after
+// a reconnect, and closes its delivery channel once the deliveries already
+// received have been handed over, ending the caller's range loop
+func (c *Client) CancelConsumer(tag string) error {
+	c.topologyMu.Lock()
+	var cons *consumer
+	for i, cn := range c.consumers {
+		if cn.tag == tag {
+			cons = cn
+			c.consumers = append(c.consumers[:i], c.consumers[i+1:]...)
+			break
+		}
+	}
+	c.topologyMu.Unlock()
+	if cons == nil {
+		return fmt.Errorf("rabbitmq: no consumer %q", tag)
+	}
+
+	// While reconnecting no channel is forwarding to cons, so there is nothing to cancel
+	if ch, err := c.currentChannel(); err == nil {
+		if err := ch.Cancel(tag, false); err != nil {
+			return fmt.Errorf("failed to cancel consumer %s: %w", tag, err)
+		}
+	}
+
+	// forward holds the lock until the cancelled deliveries channel drains
+	cons.mu.Lock()
+	defer cons.mu.Unlock()
+	if !cons.closed {
+		cons.closed = true
+		close(cons.out)
+	}
+	return nil
+}
+
 // DeclareExchanges declares the required exchanges
 func (c *Client) DeclareExchanges() error {
+	return c.declare("exchanges", declareExchanges)
+}
+
+func declareExchanges(ch *amqp.Channel) error {
 	// Declare chat.topic exchange
-	if err := c.channel.ExchangeDeclare(
+	if err := ch.ExchangeDeclare(
 		"chat.topic",    // name
 		"topic",         // type
 		true,            // durable
@@ -72,7 +368,7 @@ func (c *Client) DeclareExchanges() error {
 	}
 
 	// Declare delivery.topic exchange
-	if err := c.channel.ExchangeDeclare(
+	if err := ch.ExchangeDeclare(
 		"delivery.topic", // name
 		"topic",          // type
 		true,             // durable
@@ -85,7 +381,7 @@ func (c *Client) DeclareExchanges() error {
 	}
 
 	// Declare presence.fanout exchange for broadcasting presence updates
-	if err := c.channel.ExchangeDeclare(
+	if err := ch.ExchangeDeclare(
 		"presence.fanout", // name
 		"fanout",          // type - fanout broadcasts to all bound queues
 		true,              // durable
@@ -103,16 +399,23 @@ func (c *Client) DeclareExchanges() error {
 // DeclareSharedChatQueue declares a single shared queue for all chat messages
 // This follows best practices for scalable message processing systems
 func (c *Client) DeclareSharedChatQueue() error {
-	queueName := "chat.messages"
+	return c.declare("queue:chat.messages", declareSharedChatQueue)
+}
 
-	// Declare queue with lazy mode and TTL
+func declareSharedChatQueue(ch *amqp.Channel) error {
+	queueName := sharedChatQueue
+
+	// Declare queue with lazy mode and TTL. Rejected messages go to the
+	// dead-letter exchange; RabbitMQ refuses to change the arguments of an
+	// existing queue, so an older chat.messages must be deleted first.
 	args := amqp.Table{
-		"x-queue-mode":   "lazy",
-		"x-message-ttl":  86400000, // 24 hours in milliseconds
-		"x-max-priority": 3,        // Support message priorities
+		"x-queue-mode":           "lazy",
+		"x-message-ttl":          86400000, // 24 hours in milliseconds
+		"x-max-priority":         3,        // Support message priorities
+		"x-dead-letter-exchange": deadLetterExchange,
 	}
 
-	_, err := c.channel.QueueDeclare(
+	_, err := ch.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // delete when unused
@@ -125,7 +428,7 @@ func (c *Client) DeclareSharedChatQueue() error {
 	}
 
 	// Bind queue to exchange with wildcard routing key to capture all chat messages
-	if err := c.channel.QueueBind(
+	if err := ch.QueueBind(
 		queueName,    // queue name
 		"*",          // routing key (wildcard to match all chat IDs)
 		"chat.topic", // exchange
@@ -140,11 +443,70 @@ func (c *Client) DeclareSharedChatQueue() error {
 
 
 
+// DeclareDeadLetterQueue declares the exchange chat messages are dead-lettered
+// to and the queue that keeps them
+func (c *Client) DeclareDeadLetterQueue() error {
+	return c.declare("queue:"+deadLetterQueue, declareDeadLetterQueue)
+}
+
+func declareDeadLetterQueue(ch *amqp.Channel) error {
+	// Fanout, so dead messages arrive whatever routing key they were published with
+	if err := ch.ExchangeDeclare(
+		deadLetterExchange, // name
+		"fanout",           // type
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare %s exchange: %w", deadLetterExchange, err)
+	}
+
+	if _, err := ch.QueueDeclare(
+		deadLetterQueue, // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare dead letter queue: %w", err)
+	}
+
+	if err := ch.QueueBind(
+		deadLetterQueue,    // queue name
+		"",                 // routing key (ignored for fanout)
+		deadLetterExchange, // exchange
+		false,              // no-wait
+		nil,                // arguments
+	); err != nil {
+		return fmt.Errorf("failed to bind dead letter queue: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeDeadLetterQueue starts consuming dead-lettered chat messages
+func (c *Client) ConsumeDeadLetterQueue(consumerTag string) (<-chan amqp.Delivery, error) {
+	msgs, err := c.consume(deadLetterQueue, consumerTag, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume dead letter queue: %w", err)
+	}
+
+	return msgs, nil
+}
+
 // PublishToDeliveryExchange publishes a delivery event
 func (c *Client) PublishToDeliveryExchange(ctx context.Context, chatID int64, body []byte) error {
 	routingKey := fmt.Sprintf("%d", chatID)
 
-	err := c.channel.PublishWithContext(
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
 		ctx,
 		"delivery.topic", // exchange
 		routingKey,       // routing key
@@ -155,6 +517,7 @@ func (c *Client) PublishToDeliveryExchange(ctx context.Context, chatID int64, bo
 			Body:         body,
 			DeliveryMode: amqp.Persistent,
 			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
 		},
 	)
 	if err != nil {
@@ -167,17 +530,9 @@ func (c *Client) PublishToDeliveryExchange(ctx context.Context, chatID int64, bo
 // ConsumeSharedChatQueue starts consuming from the shared chat messages queue
 // This is the recommended approach for scalable message processing
 func (c *Client) ConsumeSharedChatQueue(consumerTag string) (<-chan amqp.Delivery, error) {
-	queueName := "chat.messages"
-
-	msgs, err := c.channel.Consume(
-		queueName,   // queue
-		consumerTag, // consumer tag
-		false,       // auto-ack (we'll manually ack for reliability)
-		false,       // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
+	queueName := sharedChatQueue
+
+	msgs, err := c.consume(queueName, consumerTag, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start consuming from shared queue: %w", err)
 	}
@@ -187,10 +542,14 @@ func (c *Client) ConsumeSharedChatQueue(consumerTag string) (<-chan amqp.Deliver
 
 // DeclarePresenceQueue declares a shared queue for presence events
 func (c *Client) DeclarePresenceQueue() error {
+	return c.declare("queue:presence.events", declarePresenceQueue)
+}
+
+func declarePresenceQueue(ch *amqp.Channel) error {
 	queueName := "presence.events"
 
 	// Declare queue
-	_, err := c.channel.QueueDeclare(
+	_, err := ch.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // delete when unused
@@ -207,10 +566,14 @@ func (c *Client) DeclarePresenceQueue() error {
 
 // DeclareReadReceiptQueue declares a shared queue for read receipts
 func (c *Client) DeclareReadReceiptQueue() error {
+	return c.declare("queue:read.receipts", declareReadReceiptQueue)
+}
+
+func declareReadReceiptQueue(ch *amqp.Channel) error {
 	queueName := "read.receipts"
 
 	// Declare queue for batching read receipts
-	_, err := c.channel.QueueDeclare(
+	_, err := ch.QueueDeclare(
 		queueName, // name
 		true,      // durable
 		false,     // delete when unused
@@ -225,9 +588,35 @@ func (c *Client) DeclareReadReceiptQueue() error {
 	return nil
 }
 
+// DeclareDeliveredReceiptQueue declares a shared queue for delivered receipts
+func (c *Client) DeclareDeliveredReceiptQueue() error {
+	return c.declare("queue:"+deliveredReceiptQueue, declareDeliveredReceiptQueue)
+}
+
+func declareDeliveredReceiptQueue(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		deliveredReceiptQueue, // name
+		true,                  // durable
+		false,                 // delete when unused
+		false,                 // exclusive
+		false,                 // no-wait
+		nil,                   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare delivered receipt queue: %w", err)
+	}
+
+	return nil
+}
+
 // PublishPresenceEvent publishes a presence update
 func (c *Client) PublishPresenceEvent(ctx context.Context, body []byte) error {
-	err := c.channel.PublishWithContext(
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
 		ctx,
 		"presence.fanout", // exchange
 		"",                // routing key (ignored for fanout)
@@ -238,6 +627,7 @@ func (c *Client) PublishPresenceEvent(ctx context.Context, body []byte) error {
 			Body:         body,
 			DeliveryMode: amqp.Transient, // Don't persist presence events
 			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
 		},
 	)
 	if err != nil {
@@ -251,7 +641,12 @@ func (c *Client) PublishPresenceEvent(ctx context.Context, body []byte) error {
 func (c *Client) PublishTypingEvent(ctx context.Context, chatID int64, body []byte) error {
 	routingKey := fmt.Sprintf("%d", chatID)
 
-	err := c.channel.PublishWithContext(
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
 		ctx,
 		"delivery.topic", // exchange
 		routingKey,       // routing key
@@ -262,6 +657,7 @@ func (c *Client) PublishTypingEvent(ctx context.Context, chatID int64, body []by
 			Body:         body,
 			DeliveryMode: amqp.Transient, // Transient for ephemeral events
 			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
 		},
 	)
 	if err != nil {
@@ -275,7 +671,12 @@ func (c *Client) PublishTypingEvent(ctx context.Context, chatID int64, body []by
 func (c *Client) PublishReadReceiptBroadcast(ctx context.Context, chatID int64, body []byte) error {
 	routingKey := fmt.Sprintf("%d", chatID)
 
-	err := c.channel.PublishWithContext(
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
 		ctx,
 		"delivery.topic", // exchange
 		routingKey,       // routing key
@@ -286,6 +687,7 @@ func (c *Client) PublishReadReceiptBroadcast(ctx context.Context, chatID int64,
 			Body:         body,
 			DeliveryMode: amqp.Transient, // Transient for ephemeral events
 			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
 		},
 	)
 	if err != nil {
@@ -297,7 +699,12 @@ func (c *Client) PublishReadReceiptBroadcast(ctx context.Context, chatID int64,
 
 // PublishReadReceipt publishes a read receipt to the queue
 func (c *Client) PublishReadReceipt(ctx context.Context, body []byte) error {
-	err := c.channel.PublishWithContext(
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
 		ctx,
 		"",              // exchange (empty = default)
 		"read.receipts", // routing key (queue name)
@@ -308,6 +715,7 @@ func (c *Client) PublishReadReceipt(ctx context.Context, body []byte) error {
 			Body:         body,
 			DeliveryMode: amqp.Persistent,
 			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
 		},
 	)
 	if err != nil {
@@ -317,19 +725,39 @@ func (c *Client) PublishReadReceipt(ctx context.Context, body []byte) error {
 	return nil
 }
 
+// PublishDeliveredReceipt publishes a delivered receipt to the queue
+func (c *Client) PublishDeliveredReceipt(ctx context.Context, body []byte) error {
+	ch, err := c.currentChannel()
+	if err != nil {
+		return err
+	}
+
+	err = ch.PublishWithContext(
+		ctx,
+		"",                    // exchange (empty = default)
+		deliveredReceiptQueue, // routing key (queue name)
+		false,                 // mandatory
+		false,                 // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         body,
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    time.Now(),
+			Headers:      headersFromContext(ctx),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish delivered receipt: %w", err)
+	}
+
+	return nil
+}
+
 // ConsumePresenceQueue starts consuming from the presence queue
 func (c *Client) ConsumePresenceQueue(consumerTag string) (<-chan amqp.Delivery, error) {
 	queueName := "presence.events"
 
-	msgs, err := c.channel.Consume(
-		queueName,   // queue
-		consumerTag, // consumer tag
-		false,       // auto-ack
-		false,       // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
+	msgs, err := c.consume(queueName, consumerTag, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to consume presence queue: %w", err)
 	}
@@ -341,15 +769,7 @@ func (c *Client) ConsumePresenceQueue(consumerTag string) (<-chan amqp.Delivery,
 func (c *Client) ConsumeReadReceiptQueue(consumerTag string) (<-chan amqp.Delivery, error) {
 	queueName := "read.receipts"
 
-	msgs, err := c.channel.Consume(
-		queueName,   // queue
-		consumerTag, // consumer tag
-		false,       // auto-ack
-		false,       // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
+	msgs, err := c.consume(queueName, consumerTag, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to consume read receipt queue: %w", err)
 	}
@@ -357,33 +777,44 @@ func (c *Client) ConsumeReadReceiptQueue(consumerTag string) (<-chan amqp.Delive
 	return msgs, nil
 }
 
+// ConsumeDeliveredReceiptQueue starts consuming from the delivered receipt queue
+func (c *Client) ConsumeDeliveredReceiptQueue(consumerTag string) (<-chan amqp.Delivery, error) {
+	msgs, err := c.consume(deliveredReceiptQueue, consumerTag, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume delivered receipt queue: %w", err)
+	}
+
+	return msgs, nil
+}
+
 // DeclareDeliveryQueue declares a delivery queue for a gateway pod
 func (c *Client) DeclareDeliveryQueue(podID string, chatIDs []int64) (string, error) {
 	queueName := fmt.Sprintf("delivery.%s", podID)
 
-	_, err := c.channel.QueueDeclare(
-		queueName, // name
-		false,     // durable (transient queue per pod)
-		true,      // delete when unused
-		true,      // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
+	// The queue is exclusive, so the broker drops it with the connection and
+	// a reconnect has to declare it again
+	err := c.declare("queue:"+queueName, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(
+			queueName, // name
+			false,     // durable (transient queue per pod)
+			true,      // delete when unused
+			true,      // exclusive
+			false,     // no-wait
+			nil,       // arguments
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare delivery queue: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to declare delivery queue: %w", err)
+		return "", err
 	}
 
 	// Bind to all chat IDs
 	for _, chatID := range chatIDs {
-		routingKey := fmt.Sprintf("%d", chatID)
-		if err := c.channel.QueueBind(
-			queueName,        // queue name
-			routingKey,       // routing key
-			"delivery.topic", // exchange
-			false,            // no-wait
-			nil,              // arguments
-		); err != nil {
-			return "", fmt.Errorf("failed to bind delivery queue: %w", err)
+		if err := c.BindDeliveryQueue(queueName, chatID); err != nil {
+			return "", err
 		}
 	}
 
@@ -393,57 +824,43 @@ func (c *Client) DeclareDeliveryQueue(podID string, chatIDs []int64) (string, er
 // BindDeliveryQueue binds a delivery queue to a chat ID
 func (c *Client) BindDeliveryQueue(queueName string, chatID int64) error {
 	routingKey := fmt.Sprintf("%d", chatID)
-	if err := c.channel.QueueBind(
-		queueName,        // queue name
-		routingKey,       // routing key
-		"delivery.topic", // exchange
-		false,            // no-wait
-		nil,              // arguments
-	); err != nil {
-		return fmt.Errorf("failed to bind delivery queue: %w", err)
-	}
-	return nil
+	return c.declare("bind:"+queueName+":"+routingKey, func(ch *amqp.Channel) error {
+		if err := ch.QueueBind(
+			queueName,        // queue name
+			routingKey,       // routing key
+			"delivery.topic", // exchange
+			false,            // no-wait
+			nil,              // arguments
+		); err != nil {
+			return fmt.Errorf("failed to bind delivery queue: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeclarePresenceFanoutBinding binds a gateway's delivery queue to the
+// presence.fanout exchange, so every gateway sees every presence change
+func (c *Client) DeclarePresenceFanoutBinding(queueName string) error {
+	return c.declare("bind:"+queueName+":presence", func(ch *amqp.Channel) error {
+		if err := ch.QueueBind(
+			queueName,         // queue name
+			"",                // routing key (ignored for fanout)
+			"presence.fanout", // exchange
+			false,             // no-wait
+			nil,               // arguments
+		); err != nil {
+			return fmt.Errorf("failed to bind queue to presence fanout: %w", err)
+		}
+		return nil
+	})
 }
 
 // ConsumeDeliveryQueue starts consuming from a delivery queue
 func (c *Client) ConsumeDeliveryQueue(queueName, consumerTag string) (<-chan amqp.Delivery, error) {
-	msgs, err := c.channel.Consume(
-		queueName,   // queue
-		consumerTag, // consumer tag
-		false,       // auto-ack
-		true,        // exclusive
-		false,       // no-local
-		false,       // no-wait
-		nil,         // args
-	)
+	msgs, err := c.consume(queueName, consumerTag, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to consume delivery queue: %w", err)
 	}
 
 	return msgs, nil
 }
-// PublishUserStatus publishes a user online/offline status update
-func (c *Client) PublishUserStatus(ctx context.Context, chatID, userID int64, status string) error {
-	routingKey := fmt.Sprintf("%d", chatID)
-	
-	body := []byte(fmt.Sprintf(`{"type":"UserStatus","userId":%d,"status":"%s"}`, userID, status))
-
-	err := c.channel.PublishWithContext(
-		ctx,
-		"delivery.topic", // exchange
-		routingKey,       // routing key
-		false,            // mandatory
-		false,            // immediate
-		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp.Transient, // Transient for ephemeral events
-			Timestamp:    time.Now(),
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to publish user status: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,46 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForward_KeepsConsumerOpenAcrossReconnects(t *testing.T) {
+	c := &Client{done: make(chan struct{})}
+	cons := &consumer{out: make(chan amqp.Delivery)}
+
+	// The first channel dies after one delivery, as it does when the broker restarts
+	first := make(chan amqp.Delivery, 1)
+	first <- amqp.Delivery{MessageId: "1"}
+	close(first)
+	go c.forward(cons, first)
+	assert.Equal(t, "1", (<-cons.out).MessageId)
+
+	second := make(chan amqp.Delivery, 1)
+	second <- amqp.Delivery{MessageId: "2"}
+	go c.forward(cons, second)
+	assert.Equal(t, "2", (<-cons.out).MessageId)
+
+	// Closing the client ends the caller's range loop
+	close(c.done)
+	close(second)
+	select {
+	case _, open := <-cons.out:
+		assert.False(t, open)
+	case <-time.After(time.Second):
+		t.Fatal("consumer channel not closed after Close")
+	}
+}
+
+func TestDeclare_NotConnected(t *testing.T) {
+	c := &Client{done: make(chan struct{}), declared: make(map[string]bool)}
+
+	err := c.DeclareExchanges()
+	require.ErrorIs(t, err, ErrNotConnected)
+	assert.Empty(t, c.topology, "failed declarations are not replayed")
+	assert.False(t, c.Healthy())
+}
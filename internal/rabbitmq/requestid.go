@@ -0,0 +1,60 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// requestIDHeader is the AMQP header carrying the originating HTTP request ID
+const requestIDHeader = "x-request-id"
+
+// headerCarrier adapts AMQP headers to the OpenTelemetry propagator, which
+// stores the trace context under "traceparent"
+type headerCarrier amqp.Table
+
+func (h headerCarrier) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// headersFromContext copies the request ID and trace context from ctx into
+// publishing headers
+func headersFromContext(ctx context.Context) amqp.Table {
+	headers := amqp.Table{}
+	if id := telemetry.RequestIDFromContext(ctx); id != "" {
+		headers[requestIDHeader] = id
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// ContextWithDelivery returns ctx carrying the request ID and trace context of
+// the publisher that produced d, so consumer logs share the producer's
+// correlation ID and consumer spans join the producer's trace
+func ContextWithDelivery(ctx context.Context, d amqp.Delivery) context.Context {
+	if d.Headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(d.Headers))
+	}
+	if id, ok := d.Headers[requestIDHeader].(string); ok && id != "" {
+		return telemetry.WithRequestID(ctx, id)
+	}
+	return ctx
+}
@@ -0,0 +1,42 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaders_CarryRequestIDAndTraceContext(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(telemetry.WithRequestID(context.Background(), "req-1"), parent)
+
+	headers := headersFromContext(ctx)
+	assert.Equal(t, "req-1", headers[requestIDHeader])
+	assert.Contains(t, headers, "traceparent")
+
+	got := ContextWithDelivery(context.Background(), amqp.Delivery{Headers: headers})
+	assert.Equal(t, "req-1", telemetry.RequestIDFromContext(got))
+	remote := trace.SpanContextFromContext(got)
+	require.True(t, remote.IsValid())
+	assert.Equal(t, parent.TraceID(), remote.TraceID())
+	assert.Equal(t, parent.SpanID(), remote.SpanID())
+}
+
+func TestHeaders_EmptyWithoutRequestOrTrace(t *testing.T) {
+	assert.Nil(t, headersFromContext(context.Background()))
+}
@@ -0,0 +1,90 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RetryBackoff returns how long to wait before requeueing a delivery after
+// failures consecutive processing failures: base doubled per failure, capped at max
+func RetryBackoff(failures int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
+
+// NackAfter waits for delay, or until ctx is done, then nacks d for redelivery.
+// The delivery stays unacked while waiting, so it isn't handed to another consumer early.
+func NackAfter(ctx context.Context, d amqp.Delivery, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return d.Nack(false, true)
+}
+
+// retryCountHeader counts how often a chat message has been republished for retry
+const retryCountHeader = "x-retry-count"
+
+// RetryCount returns how many times d has already been retried
+func RetryCount(d amqp.Delivery) int {
+	switch n := d.Headers[retryCountHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// RetryAfter waits for delay, then republishes d to the shared chat queue with
+// its retry count incremented and acks the original. A nack can't change
+// headers, so this is how the count survives redelivery. If ctx is done or the
+// republish fails, d is nacked for redelivery with its count unchanged.
+func (c *Client) RetryAfter(ctx context.Context, d amqp.Delivery, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return d.Nack(false, true)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(RetryCount(d) + 1)
+
+	ch, err := c.currentChannel()
+	if err == nil {
+		err = ch.PublishWithContext(ctx,
+			"",              // exchange (empty = default)
+			sharedChatQueue, // routing key (queue name)
+			false,           // mandatory
+			false,           // immediate
+			amqp.Publishing{
+				ContentType:  d.ContentType,
+				Body:         d.Body,
+				DeliveryMode: amqp.Persistent,
+				Priority:     d.Priority,
+				Timestamp:    d.Timestamp,
+				Headers:      headers,
+			},
+		)
+	}
+	if err != nil {
+		d.Nack(false, true)
+		return fmt.Errorf("failed to republish message for retry: %w", err)
+	}
+	return d.Ack(false)
+}
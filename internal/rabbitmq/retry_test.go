@@ -0,0 +1,26 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	base, max := 500*time.Millisecond, 5*time.Second
+
+	assert.Equal(t, 500*time.Millisecond, RetryBackoff(1, base, max))
+	assert.Equal(t, time.Second, RetryBackoff(2, base, max))
+	assert.Equal(t, 4*time.Second, RetryBackoff(4, base, max))
+	assert.Equal(t, max, RetryBackoff(5, base, max))
+	assert.Equal(t, max, RetryBackoff(50, base, max))
+}
+
+func TestRetryCount(t *testing.T) {
+	assert.Equal(t, 0, RetryCount(amqp.Delivery{}))
+	// Headers read back from the broker arrive as int32
+	assert.Equal(t, 3, RetryCount(amqp.Delivery{Headers: amqp.Table{retryCountHeader: int32(3)}}))
+	assert.Equal(t, 4, RetryCount(amqp.Delivery{Headers: amqp.Table{retryCountHeader: int64(4)}}))
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// benchChatCount is the number of chats the benchmark user belongs to
+const benchChatCount = 200
+
+// seedUserChats creates a user who belongs to benchChatCount chats holding a few
+// messages each, and returns the user's ID. Everything is removed when the benchmark ends.
+func seedUserChats(b *testing.B, db *DB) int64 {
+	var userID int64
+	email := fmt.Sprintf("bench-%d@example.com", time.Now().UnixNano())
+	if err := db.Raw("INSERT INTO users (email, password_hash) VALUES (?, 'x') RETURNING id", email).Scan(&userID).Error; err != nil {
+		b.Fatal(err)
+	}
+	var chatIDs []int64
+	if err := db.Raw("INSERT INTO chats (type) SELECT 2 FROM generate_series(1, ?) RETURNING id", benchChatCount).Scan(&chatIDs).Error; err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		db.Exec("DELETE FROM chats WHERE id IN ?", chatIDs)
+		db.Exec("DELETE FROM users WHERE id = ?", userID)
+	})
+
+	if err := db.Exec("INSERT INTO chat_members (chat_id, user_id, role) SELECT id, ?, 'owner' FROM chats WHERE id IN ?", userID, chatIDs).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Exec(
+		"INSERT INTO messages (chat_id, user_id, body) SELECT c.id, ?, 'message ' || g FROM chats c, generate_series(1, 5) g WHERE c.id IN ?",
+		userID, chatIDs,
+	).Error; err != nil {
+		b.Fatal(err)
+	}
+	return userID
+}
+
+// countQueries counts the statements db runs from now on
+func countQueries(b *testing.B, db *DB) *atomic.Int64 {
+	var n atomic.Int64
+	count := func(*gorm.DB) { n.Add(1) }
+	name := fmt.Sprintf("bench:count_queries:%d", time.Now().UnixNano())
+	if err := db.Callback().Query().After("gorm:query").Register(name, count); err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Callback().Row().After("gorm:row").Register(name, count); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = db.Callback().Query().Remove(name)
+		_ = db.Callback().Row().Remove(name)
+	})
+	return &n
+}
+
+// BenchmarkUserChatsLastMessages compares loading the chat list's last message
+// previews one query per chat against the single LATERAL query GetUserChats uses.
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run=^$ -bench=UserChatsLastMessages ./internal/repository/postgres/
+func BenchmarkUserChatsLastMessages(b *testing.B) {
+	db := openBenchDB(b)
+	userID := seedUserChats(b, db)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	var daos []ChatDAO
+	if err := repo.userChatsQuery(ctx, userID).Find(&daos).Error; err != nil {
+		b.Fatal(err)
+	}
+	chatIDs := make([]int64, len(daos))
+	for i, dao := range daos {
+		chatIDs[i] = dao.ID
+	}
+	queries := countQueries(b, db)
+
+	b.Run("per-chat", func(b *testing.B) {
+		queries.Store(0)
+		for i := 0; i < b.N; i++ {
+			for _, id := range chatIDs {
+				if _, err := repo.GetLastMessage(ctx, id); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+	})
+	b.Run("lateral", func(b *testing.B) {
+		queries.Store(0)
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.getLastMessages(ctx, userID, chatIDs); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+	})
+}
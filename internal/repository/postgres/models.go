@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
@@ -8,36 +9,69 @@ import (
 
 // UserDAO represents a registered user in the database
 type UserDAO struct {
-	ID           int64     `gorm:"primaryKey"`
-	Email        string    `gorm:"uniqueIndex;not null"`
-	Username     string    `gorm:"size:50"`
-	AvatarURL    string    `gorm:"column:avatar_url"`
-	Bio          string    ``
-	PasswordHash string    `gorm:"not null"`
-	CreatedAt    time.Time `gorm:"default:now()"`
+	ID            int64      `gorm:"primaryKey"`
+	Email         string     `gorm:"uniqueIndex;not null"`
+	EmailVerified bool       `gorm:"not null;default:false"`
+	Username      string     `gorm:"size:50"`
+	AvatarURL     string     `gorm:"column:avatar_url"`
+	Bio           string     ``
+	PasswordHash  string     `gorm:"not null"`
+	CreatedAt     time.Time  `gorm:"default:now()"`
+	DeactivatedAt *time.Time ``
+	ShowLastSeen  bool       `gorm:"default:true"`
+	LastSeenAt    *time.Time ``
+	TokenVersion  int64      `gorm:"not null;default:0"`
+	IsAdmin       bool       `gorm:"default:false"`
+
+	Timezone         string `gorm:"size:64;not null;default:'UTC'"`
+	DNDStart         string `gorm:"column:dnd_start;size:5;not null;default:''"`
+	DNDEnd           string `gorm:"column:dnd_end;size:5;not null;default:''"`
+	DNDAllowMentions bool   `gorm:"column:dnd_allow_mentions;default:true"`
 }
 
 func (u *UserDAO) ToDomain() *domain.User {
 	return &domain.User{
-		ID:           u.ID,
-		Email:        u.Email,
-		Username:     u.Username,
-		AvatarURL:    u.AvatarURL,
-		Bio:          u.Bio,
-		PasswordHash: u.PasswordHash,
-		CreatedAt:    u.CreatedAt,
+		ID:            u.ID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Username:      u.Username,
+		AvatarURL:     u.AvatarURL,
+		Bio:           u.Bio,
+		PasswordHash:  u.PasswordHash,
+		CreatedAt:     u.CreatedAt,
+		DeactivatedAt: u.DeactivatedAt,
+		ShowLastSeen:  u.ShowLastSeen,
+		LastSeenAt:    u.LastSeenAt,
+		TokenVersion:  u.TokenVersion,
+		IsAdmin:       u.IsAdmin,
+
+		Timezone:         u.Timezone,
+		DNDStart:         u.DNDStart,
+		DNDEnd:           u.DNDEnd,
+		DNDAllowMentions: u.DNDAllowMentions,
 	}
 }
 
 func FromDomainUser(u *domain.User) *UserDAO {
 	return &UserDAO{
-		ID:           u.ID,
-		Email:        u.Email,
-		Username:     u.Username,
-		AvatarURL:    u.AvatarURL,
-		Bio:          u.Bio,
-		PasswordHash: u.PasswordHash,
-		CreatedAt:    u.CreatedAt,
+		ID:            u.ID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Username:      u.Username,
+		AvatarURL:     u.AvatarURL,
+		Bio:           u.Bio,
+		PasswordHash:  u.PasswordHash,
+		CreatedAt:     u.CreatedAt,
+		DeactivatedAt: u.DeactivatedAt,
+		ShowLastSeen:  u.ShowLastSeen,
+		LastSeenAt:    u.LastSeenAt,
+		TokenVersion:  u.TokenVersion,
+		IsAdmin:       u.IsAdmin,
+
+		Timezone:         u.Timezone,
+		DNDStart:         u.DNDStart,
+		DNDEnd:           u.DNDEnd,
+		DNDAllowMentions: u.DNDAllowMentions,
 	}
 }
 
@@ -47,8 +81,16 @@ type ChatDAO struct {
 	ID        int64     `gorm:"primaryKey"`
 	Type      int16     `gorm:"not null;check:type IN (1,2)"`
 	Title     string    `gorm:"size:255"`
+	Description string  ``
+	AvatarURL   string  ``
+	PostPolicy  string  `gorm:"size:10;default:'all'"`
+	SlowModeSeconds int `gorm:"not null;default:0"`
+	RetentionDays   int `gorm:"not null;default:0"`
+	MessageTTLSeconds int `gorm:"not null;default:0"`
 	CreatedAt time.Time `gorm:"default:now()"`
 	UnreadCount int64   `gorm:"->;column:unread_count"`
+	LastActivityAt time.Time `gorm:"->;column:last_activity_at"`
+	Archived       bool      `gorm:"->;column:archived"`
 }
 
 func (c *ChatDAO) ToDomain() *domain.Chat {
@@ -56,8 +98,16 @@ func (c *ChatDAO) ToDomain() *domain.Chat {
 		ID:          c.ID,
 		Type:        c.Type,
 		Title:       c.Title,
+		Description: c.Description,
+		AvatarURL:   c.AvatarURL,
+		PostPolicy:  domain.PostPolicy(c.PostPolicy),
+		SlowModeSeconds: c.SlowModeSeconds,
+		RetentionDays:   c.RetentionDays,
+		MessageTTLSeconds: c.MessageTTLSeconds,
 		CreatedAt:   c.CreatedAt,
 		UnreadCount: c.UnreadCount,
+		LastActivityAt: c.LastActivityAt,
+		Archived:       c.Archived,
 	}
 }
 
@@ -66,27 +116,41 @@ func FromDomainChat(c *domain.Chat) *ChatDAO {
 		ID:        c.ID,
 		Type:      c.Type,
 		Title:     c.Title,
+		Description: c.Description,
+		AvatarURL:   c.AvatarURL,
+		PostPolicy:  string(c.PostPolicy),
+		SlowModeSeconds: c.SlowModeSeconds,
+		RetentionDays:   c.RetentionDays,
+		MessageTTLSeconds: c.MessageTTLSeconds,
 		CreatedAt: c.CreatedAt,
 	}
 }
 
 // ChatMemberDAO represents membership in a chat
 type ChatMemberDAO struct {
-	ChatID        int64     `gorm:"primaryKey"`
-	UserID        int64     `gorm:"primaryKey"`
-	Role          string    `gorm:"default:'member'"`
-	LastReadMsgID int64     `gorm:"default:0"`
-	JoinedAt      time.Time `gorm:"default:now()"`
-	User          UserDAO   `gorm:"foreignKey:UserID"`
+	ChatID             int64     `gorm:"primaryKey"`
+	UserID             int64     `gorm:"primaryKey"`
+	Role               string    `gorm:"default:'member'"`
+	LastReadMsgID      int64     `gorm:"default:0"`
+	LastDeliveredMsgID int64     `gorm:"default:0"`
+	NotificationLevel  string    `gorm:"size:20;default:'all'"`
+	ArchivedAt         *time.Time
+	MutedUntil         *time.Time
+	JoinedAt           time.Time `gorm:"default:now()"`
+	User               UserDAO   `gorm:"foreignKey:UserID"`
 }
 
 func (m *ChatMemberDAO) ToDomain() *domain.ChatMember {
 	dm := &domain.ChatMember{
-		ChatID:        m.ChatID,
-		UserID:        m.UserID,
-		Role:          domain.Role(m.Role),
-		LastReadMsgID: m.LastReadMsgID,
-		JoinedAt:      m.JoinedAt,
+		ChatID:             m.ChatID,
+		UserID:             m.UserID,
+		Role:               domain.Role(m.Role),
+		LastReadMsgID:      m.LastReadMsgID,
+		LastDeliveredMsgID: m.LastDeliveredMsgID,
+		NotificationLevel:  domain.NotificationLevel(m.NotificationLevel),
+		ArchivedAt:         m.ArchivedAt,
+		MutedUntil:         m.MutedUntil,
+		JoinedAt:           m.JoinedAt,
 	}
 	if m.User.ID != 0 {
 		dm.User = m.User.ToDomain()
@@ -96,11 +160,15 @@ func (m *ChatMemberDAO) ToDomain() *domain.ChatMember {
 
 func FromDomainChatMember(m *domain.ChatMember) *ChatMemberDAO {
 	return &ChatMemberDAO{
-		ChatID:        m.ChatID,
-		UserID:        m.UserID,
-		Role:          string(m.Role),
-		LastReadMsgID: m.LastReadMsgID,
-		JoinedAt:      m.JoinedAt,
+		ChatID:             m.ChatID,
+		UserID:             m.UserID,
+		Role:               string(m.Role),
+		LastReadMsgID:      m.LastReadMsgID,
+		LastDeliveredMsgID: m.LastDeliveredMsgID,
+		NotificationLevel:  string(m.NotificationLevel),
+		ArchivedAt:         m.ArchivedAt,
+		MutedUntil:         m.MutedUntil,
+		JoinedAt:           m.JoinedAt,
 	}
 }
 
@@ -110,34 +178,87 @@ type MessageDAO struct {
 	ChatID    int64     `gorm:"not null;index:idx_messages_chat_created"`
 	UserID    int64     `gorm:"not null"`
 	Body      string    `gorm:"not null"`
+	Kind      string    `gorm:"size:10;not null;default:'user'"`
+	Meta      []byte    `gorm:"type:jsonb"`
 	MediaURL  string    ``
+	MediaKey  string    `gorm:"not null;default:''"`
+	MediaMeta []byte    `gorm:"type:jsonb"`
 	ReplyToID *int64    ``
+	ReplySnippet string `gorm:"size:200;not null;default:''"`
+	ForwardedFromChatID *int64
+	ForwardedFromMsgID  *int64
 	CreatedAt time.Time `gorm:"default:now();index:idx_messages_chat_created"`
+	EditedAt  *time.Time
+	DeletedAt *time.Time
+	ExpiresAt *time.Time
+	// Computed in history queries; never written
+	ReplyCount  int64      `gorm:"->;column:reply_count"`
+	LastReplyAt *time.Time `gorm:"->;column:last_reply_at"`
 }
 
 func (m *MessageDAO) ToDomain() *domain.Message {
+	var forwardedFrom *domain.ForwardedFrom
+	if m.ForwardedFromChatID != nil && m.ForwardedFromMsgID != nil {
+		forwardedFrom = &domain.ForwardedFrom{ChatID: *m.ForwardedFromChatID, MsgID: *m.ForwardedFromMsgID}
+	}
+	var mediaMeta *domain.MediaMeta
+	if len(m.MediaMeta) > 0 {
+		mediaMeta = &domain.MediaMeta{}
+		if err := json.Unmarshal(m.MediaMeta, mediaMeta); err != nil {
+			mediaMeta = nil
+		}
+	}
 	return &domain.Message{
 		ID:        m.ID,
 		ChatID:    m.ChatID,
 		UserID:    m.UserID,
 		Body:      m.Body,
+		Kind:      domain.MessageKind(m.Kind),
+		Meta:      m.Meta,
 		MediaURL:  m.MediaURL,
+		MediaKey:  m.MediaKey,
+		MediaMeta: mediaMeta,
 		ReplyToID: m.ReplyToID,
+		ReplySnippet: m.ReplySnippet,
+		ForwardedFrom: forwardedFrom,
 		// Reactions are loaded separately from the reactions table
+		ReplyCount:  m.ReplyCount,
+		LastReplyAt: m.LastReplyAt,
 		CreatedAt: m.CreatedAt,
+		EditedAt:  m.EditedAt,
+		DeletedAt: m.DeletedAt,
+		ExpiresAt: m.ExpiresAt,
 	}
 }
 
 func FromDomainMessage(m *domain.Message) *MessageDAO {
+	var forwardedChatID, forwardedMsgID *int64
+	if m.ForwardedFrom != nil {
+		forwardedChatID, forwardedMsgID = &m.ForwardedFrom.ChatID, &m.ForwardedFrom.MsgID
+	}
+	var mediaMeta []byte
+	if m.MediaMeta != nil {
+		mediaMeta, _ = json.Marshal(m.MediaMeta)
+	}
 	return &MessageDAO{
 		ID:        m.ID,
 		ChatID:    m.ChatID,
 		UserID:    m.UserID,
 		Body:      m.Body,
+		Kind:      string(m.Kind),
+		Meta:      m.Meta,
 		MediaURL:  m.MediaURL,
+		MediaKey:  m.MediaKey,
+		MediaMeta: mediaMeta,
 		ReplyToID: m.ReplyToID,
+		ReplySnippet: m.ReplySnippet,
+		ForwardedFromChatID: forwardedChatID,
+		ForwardedFromMsgID:  forwardedMsgID,
 		// Reactions are stored in a separate table now
 		CreatedAt: m.CreatedAt,
+		EditedAt:  m.EditedAt,
+		DeletedAt: m.DeletedAt,
+		ExpiresAt: m.ExpiresAt,
 	}
 }
 
@@ -222,6 +343,134 @@ func FromDomainReaction(r *domain.Reaction) *ReactionDAO {
 	}
 }
 
+// PinnedMessageDAO represents a message pinned in a chat
+type PinnedMessageDAO struct {
+	ChatID    int64     `gorm:"primaryKey"`
+	MsgID     int64     `gorm:"primaryKey"`
+	PinnedBy  int64     `gorm:"not null"`
+	PinnedAt  time.Time `gorm:"not null"`
+}
+
+func (p *PinnedMessageDAO) ToDomain() *domain.PinnedMessage {
+	return &domain.PinnedMessage{
+		ChatID:    p.ChatID,
+		MessageID: p.MsgID,
+		PinnedBy:  p.PinnedBy,
+		PinnedAt:  p.PinnedAt,
+	}
+}
+
+func FromDomainPinnedMessage(p *domain.PinnedMessage) *PinnedMessageDAO {
+	return &PinnedMessageDAO{
+		ChatID:   p.ChatID,
+		MsgID:    p.MessageID,
+		PinnedBy: p.PinnedBy,
+		PinnedAt: p.PinnedAt,
+	}
+}
+
+// FolderDAO represents a user's chat folder
+type FolderDAO struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null"`
+	Name      string    `gorm:"size:64;not null"`
+	CreatedAt time.Time `gorm:"default:now()"`
+}
+
+func (f *FolderDAO) ToDomain() *domain.Folder {
+	return &domain.Folder{
+		ID:        f.ID,
+		UserID:    f.UserID,
+		Name:      f.Name,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+func FromDomainFolder(f *domain.Folder) *FolderDAO {
+	return &FolderDAO{
+		ID:        f.ID,
+		UserID:    f.UserID,
+		Name:      f.Name,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+// ChatFolderDAO assigns a chat to a folder
+type ChatFolderDAO struct {
+	FolderID int64 `gorm:"primaryKey"`
+	ChatID   int64 `gorm:"primaryKey"`
+}
+
+// ScheduledMessageDAO is a message waiting for its send time
+type ScheduledMessageDAO struct {
+	ID           int64     `gorm:"primaryKey"`
+	ChatID       int64     `gorm:"not null"`
+	UserID       int64     `gorm:"not null"`
+	Body         string    `gorm:"not null"`
+	MediaURL     string    `gorm:"not null;default:''"`
+	MediaMeta    []byte    `gorm:"type:jsonb"`
+	ReplyToID    *int64
+	ReplySnippet string    `gorm:"size:200;not null;default:''"`
+	SendAt       time.Time `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"default:now()"`
+}
+
+func (m *ScheduledMessageDAO) ToDomain() *domain.ScheduledMessage {
+	var mediaMeta *domain.MediaMeta
+	if len(m.MediaMeta) > 0 {
+		mediaMeta = &domain.MediaMeta{}
+		if err := json.Unmarshal(m.MediaMeta, mediaMeta); err != nil {
+			mediaMeta = nil
+		}
+	}
+	return &domain.ScheduledMessage{
+		ID:           m.ID,
+		ChatID:       m.ChatID,
+		UserID:       m.UserID,
+		Body:         m.Body,
+		MediaURL:     m.MediaURL,
+		MediaMeta:    mediaMeta,
+		ReplyToID:    m.ReplyToID,
+		ReplySnippet: m.ReplySnippet,
+		SendAt:       m.SendAt,
+		CreatedAt:    m.CreatedAt,
+	}
+}
+
+func FromDomainScheduledMessage(m *domain.ScheduledMessage) *ScheduledMessageDAO {
+	var mediaMeta []byte
+	if m.MediaMeta != nil {
+		mediaMeta, _ = json.Marshal(m.MediaMeta)
+	}
+	return &ScheduledMessageDAO{
+		ID:           m.ID,
+		ChatID:       m.ChatID,
+		UserID:       m.UserID,
+		Body:         m.Body,
+		MediaURL:     m.MediaURL,
+		MediaMeta:    mediaMeta,
+		ReplyToID:    m.ReplyToID,
+		ReplySnippet: m.ReplySnippet,
+		SendAt:       m.SendAt,
+		CreatedAt:    m.CreatedAt,
+	}
+}
+
+// BlockDAO records one user blocking another
+type BlockDAO struct {
+	BlockerID int64     `gorm:"primaryKey"`
+	BlockedID int64     `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"default:now()"`
+}
+
+func (b *BlockDAO) ToDomain() *domain.Block {
+	return &domain.Block{
+		BlockerID: b.BlockerID,
+		BlockedID: b.BlockedID,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
 // TableName overrides
 func (UserDAO) TableName() string        { return "users" }
 func (ChatDAO) TableName() string        { return "chats" }
@@ -230,4 +479,9 @@ func (MessageDAO) TableName() string     { return "messages" }
 func (ReceiptDAO) TableName() string     { return "receipts" }
 func (DeviceTokenDAO) TableName() string { return "device_tokens" }
 func (ReactionDAO) TableName() string    { return "reactions" }
+func (PinnedMessageDAO) TableName() string { return "pinned_messages" }
+func (FolderDAO) TableName() string        { return "folders" }
+func (ChatFolderDAO) TableName() string    { return "chat_folders" }
+func (BlockDAO) TableName() string         { return "blocks" }
+func (ScheduledMessageDAO) TableName() string { return "scheduled_messages" }
 
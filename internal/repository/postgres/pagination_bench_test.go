@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// benchHistorySize is the number of messages seeded into the benchmark chat
+const benchHistorySize = 200_000
+
+// openBenchDB connects to the migrated database in TEST_DATABASE_DSN, skipping when unset
+func openBenchDB(b *testing.B) *DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := New(Config{DSN: dsn, MaxOpenConns: 4, MaxIdleConns: 4, ConnMaxLifetime: time.Minute})
+	if err != nil {
+		b.Fatal(err)
+	}
+	db.DB = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	b.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// seedHistory creates a chat holding benchHistorySize messages and returns its ID
+// and the ID of its newest message. Everything is removed when the benchmark ends.
+func seedHistory(b *testing.B, db *DB) (chatID, newestID int64) {
+	var userID int64
+	email := fmt.Sprintf("bench-%d@example.com", time.Now().UnixNano())
+	if err := db.Raw("INSERT INTO users (email, password_hash) VALUES (?, 'x') RETURNING id", email).Scan(&userID).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Raw("INSERT INTO chats (type) VALUES (2) RETURNING id").Scan(&chatID).Error; err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		db.Exec("DELETE FROM chats WHERE id = ?", chatID)
+		db.Exec("DELETE FROM users WHERE id = ?", userID)
+	})
+
+	if err := db.Exec(
+		"INSERT INTO messages (chat_id, user_id, body) SELECT ?, ?, 'message ' || g FROM generate_series(1, ?) g",
+		chatID, userID, benchHistorySize,
+	).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Exec("ANALYZE messages").Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := db.Raw("SELECT MAX(id) FROM messages WHERE chat_id = ?", chatID).Scan(&newestID).Error; err != nil {
+		b.Fatal(err)
+	}
+	return chatID, newestID
+}
+
+// BenchmarkMessageHistoryPagination compares keyset and OFFSET paging at increasing
+// depth. Keyset pages should cost the same at every depth; OFFSET grows linearly.
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run=^$ -bench=MessageHistoryPagination ./internal/repository/postgres/
+func BenchmarkMessageHistoryPagination(b *testing.B) {
+	db := openBenchDB(b)
+	chatID, newestID := seedHistory(b, db)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+	const pageSize = 50
+
+	for _, depth := range []int{0, 1_000, 10_000, 100_000, benchHistorySize - pageSize} {
+		b.Run(fmt.Sprintf("keyset/depth=%d", depth), func(b *testing.B) {
+			beforeID := newestID - int64(depth) + 1
+			if depth == 0 {
+				beforeID = 0
+			}
+			for i := 0; i < b.N; i++ {
+				msgs, err := repo.GetMessageHistory(ctx, chatID, 0, beforeID, pageSize, false)
+				if err != nil || len(msgs) != pageSize {
+					b.Fatalf("got %d messages, err %v", len(msgs), err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("offset/depth=%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var daos []MessageDAO
+				if err := db.WithContext(ctx).
+					Where("chat_id = ?", chatID).
+					Order("id DESC").
+					Offset(depth).
+					Limit(pageSize).
+					Find(&daos).Error; err != nil || len(daos) != pageSize {
+					b.Fatalf("got %d messages, err %v", len(daos), err)
+				}
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/plugin/opentelemetry/tracing"
 )
@@ -98,17 +100,44 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.
 	}
 	return dao.ToDomain(), nil
 }
-func (r *UserRepository) SearchUsers(ctx context.Context, query string, limit, offset int) ([]domain.User, error) {
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	if len(ids) == 0 {
+		return []domain.User{}, nil
+	}
+
+	var daos []UserDAO
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&daos).Error; err != nil {
+		return nil, err
+	}
+
+	users := make([]domain.User, len(daos))
+	for i, dao := range daos {
+		users[i] = *dao.ToDomain()
+	}
+	return users, nil
+}
+
+// SearchUsers pages through users whose username starts with query, in ID
+// order. afterID is the last ID of the previous page (0 for the first), so deep
+// pages cost the same as the first. Deactivated accounts are never found.
+func (r *UserRepository) SearchUsers(ctx context.Context, requesterID int64, query string, limit int, afterID int64) ([]domain.User, error) {
 	if query == "" {
 		return []domain.User{}, nil
 	}
 
+	// Prefix match on the username only, served by idx_users_username_prefix
+	prefix := escapeLike(strings.ToLower(query)) + "%"
 	var daos []UserDAO
-	// Search by email or username (partial match)
 	err := r.db.WithContext(ctx).
-		Where("email LIKE ? OR username LIKE ?", "%"+query+"%", "%"+query+"%").
+		Where("lower(username) LIKE ?", prefix).
+		Where("id <> ? AND deactivated_at IS NULL", requesterID).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = ? AND b.blocked_id = users.id) OR (b.blocker_id = users.id AND b.blocked_id = ?)
+		)`, requesterID, requesterID).
+		Where("id > ?", afterID).
+		Order("id ASC").
 		Limit(limit).
-		Offset(offset).
 		Find(&daos).Error
 	if err != nil {
 		return nil, err
@@ -121,9 +150,132 @@ func (r *UserRepository) SearchUsers(ctx context.Context, query string, limit, o
 	return users, nil
 }
 
+// Update saves the user's editable profile fields. Only those columns are
+// selected so the email and password hash can never be overwritten here.
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 	dao := FromDomainUser(user)
-	return r.db.WithContext(ctx).Model(dao).Select("username", "avatar_url", "bio").Updates(dao).Error
+	result := r.db.WithContext(ctx).Model(dao).Select("username", "avatar_url", "bio", "show_last_seen", "timezone", "dnd_start", "dnd_end", "dnd_allow_mentions").Updates(dao)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetDeactivatedAt marks a user deactivated at the given time, or reactivates them when at is nil
+func (r *UserRepository) SetDeactivatedAt(ctx context.Context, id int64, at *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&UserDAO{}).
+		Where("id = ?", id).
+		Update("deactivated_at", at).Error
+}
+
+// SetLastSeenAt records when a user last went offline
+func (r *UserRepository) SetLastSeenAt(ctx context.Context, id int64, at time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&UserDAO{}).
+		Where("id = ?", id).
+		Update("last_seen_at", at).Error
+}
+
+// SetEmailVerified marks a user's email address as verified
+func (r *UserRepository) SetEmailVerified(ctx context.Context, id int64) error {
+	result := r.db.WithContext(ctx).
+		Model(&UserDAO{}).
+		Where("id = ?", id).
+		Update("email_verified", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	result := r.db.WithContext(ctx).
+		Model(&UserDAO{}).
+		Where("id = ?", id).
+		Update("password_hash", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// IncrTokenVersion bumps a user's token version and returns the new one
+func (r *UserRepository) IncrTokenVersion(ctx context.Context, id int64) (int64, error) {
+	var version int64
+	err := r.db.WithContext(ctx).
+		Raw("UPDATE users SET token_version = token_version + 1 WHERE id = ? RETURNING token_version", id).
+		Scan(&version).Error
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// BlockRepository implementation
+type BlockRepository struct {
+	db *gorm.DB
+}
+
+func NewBlockRepository(db *DB) *BlockRepository {
+	return &BlockRepository{db: db.DB}
+}
+
+func (r *BlockRepository) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&BlockDAO{BlockerID: blockerID, BlockedID: blockedID}).Error
+}
+
+func (r *BlockRepository) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return r.db.WithContext(ctx).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Delete(&BlockDAO{}).Error
+}
+
+// ListBlocks returns the users blockerID has blocked, most recent first
+func (r *BlockRepository) ListBlocks(ctx context.Context, blockerID int64) ([]domain.Block, error) {
+	var daos []BlockDAO
+	if err := r.db.WithContext(ctx).
+		Where("blocker_id = ?", blockerID).
+		Order("created_at DESC").
+		Find(&daos).Error; err != nil {
+		return nil, err
+	}
+
+	blocks := make([]domain.Block, len(daos))
+	for i, dao := range daos {
+		blocks[i] = *dao.ToDomain()
+	}
+	return blocks, nil
+}
+
+func (r *BlockRepository) IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&BlockDAO{}).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *BlockRepository) GetBlockerIDs(ctx context.Context, blockedID int64) ([]int64, error) {
+	var ids []int64
+	err := r.db.WithContext(ctx).
+		Model(&BlockDAO{}).
+		Where("blocked_id = ?", blockedID).
+		Pluck("blocker_id", &ids).Error
+	return ids, err
 }
 
 
@@ -136,9 +288,22 @@ func NewChatRepository(db *DB) *ChatRepository {
 	return &ChatRepository{db: db.DB}
 }
 
-func (r *ChatRepository) CreateChat(ctx context.Context, chat *domain.Chat, memberIDs []int64) (*domain.Chat, error) {
+// CreateChat inserts chat together with its member rows: ownerID as owner and
+// memberIDs as members. Either all of them are created or none.
+func (r *ChatRepository) CreateChat(ctx context.Context, chat *domain.Chat, ownerID int64, memberIDs []int64) (*domain.Chat, error) {
 	dao := FromDomainChat(chat)
-	if err := r.db.WithContext(ctx).Create(dao).Error; err != nil {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dao).Error; err != nil {
+			return err
+		}
+		members := make([]ChatMemberDAO, 0, len(memberIDs)+1)
+		members = append(members, ChatMemberDAO{ChatID: dao.ID, UserID: ownerID, Role: string(domain.RoleOwner)})
+		for _, id := range memberIDs {
+			members = append(members, ChatMemberDAO{ChatID: dao.ID, UserID: id, Role: string(domain.RoleMember)})
+		}
+		return tx.Omit(clause.Associations).Create(&members).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	chat.ID = dao.ID
@@ -148,7 +313,11 @@ func (r *ChatRepository) CreateChat(ctx context.Context, chat *domain.Chat, memb
 
 func (r *ChatRepository) UpdateChat(ctx context.Context, chat *domain.Chat) error {
 	dao := FromDomainChat(chat)
-	return r.db.WithContext(ctx).Model(dao).Updates(dao).Error
+	// Select the editable columns so fields can be cleared back to their zero value
+	return r.db.WithContext(ctx).
+		Model(dao).
+		Select("title", "description", "avatar_url", "post_policy", "slow_mode_seconds", "retention_days", "message_ttl_seconds").
+		Updates(dao).Error
 }
 
 func (r *ChatRepository) GetChat(ctx context.Context, id int64) (*domain.Chat, error) {
@@ -159,35 +328,121 @@ func (r *ChatRepository) GetChat(ctx context.Context, id int64) (*domain.Chat, e
 	return dao.ToDomain(), nil
 }
 
-func (r *ChatRepository) GetUserChats(ctx context.Context, userID int64) ([]domain.Chat, error) {
-	var daos []ChatDAO
-	if err := r.db.WithContext(ctx).
+// notExpiredCond hides messages whose TTL has passed but that the expiry
+// sweeper hasn't deleted yet
+const notExpiredCond = "(messages.expires_at IS NULL OR messages.expires_at > NOW())"
+
+// notBlockedByMemberCond drops messages from users the chat_members row's user
+// has blocked
+const notBlockedByMemberCond = "NOT EXISTS (SELECT 1 FROM blocks WHERE blocks.blocker_id = chat_members.user_id AND blocks.blocked_id = messages.user_id)"
+
+// notBlockedByViewerCond hides user messages from senders the viewer (the
+// single bind parameter) has blocked. System messages stay visible.
+const notBlockedByViewerCond = "(messages.kind <> 'user' OR NOT EXISTS (SELECT 1 FROM blocks WHERE blocks.blocker_id = ? AND blocks.blocked_id = messages.user_id))"
+
+// lastActivityExpr is a chat's newest message time, falling back to its creation time
+const lastActivityExpr = "COALESCE((SELECT MAX(messages.created_at) FROM messages WHERE messages.chat_id = chats.id AND messages.deleted_at IS NULL), chats.created_at)"
+
+// unreadCountExpr counts the user messages in a chat the member has not read,
+// excluding their own and those from users they blocked
+const unreadCountExpr = "(SELECT COUNT(*) FROM messages WHERE messages.chat_id = chat_members.chat_id AND messages.id > chat_members.last_read_msg_id AND messages.user_id != chat_members.user_id AND messages.kind = 'user' AND messages.deleted_at IS NULL AND " + notExpiredCond + " AND " + notBlockedByMemberCond + ")"
+
+// userChatsQuery selects the chats userID belongs to with their unread count and last activity
+func (r *ChatRepository) userChatsQuery(ctx context.Context, userID int64) *gorm.DB {
+	return r.db.WithContext(ctx).
 		Table("chats").
-		Select("chats.*, (SELECT COUNT(*) FROM messages WHERE messages.chat_id = chats.id AND messages.id > chat_members.last_read_msg_id AND messages.user_id != chat_members.user_id) as unread_count").
+		Select("chats.*, " + unreadCountExpr + " as unread_count, " + lastActivityExpr + " as last_activity_at, chat_members.archived_at IS NOT NULL as archived").
 		Joins("JOIN chat_members ON chat_members.chat_id = chats.id").
-		Where("chat_members.user_id = ?", userID).
+		Where("chat_members.user_id = ?", userID)
+}
+
+// GetUserChats returns all of userID's chats, most recently active first. Chats
+// without messages are ordered by their creation time.
+func (r *ChatRepository) GetUserChats(ctx context.Context, userID int64) ([]domain.Chat, error) {
+	var daos []ChatDAO
+	if err := r.userChatsQuery(ctx, userID).
+		Order("last_activity_at DESC, chats.id DESC").
 		Find(&daos).Error; err != nil {
 		return nil, err
 	}
-	
+	return r.withLastMessages(ctx, userID, daos), nil
+}
+
+// ListUserChats returns one page of userID's chats, most recently active first
+func (r *ChatRepository) ListUserChats(ctx context.Context, userID int64, opts domain.ChatListOptions) ([]domain.Chat, error) {
+	query := r.userChatsQuery(ctx, userID)
+	if opts.Type != 0 {
+		query = query.Where("chats.type = ?", opts.Type)
+	}
+	if opts.FolderID != 0 {
+		query = query.Where("chats.id IN (SELECT chat_id FROM chat_folders WHERE folder_id = ?)", opts.FolderID)
+	}
+	if !opts.IncludeArchived {
+		query = query.Where("chat_members.archived_at IS NULL")
+	}
+	if opts.Cursor != nil {
+		query = query.Where("("+lastActivityExpr+", chats.id) < (?, ?)", opts.Cursor.LastActivityAt, opts.Cursor.ChatID)
+	}
+
+	var daos []ChatDAO
+	if err := query.
+		Order("last_activity_at DESC, chats.id DESC").
+		Limit(opts.Limit).
+		Find(&daos).Error; err != nil {
+		return nil, err
+	}
+	return r.withLastMessages(ctx, userID, daos), nil
+}
+
+// withLastMessages maps chat rows to domain chats with their last message
+// preview as viewerID sees it
+func (r *ChatRepository) withLastMessages(ctx context.Context, viewerID int64, daos []ChatDAO) []domain.Chat {
 	chats := make([]domain.Chat, len(daos))
+	chatIDs := make([]int64, len(daos))
 	for i, dao := range daos {
 		chats[i] = *dao.ToDomain()
-		
-		// Fetch last message
-		var msgDAO MessageDAO
-		if err := r.db.WithContext(ctx).
-			Where("chat_id = ?", dao.ID).
-			Order("created_at DESC").
-			Limit(1).
-			Find(&msgDAO).Error; err == nil && msgDAO.ID != 0 {
-			chats[i].LastMessage = msgDAO.ToDomain()
-			// Populate User for LastMessage if needed? 
-			// Frontend uses `lastMessage.body` and `created_at`. User not strictly needed for preview unless we show "Name: Body".
-			// Current UI just shows Body.
-		}
+		chatIDs[i] = dao.ID
+	}
+
+	// Frontend uses `lastMessage.body` and `created_at`. User not strictly needed for preview unless we show "Name: Body".
+	lastMessages, err := r.getLastMessages(ctx, viewerID, chatIDs)
+	if err != nil {
+		return chats
+	}
+	for i := range chats {
+		chats[i].LastMessage = lastMessages[chats[i].ID]
+	}
+	return chats
+}
+
+// getLastMessages returns the newest message viewerID can see in each of
+// chatIDs in one query, keyed by chat ID. Chats without messages are missing
+// from the map.
+func (r *ChatRepository) getLastMessages(ctx context.Context, viewerID int64, chatIDs []int64) (map[int64]*domain.Message, error) {
+	if len(chatIDs) == 0 {
+		return nil, nil
+	}
+
+	// One idx_messages_chat_id_id lookup per chat
+	var daos []MessageDAO
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT last.* FROM chats
+		CROSS JOIN LATERAL (
+			SELECT * FROM messages
+			WHERE messages.chat_id = chats.id AND messages.deleted_at IS NULL AND `+notExpiredCond+` AND `+notBlockedByViewerCond+`
+			ORDER BY messages.id DESC
+			LIMIT 1
+		) last
+		WHERE chats.id IN ?`, viewerID, chatIDs).
+		Scan(&daos).Error; err != nil {
+		return nil, err
 	}
-	return chats, nil
+
+	messages := make(map[int64]*domain.Message, len(daos))
+	for i := range daos {
+		messages[daos[i].ChatID] = daos[i].ToDomain()
+	}
+	return messages, nil
 }
 
 func (r *ChatRepository) AddMember(ctx context.Context, chatID, userID int64, role domain.Role) error {
@@ -212,9 +467,21 @@ func (r *ChatRepository) RemoveMember(ctx context.Context, chatID, userID int64)
 		Delete(&ChatMemberDAO{}).Error
 }
 
+// memberUserColumns are the user columns loaded with chat members: the public
+// profile, deactivation for anonymizing, and quiet hours for push. Credentials
+// are never read.
+var memberUserColumns = []string{
+	"id", "email", "username", "avatar_url", "created_at", "deactivated_at",
+	"timezone", "dnd_start", "dnd_end", "dnd_allow_mentions",
+}
+
 func (r *ChatRepository) GetChatMembers(ctx context.Context, chatID int64) ([]domain.ChatMember, error) {
 	var daos []ChatMemberDAO
-	if err := r.db.WithContext(ctx).Preload("User").Where("chat_id = ?", chatID).Find(&daos).Error; err != nil {
+	err := r.db.WithContext(ctx).
+		Preload("User", func(db *gorm.DB) *gorm.DB { return db.Select(memberUserColumns) }).
+		Where("chat_id = ?", chatID).
+		Find(&daos).Error
+	if err != nil {
 		return nil, err
 	}
 
@@ -225,6 +492,26 @@ func (r *ChatRepository) GetChatMembers(ctx context.Context, chatID int64) ([]do
 	return members, nil
 }
 
+// CountMembers returns how many users belong to a chat
+func (r *ChatRepository) CountMembers(ctx context.Context, chatID int64) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&ChatMemberDAO{}).Where("chat_id = ?", chatID).Count(&count).Error
+	return count, err
+}
+
+// GetContactIDs returns the distinct IDs of users sharing at least one chat with userID
+func (r *ChatRepository) GetContactIDs(ctx context.Context, userID int64) ([]int64, error) {
+	userChats := r.db.Model(&ChatMemberDAO{}).Select("chat_id").Where("user_id = ?", userID)
+
+	var ids []int64
+	err := r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Distinct().
+		Where("chat_id IN (?) AND user_id <> ?", userChats, userID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
 func (r *ChatRepository) IsMember(ctx context.Context, chatID, userID int64) (bool, error) {
 	var count int64
 	err := r.db.WithContext(ctx).
@@ -246,6 +533,109 @@ func (r *ChatRepository) GetMemberRole(ctx context.Context, chatID, userID int64
 	return domain.Role(role), nil
 }
 
+func (r *ChatRepository) GetMember(ctx context.Context, chatID, userID int64) (*domain.ChatMember, error) {
+	var dao ChatMemberDAO
+	if err := r.db.WithContext(ctx).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		First(&dao).Error; err != nil {
+		return nil, err
+	}
+	return dao.ToDomain(), nil
+}
+
+// GetFirstUnread returns the oldest message from someone else after the member's
+// read marker, or nil if the member has read everything
+func (r *ChatRepository) GetFirstUnread(ctx context.Context, chatID, userID int64) (*int64, error) {
+	var firstID *int64
+	err := r.db.WithContext(ctx).
+		Table("messages").
+		Select("MIN(messages.id)").
+		Joins("JOIN chat_members ON chat_members.chat_id = messages.chat_id AND chat_members.user_id = ?", userID).
+		Where("messages.chat_id = ? AND messages.id > chat_members.last_read_msg_id AND messages.user_id != ? AND messages.deleted_at IS NULL", chatID, userID).
+		Where(notBlockedByMemberCond).
+		Scan(&firstID).Error
+	if err != nil {
+		return nil, err
+	}
+	return firstID, nil
+}
+
+// CountUnreadMessages totals userID's unread messages across all their chats
+func (r *ChatRepository) CountUnreadMessages(ctx context.Context, userID int64) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).
+		Table("chat_members").
+		Select("COALESCE(SUM("+unreadCountExpr+"), 0)").
+		Where("chat_members.user_id = ?", userID).
+		Scan(&total).Error
+	return total, err
+}
+
+// GetUnreadCounts returns userID's unread count per chat in one aggregate, skipping chats with nothing unread
+func (r *ChatRepository) GetUnreadCounts(ctx context.Context, userID int64) ([]domain.ChatUnread, error) {
+	var counts []domain.ChatUnread
+	err := r.db.WithContext(ctx).
+		Table("chat_members").
+		Select("chat_members.chat_id, COUNT(messages.id) as count").
+		Joins("JOIN messages ON messages.chat_id = chat_members.chat_id AND messages.id > chat_members.last_read_msg_id AND messages.user_id != chat_members.user_id AND messages.kind = 'user' AND messages.deleted_at IS NULL AND " + notExpiredCond + " AND " + notBlockedByMemberCond).
+		Where("chat_members.user_id = ?", userID).
+		Group("chat_members.chat_id").
+		Order("chat_members.chat_id").
+		Scan(&counts).Error
+	return counts, err
+}
+
+func (r *ChatRepository) UpdateNotificationLevel(ctx context.Context, chatID, userID int64, level domain.NotificationLevel) error {
+	return r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Update("notification_level", string(level)).Error
+}
+
+func (r *ChatRepository) SetArchivedAt(ctx context.Context, chatID, userID int64, archivedAt *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Update("archived_at", archivedAt).Error
+}
+
+// SetMutedUntil mutes a chat for a member until mutedUntil; nil unmutes it
+func (r *ChatRepository) SetMutedUntil(ctx context.Context, chatID, userID int64, mutedUntil *time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Update("muted_until", mutedUntil).Error
+}
+
+// GetMutedMemberIDs returns the members of a chat who have it muted at now
+func (r *ChatRepository) GetMutedMemberIDs(ctx context.Context, chatID int64, now time.Time) ([]int64, error) {
+	var userIDs []int64
+	err := r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND muted_until > ?", chatID, now).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// HasArchivedMembers reports whether any member has archived the chat. The
+// partial idx_chat_members_archived index keeps this cheap on every message.
+func (r *ChatRepository) HasArchivedMembers(ctx context.Context, chatID int64) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND archived_at IS NOT NULL", chatID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UnarchiveForAll clears the archived flag for every member of a chat
+func (r *ChatRepository) UnarchiveForAll(ctx context.Context, chatID int64) error {
+	return r.db.WithContext(ctx).
+		Model(&ChatMemberDAO{}).
+		Where("chat_id = ? AND archived_at IS NOT NULL", chatID).
+		Update("archived_at", nil).Error
+}
+
 func (r *ChatRepository) CreateMessage(ctx context.Context, msg *domain.Message) error {
 	dao := FromDomainMessage(msg)
 	if err := r.db.WithContext(ctx).Create(dao).Error; err != nil {
@@ -256,35 +646,276 @@ func (r *ChatRepository) CreateMessage(ctx context.Context, msg *domain.Message)
 	return nil
 }
 
-func (r *ChatRepository) GetMessageHistory(ctx context.Context, chatID int64, limit int) ([]domain.Message, error) {
+// replyCountExpr and lastReplyAtExpr summarise the live replies to each message in a history page
+const (
+	replyCountExpr  = "(SELECT COUNT(*) FROM messages replies WHERE replies.reply_to_id = messages.id AND replies.deleted_at IS NULL AND (replies.expires_at IS NULL OR replies.expires_at > NOW()))"
+	lastReplyAtExpr = "(SELECT MAX(replies.created_at) FROM messages replies WHERE replies.reply_to_id = messages.id AND replies.deleted_at IS NULL AND (replies.expires_at IS NULL OR replies.expires_at > NOW()))"
+)
+
+// GetMessageHistory returns up to limit messages older than beforeID, newest first.
+// beforeID 0 starts from the newest message. The cursor is a keyset on
+// (chat_id, id), so every page is an index range scan regardless of depth.
+// Soft-deleted messages are skipped unless includeDeleted is set, and messages
+// from users viewerID has blocked always are.
+func (r *ChatRepository) GetMessageHistory(ctx context.Context, chatID, viewerID, beforeID int64, limit int, includeDeleted bool) ([]domain.Message, error) {
+	query := r.db.WithContext(ctx).
+		Select("messages.*, "+replyCountExpr+" as reply_count, "+lastReplyAtExpr+" as last_reply_at").
+		Where("messages.chat_id = ?", chatID)
+	if beforeID > 0 {
+		query = query.Where("messages.id < ?", beforeID)
+	}
+	if !includeDeleted {
+		query = query.Where("messages.deleted_at IS NULL")
+	}
+	// Expired messages stay hidden until the sweeper deletes them, even from admins
+	query = query.Where(notExpiredCond).Where(notBlockedByViewerCond, viewerID)
+
+	var daos []MessageDAO
+	if err := query.
+		Order("messages.id DESC").
+		Limit(limit).
+		Find(&daos).Error; err != nil {
+		return nil, err
+	}
+	return r.withReactions(ctx, daos)
+}
+
+// GetMessagesAfter returns up to limit messages newer than afterID, oldest
+// first, skipping those from users viewerID has blocked
+func (r *ChatRepository) GetMessagesAfter(ctx context.Context, chatID, viewerID, afterID int64, limit int) ([]domain.Message, error) {
 	var daos []MessageDAO
 	if err := r.db.WithContext(ctx).
-		Where("chat_id = ?", chatID).
-		Order("id DESC").
+		Where("chat_id = ? AND id > ? AND deleted_at IS NULL", chatID, afterID).
+		Where(notExpiredCond).
+		Where(notBlockedByViewerCond, viewerID).
+		Order("id ASC").
 		Limit(limit).
 		Find(&daos).Error; err != nil {
 		return nil, err
 	}
-	
+	return r.withReactions(ctx, daos)
+}
+
+// GetMessage returns a single message with its reactions. Soft-deleted and expired messages are not found.
+func (r *ChatRepository) GetMessage(ctx context.Context, msgID int64) (*domain.Message, error) {
+	var dao MessageDAO
+	if err := r.db.WithContext(ctx).Where("deleted_at IS NULL").Where(notExpiredCond).First(&dao, msgID).Error; err != nil {
+		return nil, err
+	}
+	msg := dao.ToDomain()
+
+	var reactionDAOs []ReactionDAO
+	if err := r.db.WithContext(ctx).
+		Where("message_id = ?", msgID).
+		Find(&reactionDAOs).Error; err == nil {
+		msg.Reactions = make([]domain.Reaction, len(reactionDAOs))
+		for i, rDAO := range reactionDAOs {
+			msg.Reactions[i] = *rDAO.ToDomain()
+		}
+	}
+	msgs := []domain.Message{*msg}
+	if err := r.withReplySnippets(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return &msgs[0], nil
+}
+
+func (r *ChatRepository) UpdateMessage(ctx context.Context, msg *domain.Message) error {
+	dao := FromDomainMessage(msg)
+	result := r.db.WithContext(ctx).
+		Model(dao).
+		Select("body", "edited_at").
+		Updates(dao)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *ChatRepository) SoftDeleteMessage(ctx context.Context, msgID int64, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&MessageDAO{}).
+		Where("id = ? AND deleted_at IS NULL", msgID).
+		Update("deleted_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetMessagesByIDs returns the messages with the given IDs, with reactions, in one
+// query per table. Missing and soft-deleted IDs are skipped.
+func (r *ChatRepository) GetMessagesByIDs(ctx context.Context, ids []int64) ([]domain.Message, error) {
+	var daos []MessageDAO
+	if err := r.db.WithContext(ctx).Where("id IN ? AND deleted_at IS NULL", ids).Where(notExpiredCond).Find(&daos).Error; err != nil {
+		return nil, err
+	}
+	return r.withReactions(ctx, daos)
+}
+
+// withReactions converts daos to messages, attaches their reactions in one query
+// and fills in missing reply snippets
+func (r *ChatRepository) withReactions(ctx context.Context, daos []MessageDAO) ([]domain.Message, error) {
+	if len(daos) == 0 {
+		return []domain.Message{}, nil
+	}
+	ids := make([]int64, len(daos))
+	for i, dao := range daos {
+		ids[i] = dao.ID
+	}
+
+	var reactionDAOs []ReactionDAO
+	if err := r.db.WithContext(ctx).Where("message_id IN ?", ids).Find(&reactionDAOs).Error; err != nil {
+		return nil, err
+	}
+	reactions := make(map[int64][]domain.Reaction)
+	for _, rDAO := range reactionDAOs {
+		reactions[rDAO.MessageID] = append(reactions[rDAO.MessageID], *rDAO.ToDomain())
+	}
+
 	msgs := make([]domain.Message, len(daos))
 	for i, dao := range daos {
 		msgs[i] = *dao.ToDomain()
-		
-		// Fetch reactions for this message
-		var reactionDAOs []ReactionDAO
-		if err := r.db.WithContext(ctx).
-			Where("message_id = ?", dao.ID).
-			Find(&reactionDAOs).Error; err == nil {
-			reactions := make([]domain.Reaction, len(reactionDAOs))
-			for j, rDAO := range reactionDAOs {
-				reactions[j] = *rDAO.ToDomain()
-			}
-			msgs[i].Reactions = reactions
-		}
+		msgs[i].Reactions = reactions[dao.ID]
+	}
+	if err := r.withReplySnippets(ctx, msgs); err != nil {
+		return nil, err
 	}
 	return msgs, nil
 }
 
+// withReplySnippets hydrates the snippet of replies sent without one from their
+// parents, in one query. Replies whose parent is gone or deleted keep an empty snippet.
+func (r *ChatRepository) withReplySnippets(ctx context.Context, msgs []domain.Message) error {
+	var parentIDs []int64
+	for _, m := range msgs {
+		if m.ReplyToID != nil && m.ReplySnippet == "" {
+			parentIDs = append(parentIDs, *m.ReplyToID)
+		}
+	}
+	if len(parentIDs) == 0 {
+		return nil
+	}
+
+	var parents []MessageDAO
+	if err := r.db.WithContext(ctx).Select("id", "body").Where("id IN ? AND deleted_at IS NULL", parentIDs).Where(notExpiredCond).Find(&parents).Error; err != nil {
+		return err
+	}
+	bodies := make(map[int64]string, len(parents))
+	for _, p := range parents {
+		bodies[p.ID] = p.Body
+	}
+	for i := range msgs {
+		if msgs[i].ReplyToID != nil && msgs[i].ReplySnippet == "" {
+			msgs[i].ReplySnippet = domain.ReplySnippetOf(bodies[*msgs[i].ReplyToID])
+		}
+	}
+	return nil
+}
+
+// GetLastMessage returns the newest message in a chat, or nil if the chat has none
+func (r *ChatRepository) GetLastMessage(ctx context.Context, chatID int64) (*domain.Message, error) {
+	var dao MessageDAO
+	if err := r.db.WithContext(ctx).
+		Where("chat_id = ? AND deleted_at IS NULL", chatID).
+		Where(notExpiredCond).
+		Order("id DESC").
+		Limit(1).
+		Find(&dao).Error; err != nil {
+		return nil, err
+	}
+	if dao.ID == 0 {
+		return nil, nil
+	}
+	return dao.ToDomain(), nil
+}
+
+// CountMessagesWithMedia counts live messages still referencing objectKey, e.g. forwards of a deleted message
+func (r *ChatRepository) CountMessagesWithMedia(ctx context.Context, objectKey string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&MessageDAO{}).
+		Where("media_key = ? AND deleted_at IS NULL", objectKey).
+		Count(&count).Error
+	return count, err
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// CanAccessMedia reports whether userID is a member of a chat where a live
+// message references objectKey, which also covers forwards into other chats.
+// Only the validated media_key counts; media_url is whatever the sender wrote.
+func (r *ChatRepository) CanAccessMedia(ctx context.Context, userID int64, objectKey string) (bool, error) {
+	var ok bool
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT EXISTS (
+			SELECT 1 FROM messages m
+			JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ?
+			WHERE m.deleted_at IS NULL AND m.media_key = ?
+		)`, userID, objectKey).
+		Scan(&ok).Error
+	return ok, err
+}
+
+func (r *ChatRepository) PurgeExpiredMessages(ctx context.Context, defaultDays, limit int) (int64, []string, error) {
+	// Receipts, reactions and pins cascade; replies keep their snippet and lose reply_to_id
+	var rows []struct{ MediaKey string }
+	err := r.db.WithContext(ctx).Raw(`
+		DELETE FROM messages WHERE id IN (
+			SELECT m.id FROM messages m
+			JOIN chats c ON c.id = m.chat_id
+			WHERE COALESCE(NULLIF(c.retention_days, 0), ?) > 0
+			  AND m.created_at < NOW() - COALESCE(NULLIF(c.retention_days, 0), ?) * INTERVAL '1 day'
+			  AND NOT EXISTS (SELECT 1 FROM pinned_messages p WHERE p.msg_id = m.id)
+			ORDER BY m.id
+			LIMIT ?
+		)
+		RETURNING media_key`,
+		defaultDays, defaultDays, limit,
+	).Scan(&rows).Error
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var mediaKeys []string
+	for _, row := range rows {
+		if row.MediaKey != "" {
+			mediaKeys = append(mediaKeys, row.MediaKey)
+		}
+	}
+	return int64(len(rows)), mediaKeys, nil
+}
+
+// DeleteExpiredMessages permanently deletes up to limit messages past their
+// expires_at. Rows locked by a concurrent sweeper are skipped rather than waited on.
+func (r *ChatRepository) DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) ([]domain.Message, error) {
+	// Receipts, reactions and pins cascade; replies keep their snippet and lose reply_to_id
+	var daos []MessageDAO
+	err := r.db.WithContext(ctx).Raw(`
+		DELETE FROM messages WHERE id IN (
+			SELECT id FROM messages
+			WHERE expires_at IS NOT NULL AND expires_at <= ?
+			ORDER BY expires_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now, limit,
+	).Scan(&daos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]domain.Message, len(daos))
+	for i := range daos {
+		messages[i] = *daos[i].ToDomain()
+	}
+	return messages, nil
+}
+
 func (r *ChatRepository) CreateReceipt(ctx context.Context, receipt *domain.Receipt) error {
 	dao := FromDomainReceipt(receipt)
 	return r.db.WithContext(ctx).Create(dao).Error
@@ -297,18 +928,67 @@ func (r *ChatRepository) UpdateLastReadMessage(ctx context.Context, chatID, user
 		Update("last_read_msg_id", msgID).Error
 }
 
-func (r *ChatRepository) AddDeviceToken(ctx context.Context, token *domain.DeviceToken) error {
-	dao := FromDomainDeviceToken(token)
-	return r.db.WithContext(ctx).Save(dao).Error
+// MarkDelivered moves userID's receipt for msgID from sent to delivered and
+// advances their delivered watermark in the chat. Neither ever moves backwards.
+func (r *ChatRepository) MarkDelivered(ctx context.Context, chatID, userID, msgID int64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ReceiptDAO{}).
+			Where("msg_id = ? AND user_id = ? AND status = ?", msgID, userID, domain.ReceiptStatusSent).
+			Update("status", domain.ReceiptStatusDelivered).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ChatMemberDAO{}).
+			Where("chat_id = ? AND user_id = ? AND last_delivered_msg_id < ?", chatID, userID, msgID).
+			Update("last_delivered_msg_id", msgID).Error
+	})
+}
+
+// AddDeviceToken upserts a push token and refreshes its updated_at, so tokens
+// that stop being re-registered can be pruned. created is false when the
+// user had already registered the token.
+func (r *ChatRepository) AddDeviceToken(ctx context.Context, token *domain.DeviceToken) (bool, error) {
+	var created bool
+	// xmax is 0 only for rows this statement inserted rather than updated
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO device_tokens (user_id, token, platform, updated_at)
+		VALUES (?, ?, ?, NOW())
+		ON CONFLICT (user_id, token) DO UPDATE
+		SET platform = EXCLUDED.platform, updated_at = EXCLUDED.updated_at
+		RETURNING (xmax = 0)`,
+		token.UserID, token.Token, token.Platform,
+	).Scan(&created).Error
+	return created, err
 }
 
-func (r *ChatRepository) GetDeviceTokens(ctx context.Context, userID int64) ([]string, error) {
-	var tokens []string
+func (r *ChatRepository) GetDeviceTokens(ctx context.Context, userID int64) ([]domain.DeviceToken, error) {
+	var daos []DeviceTokenDAO
 	err := r.db.WithContext(ctx).
-		Model(&DeviceTokenDAO{}).
 		Where("user_id = ?", userID).
-		Pluck("token", &tokens).Error
-	return tokens, err
+		Find(&daos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]domain.DeviceToken, len(daos))
+	for i, dao := range daos {
+		tokens[i] = *dao.ToDomain()
+	}
+	return tokens, nil
+}
+
+// RemoveDeviceToken deletes a push token the provider reported as no longer
+// registered, whichever user it belongs to
+func (r *ChatRepository) RemoveDeviceToken(ctx context.Context, token string) error {
+	return r.db.WithContext(ctx).
+		Where("token = ?", token).
+		Delete(&DeviceTokenDAO{}).Error
+}
+
+// RemoveUserDeviceTokens deletes every push token registered by a user
+func (r *ChatRepository) RemoveUserDeviceTokens(ctx context.Context, userID int64) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Delete(&DeviceTokenDAO{}).Error
 }
 
 func (r *ChatRepository) GetPrivateChatBetweenUsers(ctx context.Context, userA, userB int64) (*domain.Chat, error) {
@@ -354,6 +1034,200 @@ func (r *ChatRepository) RemoveReaction(ctx context.Context, msgID, userID int64
 		Delete(&ReactionDAO{}).Error
 }
 
+// PinMessage pins a message, or moves an already pinned one to the top by
+// refreshing its pinned_at
+func (r *ChatRepository) PinMessage(ctx context.Context, pin *domain.PinnedMessage) error {
+	dao := FromDomainPinnedMessage(pin)
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "msg_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"pinned_by", "pinned_at"}),
+		}).
+		Create(dao).Error
+}
+
+// UnpinMessage removes a pin and reports whether the message was pinned
+func (r *ChatRepository) UnpinMessage(ctx context.Context, chatID, msgID int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("chat_id = ? AND msg_id = ?", chatID, msgID).
+		Delete(&PinnedMessageDAO{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *ChatRepository) CreateScheduledMessage(ctx context.Context, sm *domain.ScheduledMessage) error {
+	dao := FromDomainScheduledMessage(sm)
+	if err := r.db.WithContext(ctx).Create(dao).Error; err != nil {
+		return err
+	}
+	sm.ID = dao.ID
+	sm.CreatedAt = dao.CreatedAt
+	return nil
+}
+
+func (r *ChatRepository) ListScheduledMessages(ctx context.Context, chatID, userID int64) ([]domain.ScheduledMessage, error) {
+	var daos []ScheduledMessageDAO
+	if err := r.db.WithContext(ctx).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Order("send_at, id").
+		Find(&daos).Error; err != nil {
+		return nil, err
+	}
+
+	messages := make([]domain.ScheduledMessage, len(daos))
+	for i := range daos {
+		messages[i] = *daos[i].ToDomain()
+	}
+	return messages, nil
+}
+
+func (r *ChatRepository) DeleteScheduledMessage(ctx context.Context, chatID, userID, id int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND chat_id = ? AND user_id = ?", id, chatID, userID).
+		Delete(&ScheduledMessageDAO{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ClaimDueScheduledMessages deletes and returns due messages. Rows locked by
+// another dispatcher are skipped, so several chat-svc replicas can poll at once.
+func (r *ChatRepository) ClaimDueScheduledMessages(ctx context.Context, now time.Time, limit int) ([]domain.ScheduledMessage, error) {
+	var daos []ScheduledMessageDAO
+	err := r.db.WithContext(ctx).Raw(`
+		DELETE FROM scheduled_messages WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE send_at <= ?
+			ORDER BY send_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now, limit,
+	).Scan(&daos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]domain.ScheduledMessage, len(daos))
+	for i := range daos {
+		messages[i] = *daos[i].ToDomain()
+	}
+	return messages, nil
+}
+
+func (r *ChatRepository) CreateFolder(ctx context.Context, folder *domain.Folder) error {
+	dao := FromDomainFolder(folder)
+	if err := r.db.WithContext(ctx).Create(dao).Error; err != nil {
+		return err
+	}
+	folder.ID = dao.ID
+	folder.CreatedAt = dao.CreatedAt
+	return nil
+}
+
+func (r *ChatRepository) GetFolder(ctx context.Context, folderID int64) (*domain.Folder, error) {
+	var dao FolderDAO
+	if err := r.db.WithContext(ctx).First(&dao, folderID).Error; err != nil {
+		return nil, err
+	}
+	return dao.ToDomain(), nil
+}
+
+func (r *ChatRepository) RenameFolder(ctx context.Context, folderID int64, name string) error {
+	return r.db.WithContext(ctx).
+		Model(&FolderDAO{}).
+		Where("id = ?", folderID).
+		Update("name", name).Error
+}
+
+func (r *ChatRepository) DeleteFolder(ctx context.Context, folderID int64) error {
+	return r.db.WithContext(ctx).Delete(&FolderDAO{}, folderID).Error
+}
+
+// folderWithCounts is a folders row joined with its aggregated chat and unread counts
+type folderWithCounts struct {
+	FolderDAO
+	ChatCount   int64
+	UnreadCount int64
+}
+
+// ListFolders returns userID's folders, oldest first. Counts only cover chats
+// the user is still a member of, so leaving a chat drops it from its folders'
+// totals without touching chat_folders.
+func (r *ChatRepository) ListFolders(ctx context.Context, userID int64) ([]domain.Folder, error) {
+	var rows []folderWithCounts
+	err := r.db.WithContext(ctx).
+		Table("folders").
+		Select("folders.*, COUNT(fc.chat_id) as chat_count, COALESCE(SUM(fc.unread), 0) as unread_count").
+		Joins(`LEFT JOIN (
+			SELECT chat_folders.folder_id, chat_folders.chat_id, `+unreadCountExpr+` as unread
+			FROM chat_folders
+			JOIN chat_members ON chat_members.chat_id = chat_folders.chat_id AND chat_members.user_id = ?
+		) fc ON fc.folder_id = folders.id`, userID).
+		Where("folders.user_id = ?", userID).
+		Group("folders.id").
+		Order("folders.created_at ASC, folders.id ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make([]domain.Folder, len(rows))
+	for i, row := range rows {
+		folders[i] = *row.ToDomain()
+		folders[i].ChatCount = row.ChatCount
+		folders[i].UnreadCount = row.UnreadCount
+	}
+	return folders, nil
+}
+
+// AddChatToFolder assigns a chat to a folder; assigning it twice is a no-op
+func (r *ChatRepository) AddChatToFolder(ctx context.Context, folderID, chatID int64) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ChatFolderDAO{FolderID: folderID, ChatID: chatID}).Error
+}
+
+// RemoveChatFromFolder unassigns a chat and reports whether it was in the folder
+func (r *ChatRepository) RemoveChatFromFolder(ctx context.Context, folderID, chatID int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("folder_id = ? AND chat_id = ?", folderID, chatID).
+		Delete(&ChatFolderDAO{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetPinnedMessages returns a chat's pins with their messages, newest pin first
+func (r *ChatRepository) GetPinnedMessages(ctx context.Context, chatID int64) ([]domain.PinnedMessage, error) {
+	var daos []PinnedMessageDAO
+	if err := r.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("pinned_at DESC, msg_id DESC").
+		Find(&daos).Error; err != nil {
+		return nil, err
+	}
+	if len(daos) == 0 {
+		return []domain.PinnedMessage{}, nil
+	}
+
+	ids := make([]int64, len(daos))
+	for i, dao := range daos {
+		ids[i] = dao.MsgID
+	}
+	msgs, err := r.GetMessagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*domain.Message, len(msgs))
+	for i := range msgs {
+		byID[msgs[i].ID] = &msgs[i]
+	}
+
+	pins := make([]domain.PinnedMessage, len(daos))
+	for i, dao := range daos {
+		pins[i] = *dao.ToDomain()
+		pins[i].Message = byID[dao.MsgID]
+	}
+	return pins, nil
+}
+
 // RemoveAllUserReactions removes all reactions from a user on a specific message
 func (r *ChatRepository) RemoveAllUserReactions(ctx context.Context, msgID, userID int64) error {
 	return r.db.WithContext(ctx).
@@ -375,11 +1249,12 @@ func (r *ChatRepository) GetReactions(ctx context.Context, msgID int64) ([]domai
 	return reactions, nil
 }
 
-// GetThreadReplies returns all messages that are replies to a parent message
-func (r *ChatRepository) GetThreadReplies(ctx context.Context, parentMsgID int64, limit int) ([]domain.Message, error) {
+// GetThreadReplies returns up to limit live replies to a parent message in chatID, oldest first
+func (r *ChatRepository) GetThreadReplies(ctx context.Context, chatID, parentMsgID int64, limit int) ([]domain.Message, error) {
 	var daos []MessageDAO
 	if err := r.db.WithContext(ctx).
-		Where("reply_to_id = ?", parentMsgID).
+		Where("chat_id = ? AND reply_to_id = ? AND deleted_at IS NULL", chatID, parentMsgID).
+		Where(notExpiredCond).
 		Order("id ASC").
 		Limit(limit).
 		Find(&daos).Error; err != nil {
@@ -390,6 +1265,9 @@ func (r *ChatRepository) GetThreadReplies(ctx context.Context, parentMsgID int64
 	for i, dao := range daos {
 		msgs[i] = *dao.ToDomain()
 	}
+	if err := r.withReplySnippets(ctx, msgs); err != nil {
+		return nil, err
+	}
 	return msgs, nil
 }
 
@@ -398,7 +1276,8 @@ func (r *ChatRepository) GetReplyCount(ctx context.Context, msgID int64) (int64,
 	var count int64
 	err := r.db.WithContext(ctx).
 		Model(&MessageDAO{}).
-		Where("reply_to_id = ?", msgID).
+		Where("reply_to_id = ? AND deleted_at IS NULL", msgID).
+		Where(notExpiredCond).
 		Count(&count).Error
 	return count, err
 }
@@ -0,0 +1,507 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to the migrated database in TEST_DATABASE_DSN, skipping when unset
+func openTestDB(t *testing.T) *DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := New(Config{DSN: dsn, MaxOpenConns: 4, MaxIdleConns: 4, ConnMaxLifetime: time.Minute})
+	require.NoError(t, err)
+	db.DB = db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// seedUsers creates n users, removed again when the test ends
+func seedUsers(t *testing.T, db *DB, n int) []int64 {
+	ids := make([]int64, n)
+	for i := range ids {
+		email := fmt.Sprintf("test-%d-%d@example.com", time.Now().UnixNano(), i)
+		require.NoError(t, db.Raw("INSERT INTO users (email, password_hash) VALUES (?, 'x') RETURNING id", email).Scan(&ids[i]).Error)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id IN ?", ids) })
+	return ids
+}
+
+// TestChatRepository_CreateChatAddsMembers checks that a group with two members
+// gets exactly three member rows, the creator's as owner.
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run=CreateChat ./internal/repository/postgres/
+func TestChatRepository_CreateChatAddsMembers(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 3)
+	repo := NewChatRepository(db)
+
+	chat, err := repo.CreateChat(context.Background(), &domain.Chat{Type: domain.ChatTypeGroup, Title: "g"}, users[0], users[1:])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	var members []ChatMemberDAO
+	require.NoError(t, db.Where("chat_id = ?", chat.ID).Order("user_id").Find(&members).Error)
+	require.Len(t, members, 3)
+	roles := make(map[int64]string, len(members))
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	assert.Equal(t, map[int64]string{
+		users[0]: string(domain.RoleOwner),
+		users[1]: string(domain.RoleMember),
+		users[2]: string(domain.RoleMember),
+	}, roles)
+}
+
+// TestChatRepository_CreateChatRollsBack checks that a failing member insert
+// leaves neither the chat nor any of its members behind.
+func TestChatRepository_CreateChatRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 2)
+	repo := NewChatRepository(db)
+
+	var maxID int64
+	require.NoError(t, db.Raw("SELECT COALESCE(MAX(id), 0) FROM users").Scan(&maxID).Error)
+	missing := maxID + 1_000_000 // violates chat_members.user_id's foreign key
+
+	title := fmt.Sprintf("rollback-%d", time.Now().UnixNano())
+	_, err := repo.CreateChat(context.Background(), &domain.Chat{Type: domain.ChatTypeGroup, Title: title}, users[0], []int64{users[1], missing})
+	require.Error(t, err)
+
+	var chats, members int64
+	require.NoError(t, db.Model(&ChatDAO{}).Where("title = ?", title).Count(&chats).Error)
+	require.NoError(t, db.Model(&ChatMemberDAO{}).Where("user_id IN ?", users).Count(&members).Error)
+	assert.Zero(t, chats)
+	assert.Zero(t, members)
+}
+
+// TestChatRepository_GetUserChatsByActivity checks that chats come newest
+// activity first, with empty chats placed by their creation time.
+func TestChatRepository_GetUserChatsByActivity(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 1)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	now := time.Now()
+	newChat := func(createdAt time.Time) int64 {
+		var id int64
+		require.NoError(t, db.Raw("INSERT INTO chats (type, created_at) VALUES (2, ?) RETURNING id", createdAt).Scan(&id).Error)
+		t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", id) })
+		require.NoError(t, db.Exec("INSERT INTO chat_members (chat_id, user_id, role) VALUES (?, ?, 'owner')", id, users[0]).Error)
+		return id
+	}
+	post := func(chatID int64, at time.Time) {
+		require.NoError(t, db.Exec("INSERT INTO messages (chat_id, user_id, body, created_at) VALUES (?, ?, 'hi', ?)", chatID, users[0], at).Error)
+	}
+
+	oldChatNewMessage := newChat(now.Add(-3 * time.Hour))
+	post(oldChatNewMessage, now.Add(-time.Minute))
+	empty := newChat(now.Add(-time.Hour))
+	quiet := newChat(now.Add(-2 * time.Hour))
+	post(quiet, now.Add(-90*time.Minute))
+
+	chats, err := repo.GetUserChats(ctx, users[0])
+	require.NoError(t, err)
+	ids := make([]int64, len(chats))
+	for i, c := range chats {
+		ids[i] = c.ID
+	}
+	assert.Equal(t, []int64{oldChatNewMessage, empty, quiet}, ids)
+	assert.Nil(t, chats[1].LastMessage)
+	assert.WithinDuration(t, now.Add(-time.Hour), chats[1].LastActivityAt, time.Second)
+}
+
+// TestChatRepository_CanAccessMedia checks that media is visible to members of
+// chats referencing it by validated key, and not through a message that merely
+// names it in its URL or a lookalike key.
+func TestChatRepository_CanAccessMedia(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 3)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "media"}, users[0], users[1:2])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+	own, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "outsider"}, users[2], nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", own.ID) })
+
+	key := fmt.Sprintf("uploads/%d/%d/a_b.png", chat.ID, users[0])
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "pic", Kind: domain.MessageKindUser,
+		MediaURL: "http://localhost:9000/chat-media/" + key, MediaKey: key}))
+	// An outsider naming the key in their own chat's message gets no key stored
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: own.ID, UserID: users[2], Body: "stolen", Kind: domain.MessageKindUser,
+		MediaURL: "http://localhost:9000/chat-media/" + key}))
+
+	ok, err := repo.CanAccessMedia(ctx, users[1], key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repo.CanAccessMedia(ctx, users[2], key)
+	require.NoError(t, err)
+	assert.False(t, ok, "an unvalidated URL in the outsider's own chat grants nothing")
+
+	ok, err = repo.CanAccessMedia(ctx, users[1], fmt.Sprintf("uploads/%d/%d/a%%b.png", chat.ID, users[0]))
+	require.NoError(t, err)
+	assert.False(t, ok, "lookalike keys must not match")
+}
+
+// TestChatRepository_CountMessagesWithMedia checks that references are counted
+// by object key, whatever URL the message was sent with.
+func TestChatRepository_CountMessagesWithMedia(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 1)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "refs"}, users[0], nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	key := fmt.Sprintf("uploads/%d/%d/a.png", chat.ID, users[0])
+	for _, url := range []string{"http://localhost:9000/chat-media/" + key, "http://127.0.0.1:9000/chat-media/" + key} {
+		require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "pic", Kind: domain.MessageKindUser,
+			MediaURL: url, MediaKey: key}))
+	}
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "unchecked", Kind: domain.MessageKindUser,
+		MediaURL: "http://localhost:9000/chat-media/" + key}))
+
+	refs, err := repo.CountMessagesWithMedia(ctx, key)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, refs)
+}
+
+// TestChatRepository_ExpiredMessages checks that expired messages vanish from
+// history at once and are deleted by the sweep, reporting earlier soft deletes.
+func TestChatRepository_ExpiredMessages(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 1)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "ttl"}, users[0], nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	send := func(expiresAt *time.Time) *domain.Message {
+		msg := &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "x", Kind: domain.MessageKindUser, ExpiresAt: expiresAt}
+		require.NoError(t, repo.CreateMessage(ctx, msg))
+		return msg
+	}
+	expired := send(&past)
+	expiredDeleted := send(&past)
+	live := send(&future)
+	_, err = repo.SoftDeleteMessage(ctx, expiredDeleted.ID, time.Now())
+	require.NoError(t, err)
+
+	history, err := repo.GetMessageHistory(ctx, chat.ID, users[0], 0, 10, true)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, live.ID, history[0].ID)
+
+	swept, err := repo.DeleteExpiredMessages(ctx, time.Now(), 100)
+	require.NoError(t, err)
+	byID := make(map[int64]domain.Message)
+	for _, m := range swept {
+		if m.ChatID == chat.ID {
+			byID[m.ID] = m
+		}
+	}
+	require.Len(t, byID, 2)
+	assert.Nil(t, byID[expired.ID].DeletedAt)
+	assert.NotNil(t, byID[expiredDeleted.ID].DeletedAt)
+}
+
+// TestChatRepository_ExpiredMessagesHidden checks that expired messages that
+// haven't been swept yet stay out of batch lookups, threads, reply snippets and
+// unread counts.
+func TestChatRepository_ExpiredMessagesHidden(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 2)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "ttl"}, users[0], users[1:])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	past := time.Now().Add(-time.Minute)
+	send := func(body string, replyTo *int64, expiresAt *time.Time) *domain.Message {
+		msg := &domain.Message{ChatID: chat.ID, UserID: users[0], Body: body, Kind: domain.MessageKindUser, ReplyToID: replyTo, ExpiresAt: expiresAt}
+		require.NoError(t, repo.CreateMessage(ctx, msg))
+		return msg
+	}
+	parent := send("parent", nil, nil)
+	expiredReply := send("gone", &parent.ID, &past)
+	liveReply := send("here", &parent.ID, nil)
+	expiredParent := send("secret", nil, &past)
+	replyToExpired := send("re", &expiredParent.ID, nil)
+
+	batch, err := repo.GetMessagesByIDs(ctx, []int64{parent.ID, expiredReply.ID, expiredParent.ID})
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, parent.ID, batch[0].ID)
+
+	thread, err := repo.GetThreadReplies(ctx, chat.ID, parent.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, thread, 1)
+	assert.Equal(t, liveReply.ID, thread[0].ID)
+
+	replies, err := repo.GetMessagesByIDs(ctx, []int64{replyToExpired.ID})
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Empty(t, replies[0].ReplySnippet, "an expired parent's text isn't quoted")
+
+	counts, err := repo.GetUnreadCounts(ctx, users[1])
+	require.NoError(t, err)
+	assert.Equal(t, []domain.ChatUnread{{ChatID: chat.ID, Count: 3}}, counts)
+	total, err := repo.CountUnreadMessages(ctx, users[1])
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, total)
+}
+
+// TestChatRepository_UnreadCountsSkipSystemMessages checks that group events
+// such as joins don't count as unread.
+func TestChatRepository_UnreadCountsSkipSystemMessages(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 2)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "events"}, users[0], users[1:])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "joined", Kind: domain.MessageKindSystem}))
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "hi", Kind: domain.MessageKindUser}))
+
+	counts, err := repo.GetUnreadCounts(ctx, users[1])
+	require.NoError(t, err)
+	assert.Equal(t, []domain.ChatUnread{{ChatID: chat.ID, Count: 1}}, counts)
+	total, err := repo.CountUnreadMessages(ctx, users[1])
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+}
+
+func TestChatRepository_BlockedSendersHidden(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 3)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "blocks"}, users[0], users[1:])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	// users[1] blocked users[0]; users[2] didn't
+	require.NoError(t, NewBlockRepository(db).Block(ctx, users[1], users[0]))
+	joined := &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "joined", Kind: domain.MessageKindSystem}
+	require.NoError(t, repo.CreateMessage(ctx, joined))
+	hidden := &domain.Message{ChatID: chat.ID, UserID: users[0], Body: "hi", Kind: domain.MessageKindUser}
+	require.NoError(t, repo.CreateMessage(ctx, hidden))
+
+	history, err := repo.GetMessageHistory(ctx, chat.ID, users[1], 0, 10, false)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, joined.ID, history[0].ID)
+	after, err := repo.GetMessagesAfter(ctx, chat.ID, users[1], 0, 10)
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+	assert.Equal(t, joined.ID, after[0].ID)
+	history, err = repo.GetMessageHistory(ctx, chat.ID, users[2], 0, 10, false)
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	chats, err := repo.GetUserChats(ctx, users[1])
+	require.NoError(t, err)
+	require.Len(t, chats, 1)
+	require.NotNil(t, chats[0].LastMessage)
+	assert.Equal(t, joined.ID, chats[0].LastMessage.ID)
+	assert.EqualValues(t, 0, chats[0].UnreadCount)
+	counts, err := repo.GetUnreadCounts(ctx, users[1])
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+	total, err := repo.CountUnreadMessages(ctx, users[2])
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+}
+
+func TestChatRepository_ScheduledMessages(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 1)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "later"}, users[0], nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	schedule := func(sendAt time.Time) *domain.ScheduledMessage {
+		sm := &domain.ScheduledMessage{
+			ChatID:    chat.ID,
+			UserID:    users[0],
+			Body:      "x",
+			MediaMeta: &domain.MediaMeta{Mime: "image/png", Size: 10},
+			SendAt:    sendAt,
+		}
+		require.NoError(t, repo.CreateScheduledMessage(ctx, sm))
+		return sm
+	}
+	due := schedule(time.Now().Add(-time.Minute))
+	later := schedule(time.Now().Add(time.Hour))
+	cancelled := schedule(time.Now().Add(2 * time.Hour))
+
+	removed, err := repo.DeleteScheduledMessage(ctx, chat.ID, users[0]+1, cancelled.ID)
+	require.NoError(t, err)
+	assert.False(t, removed, "only the author's messages are deleted")
+	removed, err = repo.DeleteScheduledMessage(ctx, chat.ID, users[0], cancelled.ID)
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	pending, err := repo.ListScheduledMessages(ctx, chat.ID, users[0])
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, []int64{due.ID, later.ID}, []int64{pending[0].ID, pending[1].ID})
+	assert.Equal(t, "image/png", pending[0].MediaMeta.Mime)
+
+	claimed, err := repo.ClaimDueScheduledMessages(ctx, time.Now(), 100)
+	require.NoError(t, err)
+	var ids []int64
+	for _, sm := range claimed {
+		if sm.ChatID == chat.ID {
+			ids = append(ids, sm.ID)
+		}
+	}
+	assert.Equal(t, []int64{due.ID}, ids)
+
+	pending, err = repo.ListScheduledMessages(ctx, chat.ID, users[0])
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, later.ID, pending[0].ID)
+}
+
+func TestChatRepository_GetChatMembersOmitsCredentials(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 2)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+
+	chat, err := repo.CreateChat(ctx, &domain.Chat{Type: domain.ChatTypeGroup, Title: "members"}, users[0], users[1:])
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DELETE FROM chats WHERE id = ?", chat.ID) })
+
+	members, err := repo.GetChatMembers(ctx, chat.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	for _, m := range members {
+		require.NotNil(t, m.User)
+		assert.Equal(t, m.UserID, m.User.ID)
+		assert.NotEmpty(t, m.User.Email)
+		assert.Empty(t, m.User.PasswordHash, "the hash isn't loaded")
+	}
+
+	body, err := json.Marshal(members)
+	require.NoError(t, err)
+	assert.NotContains(t, strings.ToLower(string(body)), "password")
+}
+
+// TestChatRepository_AddDeviceTokenUpsert checks that re-registering a token
+// updates the existing row and reports it as not created.
+func TestChatRepository_AddDeviceTokenUpsert(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 1)
+	repo := NewChatRepository(db)
+	ctx := context.Background()
+	t.Cleanup(func() { db.Exec("DELETE FROM device_tokens WHERE user_id = ?", users[0]) })
+
+	created, err := repo.AddDeviceToken(ctx, &domain.DeviceToken{UserID: users[0], Token: "tok", Platform: "android"})
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = repo.AddDeviceToken(ctx, &domain.DeviceToken{UserID: users[0], Token: "tok", Platform: "ios"})
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	tokens, err := repo.GetDeviceTokens(ctx, users[0])
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "ios", tokens[0].Platform)
+}
+
+func TestUserRepository_SearchUsers(t *testing.T) {
+	db := openTestDB(t)
+	users := seedUsers(t, db, 5)
+	repo := NewUserRepository(db)
+	blocks := NewBlockRepository(db)
+	ctx := context.Background()
+
+	// A per-run prefix keeps other rows out of the results
+	prefix := fmt.Sprintf("srch%d", time.Now().UnixNano()%1_000_000_000)
+	for i, id := range users {
+		require.NoError(t, db.Exec("UPDATE users SET username = ? WHERE id = ?", fmt.Sprintf("%s_%d", prefix, i), id).Error)
+	}
+	require.NoError(t, db.Exec("UPDATE users SET username = ? WHERE id = ?", "x"+prefix, users[4]).Error) // infix only
+	require.NoError(t, blocks.Block(ctx, users[0], users[1]))
+	require.NoError(t, blocks.Block(ctx, users[2], users[0]))
+	t.Cleanup(func() { db.Exec("DELETE FROM blocks WHERE blocker_id IN ?", users) })
+
+	found, err := repo.SearchUsers(ctx, users[0], strings.ToUpper(prefix), 10, 0)
+	require.NoError(t, err)
+	var ids []int64
+	for _, u := range found {
+		ids = append(ids, u.ID)
+	}
+	assert.Equal(t, []int64{users[3]}, ids, "the requester, blocked users, blockers and infix matches are left out")
+
+	found, err = repo.SearchUsers(ctx, users[0], prefix+"%", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, found, "wildcards match literally")
+}
+
+// TestUserDAO_RoundTrip checks that every domain.User field survives the DAO
+// mapping, so a new column can't be silently dropped on save or load.
+func TestUserDAO_RoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	user := &domain.User{
+		ID:               7,
+		Email:            "alice@example.com",
+		EmailVerified:    true,
+		Username:         "alice",
+		AvatarURL:        "http://localhost:9000/chat-media/avatars/7.png",
+		Bio:              "hello",
+		PasswordHash:     "$2a$10$hash",
+		CreatedAt:        now,
+		DeactivatedAt:    &now,
+		ShowLastSeen:     true,
+		LastSeenAt:       &now,
+		TokenVersion:     3,
+		IsAdmin:          true,
+		Timezone:         "Europe/Berlin",
+		DNDStart:         "22:00",
+		DNDEnd:           "07:00",
+		DNDAllowMentions: true,
+	}
+	v := reflect.ValueOf(*user)
+	for i := 0; i < v.NumField(); i++ {
+		require.False(t, v.Field(i).IsZero(), "set %s so the round trip covers it", v.Type().Field(i).Name)
+	}
+	assert.Equal(t, user, FromDomainUser(user).ToDomain())
+}
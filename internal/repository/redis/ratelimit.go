@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript atomically refills and takes one token from a bucket stored
+// as a hash {tokens, ts}. It returns {allowed, retryAfterMs}.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refill_per_ms = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * refill_per_ms)
+
+local allowed = 0
+local retry_ms = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_ms = math.ceil((1 - tokens) / refill_per_ms)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / refill_per_ms))
+return {allowed, retry_ms}
+`)
+
+// TakeToken takes one token from the bucket named key, which holds up to limit
+// tokens and refills limit tokens per window. Buckets live in Redis so every
+// gateway pod shares them. When no token is available it returns false and how
+// long until one is.
+func (r *CacheRepository) TakeToken(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	refillPerMs := float64(limit) / float64(window.Milliseconds())
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{"rl:" + key},
+		limit, refillPerMs, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// AcquireSlowMode claims userID's next slot in chatID, blocking further claims
+// for interval. It returns 0 when the slot was free, otherwise how long until it is.
+func (r *CacheRepository) AcquireSlowMode(ctx context.Context, chatID, userID int64, interval time.Duration) (time.Duration, error) {
+	key := fmt.Sprintf("slow:%d:%d", chatID, userID)
+	ok, err := r.client.SetNX(ctx, key, 1, interval).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire slow mode slot: %w", err)
+	}
+	if ok {
+		return 0, nil
+	}
+
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read slow mode slot: %w", err)
+	}
+	if ttl <= 0 {
+		// Expired between the two calls; the next attempt will succeed
+		ttl = time.Millisecond
+	}
+	return ttl, nil
+}
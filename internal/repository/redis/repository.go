@@ -2,9 +2,11 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/ambarg/mini-telegram/internal/domain"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
@@ -119,23 +121,208 @@ func (r *CacheRepository) GetPresence(ctx context.Context, userID int64) (online
 		return false, 0, fmt.Errorf("failed to get presence: %w", err)
 	}
 
+	p, err := parsePresence(val)
+	if err != nil {
+		return false, 0, err
+	}
+	return p.Online, p.LastSeen, nil
+}
+
+// GetPresences retrieves presence for many users with a single MGET.
+// Users without a presence key are reported offline with no last-seen time.
+func (r *CacheRepository) GetPresences(ctx context.Context, userIDs []int64) (map[int64]domain.Presence, error) {
+	result := make(map[int64]domain.Presence, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, uid := range userIDs {
+		keys[i] = fmt.Sprintf("pres:%d", uid)
+	}
+
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presences: %w", err)
+	}
+
+	for i, uid := range userIDs {
+		val, ok := vals[i].(string)
+		if !ok {
+			result[uid] = domain.Presence{}
+			continue
+		}
+		p, err := parsePresence(val)
+		if err != nil {
+			return nil, err
+		}
+		result[uid] = p
+	}
+	return result, nil
+}
+
+// parsePresence decodes a pres:<uid> value written by SetPresence
+func parsePresence(val string) (domain.Presence, error) {
 	if val == "0" {
-		return false, 0, nil
+		return domain.Presence{}, nil
 	}
 
 	var timestamp int64
-	_, err = fmt.Sscanf(val, "%d", &timestamp)
-	if err != nil {
-		return false, 0, fmt.Errorf("failed to parse presence timestamp: %w", err)
+	if _, err := fmt.Sscanf(val, "%d", &timestamp); err != nil {
+		return domain.Presence{}, fmt.Errorf("failed to parse presence timestamp: %w", err)
 	}
 
 	// If negative, it means explicit offline
 	if timestamp < 0 {
-		return false, -timestamp, nil
+		return domain.Presence{LastSeen: -timestamp}, nil
 	}
 
 	// Consider online if timestamp is positive (relying on Redis TTL for expiry)
-	return true, timestamp, nil
+	return domain.Presence{Online: true, LastSeen: timestamp}, nil
+}
+
+// mediaCleanupKey is a sorted set of media object keys scored by the time their message was deleted
+const mediaCleanupKey = "media:cleanup"
+
+// ScheduleMediaCleanup queues a media object for deletion once its grace period has passed
+func (r *CacheRepository) ScheduleMediaCleanup(ctx context.Context, objectKey string, deletedAt time.Time) error {
+	if err := r.client.ZAdd(ctx, mediaCleanupKey, redis.Z{
+		Score:  float64(deletedAt.Unix()),
+		Member: objectKey,
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule media cleanup: %w", err)
+	}
+	return nil
+}
+
+// ClaimMediaCleanups removes and returns up to limit media object keys deleted before
+// the given time. Each key is claimed by exactly one caller, so several gateways can
+// drain the queue concurrently.
+func (r *CacheRepository) ClaimMediaCleanups(ctx context.Context, deletedBefore time.Time, limit int64) ([]string, error) {
+	urls, err := r.client.ZRangeByScore(ctx, mediaCleanupKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("%d", deletedBefore.Unix()),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media cleanup queue: %w", err)
+	}
+
+	claimed := make([]string, 0, len(urls))
+	for _, url := range urls {
+		removed, err := r.client.ZRem(ctx, mediaCleanupKey, url).Result()
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim media cleanup: %w", err)
+		}
+		if removed == 1 {
+			claimed = append(claimed, url)
+		}
+	}
+	return claimed, nil
+}
+
+// SetUploadContentType records the content type objectKey was presigned with
+func (r *CacheRepository) SetUploadContentType(ctx context.Context, objectKey, contentType string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, "media:type:"+objectKey, contentType, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set upload content type: %w", err)
+	}
+	return nil
+}
+
+// GetUploadContentType returns the content type objectKey was presigned with;
+// found is false once the record has expired or for unknown objects
+func (r *CacheRepository) GetUploadContentType(ctx context.Context, objectKey string) (string, bool, error) {
+	contentType, err := r.client.Get(ctx, "media:type:"+objectKey).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get upload content type: %w", err)
+	}
+	return contentType, true, nil
+}
+
+// SetContacts caches the IDs of users sharing a chat with userID. The list is
+// stored as one JSON value so an empty contact list is still a cache hit.
+func (r *CacheRepository) SetContacts(ctx context.Context, userID int64, contactIDs []int64, ttl time.Duration) error {
+	key := fmt.Sprintf("contacts:%d", userID)
+	if contactIDs == nil {
+		contactIDs = []int64{}
+	}
+	value, err := json.Marshal(contactIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode contacts: %w", err)
+	}
+	if err := r.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set contacts: %w", err)
+	}
+	return nil
+}
+
+// GetContacts returns the cached contact IDs of userID; found is false on a miss
+func (r *CacheRepository) GetContacts(ctx context.Context, userID int64) ([]int64, bool, error) {
+	key := fmt.Sprintf("contacts:%d", userID)
+	val, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get contacts: %w", err)
+	}
+
+	var contactIDs []int64
+	if err := json.Unmarshal(val, &contactIDs); err != nil {
+		return nil, false, fmt.Errorf("failed to decode contacts: %w", err)
+	}
+	return contactIDs, true, nil
+}
+
+func unreadSummaryKey(userID int64) string {
+	return fmt.Sprintf("unread:%d", userID)
+}
+
+// SetUnreadSummary caches userID's unread summary as one JSON value
+func (r *CacheRepository) SetUnreadSummary(ctx context.Context, userID int64, summary *domain.UnreadSummary, ttl time.Duration) error {
+	value, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode unread summary: %w", err)
+	}
+	if err := r.client.Set(ctx, unreadSummaryKey(userID), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set unread summary: %w", err)
+	}
+	return nil
+}
+
+// GetUnreadSummary returns the cached unread summary of userID; found is false on a miss
+func (r *CacheRepository) GetUnreadSummary(ctx context.Context, userID int64) (*domain.UnreadSummary, bool, error) {
+	val, err := r.client.Get(ctx, unreadSummaryKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get unread summary: %w", err)
+	}
+
+	var summary domain.UnreadSummary
+	if err := json.Unmarshal(val, &summary); err != nil {
+		return nil, false, fmt.Errorf("failed to decode unread summary: %w", err)
+	}
+	return &summary, true, nil
+}
+
+// InvalidateUnreadSummaries drops the cached unread summaries of userIDs
+func (r *CacheRepository) InvalidateUnreadSummaries(ctx context.Context, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = unreadSummaryKey(id)
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate unread summaries: %w", err)
+	}
+	return nil
 }
 
 // AddGroupMembers adds members to a group cache
@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RevokeToken denylists a token ID for ttl, after which the token has expired anyway
+func (r *CacheRepository) RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, "revoked:"+jti, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether a token ID is on the denylist
+func (r *CacheRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := r.client.Exists(ctx, "revoked:"+jti).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check revoked token: %w", err)
+	}
+	return n > 0, nil
+}
+
+// setTokenVersionScript stores ARGV[1] with a TTL of ARGV[2] ms unless the key
+// already holds a version at least as new
+var setTokenVersionScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]))
+if current and current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// SetTokenVersion caches userID's token version. It never lowers a cached
+// version, so a reader that loaded the version before a bump can't overwrite
+// the bumped one.
+func (r *CacheRepository) SetTokenVersion(ctx context.Context, userID, version int64, ttl time.Duration) error {
+	key := fmt.Sprintf("tokver:%d", userID)
+	if err := setTokenVersionScript.Run(ctx, r.client, []string{key}, version, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to set token version: %w", err)
+	}
+	return nil
+}
+
+// GetTokenVersion returns userID's cached token version; found is false on a miss
+func (r *CacheRepository) GetTokenVersion(ctx context.Context, userID int64) (int64, bool, error) {
+	version, err := r.client.Get(ctx, fmt.Sprintf("tokver:%d", userID)).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return version, true, nil
+}
@@ -2,14 +2,19 @@ package s3
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ambarg/mini-telegram/internal/config"
+	"github.com/ambarg/mini-telegram/internal/domain"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type Repository struct {
@@ -56,19 +61,155 @@ func New(ctx context.Context, cfg *config.Config) (*Repository, error) {
 	}, nil
 }
 
-func (r *Repository) GeneratePresignedURL(ctx context.Context, objectName string, contentType string, expirySeconds int64) (string, error) {
+// DeleteObject removes an object from the bucket
+func (r *Repository) DeleteObject(ctx context.Context, objectName string) error {
+	if _, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(objectName),
+	}); err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", objectName, err)
+	}
+	return nil
+}
+
+// GeneratePresignedURL presigns a PUT of objectName. Content-Length is a signed
+// header, so the upload must be exactly size bytes.
+func (r *Repository) GeneratePresignedURL(ctx context.Context, objectName string, contentType string, size int64, expiry time.Duration) (*domain.PresignedRequest, error) {
 	req, err := r.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r.bucket),
+		Key:           aws.String(objectName),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiry
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned url: %w", err)
+	}
+
+	return presignedRequest(req), nil
+}
+
+// GeneratePresignedGetURL presigns a GET of a private object
+func (r *Repository) GeneratePresignedGetURL(ctx context.Context, objectName string, expiry time.Duration) (*domain.PresignedRequest, error) {
+	req, err := r.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(objectName),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiry
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned download url: %w", err)
+	}
+
+	return presignedRequest(req), nil
+}
+
+// presignedRequest converts a signed SDK request into the domain form
+func presignedRequest(req *v4.PresignedHTTPRequest) *domain.PresignedRequest {
+	// Host is set by the client's HTTP stack; every other signed header must be sent as-is
+	headers := make(map[string]string, len(req.SignedHeader))
+	for name, values := range req.SignedHeader {
+		if strings.EqualFold(name, "Host") || len(values) == 0 {
+			continue
+		}
+		headers[name] = values[0]
+	}
+
+	return &domain.PresignedRequest{
+		URL:     req.URL,
+		Method:  req.Method,
+		Headers: headers,
+	}
+}
+
+// InitiateMultipartUpload starts a multipart upload and returns its upload ID
+func (r *Repository) InitiateMultipartUpload(ctx context.Context, objectName string, contentType string) (string, error) {
+	out, err := r.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
 		Bucket:      aws.String(r.bucket),
 		Key:         aws.String(objectName),
 		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to initiate multipart upload: %w", err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// PresignUploadPart presigns the PUT of one part. Presigning the same part
+// again lets a client retry it after a failed transfer.
+func (r *Repository) PresignUploadPart(ctx context.Context, objectName, uploadID string, partNumber int32, expiry time.Duration) (*domain.PresignedRequest, error) {
+	req, err := r.presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(r.bucket),
+		Key:        aws.String(objectName),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int32(partNumber),
 	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Duration(expirySeconds) * time.Second
+		opts.Expires = expiry
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned url: %w", err)
+		return nil, fmt.Errorf("failed to presign upload part: %w", err)
 	}
+	return presignedRequest(req), nil
+}
 
-	return req.URL, nil
+// ListUploadedParts returns the parts received so far, ordered by part number
+func (r *Repository) ListUploadedParts(ctx context.Context, objectName, uploadID string) ([]domain.UploadPart, error) {
+	var parts []domain.UploadPart
+	paginator := s3.NewListPartsPaginator(r.client, &s3.ListPartsInput{
+		Bucket:   aws.String(r.bucket),
+		Key:      aws.String(objectName),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			var noUpload *types.NoSuchUpload
+			if errors.As(err, &noUpload) {
+				return nil, fmt.Errorf("upload %s: %w", uploadID, domain.ErrNotFound)
+			}
+			return nil, fmt.Errorf("failed to list upload parts: %w", err)
+		}
+		for _, p := range page.Parts {
+			parts = append(parts, domain.UploadPart{
+				Number: aws.ToInt32(p.PartNumber),
+				ETag:   aws.ToString(p.ETag),
+				Size:   aws.ToInt64(p.Size),
+			})
+		}
+	}
+	return parts, nil
 }
 
+// CompleteMultipartUpload assembles the given parts into the final object
+func (r *Repository) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, parts []domain.UploadPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(p.ETag),
+			PartNumber: aws.Int32(p.Number),
+		}
+	}
 
+	if _, err := r.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(r.bucket),
+		Key:             aws.String(objectName),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload discards an upload and the parts stored for it
+func (r *Repository) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	if _, err := r.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(r.bucket),
+		Key:      aws.String(objectName),
+		UploadId: aws.String(uploadID),
+	}); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+)
+
+// VerificationSender delivers an email verification token to the address it was issued for
+type VerificationSender interface {
+	SendVerification(ctx context.Context, email, token string) error
+}
+
+// logVerificationSender stands in for a mail provider when none is configured
+type logVerificationSender struct{}
+
+func (logVerificationSender) SendVerification(ctx context.Context, email, token string) error {
+	telemetry.Logger(ctx).Info().
+		Str("email", email).
+		Str("token", token).
+		Msg("Sending verification email")
+	return nil
+}
@@ -4,23 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
+
 	"github.com/ambarg/mini-telegram/internal/auth"
 	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
 )
 
+// ErrAccountDeactivated is returned when a deactivated account logs in after the reactivation window
+var ErrAccountDeactivated = errors.New("account has been deactivated")
+
 // Service handles authentication logic
 type Service struct {
-	userRepo    domain.UserRepository
-	authService *auth.Service // Utility service for JWT/Hashing
+	userRepo           domain.UserRepository
+	cacheRepo          domain.CacheRepository // refresh token denylist and versions
+	authService        *auth.Service          // Utility service for JWT/Hashing
+	reactivationWindow time.Duration
+	passwordPolicy     auth.PasswordPolicy
+	verifier           VerificationSender
 }
 
-func NewService(userRepo domain.UserRepository, authService *auth.Service) *Service {
+func NewService(userRepo domain.UserRepository, cacheRepo domain.CacheRepository, authService *auth.Service, reactivationWindow time.Duration, passwordPolicy auth.PasswordPolicy) *Service {
 	return &Service{
-		userRepo:    userRepo,
-		authService: authService,
+		userRepo:           userRepo,
+		cacheRepo:          cacheRepo,
+		authService:        authService,
+		reactivationWindow: reactivationWindow,
+		passwordPolicy:     passwordPolicy,
+		verifier:           logVerificationSender{},
 	}
 }
 
+// SetVerificationSender replaces the default sender, which only logs verification tokens
+func (s *Service) SetVerificationSender(verifier VerificationSender) {
+	s.verifier = verifier
+}
+
 type RegisterInput struct {
 	Email    string
 	Password string
@@ -34,6 +53,10 @@ type TokenResponse struct {
 }
 
 func (s *Service) Register(ctx context.Context, input RegisterInput) (*TokenResponse, error) {
+	if err := s.ValidatePassword(input.Password); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	passwordHash, err := auth.HashPassword(input.Password)
 	if err != nil {
@@ -50,8 +73,13 @@ func (s *Service) Register(ctx context.Context, input RegisterInput) (*TokenResp
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// The account is usable without it, and the user can ask for another one
+	if err := s.sendVerification(ctx, user); err != nil {
+		telemetry.Logger(ctx).Warn().Err(err).Int64("user_id", user.ID).Msg("Failed to send verification email")
+	}
+
 	// Generate tokens
-	resp, err := s.generateTokens(user.ID)
+	resp, err := s.generateTokens(user)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +97,18 @@ func (s *Service) Login(ctx context.Context, email, password string) (*TokenResp
 		return nil, errors.New("invalid credentials")
 	}
 
-	resp, err := s.generateTokens(user.ID)
+	// A successful password login within the grace window reactivates the account
+	if user.IsDeactivated() {
+		if time.Since(*user.DeactivatedAt) > s.reactivationWindow {
+			return nil, ErrAccountDeactivated
+		}
+		if err := s.userRepo.SetDeactivatedAt(ctx, user.ID, nil); err != nil {
+			return nil, fmt.Errorf("failed to reactivate account: %w", err)
+		}
+		user.DeactivatedAt = nil
+	}
+
+	resp, err := s.generateTokens(user)
 	if err != nil {
 		return nil, err
 	}
@@ -77,9 +116,9 @@ func (s *Service) Login(ctx context.Context, email, password string) (*TokenResp
 	return resp, nil
 }
 
-func (s *Service) RefreshToken(refreshToken string) (string, error) {
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (string, error) {
 	claims, err := s.authService.ValidateToken(refreshToken)
-	if err != nil {
+	if err != nil || claims.Purpose != "" {
 		return "", errors.New("invalid refresh token")
 	}
 
@@ -88,7 +127,26 @@ func (s *Service) RefreshToken(refreshToken string) (string, error) {
 		return "", errors.New("invalid user ID")
 	}
 
-	accessToken, err := s.authService.GenerateAccessToken(userID)
+	// Tokens issued before jti existed can only be revoked by their version
+	if claims.ID != "" {
+		revoked, err := s.cacheRepo.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return "", err
+		}
+		if revoked {
+			return "", errors.New("invalid refresh token")
+		}
+	}
+
+	// Deactivation and token version bumps revoke all outstanding refresh
+	// tokens. The role is read fresh so granting or revoking admin takes
+	// effect on the next refresh.
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil || user.IsDeactivated() || claims.TokenVersion != user.TokenVersion {
+		return "", errors.New("invalid refresh token")
+	}
+
+	accessToken, err := s.authService.GenerateAccessToken(userID, user.IsAdmin, user.TokenVersion)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -96,13 +154,163 @@ func (s *Service) RefreshToken(refreshToken string) (string, error) {
 	return accessToken, nil
 }
 
-func (s *Service) generateTokens(userID int64) (*TokenResponse, error) {
-	accessToken, err := s.authService.GenerateAccessToken(userID)
+// Logout revokes a refresh token for the rest of its lifetime. Tokens that are
+// already invalid or expired are ignored, since they can't be used anyway.
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	claims, err := s.authService.ValidateToken(refreshToken)
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.cacheRepo.RevokeToken(ctx, claims.ID, ttl)
+}
+
+// ChangePassword replaces userID's password after checking the current one.
+// Every existing session is signed out; the returned tokens keep the caller
+// signed in.
+func (s *Service) ChangePassword(ctx context.Context, userID int64, oldPassword, newPassword string) (*TokenResponse, error) {
+	if oldPassword == newPassword {
+		return nil, fmt.Errorf("new password must differ from the current one: %w", domain.ErrInvalidInput)
+	}
+	if err := s.ValidatePassword(newPassword); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user %d: %w", userID, domain.ErrNotFound)
+	}
+	if err := auth.VerifyPassword(oldPassword, user.PasswordHash); err != nil {
+		return nil, fmt.Errorf("current password is incorrect: %w", domain.ErrPermissionDenied)
+	}
+
+	passwordHash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, passwordHash); err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+	if user.TokenVersion, err = s.BumpTokenVersion(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.generateTokens(user)
+	if err != nil {
+		return nil, err
+	}
+	resp.User = user
+	return resp, nil
+}
+
+// VerifyEmail marks the account a verification token was issued for as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	userID, email, err := s.authService.ValidateVerificationToken(token)
+	if err != nil {
+		return fmt.Errorf("invalid verification token: %w", domain.ErrInvalidInput)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, domain.ErrNotFound)
+	}
+	// A token only vouches for the address it was sent to
+	if user.Email != email {
+		return fmt.Errorf("invalid verification token: %w", domain.ErrInvalidInput)
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.userRepo.SetEmailVerified(ctx, userID)
+}
+
+// resendVerificationLimit caps verification emails a user can request per hour
+const resendVerificationLimit = 3
+
+// ResendVerification sends userID a new verification token
+func (s *Service) ResendVerification(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user %d: %w", userID, domain.ErrNotFound)
+	}
+	if user.EmailVerified {
+		return fmt.Errorf("email already verified: %w", domain.ErrInvalidInput)
+	}
+
+	allowed, retryAfter, err := s.cacheRepo.TakeToken(ctx, fmt.Sprintf("verify-email:%d", userID), resendVerificationLimit, time.Hour)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &domain.RateLimitError{RetryAfter: retryAfter}
+	}
+	return s.sendVerification(ctx, user)
+}
+
+func (s *Service) sendVerification(ctx context.Context, user *domain.User) error {
+	token, err := s.authService.GenerateVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	return s.verifier.SendVerification(ctx, user.Email, token)
+}
+
+// LogoutAll signs userID out of every device
+func (s *Service) LogoutAll(ctx context.Context, userID int64) error {
+	_, err := s.BumpTokenVersion(ctx, userID)
+	return err
+}
+
+// BumpTokenVersion invalidates every access and refresh token issued to userID
+// so far and returns the new version
+func (s *Service) BumpTokenVersion(ctx context.Context, userID int64) (int64, error) {
+	version, err := s.userRepo.IncrTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+	if err := s.cacheRepo.SetTokenVersion(ctx, userID, version, domain.TokenVersionCacheTTL); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// TokenVersion returns userID's current token version, checked on every
+// authenticated request, so it is served from Redis when cached
+func (s *Service) TokenVersion(ctx context.Context, userID int64) (int64, error) {
+	if version, found, err := s.cacheRepo.GetTokenVersion(ctx, userID); err == nil && found {
+		return version, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	// A bump racing this read keeps its newer version; the cache never goes back
+	_ = s.cacheRepo.SetTokenVersion(ctx, userID, user.TokenVersion, domain.TokenVersionCacheTTL)
+	return user.TokenVersion, nil
+}
+
+// ValidatePassword checks a new password against the configured policy.
+// Violations wrap both the specific auth.ErrPassword* rule and domain.ErrInvalidInput.
+func (s *Service) ValidatePassword(password string) error {
+	if err := s.passwordPolicy.Validate(password); err != nil {
+		return fmt.Errorf("%w: %w", err, domain.ErrInvalidInput)
+	}
+	return nil
+}
+
+// generateTokens mints an access and a refresh token under the user's current token version
+func (s *Service) generateTokens(user *domain.User) (*TokenResponse, error) {
+	userID := user.ID
+	accessToken, err := s.authService.GenerateAccessToken(userID, user.IsAdmin, user.TokenVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := s.authService.GenerateRefreshToken(userID)
+	refreshToken, err := s.authService.GenerateRefreshToken(userID, user.TokenVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
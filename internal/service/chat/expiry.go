@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// expiryBatchSize bounds how many expired messages one sweep statement deletes
+const expiryBatchSize = 500
+
+var expiredDeleted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "chat_expired_messages_deleted_total",
+	Help: "Disappearing messages deleted by the expiry sweeper",
+})
+
+// SetMessageTTL makes new messages in chatID disappear ttlSeconds after they
+// are sent; 0 turns disappearing messages off. Any member of a direct chat may
+// change it, in groups only admins. Messages already sent keep their expiry.
+func (s *Service) SetMessageTTL(ctx context.Context, chatID, actorID int64, ttlSeconds int) error {
+	if ttlSeconds < 0 || ttlSeconds > domain.MaxMessageTTLSeconds {
+		return fmt.Errorf("message TTL must be 0-%d seconds: %w", domain.MaxMessageTTLSeconds, domain.ErrInvalidInput)
+	}
+
+	chat, err := s.getChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	role, err := s.chatRepo.GetMemberRole(ctx, chatID, actorID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	if chat.Type == domain.ChatTypeGroup && role != domain.RoleOwner && role != domain.RoleAdmin {
+		return fmt.Errorf("only admins can change the message TTL: %w", domain.ErrPermissionDenied)
+	}
+
+	if chat.MessageTTLSeconds == ttlSeconds {
+		return nil
+	}
+	chat.MessageTTLSeconds = ttlSeconds
+	if err := s.chatRepo.UpdateChat(ctx, chat); err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":              "ChatUpdated",
+		"chatId":            chatID,
+		"messageTtlSeconds": ttlSeconds,
+	})
+	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+	return nil
+}
+
+// RunExpiry deletes expired disappearing messages every interval until ctx is cancelled
+func (s *Service) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.DeleteExpiredMessages(ctx)
+			if err != nil {
+				telemetry.Logger(ctx).Error().Err(err).Int64("deleted", deleted).Msg("message expiry failed")
+			}
+		}
+	}
+}
+
+// DeleteExpiredMessages permanently deletes messages past their expiry and tells
+// members they are gone. Messages already soft-deleted were announced by
+// DeleteMessage, so only their rows and media are cleaned up.
+func (s *Service) DeleteExpiredMessages(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		expired, err := s.chatRepo.DeleteExpiredMessages(ctx, time.Now(), expiryBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += int64(len(expired))
+		expiredDeleted.Add(float64(len(expired)))
+
+		now := time.Now()
+		previews := make(map[int64]bool)
+		for _, msg := range expired {
+			if msg.MediaKey != "" {
+				if err := s.cacheRepo.ScheduleMediaCleanup(ctx, msg.MediaKey, now); err != nil {
+					telemetry.Logger(ctx).Error().Err(err).Str("object_key", msg.MediaKey).Msg("failed to queue media of expired message")
+				}
+			}
+			if msg.DeletedAt != nil {
+				continue
+			}
+			payload, _ := json.Marshal(map[string]interface{}{
+				"type":    "MessageDeleted",
+				"chatId":  msg.ChatID,
+				"id":      msg.ID,
+				"expired": true,
+			})
+			if err := s.broker.PublishToDeliveryExchange(ctx, msg.ChatID, payload); err != nil {
+				telemetry.Logger(ctx).Error().Err(err).Int64("msg_id", msg.ID).Msg("failed to publish expired message deletion")
+			}
+			previews[msg.ChatID] = true
+		}
+		for chatID := range previews {
+			_ = s.PublishChatPreview(ctx, chatID)
+		}
+
+		if len(expired) < expiryBatchSize || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+)
+
+// ErrFolderLimitReached is returned when creating more than domain.MaxFoldersPerUser folders
+var ErrFolderLimitReached = fmt.Errorf("at most %d folders are allowed: %w", domain.MaxFoldersPerUser, domain.ErrInvalidInput)
+
+// CreateFolder creates a folder owned by userID. Names are unique per user.
+func (s *Service) CreateFolder(ctx context.Context, userID int64, name string) (*domain.Folder, error) {
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := s.chatRepo.ListFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(folders) >= domain.MaxFoldersPerUser {
+		return nil, ErrFolderLimitReached
+	}
+	if err := ensureUniqueFolderName(folders, 0, name); err != nil {
+		return nil, err
+	}
+
+	folder := &domain.Folder{UserID: userID, Name: name}
+	if err := s.chatRepo.CreateFolder(ctx, folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// RenameFolder renames one of userID's folders
+func (s *Service) RenameFolder(ctx context.Context, userID, folderID int64, name string) (*domain.Folder, error) {
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.getFolder(ctx, userID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := s.chatRepo.ListFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureUniqueFolderName(folders, folderID, name); err != nil {
+		return nil, err
+	}
+
+	if err := s.chatRepo.RenameFolder(ctx, folderID, name); err != nil {
+		return nil, err
+	}
+	folder.Name = name
+	return folder, nil
+}
+
+// DeleteFolder deletes one of userID's folders. Its chats are unassigned, not deleted.
+func (s *Service) DeleteFolder(ctx context.Context, userID, folderID int64) error {
+	if _, err := s.getFolder(ctx, userID, folderID); err != nil {
+		return err
+	}
+	return s.chatRepo.DeleteFolder(ctx, folderID)
+}
+
+// ListFolders returns userID's folders with their chat and unread counts
+func (s *Service) ListFolders(ctx context.Context, userID int64) ([]domain.Folder, error) {
+	return s.chatRepo.ListFolders(ctx, userID)
+}
+
+// AddChatToFolder files chatID under one of userID's folders. The user must be
+// a member of the chat; a chat may sit in several folders at once.
+func (s *Service) AddChatToFolder(ctx context.Context, userID, folderID, chatID int64) error {
+	if _, err := s.getFolder(ctx, userID, folderID); err != nil {
+		return err
+	}
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	return s.chatRepo.AddChatToFolder(ctx, folderID, chatID)
+}
+
+// RemoveChatFromFolder takes chatID out of one of userID's folders
+func (s *Service) RemoveChatFromFolder(ctx context.Context, userID, folderID, chatID int64) error {
+	if _, err := s.getFolder(ctx, userID, folderID); err != nil {
+		return err
+	}
+	removed, err := s.chatRepo.RemoveChatFromFolder(ctx, folderID, chatID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("chat %d is not in folder %d: %w", chatID, folderID, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// getFolder loads a folder owned by userID. Other users' folders are reported
+// as not found so their IDs can't be probed.
+func (s *Service) getFolder(ctx context.Context, userID, folderID int64) (*domain.Folder, error) {
+	folder, err := s.chatRepo.GetFolder(ctx, folderID)
+	if err != nil {
+		return nil, translateNotFound(err, "folder %d", folderID)
+	}
+	if folder.UserID != userID {
+		return nil, fmt.Errorf("folder %d: %w", folderID, domain.ErrNotFound)
+	}
+	return folder, nil
+}
+
+func normalizeFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("folder name is required: %w", domain.ErrInvalidInput)
+	}
+	if utf8.RuneCountInString(name) > domain.MaxFolderNameLen {
+		return "", fmt.Errorf("folder name exceeds %d characters: %w", domain.MaxFolderNameLen, domain.ErrInvalidInput)
+	}
+	return name, nil
+}
+
+// ensureUniqueFolderName rejects name if another of the user's folders (other than exceptID) uses it
+func ensureUniqueFolderName(folders []domain.Folder, exceptID int64, name string) error {
+	for _, f := range folders {
+		if f.ID != exceptID && f.Name == name {
+			return fmt.Errorf("folder %q already exists: %w", name, domain.ErrInvalidInput)
+		}
+	}
+	return nil
+}
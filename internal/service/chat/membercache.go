@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// In-process member cache sizing. The TTL is short because other pods change
+// memberships without invalidating this tier.
+const (
+	memberCacheSize = 10000
+	memberCacheTTL  = 5 * time.Second
+)
+
+// memberLookups counts member list lookups by the tier that answered them
+var memberLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "chat_member_cache_lookups_total",
+	Help: "Chat member list lookups by answering tier (local, redis, db)",
+}, []string{"tier"})
+
+// memberCacheRedisErrors counts failed reads and writes of the Redis member sets
+var memberCacheRedisErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "chat_member_cache_redis_errors_total",
+	Help: "Failed Redis reads and writes of chat member sets",
+})
+
+// memberCache is a small LRU of chat member IDs with a per-entry TTL. It sits
+// in front of Redis so hot chats keep working without hammering Postgres
+// when Redis is unavailable.
+type memberCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[int64]*list.Element
+}
+
+type memberCacheEntry struct {
+	chatID    int64
+	members   []int64
+	expiresAt time.Time
+}
+
+func newMemberCache(size int, ttl time.Duration) *memberCache {
+	return &memberCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[int64]*list.Element),
+	}
+}
+
+// get returns chatID's cached members, if present and fresh
+func (c *memberCache) get(chatID int64) ([]int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[chatID]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memberCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, chatID)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.members, true
+}
+
+// set caches members for chatID, evicting the least recently used chat if full
+func (c *memberCache) set(chatID int64, members []int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if el, ok := c.entries[chatID]; ok {
+		entry := el.Value.(*memberCacheEntry)
+		entry.members, entry.expiresAt = members, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[chatID] = c.order.PushFront(&memberCacheEntry{chatID: chatID, members: members, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memberCacheEntry).chatID)
+	}
+}
+
+// invalidate drops chatID so the next lookup goes to Redis or the database
+func (c *memberCache) invalidate(chatID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[chatID]; ok {
+		c.order.Remove(el)
+		delete(c.entries, chatID)
+	}
+}
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+)
+
+// Display names change rarely and are shown next to ephemeral events such as
+// typing, so a few minutes of staleness is fine
+const (
+	nameCacheSize = 10000
+	nameCacheTTL  = 5 * time.Minute
+)
+
+// TypingTimeout is how long a Typing event stays valid unless renewed or
+// cleared with StopTyping
+const TypingTimeout = 5 * time.Second
+
+// nameCache maps user IDs to display names with a per-entry TTL. When full it
+// is simply reset, which only costs a round of database lookups.
+type nameCache struct {
+	mu      sync.Mutex
+	entries map[int64]nameCacheEntry
+}
+
+type nameCacheEntry struct {
+	name      string
+	expiresAt time.Time
+}
+
+func (c *nameCache) get(userID int64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.name, true
+}
+
+func (c *nameCache) set(userID int64, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil || len(c.entries) >= nameCacheSize {
+		c.entries = make(map[int64]nameCacheEntry)
+	}
+	c.entries[userID] = nameCacheEntry{name: name, expiresAt: time.Now().Add(nameCacheTTL)}
+}
+
+// DisplayName returns the name shown for userID, served from an in-process
+// cache for frequent events like typing
+func (s *Service) DisplayName(ctx context.Context, userID int64) (string, error) {
+	if name, ok := s.names.get(userID); ok {
+		return name, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", translateNotFound(err, "user %d", userID)
+	}
+	name := displayNameOf(user)
+	s.names.set(userID, name)
+	return name, nil
+}
+
+// displayNameOf is the name shown for user: their username, falling back to
+// their email
+func displayNameOf(user *domain.User) string {
+	switch {
+	case user.IsDeactivated():
+		return domain.DeletedAccountName
+	case user.Username != "":
+		return user.Username
+	default:
+		return user.Email
+	}
+}
@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// retentionBatchSize bounds how many messages one purge statement deletes, keeping
+// lock time and WAL bursts small
+const retentionBatchSize = 1000
+
+var (
+	retentionPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_retention_purged_messages_total",
+		Help: "Messages permanently deleted by the retention job",
+	})
+	retentionRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_retention_runs_total",
+		Help: "Retention job passes by outcome",
+	}, []string{"result"})
+)
+
+// RunRetention purges expired messages every interval until ctx is cancelled
+func (s *Service) RunRetention(ctx context.Context, interval time.Duration, defaultDays int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeExpiredMessages(ctx, defaultDays)
+			if err != nil {
+				retentionRuns.WithLabelValues("error").Inc()
+				telemetry.Logger(ctx).Error().Err(err).Int64("purged", purged).Msg("message retention failed")
+				continue
+			}
+			retentionRuns.WithLabelValues("ok").Inc()
+			if purged > 0 {
+				telemetry.Logger(ctx).Info().Int64("purged", purged).Msg("purged expired messages")
+			}
+		}
+	}
+}
+
+// PurgeExpiredMessages permanently deletes messages older than their chat's
+// retention, or defaultDays for chats without an override, in batches. Pinned
+// messages are kept. Attached media is queued for the media cleanup job, which
+// deletes each object once nothing references it.
+func (s *Service) PurgeExpiredMessages(ctx context.Context, defaultDays int) (int64, error) {
+	var total int64
+	for {
+		purged, mediaKeys, err := s.chatRepo.PurgeExpiredMessages(ctx, defaultDays, retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += purged
+		retentionPurged.Add(float64(purged))
+
+		now := time.Now()
+		for _, key := range mediaKeys {
+			if err := s.cacheRepo.ScheduleMediaCleanup(ctx, key, now); err != nil {
+				telemetry.Logger(ctx).Error().Err(err).Str("object_key", key).Msg("failed to queue media of purged message")
+			}
+		}
+
+		if purged < retentionBatchSize || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
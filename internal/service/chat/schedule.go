@@ -0,0 +1,167 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// scheduleBatchSize bounds how many due messages one dispatch claims at a time
+const scheduleBatchSize = 100
+
+var scheduledSent = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "chat_scheduled_messages_total",
+	Help: "Due scheduled messages by outcome: sent, dropped (no longer allowed) or retried",
+}, []string{"outcome"})
+
+// ScheduleMessage stores msg to be sent at sendAt. The sender must be able to
+// post in the chat now; the same checks run again when the message is sent.
+func (s *Service) ScheduleMessage(ctx context.Context, msg *domain.Message, sendAt time.Time) (*domain.ScheduledMessage, error) {
+	now := time.Now()
+	if !sendAt.After(now) {
+		return nil, fmt.Errorf("scheduled time must be in the future: %w", domain.ErrInvalidInput)
+	}
+	if sendAt.After(now.Add(domain.MaxScheduleAhead)) {
+		return nil, fmt.Errorf("messages can be scheduled at most %s ahead: %w", domain.MaxScheduleAhead, domain.ErrInvalidInput)
+	}
+	if strings.TrimSpace(msg.Body) == "" {
+		return nil, fmt.Errorf("message body is required: %w", domain.ErrInvalidInput)
+	}
+
+	chat, err := s.getChat(ctx, msg.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.chatRepo.GetMemberRole(ctx, msg.ChatID, msg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	if chat.PostPolicy == domain.PostPolicyAdmins && role != domain.RoleOwner && role != domain.RoleAdmin {
+		return nil, fmt.Errorf("only admins can post in this chat: %w", domain.ErrPermissionDenied)
+	}
+	if _, err := s.validateReply(ctx, msg); err != nil {
+		return nil, err
+	}
+	if err := s.validateMediaURL(msg); err != nil {
+		return nil, err
+	}
+	if err := s.validateMediaMeta(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.chatRepo.ListScheduledMessages(ctx, msg.ChatID, msg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) >= domain.MaxScheduledPerUserChat {
+		return nil, fmt.Errorf("at most %d messages can be scheduled per chat: %w", domain.MaxScheduledPerUserChat, domain.ErrInvalidInput)
+	}
+
+	scheduled := &domain.ScheduledMessage{
+		ChatID:       msg.ChatID,
+		UserID:       msg.UserID,
+		Body:         msg.Body,
+		MediaURL:     msg.MediaURL,
+		MediaMeta:    msg.MediaMeta,
+		ReplyToID:    msg.ReplyToID,
+		ReplySnippet: msg.ReplySnippet,
+		SendAt:       sendAt.UTC(),
+	}
+	if err := s.chatRepo.CreateScheduledMessage(ctx, scheduled); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// ListScheduledMessages returns userID's pending messages in chatID, soonest first
+func (s *Service) ListScheduledMessages(ctx context.Context, chatID, userID int64) ([]domain.ScheduledMessage, error) {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.ListScheduledMessages(ctx, chatID, userID)
+}
+
+// CancelScheduledMessage deletes one of userID's pending messages in chatID
+func (s *Service) CancelScheduledMessage(ctx context.Context, chatID, userID, id int64) error {
+	removed, err := s.chatRepo.DeleteScheduledMessage(ctx, chatID, userID, id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("scheduled message %d: %w", id, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// RunScheduler sends due scheduled messages every interval until ctx is cancelled
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sent, err := s.DispatchDueMessages(ctx)
+			if err != nil {
+				telemetry.Logger(ctx).Error().Err(err).Int("sent", sent).Msg("scheduled message dispatch failed")
+			}
+		}
+	}
+}
+
+// DispatchDueMessages sends every scheduled message whose time has come. A
+// message the sender may no longer post is dropped; one that failed before it
+// was stored is put back for the next run.
+func (s *Service) DispatchDueMessages(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		due, err := s.chatRepo.ClaimDueScheduledMessages(ctx, time.Now(), scheduleBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		retried := false
+		for i := range due {
+			sm := due[i]
+			msg := sm.Message()
+			err := s.ProcessMessage(ctx, msg)
+			switch {
+			case err == nil:
+				sent++
+				scheduledSent.WithLabelValues("sent").Inc()
+			case msg.ID != 0:
+				// Stored but not fully fanned out; sending it again would duplicate it
+				sent++
+				scheduledSent.WithLabelValues("sent").Inc()
+				telemetry.Logger(ctx).Error().Err(err).Int64("msg_id", msg.ID).Msg("scheduled message sent with errors")
+			case errors.Is(err, domain.ErrPermissionDenied), errors.Is(err, domain.ErrInvalidInput), errors.Is(err, domain.ErrNotFound):
+				scheduledSent.WithLabelValues("dropped").Inc()
+				telemetry.Logger(ctx).Warn().Err(err).Int64("scheduled_id", sm.ID).Int64("chat_id", sm.ChatID).Msg("dropping scheduled message")
+			default:
+				retried = true
+				scheduledSent.WithLabelValues("retried").Inc()
+				telemetry.Logger(ctx).Error().Err(err).Int64("scheduled_id", sm.ID).Msg("scheduled message failed, retrying")
+				if err := s.chatRepo.CreateScheduledMessage(ctx, &sm); err != nil {
+					telemetry.Logger(ctx).Error().Err(err).Int64("scheduled_id", sm.ID).Msg("failed to reschedule message")
+				}
+			}
+		}
+
+		// Messages put back are due again at once, so leave them to the next run
+		if len(due) < scheduleBatchSize || retried || ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+	}
+}
@@ -2,72 +2,260 @@ package chat
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
 )
 
+// ErrPinLimitReached is returned when pinning into a chat that already has
+// MaxPinnedMessages pins and the caller didn't ask to replace the oldest
+var ErrPinLimitReached = fmt.Errorf("at most %d messages can be pinned: %w", domain.MaxPinnedMessages, domain.ErrInvalidInput)
+
+// ErrDirectChatMembership is returned when trying to change the members or roles of a direct chat
+var ErrDirectChatMembership = fmt.Errorf("direct chats must keep exactly two members and no roles: %w", domain.ErrInvalidInput)
+
 // Service handles chat business logic
 type Service struct {
 	chatRepo  domain.ChatRepository
+	userRepo  domain.UserRepository
+	blockRepo domain.BlockRepository
 	cacheRepo domain.CacheRepository
 	broker    domain.MessageBroker
+
+	localMembers *memberCache       // in-process tier in front of the Redis member sets
+	memberLoads  singleflight.Group // collapses concurrent member loads per chat
+	editWindow   time.Duration      // how long after sending a message its author may edit it
+	names        nameCache          // display names for typing events
+	mediaBaseURL string             // public URL of the media bucket, see SetMediaBaseURL
 }
 
-func NewService(chatRepo domain.ChatRepository, cacheRepo domain.CacheRepository, broker domain.MessageBroker) *Service {
+// DefaultEditWindow is how long authors may edit their messages unless SetEditWindow overrides it
+const DefaultEditWindow = 48 * time.Hour
+
+// MutedUserIDsKey lists, in a Message delivery event, the members who have the
+// chat muted. It is internal to the backend and never sent to clients.
+const MutedUserIDsKey = "muted_user_ids"
+
+// BlockedUserIDsKey lists, in a Message delivery event, the members who blocked
+// the sender and must not receive it. Like MutedUserIDsKey it never reaches clients.
+const BlockedUserIDsKey = "blocked_user_ids"
+
+// OriginDeviceKey names, in a Message delivery event, the author's device that
+// sent it, so the gateway can skip the copy to that device. Never sent to clients.
+const OriginDeviceKey = "origin_device"
+
+func NewService(chatRepo domain.ChatRepository, userRepo domain.UserRepository, blockRepo domain.BlockRepository, cacheRepo domain.CacheRepository, broker domain.MessageBroker) *Service {
 	return &Service{
-		chatRepo:  chatRepo,
-		cacheRepo: cacheRepo,
-		broker:    broker,
+		chatRepo:     chatRepo,
+		userRepo:     userRepo,
+		blockRepo:    blockRepo,
+		cacheRepo:    cacheRepo,
+		broker:       broker,
+		localMembers: newMemberCache(memberCacheSize, memberCacheTTL),
+		editWindow:   DefaultEditWindow,
 	}
 }
 
+// SetEditWindow changes how long after sending authors may edit a message
+func (s *Service) SetEditWindow(d time.Duration) {
+	s.editWindow = d
+}
+
+// SetMediaBaseURL sets the public URL of the media bucket (endpoint/bucket).
+// Once set, absolute group avatar URLs must point into that bucket.
+func (s *Service) SetMediaBaseURL(u string) {
+	s.mediaBaseURL = strings.TrimSuffix(u, "/")
+}
+
 func (s *Service) CreateChat(ctx context.Context, creatorID int64, reqType int16, memberIDs []int64, title string) (*domain.Chat, error) {
+	if err := s.ensureEmailVerified(ctx, creatorID); err != nil {
+		return nil, err
+	}
+	memberIDs, err := s.validateMemberIDs(ctx, creatorID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+	if reqType == domain.ChatTypeDirect && len(memberIDs) != 1 {
+		return nil, fmt.Errorf("a direct chat needs exactly one member other than the creator, got %d: %w", len(memberIDs), domain.ErrInvalidInput)
+	}
+
 	// If private chat, check if exists
-	if reqType == domain.ChatTypeDirect && len(memberIDs) == 1 {
+	if reqType == domain.ChatTypeDirect {
+		blocked, err := s.isBlockedEitherWay(ctx, creatorID, memberIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, fmt.Errorf("one of the users has blocked the other: %w", domain.ErrPermissionDenied)
+		}
+
 		existing, err := s.chatRepo.GetPrivateChatBetweenUsers(ctx, creatorID, memberIDs[0])
 		if err == nil && existing != nil {
 			return existing, nil
 		}
 	}
 
+	// The creator becomes the owner; validateMemberIDs already dropped them from memberIDs
 	chat := &domain.Chat{Type: reqType, Title: title}
-	var err error
-	chat, err = s.chatRepo.CreateChat(ctx, chat, memberIDs)
+	chat, err = s.chatRepo.CreateChat(ctx, chat, creatorID, memberIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chat: %w", err)
 	}
 
-	// Add creator as admin
+	// Cache members
 	allMembers := append([]int64{creatorID}, memberIDs...)
-	
-	for _, memberID := range allMembers {
-		role := domain.RoleMember
-		if memberID == creatorID {
-			role = domain.RoleOwner
-		}
-		
-		if err := s.chatRepo.AddMember(ctx, chat.ID, memberID, role); err != nil {
+	if err := s.cacheRepo.AddGroupMembers(ctx, chat.ID, allMembers); err != nil {
+		memberCacheRedisErrors.Inc()
+	}
+
+	return chat, nil
+}
+
+// ensureEmailVerified keeps accounts that haven't verified their email from
+// starting conversations
+func (s *Service) ensureEmailVerified(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return translateNotFound(err, "user %d", userID)
+	}
+	if !user.EmailVerified {
+		return fmt.Errorf("email not verified: %w", domain.ErrPermissionDenied)
+	}
+	return nil
+}
 
-			return nil, fmt.Errorf("failed to add member %d: %w", memberID, err)
+// isBlockedEitherWay reports whether a or b has blocked the other
+func (s *Service) isBlockedEitherWay(ctx context.Context, a, b int64) (bool, error) {
+	blocked, err := s.blockRepo.IsBlocked(ctx, a, b)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	return s.blockRepo.IsBlocked(ctx, b, a)
+}
+
+// validateMemberIDs dedupes the requested members, drops the creator (who is
+// always added as owner) and rejects IDs that aren't active users
+func (s *Service) validateMemberIDs(ctx context.Context, creatorID int64, memberIDs []int64) ([]int64, error) {
+	seen := make(map[int64]bool, len(memberIDs))
+	unique := make([]int64, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if id == creatorID || seen[id] {
+			continue
 		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("memberIds must include at least one user other than the creator: %w", domain.ErrInvalidInput)
 	}
 
-	// Cache members
-	if err := s.cacheRepo.AddGroupMembers(ctx, chat.ID, allMembers); err != nil {
-		// Log error
+	users, err := s.userRepo.GetByIDs(ctx, unique)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up members: %w", err)
+	}
+	active := make(map[int64]bool, len(users))
+	for _, u := range users {
+		if !u.IsDeactivated() {
+			active[u.ID] = true
+		}
 	}
 
-	return chat, nil
+	var invalid []int64
+	for _, id := range unique {
+		if !active[id] {
+			invalid = append(invalid, id)
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("unknown user IDs %v: %w", invalid, domain.ErrInvalidInput)
+	}
+	return unique, nil
 }
 
+// Chat list page sizes
+const (
+	DefaultChatPageSize = 50
+	MaxChatPageSize     = 100
+)
+
 func (s *Service) GetUserChats(ctx context.Context, userID int64) ([]domain.Chat, error) {
 	chats, err := s.chatRepo.GetUserChats(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
+	s.resolveChatNames(ctx, userID, chats)
+	return chats, nil
+}
+
+// ListUserChats returns one page of the user's chats, most recently active first,
+// and the cursor for the next page ("" when this is the last page)
+func (s *Service) ListUserChats(ctx context.Context, userID int64, opts domain.ChatListOptions) ([]domain.Chat, string, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultChatPageSize
+	}
+	if opts.Limit > MaxChatPageSize {
+		opts.Limit = MaxChatPageSize
+	}
+	if opts.FolderID != 0 {
+		if _, err := s.getFolder(ctx, userID, opts.FolderID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	pageSize := opts.Limit
+	opts.Limit++
+	chats, err := s.chatRepo.ListUserChats(ctx, userID, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(chats) > pageSize {
+		chats = chats[:pageSize]
+		last := chats[pageSize-1]
+		nextCursor = EncodeChatCursor(domain.ChatCursor{LastActivityAt: last.LastActivityAt, ChatID: last.ID})
+	}
+
+	s.resolveChatNames(ctx, userID, chats)
+	return chats, nextCursor, nil
+}
+
+// EncodeChatCursor returns the opaque form of a chat list cursor
+func EncodeChatCursor(c domain.ChatCursor) string {
+	raw := fmt.Sprintf("%d:%d", c.LastActivityAt.UnixMicro(), c.ChatID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeChatCursor parses a cursor produced by EncodeChatCursor
+func DecodeChatCursor(cursor string) (*domain.ChatCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", domain.ErrInvalidInput)
+	}
+	var micros, chatID int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micros, &chatID); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", domain.ErrInvalidInput)
+	}
+	return &domain.ChatCursor{LastActivityAt: time.UnixMicro(micros).UTC(), ChatID: chatID}, nil
+}
+
+// resolveChatNames fills the display name and online flag of each chat as seen by userID
+func (s *Service) resolveChatNames(ctx context.Context, userID int64, chats []domain.Chat) {
 	for i := range chats {
 		if chats[i].Type == domain.ChatTypeGroup {
 			chats[i].Name = chats[i].Title
@@ -77,6 +265,10 @@ func (s *Service) GetUserChats(ctx context.Context, userID int64) ([]domain.Chat
 			if err == nil {
 				for _, m := range members {
 					if m.UserID != userID && m.User != nil {
+						if m.User.IsDeactivated() {
+							chats[i].Name = domain.DeletedAccountName
+							break
+						}
 						chats[i].Name = m.User.Email
 						// Check presence
 						online, _, _ := s.cacheRepo.GetPresence(ctx, m.UserID)
@@ -94,299 +286,1573 @@ func (s *Service) GetUserChats(ctx context.Context, userID int64) ([]domain.Chat
 			}
 		}
 	}
-	return chats, nil
 }
 
-func (s *Service) GetMessages(ctx context.Context, chatID, userID int64, limit int) ([]domain.Message, error) {
+// GetChatDetails returns a chat with the caller's read position so clients can
+// open it at the first unread message
+func (s *Service) GetChatDetails(ctx context.Context, chatID, userID int64) (*domain.ChatDetails, error) {
+	chat, err := s.getChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.chatRepo.GetMember(ctx, chatID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	firstUnread, err := s.chatRepo.GetFirstUnread(ctx, chatID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get first unread message: %w", err)
+	}
+
+	memberCount, err := s.chatRepo.CountMembers(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members: %w", err)
+	}
+
+	chats := []domain.Chat{*chat}
+	s.resolveChatNames(ctx, userID, chats)
+
+	details := &domain.ChatDetails{
+		Chat:             chats[0],
+		LastReadMsgID:    member.LastReadMsgID,
+		FirstUnreadMsgID: firstUnread,
+		MemberCount:      memberCount,
+		Role:             member.Role,
+	}
+	if member.IsMuted(time.Now()) {
+		details.MutedUntil = member.MutedUntil
+	}
+	if pins, err := s.chatRepo.GetPinnedMessages(ctx, chatID); err == nil && len(pins) > 0 {
+		details.PinnedMessage = &pins[0]
+	}
+	return details, nil
+}
+
+// GetMessage returns one message of chatID to a member. Messages of other chats
+// are reported as not found so their existence isn't revealed.
+func (s *Service) GetMessage(ctx context.Context, chatID, msgID, userID int64) (*domain.Message, error) {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.chatRepo.GetMessage(ctx, msgID)
+	if err != nil {
+		return nil, translateNotFound(err, "message %d", msgID)
+	}
+	if msg.ChatID != chatID {
+		return nil, fmt.Errorf("message %d: %w", msgID, domain.ErrNotFound)
+	}
+	return msg, nil
+}
+
+// MaxMessageBatch caps how many message IDs one batch lookup may request
+const MaxMessageBatch = 100
+
+// GetMessagesByIDs resolves a set of message IDs for userID, in request order,
+// silently omitting messages in chats the user doesn't belong to
+func (s *Service) GetMessagesByIDs(ctx context.Context, userID int64, ids []int64) ([]domain.Message, error) {
+	if len(ids) > MaxMessageBatch {
+		return nil, fmt.Errorf("at most %d message IDs per request: %w", MaxMessageBatch, domain.ErrInvalidInput)
+	}
+	if len(ids) == 0 {
+		return []domain.Message{}, nil
+	}
+
+	found, err := s.chatRepo.GetMessagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check membership once per distinct chat
+	allowed := make(map[int64]bool)
+	byID := make(map[int64]domain.Message, len(found))
+	for _, msg := range found {
+		ok, checked := allowed[msg.ChatID]
+		if !checked {
+			ok, err = s.chatRepo.IsMember(ctx, msg.ChatID, userID)
+			if err != nil {
+				return nil, err
+			}
+			allowed[msg.ChatID] = ok
+		}
+		if ok {
+			byID[msg.ID] = msg
+		}
+	}
+
+	messages := make([]domain.Message, 0, len(byID))
+	for _, id := range ids {
+		if msg, ok := byID[id]; ok {
+			messages = append(messages, msg)
+			delete(byID, id) // Duplicate IDs in the request are returned once
+		}
+	}
+	return messages, nil
+}
+
+// MaxCatchUpBatch caps how many messages one catch-up request returns
+const MaxCatchUpBatch = 100
+
+// CatchUp returns the messages in chatID after afterID, oldest first, for a client
+// that detected a gap. hasMore reports that another request from the last
+// returned ID is needed.
+func (s *Service) CatchUp(ctx context.Context, chatID, userID, afterID int64) ([]domain.Message, bool, error) {
+	if afterID < 0 {
+		return nil, false, fmt.Errorf("afterId must not be negative: %w", domain.ErrInvalidInput)
+	}
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, false, err
+	}
+
+	// Fetch one extra row to learn whether a follow-up page exists
+	messages, err := s.chatRepo.GetMessagesAfter(ctx, chatID, userID, afterID, MaxCatchUpBatch+1)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > MaxCatchUpBatch
+	if hasMore {
+		messages = messages[:MaxCatchUpBatch]
+	}
+	return messages, hasMore, nil
+}
+
+// Message history page sizes
+const (
+	DefaultMessagePageSize = 50
+	MaxMessagePageSize     = 100
+)
+
+// GetMessages returns one page of chatID's history, newest first, older than
+// beforeID (0 for the newest messages). nextCursor is the smallest returned ID
+// to pass as the next beforeID, or 0 when there are no older messages.
+func (s *Service) GetMessages(ctx context.Context, chatID, userID, beforeID int64, limit int, includeDeleted bool) (messages []domain.Message, nextCursor int64, err error) {
+	if beforeID < 0 {
+		return nil, 0, fmt.Errorf("beforeId must not be negative: %w", domain.ErrInvalidInput)
+	}
+	if limit <= 0 {
+		limit = DefaultMessagePageSize
+	}
+	if limit > MaxMessagePageSize {
+		limit = MaxMessagePageSize
+	}
+
+	if _, err := s.getChat(ctx, chatID); err != nil {
+		return nil, 0, err
+	}
+
 	// Check membership
 	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if !isMember {
-		return nil, fmt.Errorf("permission denied: user is not a member of this chat")
+		return nil, 0, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	if includeDeleted {
+		isAdmin, err := s.isAdmin(ctx, chatID, userID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !isAdmin {
+			return nil, 0, fmt.Errorf("only admins can list deleted messages: %w", domain.ErrPermissionDenied)
+		}
 	}
 
-	messages, err := s.chatRepo.GetMessageHistory(ctx, chatID, limit)
+	// Fetch one extra row to learn whether an older page exists
+	messages, err = s.chatRepo.GetMessageHistory(ctx, chatID, userID, beforeID, limit+1, includeDeleted)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		nextCursor = messages[limit-1].ID
 	}
 
 	// Calculate status
-	// Get all chat members to check LastReadMsgID
+	// Get all chat members to check their read and delivered watermarks
 	members, err := s.chatRepo.GetChatMembers(ctx, chatID)
 	if err == nil {
-		var maxReadID int64
+		var maxReadID, maxDeliveredID int64
 		for _, m := range members {
-			if m.UserID != userID && m.LastReadMsgID > maxReadID {
-				maxReadID = m.LastReadMsgID
+			if m.UserID == userID {
+				continue
 			}
+			maxReadID = max(maxReadID, m.LastReadMsgID)
+			maxDeliveredID = max(maxDeliveredID, m.LastDeliveredMsgID)
 		}
 
 		for i := range messages {
 			if messages[i].UserID == userID { // Only for my messages
-				if messages[i].ID <= maxReadID {
-					messages[i].Status = 3 // Read
-				} else {
-					messages[i].Status = 1 // Sent
-				}
+				messages[i].Status = messageStatus(messages[i].ID, maxReadID, maxDeliveredID)
 			}
 		}
 	}
 
-	return messages, nil
+	return messages, nextCursor, nil
+}
+
+// messageStatus is Read once any other member read up to msgID, Delivered
+// once any other member's device received it, and Sent before that
+func messageStatus(msgID, maxReadID, maxDeliveredID int64) int16 {
+	switch {
+	case msgID <= maxReadID:
+		return domain.ReceiptStatusRead
+	case msgID <= maxDeliveredID:
+		return domain.ReceiptStatusDelivered
+	default:
+		return domain.ReceiptStatusSent
+	}
 }
 
 func (s *Service) AddMember(ctx context.Context, chatID, userID int64) error {
+	if err := s.ensureGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+
 	if err := s.chatRepo.AddMember(ctx, chatID, userID, domain.RoleMember); err != nil {
 		return err
 	}
 	
-	// Update cache
-	return s.cacheRepo.AddGroupMembers(ctx, chatID, []int64{userID})
+	// Update cache. The member is already stored, so a Redis outage doesn't fail the request.
+	s.localMembers.invalidate(chatID)
+	if err := s.cacheRepo.AddGroupMembers(ctx, chatID, []int64{userID}); err != nil {
+		memberCacheRedisErrors.Inc()
+	}
+
+	names := s.memberNames(ctx, chatID)
+	s.postSystemMessage(ctx, chatID, userID, domain.SystemEventMemberJoined,
+		map[string]any{"userId": userID},
+		fmt.Sprintf("%s joined the group", names.of(userID)))
+	return nil
 }
 
+// RemoveMember takes userID out of a chat on their own behalf; admins removing
+// someone else go through KickMember
 func (s *Service) RemoveMember(ctx context.Context, chatID, userID int64) error {
-	// TODO: Add permission check if caller is not userID (i.e. kick vs leave)
-	
-	if err := s.chatRepo.RemoveMember(ctx, chatID, userID); err != nil {
+	// Resolve the name first; the user can't be looked up once removed
+	names := s.memberNames(ctx, chatID)
+
+	if err := s.dropMember(ctx, chatID, userID); err != nil {
 		return err
 	}
-	
-	// Update cache
-	return s.cacheRepo.RemoveGroupMember(ctx, chatID, userID)
+
+	s.postSystemMessage(ctx, chatID, userID, domain.SystemEventMemberLeft,
+		map[string]any{"userId": userID},
+		fmt.Sprintf("%s left the group", names.of(userID)))
+	return nil
 }
 
-func (s *Service) UpdateGroupInfo(ctx context.Context, chatID, actorID int64, title string) error {
+// KickMember removes targetID from a group on an admin's behalf. The last
+// admin can't be removed, so every group keeps someone who can manage it.
+func (s *Service) KickMember(ctx context.Context, chatID, actorID, targetID int64) error {
 	isAdmin, err := s.isAdmin(ctx, chatID, actorID)
 	if err != nil {
 		return err
 	}
 	if !isAdmin {
-		return fmt.Errorf("permission denied: only admins can update group info")
+		return fmt.Errorf("only admins can remove members: %w", domain.ErrPermissionDenied)
 	}
 
-	chat, err := s.chatRepo.GetChat(ctx, chatID)
+	if err := s.ensureGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+
+	members, err := s.chatRepo.GetChatMembers(ctx, chatID)
 	if err != nil {
 		return err
 	}
+	var target *domain.ChatMember
+	admins := 0
+	for i, m := range members {
+		if m.Role == domain.RoleOwner || m.Role == domain.RoleAdmin {
+			admins++
+		}
+		if m.UserID == targetID {
+			target = &members[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("user %d is not a member of chat %d: %w", targetID, chatID, domain.ErrInvalidInput)
+	}
+	if (target.Role == domain.RoleOwner || target.Role == domain.RoleAdmin) && admins == 1 {
+		return fmt.Errorf("the last admin of a group can't be removed: %w", domain.ErrInvalidInput)
+	}
 
-	chat.Title = title
-	return s.chatRepo.UpdateChat(ctx, chat)
-}
+	names := s.memberNames(ctx, chatID)
 
-func (s *Service) PromoteMember(ctx context.Context, chatID, actorID, targetID int64) error {
-	isAdmin, err := s.isAdmin(ctx, chatID, actorID)
-	if err != nil {
+	if err := s.dropMember(ctx, chatID, targetID); err != nil {
 		return err
 	}
-	if !isAdmin {
-		return fmt.Errorf("permission denied: only admins can promote members")
+
+	s.postSystemMessage(ctx, chatID, actorID, domain.SystemEventMemberRemoved,
+		map[string]any{"actorId": actorID, "userId": targetID},
+		fmt.Sprintf("%s removed %s", names.of(actorID), names.of(targetID)))
+	return nil
+}
+
+// dropMember deletes a membership and evicts it from the member caches. The
+// member is already removed by then, so a Redis outage doesn't fail the request.
+func (s *Service) dropMember(ctx context.Context, chatID, userID int64) error {
+	if err := s.chatRepo.RemoveMember(ctx, chatID, userID); err != nil {
+		return err
 	}
 
-	return s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, domain.RoleAdmin)
+	s.localMembers.invalidate(chatID)
+	if err := s.cacheRepo.RemoveGroupMember(ctx, chatID, userID); err != nil {
+		memberCacheRedisErrors.Inc()
+	}
+	return nil
 }
 
-func (s *Service) DemoteMember(ctx context.Context, chatID, actorID, targetID int64) error {
+// UpdateGroupInfo applies an admin's changes to a group's title, description,
+// avatar and post policy, and broadcasts the changed fields to members
+func (s *Service) UpdateGroupInfo(ctx context.Context, chatID, actorID int64, update domain.GroupInfoUpdate) error {
 	isAdmin, err := s.isAdmin(ctx, chatID, actorID)
 	if err != nil {
 		return err
 	}
 	if !isAdmin {
-		return fmt.Errorf("permission denied: only admins can demote members")
+		return fmt.Errorf("only admins can update group info: %w", domain.ErrPermissionDenied)
 	}
 
-	// Prevent demoting self? Or allow it? Allowing it for now.
-	return s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, domain.RoleMember)
-}
+	chat, err := s.getChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if chat.Type != domain.ChatTypeGroup {
+		return fmt.Errorf("only group info can be updated: %w", domain.ErrInvalidInput)
+	}
 
-func (s *Service) MarkChatRead(ctx context.Context, chatID, userID, msgID int64) error {
-	// Update last_read_msg_id
-	if err := s.chatRepo.UpdateLastReadMessage(ctx, chatID, userID, msgID); err != nil {
+	if err := validateGroupInfo(chatID, s.mediaBaseURL, update); err != nil {
 		return err
 	}
-	
-	// Broadcast Read Event to chat so senders can update ticks?
-	// For now, simpler to just update DB. Real-time ticks require broadcasting event.
-	// Let's broadcast "ReadReceipt" event
-	payload, _ := json.Marshal(map[string]interface{}{
-		"type":       "Read",
-		"chat_id":    chatID,
-		"user_id":    userID,
-		"max_id":     msgID,
-	})
-	return s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
-}
 
-func (s *Service) isAdmin(ctx context.Context, chatID, userID int64) (bool, error) {
-	role, err := s.chatRepo.GetMemberRole(ctx, chatID, userID)
-	if err != nil {
-		return false, err
+	changes := map[string]interface{}{}
+	titleChanged := update.Title != nil && *update.Title != chat.Title
+	if titleChanged {
+		chat.Title = *update.Title
+		changes["title"] = chat.Title
+	}
+	if update.Description != nil && *update.Description != chat.Description {
+		chat.Description = *update.Description
+		changes["description"] = chat.Description
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != chat.AvatarURL {
+		chat.AvatarURL = *update.AvatarURL
+		changes["avatarUrl"] = chat.AvatarURL
+	}
+	if update.PostPolicy != nil && *update.PostPolicy != chat.PostPolicy {
+		chat.PostPolicy = *update.PostPolicy
+		changes["postPolicy"] = chat.PostPolicy
+	}
+	if update.SlowModeSeconds != nil && *update.SlowModeSeconds != chat.SlowModeSeconds {
+		chat.SlowModeSeconds = *update.SlowModeSeconds
+		changes["slowModeSeconds"] = chat.SlowModeSeconds
+	}
+	if update.RetentionDays != nil && *update.RetentionDays != chat.RetentionDays {
+		chat.RetentionDays = *update.RetentionDays
+		changes["retentionDays"] = chat.RetentionDays
+	}
+	if len(changes) == 0 {
+		return nil
 	}
-	return role == domain.RoleOwner || role == domain.RoleAdmin, nil
-}
 
-func (s *Service) ProcessMessage(ctx context.Context, msg *domain.Message, clientUUID string) error {
-	// 1. Persist message
-	if err := s.chatRepo.CreateMessage(ctx, msg); err != nil {
-		return fmt.Errorf("failed to persist message: %w", err)
+	if err := s.chatRepo.UpdateChat(ctx, chat); err != nil {
+		return err
 	}
 
-	// 2. Get members (from cache or DB)
-	members, err := s.cacheRepo.GetGroupMembers(ctx, msg.ChatID)
-	if err != nil || len(members) == 0 {
-		chatMembers, err := s.chatRepo.GetChatMembers(ctx, msg.ChatID)
-		if err != nil {
-			return fmt.Errorf("failed to get chat members: %w", err)
-		}
-		
-		members = make([]int64, len(chatMembers))
-		for i, m := range chatMembers {
-			members[i] = m.UserID
-		}
+	changes["type"] = "ChatUpdated"
+	changes["chatId"] = chatID
+	payload, _ := json.Marshal(changes)
+	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
 
-		// Cache them
-		_ = s.cacheRepo.AddGroupMembers(ctx, msg.ChatID, members)
+	if titleChanged {
+		names := s.memberNames(ctx, chatID)
+		s.postSystemMessage(ctx, chatID, actorID, domain.SystemEventTitleChanged,
+			map[string]any{"actorId": actorID, "title": chat.Title},
+			fmt.Sprintf("%s changed the group name to %q", names.of(actorID), chat.Title))
 	}
+	return nil
+}
 
-	// 3. Create receipts
-	for _, memberID := range members {
-		receipt := &domain.Receipt{
-			MsgID:  msg.ID,
-			UserID: memberID,
-			Status: domain.ReceiptStatusSent,
+// validateGroupInfo checks field lengths, the post policy and that the avatar was
+// uploaded for this chat (object key prefix uploads/{chatID}/). When mediaBaseURL
+// is set, an absolute avatar URL must also point into that bucket.
+func validateGroupInfo(chatID int64, mediaBaseURL string, update domain.GroupInfoUpdate) error {
+	if update.Title != nil {
+		if n := utf8.RuneCountInString(*update.Title); n == 0 || n > domain.MaxChatTitleLength {
+			return fmt.Errorf("title must be 1-%d characters: %w", domain.MaxChatTitleLength, domain.ErrInvalidInput)
 		}
-		_ = s.chatRepo.CreateReceipt(ctx, receipt)
 	}
-
-	// 4. Publish delivery event
-	deliveryPayload, _ := json.Marshal(map[string]interface{}{
-		"type":       "Message",
-		"id":         msg.ID,
-		"chat_id":    msg.ChatID,
-		"user_id":    msg.UserID,
-		"body":       msg.Body,
-		"media_url":  msg.MediaURL,
-		"created_at": msg.CreatedAt, // Serializes to ISO string by default
-	})
-
-	if err := s.broker.PublishToDeliveryExchange(ctx, msg.ChatID, deliveryPayload); err != nil {
-		return fmt.Errorf("failed to publish delivery event: %w", err)
+	if update.Description != nil && utf8.RuneCountInString(*update.Description) > domain.MaxChatDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters: %w", domain.MaxChatDescriptionLength, domain.ErrInvalidInput)
 	}
-
-	// 5. Send delivered acknowledgment back to sender
-	if clientUUID != "" {
-		deliveredPayload, _ := json.Marshal(map[string]interface{}{
-			"type":   "Delivered",
-			"uuid":   clientUUID,
-			"msg_id": msg.ID,
-		})
-
-		if err := s.broker.PublishToDeliveryExchange(ctx, msg.ChatID, deliveredPayload); err != nil {
-
-			return fmt.Errorf("failed to publish delivered ack: %w", err)
+	if update.PostPolicy != nil && !update.PostPolicy.Valid() {
+		return fmt.Errorf("invalid post policy %q: %w", *update.PostPolicy, domain.ErrInvalidInput)
+	}
+	if update.SlowModeSeconds != nil && (*update.SlowModeSeconds < 0 || *update.SlowModeSeconds > domain.MaxSlowModeSeconds) {
+		return fmt.Errorf("slow mode must be 0-%d seconds: %w", domain.MaxSlowModeSeconds, domain.ErrInvalidInput)
+	}
+	if update.RetentionDays != nil && (*update.RetentionDays < 0 || *update.RetentionDays > domain.MaxRetentionDays) {
+		return fmt.Errorf("retention must be 0-%d days: %w", domain.MaxRetentionDays, domain.ErrInvalidInput)
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		prefix := fmt.Sprintf("uploads/%d/", chatID)
+		key := mediaObjectKey(*update.AvatarURL, mediaBaseURL)
+		if key == "" {
+			return fmt.Errorf("avatar must be stored in the media bucket: %w", domain.ErrInvalidInput)
+		}
+		if !strings.HasPrefix(key, prefix) || strings.Contains(key, "..") {
+			return fmt.Errorf("avatar must be uploaded for this chat: %w", domain.ErrInvalidInput)
 		}
 	}
-
 	return nil
 }
 
-func (s *Service) RegisterDevice(ctx context.Context, userID int64, token, platform string) error {
-	deviceToken := &domain.DeviceToken{
-		UserID:   userID,
-		Token:    token,
-		Platform: platform,
+// mediaObjectKey returns the object key a media URL refers to, or "" for an
+// absolute URL outside mediaBaseURL. Without a base URL any host is accepted and
+// the key starts at the uploads/ segment.
+func mediaObjectKey(url, mediaBaseURL string) string {
+	if mediaBaseURL != "" {
+		if key, ok := strings.CutPrefix(url, mediaBaseURL+"/"); ok {
+			return key
+		}
+		if strings.Contains(url, "://") {
+			return ""
+		}
+		return url
 	}
-	return s.chatRepo.AddDeviceToken(ctx, deviceToken)
+	if i := strings.Index(url, "/uploads/"); i >= 0 {
+		return url[i+1:]
+	}
+	return url
 }
-func (s *Service) GetChatMembers(ctx context.Context, chatID, userID int64) ([]domain.ChatMember, error) {
-	// Check membership
+
+func (s *Service) PromoteMember(ctx context.Context, chatID, actorID, targetID int64) error {
+	isAdmin, err := s.isAdmin(ctx, chatID, actorID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return fmt.Errorf("only admins can promote members: %w", domain.ErrPermissionDenied)
+	}
+
+	if err := s.ensureGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+
+	if err := s.ensureTargetMember(ctx, chatID, targetID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, domain.RoleAdmin); err != nil {
+		return err
+	}
+	s.publishRoleChanged(ctx, chatID, targetID, domain.RoleAdmin)
+
+	names := s.memberNames(ctx, chatID)
+	s.postSystemMessage(ctx, chatID, actorID, domain.SystemEventMemberPromoted,
+		map[string]any{"actorId": actorID, "userId": targetID},
+		fmt.Sprintf("%s made %s an admin", names.of(actorID), names.of(targetID)))
+	return nil
+}
+
+func (s *Service) DemoteMember(ctx context.Context, chatID, actorID, targetID int64) error {
+	isAdmin, err := s.isAdmin(ctx, chatID, actorID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return fmt.Errorf("only admins can demote members: %w", domain.ErrPermissionDenied)
+	}
+
+	if err := s.ensureGroupChat(ctx, chatID); err != nil {
+		return err
+	}
+
+	// Prevent demoting self? Or allow it? Allowing it for now.
+	if err := s.ensureTargetMember(ctx, chatID, targetID); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.UpdateMemberRole(ctx, chatID, targetID, domain.RoleMember); err != nil {
+		return err
+	}
+	s.publishRoleChanged(ctx, chatID, targetID, domain.RoleMember)
+
+	names := s.memberNames(ctx, chatID)
+	s.postSystemMessage(ctx, chatID, actorID, domain.SystemEventMemberDemoted,
+		map[string]any{"actorId": actorID, "userId": targetID},
+		fmt.Sprintf("%s removed %s as admin", names.of(actorID), names.of(targetID)))
+	return nil
+}
+
+// ensureTargetMember reports a not-found error when the user a role change targets isn't in the chat
+func (s *Service) ensureTargetMember(ctx context.Context, chatID, targetID int64) error {
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return fmt.Errorf("user %d is not a member of chat %d: %w", targetID, chatID, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// publishRoleChanged tells every member, including the target's own connections,
+// about a role change. Roles aren't cached, so there is nothing to invalidate.
+func (s *Service) publishRoleChanged(ctx context.Context, chatID, userID int64, role domain.Role) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":   "RoleChanged",
+		"chatId": chatID,
+		"userId": userID,
+		"role":   role,
+	})
+	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+}
+
+// postSystemMessage records a group event inline in the chat history through the
+// normal persistence and delivery path. Failures are ignored: the event itself
+// already succeeded and the history entry is informational.
+func (s *Service) postSystemMessage(ctx context.Context, chatID, userID int64, event string, meta map[string]any, text string) {
+	meta["event"] = event
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	_ = s.ProcessMessage(ctx, &domain.Message{
+		ChatID:    chatID,
+		UserID:    userID,
+		Body:      text,
+		Kind:      domain.MessageKindSystem,
+		Meta:      raw,
+		CreatedAt: time.Now(),
+	})
+}
+
+// displayNames maps chat members to the name shown in system messages
+type displayNames map[int64]string
+
+func (n displayNames) of(userID int64) string {
+	if name, ok := n[userID]; ok && name != "" {
+		return name
+	}
+	return "Someone"
+}
+
+// memberNames looks up the display name of every current chat member
+func (s *Service) memberNames(ctx context.Context, chatID int64) displayNames {
+	names := make(displayNames)
+	members, err := s.chatRepo.GetChatMembers(ctx, chatID)
+	if err != nil {
+		return names
+	}
+	for _, m := range members {
+		if m.User != nil {
+			names[m.UserID] = displayNameOf(m.User)
+		}
+	}
+	return names
+}
+
+// SetNotificationLevel updates the caller's push preference for a chat
+func (s *Service) SetNotificationLevel(ctx context.Context, chatID, userID int64, level domain.NotificationLevel) error {
+	if !level.Valid() {
+		return fmt.Errorf("invalid notification level %q: %w", level, domain.ErrInvalidInput)
+	}
+
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+
+	return s.chatRepo.UpdateNotificationLevel(ctx, chatID, userID, level)
+}
+
+// MuteChat stops push notifications of a chat for the user until until.
+// Messages are still delivered in-band, marked muted.
+func (s *Service) MuteChat(ctx context.Context, chatID, userID int64, until time.Time) error {
+	if !until.After(time.Now()) {
+		return fmt.Errorf("mute must end in the future: %w", domain.ErrInvalidInput)
+	}
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	return s.chatRepo.SetMutedUntil(ctx, chatID, userID, &until)
+}
+
+// UnmuteChat turns push notifications of a chat back on for the user
+func (s *Service) UnmuteChat(ctx context.Context, chatID, userID int64) error {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	return s.chatRepo.SetMutedUntil(ctx, chatID, userID, nil)
+}
+
+// ArchiveChat hides a chat from the user's main chat list
+func (s *Service) ArchiveChat(ctx context.Context, chatID, userID int64) error {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.chatRepo.SetArchivedAt(ctx, chatID, userID, &now)
+}
+
+// UnarchiveChat returns an archived chat to the user's main chat list
+func (s *Service) UnarchiveChat(ctx context.Context, chatID, userID int64) error {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+	return s.chatRepo.SetArchivedAt(ctx, chatID, userID, nil)
+}
+
+// ensureCanPost checks that userID is a member of chatID and, in groups where
+// only admins may post, that they are an admin. Direct chats between users who
+// blocked each other accept no new messages. It returns the chat.
+func (s *Service) ensureCanPost(ctx context.Context, chatID, userID int64) (*domain.Chat, error) {
+	chat, err := s.getChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.chatRepo.GetMemberRole(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	isAdmin := role == domain.RoleOwner || role == domain.RoleAdmin
+	if chat.PostPolicy == domain.PostPolicyAdmins && !isAdmin {
+		return nil, fmt.Errorf("only admins can post in this chat: %w", domain.ErrPermissionDenied)
+	}
+	if chat.Type == domain.ChatTypeDirect {
+		if err := s.ensureNotBlockedInDirect(ctx, chatID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Slow mode is best effort: if Redis is unavailable the message goes through
+	if chat.SlowModeSeconds > 0 && !isAdmin {
+		interval := time.Duration(chat.SlowModeSeconds) * time.Second
+		if retryAfter, err := s.cacheRepo.AcquireSlowMode(ctx, chatID, userID, interval); err == nil && retryAfter > 0 {
+			return nil, &domain.SlowModeError{RetryAfter: retryAfter}
+		}
+	}
+	return chat, nil
+}
+
+// ensureNotBlockedInDirect rejects posting to a direct chat once either member has blocked the other
+func (s *Service) ensureNotBlockedInDirect(ctx context.Context, chatID, userID int64) error {
+	members, err := s.memberIDs(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	for _, peerID := range members {
+		if peerID == userID {
+			continue
+		}
+		blocked, err := s.isBlockedEitherWay(ctx, userID, peerID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fmt.Errorf("one of the users has blocked the other: %w", domain.ErrPermissionDenied)
+		}
+	}
+	return nil
+}
+
+// ensureMember returns a permission error unless userID belongs to chatID
+func (s *Service) ensureMember(ctx context.Context, chatID, userID int64) error {
+	if _, err := s.getChat(ctx, chatID); err != nil {
+		return err
+	}
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	return nil
+}
+
+func (s *Service) MarkChatRead(ctx context.Context, chatID, userID, msgID int64) error {
+	// Update last_read_msg_id
+	if err := s.chatRepo.UpdateLastReadMessage(ctx, chatID, userID, msgID); err != nil {
+		return err
+	}
+	_ = s.cacheRepo.InvalidateUnreadSummaries(ctx, []int64{userID})
+	
+	// Broadcast Read Event to chat so senders can update ticks?
+	// For now, simpler to just update DB. Real-time ticks require broadcasting event.
+	// Let's broadcast "ReadReceipt" event
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":       "Read",
+		"chat_id":    chatID,
+		"user_id":    userID,
+		"max_id":     msgID,
+	})
+	return s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+}
+
+// getChat loads a chat, translating a missing row into domain.ErrNotFound
+func (s *Service) getChat(ctx context.Context, chatID int64) (*domain.Chat, error) {
+	chat, err := s.chatRepo.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, translateNotFound(err, "chat %d", chatID)
+	}
+	return chat, nil
+}
+
+// ensureGroupChat rejects member and role mutations on direct chats
+func (s *Service) ensureGroupChat(ctx context.Context, chatID int64) error {
+	chat, err := s.getChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if chat.Type == domain.ChatTypeDirect {
+		return ErrDirectChatMembership
+	}
+	return nil
+}
+
+// translateNotFound wraps gorm.ErrRecordNotFound as domain.ErrNotFound so handlers can return 404
+func translateNotFound(err error, format string, args ...any) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), domain.ErrNotFound)
+	}
+	return err
+}
+
+func (s *Service) isAdmin(ctx context.Context, chatID, userID int64) (bool, error) {
+	role, err := s.chatRepo.GetMemberRole(ctx, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == domain.RoleOwner || role == domain.RoleAdmin, nil
+}
+
+// ProcessMessage persists msg, assigning its ID, and delivers it to the chat.
+// Persisting, fanning out receipts and publishing the delivery event are each
+// traced as a child span of ctx's span.
+func (s *Service) ProcessMessage(ctx context.Context, msg *domain.Message) (err error) {
+	ctx, span := tracer.Start(ctx, "chat.ProcessMessage", trace.WithAttributes(attribute.Int64("chat.id", msg.ChatID)))
+	defer func() { endSpan(span, err) }()
+
+	if msg.Kind == "" {
+		msg.Kind = domain.MessageKindUser
+	}
+	if msg.Kind == domain.MessageKindUser {
+		chat, err := s.ensureCanPost(ctx, msg.ChatID, msg.UserID)
+		if err != nil {
+			return err
+		}
+		if chat.MessageTTLSeconds > 0 {
+			expiresAt := time.Now().Add(time.Duration(chat.MessageTTLSeconds) * time.Second)
+			msg.ExpiresAt = &expiresAt
+		}
+	}
+	replySnippet, err := s.validateReply(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if err := s.validateMediaURL(msg); err != nil {
+		return err
+	}
+	if err := s.validateMediaMeta(ctx, msg); err != nil {
+		return err
+	}
+
+	// 1. Persist message
+	spanCtx, span := tracer.Start(ctx, "persist")
+	err = s.chatRepo.CreateMessage(spanCtx, msg)
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("failed to persist message: %w", err)
+	}
+
+	// A new message brings archived chats back to the main list
+	if archived, err := s.chatRepo.HasArchivedMembers(ctx, msg.ChatID); err != nil {
+		telemetry.Logger(ctx).Error().Err(err).Int64("chat_id", msg.ChatID).Msg("failed to check archived members")
+	} else if archived {
+		if err := s.chatRepo.UnarchiveForAll(ctx, msg.ChatID); err != nil {
+			telemetry.Logger(ctx).Error().Err(err).Int64("chat_id", msg.ChatID).Msg("failed to unarchive chat")
+		}
+	}
+
+	// 2. Fan out: get members (from cache or DB) and create their receipts
+	spanCtx, span = tracer.Start(ctx, "fan-out")
+	members, err := s.memberIDs(spanCtx, msg.ChatID)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+	for _, memberID := range members {
+		receipt := &domain.Receipt{
+			MsgID:  msg.ID,
+			UserID: memberID,
+			Status: domain.ReceiptStatusSent,
+		}
+		_ = s.chatRepo.CreateReceipt(spanCtx, receipt)
+	}
+	_ = s.cacheRepo.InvalidateUnreadSummaries(spanCtx, members)
+	span.SetAttributes(attribute.Int("chat.members", len(members)))
+	endSpan(span, nil)
+
+	// 3. Publish delivery event
+	spanCtx, span = tracer.Start(ctx, "delivery-publish")
+	err = s.publishDelivery(spanCtx, msg, members, replySnippet)
+	endSpan(span, err)
+	return err
+}
+
+// validateMediaURL resolves msg's media URL to its object key, which must be the
+// sender's own upload to this chat under the media bucket. Forwarded copies
+// keep the key of the message they copy, which was checked when it was sent.
+func (s *Service) validateMediaURL(msg *domain.Message) error {
+	if msg.ForwardedFrom != nil {
+		return nil
+	}
+	msg.MediaKey = ""
+	if msg.MediaURL == "" {
+		return nil
+	}
+
+	key := msg.MediaURL
+	if s.mediaBaseURL != "" {
+		key = strings.TrimPrefix(key, s.mediaBaseURL+"/")
+	}
+	name, ok := strings.CutPrefix(key, fmt.Sprintf("uploads/%d/%d/", msg.ChatID, msg.UserID))
+	if !ok || name == "" || strings.ContainsAny(name, "/?#") || strings.Contains(name, "..") {
+		return fmt.Errorf("media must be the sender's upload to this chat: %w", domain.ErrInvalidInput)
+	}
+	msg.MediaKey = key
+	return nil
+}
+
+// validateMediaMeta checks the sender's description of an attachment. Its mime
+// type must match the content type the upload was presigned with while that is
+// still known.
+func (s *Service) validateMediaMeta(ctx context.Context, msg *domain.Message) error {
+	meta := msg.MediaMeta
+	if meta == nil {
+		return nil
+	}
+	if msg.MediaURL == "" {
+		return fmt.Errorf("media metadata needs a media URL: %w", domain.ErrInvalidInput)
+	}
+	if !strings.Contains(meta.Mime, "/") {
+		return fmt.Errorf("invalid media mime type %q: %w", meta.Mime, domain.ErrInvalidInput)
+	}
+	if meta.Size < 0 || meta.Width < 0 || meta.Height < 0 {
+		return fmt.Errorf("media size and dimensions can't be negative: %w", domain.ErrInvalidInput)
+	}
+	if utf8.RuneCountInString(meta.Name) > domain.MaxMediaNameLength {
+		return fmt.Errorf("media name must be at most %d characters: %w", domain.MaxMediaNameLength, domain.ErrInvalidInput)
+	}
+
+	key := msg.MediaKey
+	if key == "" {
+		return nil
+	}
+	contentType, found, err := s.cacheRepo.GetUploadContentType(ctx, key)
+	if err != nil {
+		telemetry.Logger(ctx).Warn().Err(err).Str("object_key", key).Msg("failed to load upload content type")
+		return nil
+	}
+	if found && !strings.EqualFold(contentType, meta.Mime) {
+		return fmt.Errorf("media mime type %q doesn't match the uploaded %q: %w", meta.Mime, contentType, domain.ErrInvalidInput)
+	}
+	return nil
+}
+
+// publishDelivery hands msg to the gateways of the chat's members
+func (s *Service) publishDelivery(ctx context.Context, msg *domain.Message, members []int64, replySnippet string) error {
+	event := map[string]interface{}{
+		"type":           "Message",
+		"id":             msg.ID,
+		"chat_id":        msg.ChatID,
+		"user_id":        msg.UserID,
+		"body":           msg.Body,
+		"kind":           msg.Kind,
+		"meta":           msg.Meta,
+		"media_url":      msg.MediaURL,
+		"media_meta":     msg.MediaMeta,
+		"reply_to_id":    msg.ReplyToID,
+		"reply_snippet":  replySnippet,
+		"forwarded_from": msg.ForwardedFrom,
+		"created_at":     msg.CreatedAt, // Serializes to ISO string by default
+		"expires_at":     msg.ExpiresAt,
+	}
+	// The gateway strips this list and marks the copies it sends these members muted
+	if muted, err := s.chatRepo.GetMutedMemberIDs(ctx, msg.ChatID, time.Now()); err != nil {
+		telemetry.Logger(ctx).Error().Err(err).Int64("chat_id", msg.ChatID).Msg("failed to load muted members")
+	} else if len(muted) > 0 {
+		event[MutedUserIDsKey] = muted
+	}
+	if msg.OriginDevice != "" {
+		event[OriginDeviceKey] = msg.OriginDevice
+	}
+	// Members who blocked the sender never see their messages
+	if msg.Kind == domain.MessageKindUser {
+		if blockers, err := s.blockedMemberIDs(ctx, msg.UserID, members); err != nil {
+			telemetry.Logger(ctx).Error().Err(err).Int64("user_id", msg.UserID).Msg("failed to load blockers")
+		} else if len(blockers) > 0 {
+			event[BlockedUserIDsKey] = blockers
+		}
+	}
+	deliveryPayload, _ := json.Marshal(event)
+
+	if err := s.broker.PublishToDeliveryExchange(ctx, msg.ChatID, deliveryPayload); err != nil {
+		return fmt.Errorf("failed to publish delivery event: %w", err)
+	}
+
+	return nil
+}
+
+// MaxForwardTargets caps how many chats one message can be forwarded to at once
+const MaxForwardTargets = 10
+
+// ForwardMessage copies a message of srcChatID into each target chat on behalf
+// of userID and delivers the copies like any new message. Forwarding a forward
+// keeps pointing at the original. Membership of every target is checked up
+// front; a target that then rejects the post (e.g. slow mode) stops the loop
+// and the copies already sent stay.
+func (s *Service) ForwardMessage(ctx context.Context, srcChatID, msgID int64, targetChatIDs []int64, userID int64) ([]domain.Message, error) {
+	targets := slices.Compact(slices.Sorted(slices.Values(targetChatIDs)))
+	if len(targets) == 0 || len(targets) > MaxForwardTargets {
+		return nil, fmt.Errorf("forward needs 1 to %d target chats: %w", MaxForwardTargets, domain.ErrInvalidInput)
+	}
+
+	// Deleted messages are not found, so they can't be forwarded
+	src, err := s.GetMessage(ctx, srcChatID, msgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if src.Kind == domain.MessageKindSystem {
+		return nil, fmt.Errorf("system messages can't be forwarded: %w", domain.ErrInvalidInput)
+	}
+	for _, chatID := range targets {
+		if err := s.ensureMember(ctx, chatID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	origin := src.ForwardedFrom
+	if origin == nil {
+		origin = &domain.ForwardedFrom{ChatID: srcChatID, MsgID: msgID}
+	}
+	forwarded := make([]domain.Message, 0, len(targets))
+	for _, chatID := range targets {
+		msg := &domain.Message{
+			ChatID:        chatID,
+			UserID:        userID,
+			Body:          src.Body,
+			MediaURL:      src.MediaURL,
+			MediaKey:      src.MediaKey,
+			MediaMeta:     src.MediaMeta,
+			ForwardedFrom: origin,
+		}
+		if err := s.ProcessMessage(ctx, msg); err != nil {
+			return forwarded, err
+		}
+		forwarded = append(forwarded, *msg)
+	}
+	return forwarded, nil
+}
+
+// blockedMemberIDs returns the members who have blocked userID
+func (s *Service) blockedMemberIDs(ctx context.Context, userID int64, members []int64) ([]int64, error) {
+	blockers, err := s.blockRepo.GetBlockerIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, id := range blockers {
+		if slices.Contains(members, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// validateReply checks that a reply's parent is in the same chat and its snippet
+// fits. It returns the snippet to deliver, taken from the parent when the sender
+// didn't quote one; only a sender-provided snippet is stored.
+func (s *Service) validateReply(ctx context.Context, msg *domain.Message) (string, error) {
+	if msg.ReplyToID == nil {
+		if msg.ReplySnippet != "" {
+			return "", fmt.Errorf("reply snippet without a reply target: %w", domain.ErrInvalidInput)
+		}
+		return "", nil
+	}
+	if utf8.RuneCountInString(msg.ReplySnippet) > domain.MaxReplySnippetLen {
+		return "", fmt.Errorf("reply snippet exceeds %d characters: %w", domain.MaxReplySnippetLen, domain.ErrInvalidInput)
+	}
+
+	parent, err := s.chatRepo.GetMessage(ctx, *msg.ReplyToID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && parent.ChatID != msg.ChatID) {
+		return "", fmt.Errorf("reply target %d is not in chat %d: %w", *msg.ReplyToID, msg.ChatID, domain.ErrInvalidInput)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if msg.ReplySnippet != "" {
+		return msg.ReplySnippet, nil
+	}
+	return domain.ReplySnippetOf(parent.Body), nil
+}
+
+// EditMessage replaces the body of msgID. Only the author may edit, and only
+// within the edit window. Members are sent a MessageEdited event, and the inbox
+// preview is refreshed when the newest message changed.
+func (s *Service) EditMessage(ctx context.Context, chatID, msgID, userID int64, body string) (*domain.Message, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("message body is required: %w", domain.ErrInvalidInput)
+	}
+	msg, err := s.GetMessage(ctx, chatID, msgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.UserID != userID || msg.Kind == domain.MessageKindSystem {
+		return nil, fmt.Errorf("only the author can edit a message: %w", domain.ErrPermissionDenied)
+	}
+	if time.Since(msg.CreatedAt) > s.editWindow {
+		return nil, fmt.Errorf("messages can only be edited within %s of sending: %w", s.editWindow, domain.ErrInvalidInput)
+	}
+	if msg.Body == body {
+		return msg, nil
+	}
+
+	editedAt := time.Now()
+	msg.Body = body
+	msg.EditedAt = &editedAt
+	if err := s.chatRepo.UpdateMessage(ctx, msg); err != nil {
+		return nil, translateNotFound(err, "message %d", msgID)
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":      "MessageEdited",
+		"chatId":    chatID,
+		"id":        msgID,
+		"body":      msg.Body,
+		"edited_at": msg.EditedAt,
+	})
+	if err := s.broker.PublishToDeliveryExchange(ctx, chatID, payload); err != nil {
+		return nil, fmt.Errorf("failed to publish edit event: %w", err)
+	}
+
+	if last, err := s.chatRepo.GetLastMessage(ctx, chatID); err == nil && last != nil && last.ID == msgID {
+		_ = s.PublishChatPreview(ctx, chatID)
+	}
+	return msg, nil
+}
+
+// DeleteMessage soft-deletes msgID. Authors can delete their own messages and
+// group admins any message in the group. Members are sent a MessageDeleted event
+// so clients can show a tombstone; pins and attached media are cleaned up.
+func (s *Service) DeleteMessage(ctx context.Context, chatID, msgID, userID int64) error {
+	msg, err := s.GetMessage(ctx, chatID, msgID, userID)
+	if err != nil {
+		return err
+	}
+	if msg.UserID != userID {
+		chat, err := s.getChat(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		isAdmin, err := s.isAdmin(ctx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		if chat.Type != domain.ChatTypeGroup || !isAdmin {
+			return fmt.Errorf("only the author or a group admin can delete a message: %w", domain.ErrPermissionDenied)
+		}
+	}
+
+	last, _ := s.chatRepo.GetLastMessage(ctx, chatID)
+	deleted, err := s.chatRepo.SoftDeleteMessage(ctx, msgID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("message %d: %w", msgID, domain.ErrNotFound)
+	}
+
+	if unpinned, err := s.chatRepo.UnpinMessage(ctx, chatID, msgID); err == nil && unpinned {
+		s.publishUnpinned(ctx, chatID, msgID)
+	}
+	if msg.MediaKey != "" {
+		if err := s.cacheRepo.ScheduleMediaCleanup(ctx, msg.MediaKey, time.Now()); err != nil {
+			telemetry.Logger(ctx).Error().Err(err).Str("object_key", msg.MediaKey).Msg("failed to queue media of deleted message")
+		}
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":      "MessageDeleted",
+		"chatId":    chatID,
+		"id":        msgID,
+		"deletedBy": userID,
+	})
+	if err := s.broker.PublishToDeliveryExchange(ctx, chatID, payload); err != nil {
+		return fmt.Errorf("failed to publish delete event: %w", err)
+	}
+
+	if last != nil && last.ID == msgID {
+		_ = s.PublishChatPreview(ctx, chatID)
+	}
+	return nil
+}
+
+// PublishChatPreview recomputes a chat's last message and broadcasts it so inbox
+// previews stay accurate after the newest message is edited or removed
+func (s *Service) PublishChatPreview(ctx context.Context, chatID int64) error {
+	lastMessage, err := s.chatRepo.GetLastMessage(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get last message: %w", err)
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":        "ChatPreviewUpdated",
+		"chatId":      chatID,
+		"lastMessage": lastMessage,
+	})
+	return s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+}
+
+// RegisterDevice records a push token for userID. Re-registering a known token
+// refreshes it and reports created as false.
+func (s *Service) RegisterDevice(ctx context.Context, userID int64, token, platform string) (bool, error) {
+	deviceToken := &domain.DeviceToken{
+		UserID:   userID,
+		Token:    token,
+		Platform: platform,
+	}
+	return s.chatRepo.AddDeviceToken(ctx, deviceToken)
+}
+func (s *Service) GetChatMembers(ctx context.Context, chatID, userID int64) ([]domain.ChatMember, error) {
+	if _, err := s.getChat(ctx, chatID); err != nil {
+		return nil, err
+	}
+
+	// Check membership
 	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
 		return nil, err
 	}
 	if !isMember {
-		return nil, fmt.Errorf("permission denied: user is not a member of this chat")
+		return nil, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
 	}
 
-	return s.chatRepo.GetChatMembers(ctx, chatID)
+	members, err := s.chatRepo.GetChatMembers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range members {
+		if members[i].User != nil && members[i].User.IsDeactivated() {
+			members[i].User = members[i].User.Anonymized()
+		}
+	}
+	return members, nil
 }
 
 func (s *Service) IsMember(ctx context.Context, chatID, userID int64) (bool, error) {
 	return s.chatRepo.IsMember(ctx, chatID, userID)
 }
 
-// AddReaction adds an emoji reaction to a message (one reaction per user per message)
-func (s *Service) AddReaction(ctx context.Context, chatID, msgID, userID int64, emoji string) (*domain.Reaction, error) {
-	// Check membership
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+// IsMemberCached is IsMember backed by the Redis group member set, for hot
+// paths such as typing indicators
+func (s *Service) IsMemberCached(ctx context.Context, chatID, userID int64) (bool, error) {
+	members, err := s.memberIDs(ctx, chatID)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(members, userID), nil
+}
+
+// memberIDs returns chatID's member IDs from the in-process cache, then Redis,
+// then the database. The returned slice is shared and must not be modified.
+func (s *Service) memberIDs(ctx context.Context, chatID int64) ([]int64, error) {
+	if members, ok := s.localMembers.get(chatID); ok {
+		memberLookups.WithLabelValues("local").Inc()
+		return members, nil
+	}
+
+	// Concurrent misses for the same chat share one Redis/database load
+	v, err, _ := s.memberLoads.Do(strconv.FormatInt(chatID, 10), func() (interface{}, error) {
+		return s.loadMemberIDs(ctx, chatID)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, fmt.Errorf("permission denied: user is not a member of this chat")
+	return v.([]int64), nil
+}
+
+// loadMemberIDs reads chatID's members from Redis, falling back to the
+// database, and fills the in-process cache
+func (s *Service) loadMemberIDs(ctx context.Context, chatID int64) ([]int64, error) {
+	members, err := s.cacheRepo.GetGroupMembers(ctx, chatID)
+	if err != nil {
+		memberCacheRedisErrors.Inc()
+	}
+	if err == nil && len(members) > 0 {
+		memberLookups.WithLabelValues("redis").Inc()
+		s.localMembers.set(chatID, members)
+		return members, nil
 	}
 
-	// Remove any existing reaction from this user on this message (enforce 1 reaction per user per message)
-	_ = s.chatRepo.RemoveAllUserReactions(ctx, msgID, userID)
+	chatMembers, err := s.chatRepo.GetChatMembers(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat members: %w", err)
+	}
+	members = make([]int64, len(chatMembers))
+	for i, m := range chatMembers {
+		members[i] = m.UserID
+	}
+	memberLookups.WithLabelValues("db").Inc()
+
+	if err := s.cacheRepo.AddGroupMembers(ctx, chatID, members); err != nil {
+		memberCacheRedisErrors.Inc()
+	}
+	s.localMembers.set(chatID, members)
+	return members, nil
+}
+
+// unreadSummaryCacheTTL bounds how stale a cached unread summary can get. New
+// messages and reads invalidate it; edits like deletions just wait it out.
+const unreadSummaryCacheTTL = 30 * time.Second
+
+// GetUnreadSummary returns userID's unread total and per-chat counts for the app badge
+func (s *Service) GetUnreadSummary(ctx context.Context, userID int64) (*domain.UnreadSummary, error) {
+	if summary, found, err := s.cacheRepo.GetUnreadSummary(ctx, userID); err == nil && found {
+		return summary, nil
+	}
+
+	counts, err := s.chatRepo.GetUnreadCounts(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+	summary := &domain.UnreadSummary{Chats: counts}
+	if summary.Chats == nil {
+		summary.Chats = []domain.ChatUnread{}
+	}
+	for _, c := range counts {
+		summary.Total += c.Count
+	}
+	_ = s.cacheRepo.SetUnreadSummary(ctx, userID, summary, unreadSummaryCacheTTL)
+	return summary, nil
+}
+
+// contactsCacheTTL bounds how stale a cached contact list can get. Membership
+// changes don't invalidate it, since they would touch every member's list.
+const contactsCacheTTL = time.Minute
 
-	reaction, err := s.chatRepo.AddReaction(ctx, msgID, userID, emoji)
+// ContactIDs returns the IDs of users sharing at least one chat with userID
+func (s *Service) ContactIDs(ctx context.Context, userID int64) ([]int64, error) {
+	if contacts, found, err := s.cacheRepo.GetContacts(ctx, userID); err == nil && found {
+		return contacts, nil
+	}
+
+	contacts, err := s.chatRepo.GetContactIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contacts: %w", err)
+	}
+	_ = s.cacheRepo.SetContacts(ctx, userID, contacts, contactsCacheTTL)
+	return contacts, nil
+}
+
+// PresenceRecipients narrows candidates (typically the users connected to a
+// gateway) to those who should see subjectID's presence: users sharing a chat
+// with the subject who the subject hasn't blocked, never the subject itself
+func (s *Service) PresenceRecipients(ctx context.Context, subjectID int64, candidates []int64) ([]int64, error) {
+	contacts, err := s.ContactIDs(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	isContact := make(map[int64]bool, len(contacts))
+	for _, uid := range contacts {
+		isContact[uid] = true
+	}
+
+	// Users the subject blocked don't get to see their presence
+	blocks, err := s.blockRepo.ListBlocks(ctx, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range blocks {
+		delete(isContact, b.BlockedID)
+	}
+
+	recipients := make([]int64, 0, min(len(contacts), len(candidates)))
+	for _, uid := range candidates {
+		if uid != subjectID && isContact[uid] {
+			recipients = append(recipients, uid)
+		}
+	}
+	return recipients, nil
+}
+
+// PublishPresence announces userID going online or offline on presence.fanout.
+// Last seen is left out for users hiding it, and deactivated users stay silent.
+func (s *Service) PublishPresence(ctx context.Context, userID int64, online bool) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return translateNotFound(err, "user %d not found", userID)
+	}
+	if user.IsDeactivated() {
+		return nil
+	}
+
+	now := time.Now()
+	// Redis presence can expire; the database keeps last seen for good
+	if !online {
+		if err := s.userRepo.SetLastSeenAt(ctx, userID, now); err != nil {
+			telemetry.Logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("failed to persist last seen")
+		}
+	}
+
+	var lastSeen int64
+	if user.ShowLastSeen {
+		lastSeen = now.Unix()
+	}
+	payload, err := json.Marshal(map[string]any{
+		"type":     "Presence",
+		"userId":   userID,
+		"online":   online,
+		"lastSeen": lastSeen,
+	})
+	if err != nil {
+		return err
+	}
+	return s.broker.PublishPresenceEvent(ctx, payload)
+}
+
+// OnlineMembers returns the members of chatID who are currently online, for
+// userID who must be a member. Members hiding their last seen are left out,
+// except the caller themselves.
+func (s *Service) OnlineMembers(ctx context.Context, chatID, userID int64) ([]int64, error) {
+	members, err := s.memberIDs(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(members, userID) {
+		return nil, fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+
+	presences, err := s.cacheRepo.GetPresences(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	var online []int64
+	for _, uid := range members {
+		if presences[uid].Online {
+			online = append(online, uid)
+		}
+	}
+	if len(online) == 0 {
+		return []int64{}, nil
+	}
+
+	users, err := s.userRepo.GetByIDs(ctx, online)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]int64, 0, len(users))
+	for _, u := range users {
+		if u.ID == userID || (u.ShowLastSeen && !u.IsDeactivated()) {
+			visible = append(visible, u.ID)
+		}
+	}
+	slices.Sort(visible)
+	return visible, nil
+}
+
+// PinMessage pins msgID in chatID. Pinning an already pinned message moves it to
+// the top. At the pin limit the oldest pin is replaced if replaceOldest is set,
+// otherwise ErrPinLimitReached is returned. Group pins are admin only.
+func (s *Service) PinMessage(ctx context.Context, chatID, msgID, actorID int64, replaceOldest bool) (*domain.PinnedMessage, error) {
+	if err := s.ensureCanPin(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+	msg, err := s.GetMessage(ctx, chatID, msgID, actorID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Broadcast reaction event to chat
+	pins, err := s.chatRepo.GetPinnedMessages(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	alreadyPinned := false
+	for _, p := range pins {
+		if p.MessageID == msgID {
+			alreadyPinned = true
+			break
+		}
+	}
+
+	var replaced *domain.PinnedMessage
+	if !alreadyPinned && len(pins) >= domain.MaxPinnedMessages {
+		if !replaceOldest {
+			return nil, ErrPinLimitReached
+		}
+		replaced = &pins[len(pins)-1] // Pins are newest first
+		if _, err := s.chatRepo.UnpinMessage(ctx, chatID, replaced.MessageID); err != nil {
+			return nil, err
+		}
+	}
+
+	pin := &domain.PinnedMessage{
+		ChatID:    chatID,
+		MessageID: msgID,
+		PinnedBy:  actorID,
+		PinnedAt:  time.Now(),
+	}
+	if err := s.chatRepo.PinMessage(ctx, pin); err != nil {
+		return nil, err
+	}
+	pin.Message = msg
+
+	if replaced != nil {
+		s.publishUnpinned(ctx, chatID, replaced.MessageID)
+	}
 	payload, _ := json.Marshal(map[string]interface{}{
-		"type":       "ReactionAdded",
-		"chat_id":    chatID,
-		"message_id": msgID,
-		"user_id":    userID,
-		"emoji":      emoji,
+		"type":      "MessagePinned",
+		"chatId":    chatID,
+		"messageId": msgID,
+		"pinnedBy":  actorID,
+		"pinnedAt":  pin.PinnedAt,
 	})
 	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+	return pin, nil
+}
+
+// UnpinMessage removes msgID from chatID's pins
+func (s *Service) UnpinMessage(ctx context.Context, chatID, msgID, actorID int64) error {
+	if err := s.ensureCanPin(ctx, chatID, actorID); err != nil {
+		return err
+	}
+	removed, err := s.chatRepo.UnpinMessage(ctx, chatID, msgID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("message %d is not pinned: %w", msgID, domain.ErrNotFound)
+	}
+	s.publishUnpinned(ctx, chatID, msgID)
+	return nil
+}
 
-	return reaction, nil
+// GetPinnedMessages returns chatID's pins, newest first
+func (s *Service) GetPinnedMessages(ctx context.Context, chatID, userID int64) ([]domain.PinnedMessage, error) {
+	if err := s.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+	return s.chatRepo.GetPinnedMessages(ctx, chatID)
 }
 
-// RemoveReaction removes an emoji reaction from a message
-func (s *Service) RemoveReaction(ctx context.Context, chatID, msgID, userID int64, emoji string) error {
-	// Check membership
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+// ensureCanPin allows any member to pin in a direct chat and only admins in a group
+func (s *Service) ensureCanPin(ctx context.Context, chatID, userID int64) error {
+	chat, err := s.getChat(ctx, chatID)
 	if err != nil {
 		return err
 	}
-	if !isMember {
-		return fmt.Errorf("permission denied: user is not a member of this chat")
+	role, err := s.chatRepo.GetMemberRole(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	if chat.Type == domain.ChatTypeGroup && role != domain.RoleOwner && role != domain.RoleAdmin {
+		return fmt.Errorf("only admins can pin messages: %w", domain.ErrPermissionDenied)
+	}
+	return nil
+}
+
+func (s *Service) publishUnpinned(ctx context.Context, chatID, msgID int64) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":      "MessageUnpinned",
+		"chatId":    chatID,
+		"messageId": msgID,
+	})
+	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
+}
+
+// AddReaction sets userID's reaction on a message of chatID, replacing any
+// earlier one (one reaction per user per message), and returns the message's
+// updated reactions
+func (s *Service) AddReaction(ctx context.Context, chatID, msgID, userID int64, emoji string) (domain.ReactionSummary, error) {
+	if _, err := s.GetMessage(ctx, chatID, msgID, userID); err != nil {
+		return nil, err
+	}
+
+	// Remove any existing reaction from this user on this message (enforce 1 reaction per user per message)
+	_ = s.chatRepo.RemoveAllUserReactions(ctx, msgID, userID)
+
+	if _, err := s.chatRepo.AddReaction(ctx, msgID, userID, emoji); err != nil {
+		return nil, err
+	}
+	return s.publishReactions(ctx, "ReactionAdded", chatID, msgID, userID, emoji)
+}
+
+// RemoveReaction removes userID's emoji reaction from a message of chatID and
+// returns the message's updated reactions
+func (s *Service) RemoveReaction(ctx context.Context, chatID, msgID, userID int64, emoji string) (domain.ReactionSummary, error) {
+	if _, err := s.GetMessage(ctx, chatID, msgID, userID); err != nil {
+		return nil, err
 	}
 
 	if err := s.chatRepo.RemoveReaction(ctx, msgID, userID, emoji); err != nil {
-		return err
+		return nil, err
+	}
+	return s.publishReactions(ctx, "ReactionRemoved", chatID, msgID, userID, emoji)
+}
+
+// publishReactions broadcasts a reaction change together with the message's
+// full reaction summary, so clients can reconcile counts without refetching
+func (s *Service) publishReactions(ctx context.Context, eventType string, chatID, msgID, userID int64, emoji string) (domain.ReactionSummary, error) {
+	reactions, err := s.chatRepo.GetReactions(ctx, msgID)
+	if err != nil {
+		return nil, err
 	}
+	summary := domain.SummarizeReactions(reactions)
 
-	// Broadcast reaction removal event to chat
 	payload, _ := json.Marshal(map[string]interface{}{
-		"type":       "ReactionRemoved",
+		"type":       eventType,
 		"chat_id":    chatID,
 		"message_id": msgID,
 		"user_id":    userID,
 		"emoji":      emoji,
+		"reactions":  summary,
 	})
 	_ = s.broker.PublishToDeliveryExchange(ctx, chatID, payload)
 
-	return nil
+	return summary, nil
 }
 
-// GetThreadReplies returns all replies to a parent message
+// GetThreadReplies returns the replies to a parent message. A parent that isn't
+// a message of chatID is reported as not found.
 func (s *Service) GetThreadReplies(ctx context.Context, chatID, parentMsgID, userID int64, limit int) ([]domain.Message, error) {
-	// Check membership
-	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
-	if err != nil {
+	if _, err := s.GetMessage(ctx, chatID, parentMsgID, userID); err != nil {
 		return nil, err
 	}
-	if !isMember {
-		return nil, fmt.Errorf("permission denied: user is not a member of this chat")
-	}
 
-	return s.chatRepo.GetThreadReplies(ctx, parentMsgID, limit)
+	return s.chatRepo.GetThreadReplies(ctx, chatID, parentMsgID, limit)
 }
 
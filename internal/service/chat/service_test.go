@@ -0,0 +1,1901 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeChatRepo is an in-memory ChatRepository. Methods not overridden here
+// panic via the embedded nil interface, so tests fail loudly on unexpected calls.
+type fakeChatRepo struct {
+	domain.ChatRepository
+	chats     map[int64]*domain.Chat
+	members   map[int64]map[int64]domain.Role
+	messages  []domain.Message
+	pins      []domain.PinnedMessage // newest first
+	reactions []domain.Reaction
+	unread    []domain.ChatUnread
+	folders   []domain.Folder
+	muted     map[int64]map[int64]time.Time // chatID -> userID -> muted until
+	archived  map[int64]bool                // chats some member archived
+	unarchive []int64                       // chats UnarchiveForAll ran on
+	devices   []domain.DeviceToken
+}
+
+func newFakeChatRepo() *fakeChatRepo {
+	return &fakeChatRepo{
+		chats:   make(map[int64]*domain.Chat),
+		members: make(map[int64]map[int64]domain.Role),
+	}
+}
+
+func (r *fakeChatRepo) addChat(id int64, chatType int16, members map[int64]domain.Role) {
+	r.chats[id] = &domain.Chat{ID: id, Type: chatType}
+	r.members[id] = members
+}
+
+func (r *fakeChatRepo) GetChat(ctx context.Context, chatID int64) (*domain.Chat, error) {
+	chat, ok := r.chats[chatID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return chat, nil
+}
+
+func (r *fakeChatRepo) CreateChat(ctx context.Context, chat *domain.Chat, ownerID int64, memberIDs []int64) (*domain.Chat, error) {
+	chat.ID = int64(len(r.chats) + 1)
+	members := map[int64]domain.Role{ownerID: domain.RoleOwner}
+	for _, id := range memberIDs {
+		if _, dup := members[id]; dup {
+			return nil, fmt.Errorf("duplicate member %d", id)
+		}
+		members[id] = domain.RoleMember
+	}
+	r.chats[chat.ID] = chat
+	r.members[chat.ID] = members
+	return chat, nil
+}
+
+func (r *fakeChatRepo) AddMember(ctx context.Context, chatID, userID int64, role domain.Role) error {
+	r.members[chatID][userID] = role
+	return nil
+}
+
+func (r *fakeChatRepo) RemoveMember(ctx context.Context, chatID, userID int64) error {
+	delete(r.members[chatID], userID)
+	return nil
+}
+
+func (r *fakeChatRepo) UpdateMemberRole(ctx context.Context, chatID, userID int64, role domain.Role) error {
+	r.members[chatID][userID] = role
+	return nil
+}
+
+func (r *fakeChatRepo) GetMemberRole(ctx context.Context, chatID, userID int64) (domain.Role, error) {
+	return r.members[chatID][userID], nil
+}
+
+func (r *fakeChatRepo) IsMember(ctx context.Context, chatID, userID int64) (bool, error) {
+	_, ok := r.members[chatID][userID]
+	return ok, nil
+}
+
+func (r *fakeChatRepo) GetChatMembers(ctx context.Context, chatID int64) ([]domain.ChatMember, error) {
+	var members []domain.ChatMember
+	for userID, role := range r.members[chatID] {
+		members = append(members, domain.ChatMember{
+			ChatID: chatID,
+			UserID: userID,
+			Role:   role,
+			User:   &domain.User{ID: userID, Username: fmt.Sprintf("user%d", userID)},
+		})
+	}
+	return members, nil
+}
+
+func (r *fakeChatRepo) GetMember(ctx context.Context, chatID, userID int64) (*domain.ChatMember, error) {
+	role, ok := r.members[chatID][userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &domain.ChatMember{ChatID: chatID, UserID: userID, Role: role}, nil
+}
+
+func (r *fakeChatRepo) CountMembers(ctx context.Context, chatID int64) (int64, error) {
+	return int64(len(r.members[chatID])), nil
+}
+
+func (r *fakeChatRepo) GetFirstUnread(ctx context.Context, chatID, userID int64) (*int64, error) {
+	return nil, nil
+}
+
+func (r *fakeChatRepo) GetContactIDs(ctx context.Context, userID int64) ([]int64, error) {
+	seen := make(map[int64]bool)
+	var ids []int64
+	for _, members := range r.members {
+		if _, ok := members[userID]; !ok {
+			continue
+		}
+		for uid := range members {
+			if uid != userID && !seen[uid] {
+				seen[uid] = true
+				ids = append(ids, uid)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeChatRepo) CreateMessage(ctx context.Context, msg *domain.Message) error {
+	msg.ID = int64(len(r.messages) + 1)
+	r.messages = append(r.messages, *msg)
+	return nil
+}
+
+func (r *fakeChatRepo) GetMessage(ctx context.Context, msgID int64) (*domain.Message, error) {
+	if msgID < 1 || msgID > int64(len(r.messages)) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	msg := r.messages[msgID-1]
+	if msg.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &msg, nil
+}
+
+func (r *fakeChatRepo) SoftDeleteMessage(ctx context.Context, msgID int64, at time.Time) (bool, error) {
+	if r.messages[msgID-1].DeletedAt != nil {
+		return false, nil
+	}
+	r.messages[msgID-1].DeletedAt = &at
+	return true, nil
+}
+
+func (r *fakeChatRepo) UpdateMessage(ctx context.Context, msg *domain.Message) error {
+	r.messages[msg.ID-1] = *msg
+	return nil
+}
+
+func (r *fakeChatRepo) GetThreadReplies(ctx context.Context, chatID, parentMsgID int64, limit int) ([]domain.Message, error) {
+	var out []domain.Message
+	for _, m := range r.messages {
+		if m.ChatID == chatID && m.ReplyToID != nil && *m.ReplyToID == parentMsgID && m.DeletedAt == nil && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeChatRepo) GetUnreadCounts(ctx context.Context, userID int64) ([]domain.ChatUnread, error) {
+	return r.unread, nil
+}
+
+func (r *fakeChatRepo) AddReaction(ctx context.Context, msgID, userID int64, emoji string) (*domain.Reaction, error) {
+	reaction := domain.Reaction{ID: int64(len(r.reactions) + 1), MessageID: msgID, UserID: userID, Emoji: emoji}
+	r.reactions = append(r.reactions, reaction)
+	return &reaction, nil
+}
+
+func (r *fakeChatRepo) RemoveReaction(ctx context.Context, msgID, userID int64, emoji string) error {
+	r.reactions = slices.DeleteFunc(r.reactions, func(re domain.Reaction) bool {
+		return re.MessageID == msgID && re.UserID == userID && re.Emoji == emoji
+	})
+	return nil
+}
+
+func (r *fakeChatRepo) RemoveAllUserReactions(ctx context.Context, msgID, userID int64) error {
+	r.reactions = slices.DeleteFunc(r.reactions, func(re domain.Reaction) bool {
+		return re.MessageID == msgID && re.UserID == userID
+	})
+	return nil
+}
+
+func (r *fakeChatRepo) GetReactions(ctx context.Context, msgID int64) ([]domain.Reaction, error) {
+	var out []domain.Reaction
+	for _, re := range r.reactions {
+		if re.MessageID == msgID {
+			out = append(out, re)
+		}
+	}
+	return out, nil
+}
+
+func (r *fakeChatRepo) GetLastMessage(ctx context.Context, chatID int64) (*domain.Message, error) {
+	for i := len(r.messages) - 1; i >= 0; i-- {
+		if r.messages[i].ChatID == chatID && r.messages[i].DeletedAt == nil {
+			msg := r.messages[i]
+			return &msg, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeChatRepo) GetMessageHistory(ctx context.Context, chatID, viewerID, beforeID int64, limit int, includeDeleted bool) ([]domain.Message, error) {
+	var msgs []domain.Message
+	for i := len(r.messages) - 1; i >= 0 && len(msgs) < limit; i-- {
+		msg := r.messages[i]
+		if msg.ChatID == chatID && (beforeID == 0 || msg.ID < beforeID) && (includeDeleted || msg.DeletedAt == nil) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (r *fakeChatRepo) GetMessagesAfter(ctx context.Context, chatID, viewerID, afterID int64, limit int) ([]domain.Message, error) {
+	var msgs []domain.Message
+	for _, msg := range r.messages {
+		if msg.ChatID == chatID && msg.ID > afterID && len(msgs) < limit {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (r *fakeChatRepo) GetMessagesByIDs(ctx context.Context, ids []int64) ([]domain.Message, error) {
+	var msgs []domain.Message
+	for _, id := range ids {
+		if msg, err := r.GetMessage(ctx, id); err == nil {
+			msgs = append(msgs, *msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (r *fakeChatRepo) PinMessage(ctx context.Context, pin *domain.PinnedMessage) error {
+	_, _ = r.UnpinMessage(ctx, pin.ChatID, pin.MessageID)
+	r.pins = append([]domain.PinnedMessage{*pin}, r.pins...)
+	return nil
+}
+
+func (r *fakeChatRepo) UnpinMessage(ctx context.Context, chatID, msgID int64) (bool, error) {
+	for i, p := range r.pins {
+		if p.ChatID == chatID && p.MessageID == msgID {
+			r.pins = append(r.pins[:i], r.pins[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeChatRepo) GetPinnedMessages(ctx context.Context, chatID int64) ([]domain.PinnedMessage, error) {
+	var pins []domain.PinnedMessage
+	for _, p := range r.pins {
+		if p.ChatID == chatID {
+			pins = append(pins, p)
+		}
+	}
+	return pins, nil
+}
+
+func (r *fakeChatRepo) CreateFolder(ctx context.Context, folder *domain.Folder) error {
+	folder.ID = int64(len(r.folders) + 1)
+	r.folders = append(r.folders, *folder)
+	return nil
+}
+
+func (r *fakeChatRepo) GetFolder(ctx context.Context, folderID int64) (*domain.Folder, error) {
+	for _, f := range r.folders {
+		if f.ID == folderID {
+			return &f, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeChatRepo) ListFolders(ctx context.Context, userID int64) ([]domain.Folder, error) {
+	var folders []domain.Folder
+	for _, f := range r.folders {
+		if f.UserID == userID {
+			folders = append(folders, f)
+		}
+	}
+	return folders, nil
+}
+
+func (r *fakeChatRepo) AddChatToFolder(ctx context.Context, folderID, chatID int64) error {
+	return nil
+}
+
+func (r *fakeChatRepo) CreateReceipt(ctx context.Context, receipt *domain.Receipt) error {
+	return nil
+}
+
+func (r *fakeChatRepo) HasArchivedMembers(ctx context.Context, chatID int64) (bool, error) {
+	return r.archived[chatID], nil
+}
+
+func (r *fakeChatRepo) UnarchiveForAll(ctx context.Context, chatID int64) error {
+	r.unarchive = append(r.unarchive, chatID)
+	delete(r.archived, chatID)
+	return nil
+}
+
+func (r *fakeChatRepo) SetMutedUntil(ctx context.Context, chatID, userID int64, mutedUntil *time.Time) error {
+	if r.muted == nil {
+		r.muted = make(map[int64]map[int64]time.Time)
+	}
+	if r.muted[chatID] == nil {
+		r.muted[chatID] = make(map[int64]time.Time)
+	}
+	if mutedUntil == nil {
+		delete(r.muted[chatID], userID)
+	} else {
+		r.muted[chatID][userID] = *mutedUntil
+	}
+	return nil
+}
+
+func (r *fakeChatRepo) GetMutedMemberIDs(ctx context.Context, chatID int64, now time.Time) ([]int64, error) {
+	var userIDs []int64
+	for userID, until := range r.muted[chatID] {
+		if until.After(now) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// fakeUserRepo knows a fixed set of users
+type fakeUserRepo struct {
+	domain.UserRepository
+	users map[int64]*domain.User
+	err   error // returned by GetByID when set
+}
+
+func (r *fakeUserRepo) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	var users []domain.User
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok {
+			users = append(users, *u)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) SetLastSeenAt(ctx context.Context, id int64, at time.Time) error {
+	r.users[id].LastSeenAt = &at
+	return nil
+}
+
+// fakeCache is a no-op CacheRepository for the methods the chat service uses
+type fakeCache struct {
+	domain.CacheRepository
+}
+
+func (fakeCache) AddGroupMembers(ctx context.Context, chatID int64, userIDs []int64) error {
+	return nil
+}
+
+func (fakeCache) GetGroupMembers(ctx context.Context, chatID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (fakeCache) RemoveGroupMember(ctx context.Context, chatID, userID int64) error {
+	return nil
+}
+
+func (fakeCache) GetContacts(ctx context.Context, userID int64) ([]int64, bool, error) {
+	return nil, false, nil
+}
+
+func (fakeCache) SetContacts(ctx context.Context, userID int64, contactIDs []int64, ttl time.Duration) error {
+	return nil
+}
+
+func (fakeCache) GetUnreadSummary(ctx context.Context, userID int64) (*domain.UnreadSummary, bool, error) {
+	return nil, false, nil
+}
+
+func (fakeCache) SetUnreadSummary(ctx context.Context, userID int64, summary *domain.UnreadSummary, ttl time.Duration) error {
+	return nil
+}
+
+func (fakeCache) InvalidateUnreadSummaries(ctx context.Context, userIDs []int64) error {
+	return nil
+}
+
+func (fakeCache) AcquireSlowMode(ctx context.Context, chatID, userID int64, interval time.Duration) (time.Duration, error) {
+	return 0, nil
+}
+
+func (fakeCache) GetUploadContentType(ctx context.Context, objectKey string) (string, bool, error) {
+	return "", false, nil
+}
+
+// uploadTypeCache knows the content types of presigned uploads by object key
+type uploadTypeCache struct {
+	fakeCache
+	types map[string]string
+}
+
+func (c uploadTypeCache) GetUploadContentType(ctx context.Context, objectKey string) (string, bool, error) {
+	contentType, ok := c.types[objectKey]
+	return contentType, ok, nil
+}
+
+// slowModeCache holds each slow-mode slot until released by the test
+type slowModeCache struct {
+	fakeCache
+	held map[[2]int64]bool
+}
+
+func (c *slowModeCache) AcquireSlowMode(ctx context.Context, chatID, userID int64, interval time.Duration) (time.Duration, error) {
+	key := [2]int64{chatID, userID}
+	if c.held[key] {
+		return interval, nil
+	}
+	c.held[key] = true
+	return 0, nil
+}
+
+// fakeBroker records published delivery events
+type fakeBroker struct {
+	domain.MessageBroker
+	published [][]byte
+}
+
+func (b *fakeBroker) PublishToDeliveryExchange(ctx context.Context, chatID int64, payload []byte) error {
+	b.published = append(b.published, payload)
+	return nil
+}
+
+func (b *fakeBroker) PublishPresenceEvent(ctx context.Context, payload []byte) error {
+	b.published = append(b.published, payload)
+	return nil
+}
+
+// fakeBlockRepo holds blocks as blocker -> blocked IDs
+type fakeBlockRepo struct {
+	domain.BlockRepository
+	blocks map[int64][]int64
+}
+
+func (r *fakeBlockRepo) IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	return slices.Contains(r.blocks[blockerID], blockedID), nil
+}
+
+func (r *fakeBlockRepo) GetBlockerIDs(ctx context.Context, blockedID int64) ([]int64, error) {
+	var ids []int64
+	for blocker, blocked := range r.blocks {
+		if slices.Contains(blocked, blockedID) {
+			ids = append(ids, blocker)
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeBlockRepo) ListBlocks(ctx context.Context, blockerID int64) ([]domain.Block, error) {
+	var blocks []domain.Block
+	for _, id := range r.blocks[blockerID] {
+		blocks = append(blocks, domain.Block{BlockerID: blockerID, BlockedID: id})
+	}
+	return blocks, nil
+}
+
+func newTestService(repo *fakeChatRepo) *Service {
+	return newTestServiceWithUsers(repo, &fakeUserRepo{})
+}
+
+func newTestServiceWithUsers(repo *fakeChatRepo, users *fakeUserRepo) *Service {
+	return NewService(repo, users, &fakeBlockRepo{}, fakeCache{}, &fakeBroker{})
+}
+
+func TestAddMember_DirectChatRejected(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := newTestService(repo)
+
+	err := svc.AddMember(context.Background(), 1, 30)
+	require.ErrorIs(t, err, ErrDirectChatMembership)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	assert.Len(t, repo.members[1], 2, "direct chat must keep exactly two members")
+}
+
+func TestPromoteMember_DirectChatRejected(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := newTestService(repo)
+
+	err := svc.PromoteMember(context.Background(), 1, 10, 20)
+	require.ErrorIs(t, err, ErrDirectChatMembership)
+	assert.Equal(t, domain.RoleMember, repo.members[1][20])
+}
+
+func TestDemoteMember_DirectChatRejected(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleAdmin})
+	svc := newTestService(repo)
+
+	err := svc.DemoteMember(context.Background(), 1, 10, 20)
+	require.ErrorIs(t, err, ErrDirectChatMembership)
+	assert.Equal(t, domain.RoleAdmin, repo.members[1][20])
+}
+
+func TestAddMember_GroupChatAllowed(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	svc := newTestService(repo)
+
+	require.NoError(t, svc.AddMember(context.Background(), 1, 30))
+	assert.Equal(t, domain.RoleMember, repo.members[1][30])
+}
+
+func TestAddMember_PostsSystemMessage(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	svc := newTestService(repo)
+
+	require.NoError(t, svc.AddMember(context.Background(), 1, 30))
+	require.Len(t, repo.messages, 1)
+
+	msg := repo.messages[0]
+	assert.Equal(t, domain.MessageKindSystem, msg.Kind)
+	assert.Equal(t, "user30 joined the group", msg.Body)
+
+	var meta map[string]any
+	require.NoError(t, json.Unmarshal(msg.Meta, &meta))
+	assert.Equal(t, domain.SystemEventMemberJoined, meta["event"])
+	assert.EqualValues(t, 30, meta["userId"])
+}
+
+func TestChatCursor_RoundTrip(t *testing.T) {
+	want := domain.ChatCursor{LastActivityAt: time.Date(2024, 5, 1, 12, 30, 0, 123000, time.UTC), ChatID: 42}
+
+	got, err := DecodeChatCursor(EncodeChatCursor(want))
+	require.NoError(t, err)
+	assert.Equal(t, want, *got)
+}
+
+func TestDecodeChatCursor_Invalid(t *testing.T) {
+	_, err := DecodeChatCursor("not-a-cursor!")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestValidateMemberIDs(t *testing.T) {
+	deactivated := time.Now()
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10},
+		20: {ID: 20},
+		30: {ID: 30, DeactivatedAt: &deactivated},
+	}}
+	svc := newTestServiceWithUsers(newFakeChatRepo(), users)
+	ctx := context.Background()
+
+	t.Run("dedupes and strips creator", func(t *testing.T) {
+		ids, err := svc.validateMemberIDs(ctx, 10, []int64{20, 10, 20})
+		require.NoError(t, err)
+		assert.Equal(t, []int64{20}, ids)
+	})
+
+	t.Run("only creator", func(t *testing.T) {
+		_, err := svc.validateMemberIDs(ctx, 10, []int64{10})
+		assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	})
+
+	t.Run("lists unknown and deactivated users", func(t *testing.T) {
+		_, err := svc.validateMemberIDs(ctx, 10, []int64{20, 30, 99})
+		require.ErrorIs(t, err, domain.ErrInvalidInput)
+		assert.Contains(t, err.Error(), "[30 99]")
+	})
+}
+
+func TestGetMessage_CrossChatIsNotFound(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{20: domain.RoleOwner})
+	require.NoError(t, repo.CreateMessage(context.Background(), &domain.Message{ChatID: 2, UserID: 20, Body: "secret"}))
+	svc := newTestService(repo)
+
+	_, err := svc.GetMessage(context.Background(), 1, 1, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = svc.GetMessage(context.Background(), 1, 42, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestPromoteMember_BroadcastsRoleChanged(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+
+	require.NoError(t, svc.PromoteMember(context.Background(), 1, 10, 20))
+	assert.Equal(t, domain.RoleAdmin, repo.members[1][20])
+
+	require.NotEmpty(t, broker.published)
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, "RoleChanged", event["type"])
+	assert.EqualValues(t, 1, event["chatId"])
+	assert.EqualValues(t, 20, event["userId"])
+	assert.Equal(t, "admin", event["role"])
+}
+
+func TestPromoteMember_NonMemberTarget(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	svc := newTestService(repo)
+
+	err := svc.PromoteMember(context.Background(), 1, 10, 99)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestProcessMessage_AdminsOnlyPostPolicy(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.chats[1].PostPolicy = domain.PostPolicyAdmins
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	err := svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "hi"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	assert.Empty(t, repo.messages)
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "announcement"}))
+	assert.Len(t, repo.messages, 1)
+}
+
+func TestProcessMessage_ListsMutedMembers(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember, 30: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	require.NoError(t, svc.MuteChat(ctx, 1, 20, time.Now().Add(time.Hour)))
+	require.NoError(t, svc.MuteChat(ctx, 1, 30, domain.MutedForever))
+	require.NoError(t, svc.UnmuteChat(ctx, 1, 30))
+	assert.ErrorIs(t, svc.MuteChat(ctx, 1, 30, time.Now().Add(-time.Minute)), domain.ErrInvalidInput)
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	require.Len(t, broker.published, 1)
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, []any{float64(20)}, event[MutedUserIDsKey])
+}
+
+func TestProcessMessage_MediaMeta(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	broker := &fakeBroker{}
+	cache := uploadTypeCache{types: map[string]string{"uploads/1/10/a.png": "image/png"}}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, cache, broker)
+	svc.SetMediaBaseURL("http://localhost:9000/chat-media")
+	ctx := context.Background()
+	url := "http://localhost:9000/chat-media/uploads/1/10/a.png"
+
+	err := svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "pic", MediaURL: url,
+		MediaMeta: &domain.MediaMeta{Mime: "application/pdf", Size: 10}})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "mime must match the presigned content type")
+	err = svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "pic",
+		MediaMeta: &domain.MediaMeta{Mime: "image/png"}})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "metadata without media")
+	err = svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "pic", MediaURL: url,
+		MediaMeta: &domain.MediaMeta{Mime: "image/png", Width: -1}})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	assert.Empty(t, repo.messages)
+
+	meta := &domain.MediaMeta{Mime: "image/png", Size: 2048, Width: 640, Height: 480, Name: "a.png"}
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "pic", MediaURL: url, MediaMeta: meta}))
+	require.Len(t, repo.messages, 1)
+	assert.Equal(t, meta, repo.messages[0].MediaMeta)
+
+	var event struct {
+		MediaMeta *domain.MediaMeta `json:"media_meta"`
+	}
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, meta, event.MediaMeta)
+}
+
+func TestMessageStatus(t *testing.T) {
+	// Read up to 5, delivered up to 8
+	assert.Equal(t, int16(domain.ReceiptStatusRead), messageStatus(5, 5, 8))
+	assert.Equal(t, int16(domain.ReceiptStatusDelivered), messageStatus(6, 5, 8))
+	assert.Equal(t, int16(domain.ReceiptStatusSent), messageStatus(9, 5, 8))
+}
+
+func TestKickMember(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{
+		10: domain.RoleOwner, 20: domain.RoleMember, 30: domain.RoleMember,
+	})
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, svc.KickMember(ctx, 1, 20, 30), domain.ErrPermissionDenied)
+	assert.ErrorIs(t, svc.KickMember(ctx, 1, 10, 99), domain.ErrInvalidInput)
+	// The owner is the only admin left
+	assert.ErrorIs(t, svc.KickMember(ctx, 1, 10, 10), domain.ErrInvalidInput)
+
+	require.NoError(t, svc.KickMember(ctx, 1, 10, 30))
+	assert.NotContains(t, repo.members[1], int64(30))
+	require.NotEmpty(t, repo.messages)
+	assert.Equal(t, "user10 removed user30", repo.messages[len(repo.messages)-1].Body)
+}
+
+func TestProcessMessage_OriginDevice(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleMember, 20: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi", OriginDevice: "ios"}))
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "from REST"}))
+	require.Len(t, broker.published, 2)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, "ios", event[OriginDeviceKey])
+	event = nil
+	require.NoError(t, json.Unmarshal(broker.published[1], &event))
+	assert.NotContains(t, event, OriginDeviceKey)
+}
+
+func TestProcessMessage_ListsBlockers(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember, 30: domain.RoleMember})
+	broker := &fakeBroker{}
+	// 40 blocked the sender too but isn't in the chat
+	blocks := &fakeBlockRepo{blocks: map[int64][]int64{20: {10}, 40: {10}, 10: {30}}}
+	svc := NewService(repo, &fakeUserRepo{}, blocks, fakeCache{}, broker)
+	ctx := context.Background()
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 30, Body: "hey"}))
+	require.Len(t, broker.published, 2)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, []any{float64(20)}, event[BlockedUserIDsKey])
+	require.NoError(t, json.Unmarshal(broker.published[1], &event))
+	assert.Equal(t, []any{float64(10)}, event[BlockedUserIDsKey])
+}
+
+func TestCreateChat_DirectChatBlocked(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{10: {ID: 10, EmailVerified: true}, 20: {ID: 20, EmailVerified: true}}}
+	blocks := &fakeBlockRepo{blocks: map[int64][]int64{20: {10}}}
+	svc := NewService(newFakeChatRepo(), users, blocks, fakeCache{}, &fakeBroker{})
+	ctx := context.Background()
+
+	// Whoever asks, a blocked pair can't get a direct chat
+	_, err := svc.CreateChat(ctx, 10, domain.ChatTypeDirect, []int64{20}, "")
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	_, err = svc.CreateChat(ctx, 20, domain.ChatTypeDirect, []int64{10}, "")
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+}
+
+func TestProcessMessage_UnarchivesOnlyArchivedChats(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.archived = map[int64]bool{2: true}
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 2, UserID: 10, Body: "hi"}))
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 2, UserID: 10, Body: "again"}))
+	assert.Equal(t, []int64{2}, repo.unarchive)
+}
+
+func TestProcessMessage_DirectChatBlocked(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleMember, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	broker := &fakeBroker{}
+	blocks := &fakeBlockRepo{blocks: map[int64][]int64{20: {10}}}
+	svc := NewService(repo, &fakeUserRepo{}, blocks, fakeCache{}, broker)
+	ctx := context.Background()
+
+	// Neither side of a blocked pair can write in their direct chat
+	err := svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"})
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	err = svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "hi"})
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	assert.Empty(t, broker.published)
+
+	// Groups still accept the message; only the fan-out skips the blocker
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 2, UserID: 10, Body: "hi"}))
+	assert.Len(t, broker.published, 1)
+}
+
+func TestCreateChat_AddsCreatorAndMembersOnce(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10, EmailVerified: true},
+		20: {ID: 20},
+		30: {ID: 30},
+	}}
+	repo := newFakeChatRepo()
+	svc := newTestServiceWithUsers(repo, users)
+
+	// The creator and a repeated member are listed too
+	chat, err := svc.CreateChat(context.Background(), 10, domain.ChatTypeGroup, []int64{20, 10, 30, 20}, "g")
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]domain.Role{
+		10: domain.RoleOwner,
+		20: domain.RoleMember,
+		30: domain.RoleMember,
+	}, repo.members[chat.ID])
+}
+
+// failingCreateRepo fails chat creation like a rolled-back member insert
+type failingCreateRepo struct {
+	*fakeChatRepo
+}
+
+func (failingCreateRepo) CreateChat(ctx context.Context, chat *domain.Chat, ownerID int64, memberIDs []int64) (*domain.Chat, error) {
+	return nil, errors.New("insert chat_members: foreign key violation")
+}
+
+// memberCacheRecorder records the member sets written to the cache
+type memberCacheRecorder struct {
+	fakeCache
+	cached map[int64][]int64
+}
+
+func (c *memberCacheRecorder) AddGroupMembers(ctx context.Context, chatID int64, userIDs []int64) error {
+	c.cached[chatID] = userIDs
+	return nil
+}
+
+func TestCreateChat_FailedInsertSkipsCache(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10, EmailVerified: true},
+		20: {ID: 20},
+		30: {ID: 30},
+	}}
+	cache := &memberCacheRecorder{cached: map[int64][]int64{}}
+	repo := failingCreateRepo{newFakeChatRepo()}
+	svc := NewService(repo, users, &fakeBlockRepo{}, cache, &fakeBroker{})
+
+	_, err := svc.CreateChat(context.Background(), 10, domain.ChatTypeGroup, []int64{20, 30}, "g")
+	require.Error(t, err)
+	assert.Empty(t, cache.cached, "members of a chat that wasn't created must not be cached")
+
+	// Once the transaction commits, the whole member set is cached
+	svc = NewService(repo.fakeChatRepo, users, &fakeBlockRepo{}, cache, &fakeBroker{})
+	chat, err := svc.CreateChat(context.Background(), 10, domain.ChatTypeGroup, []int64{20, 30}, "g")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{10, 20, 30}, cache.cached[chat.ID])
+}
+
+func TestCreateChat_MemberCount(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10, EmailVerified: true},
+		20: {ID: 20},
+		30: {ID: 30},
+	}}
+	repo := newFakeChatRepo()
+	svc := newTestServiceWithUsers(repo, users)
+	ctx := context.Background()
+
+	_, err := svc.CreateChat(ctx, 10, domain.ChatTypeDirect, []int64{20, 30}, "")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "direct chat with two other members")
+	_, err = svc.CreateChat(ctx, 10, domain.ChatTypeGroup, nil, "g")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "group chat without members")
+	_, err = svc.CreateChat(ctx, 10, domain.ChatTypeGroup, []int64{10, 10}, "g")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "group chat with only the creator")
+	assert.Empty(t, repo.chats)
+}
+
+func TestCreateChat_RequiresVerifiedEmail(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{10: {ID: 10}, 20: {ID: 20, EmailVerified: true}}}
+	repo := newFakeChatRepo()
+	svc := newTestServiceWithUsers(repo, users)
+
+	_, err := svc.CreateChat(context.Background(), 10, domain.ChatTypeGroup, []int64{20}, "g")
+	require.ErrorIs(t, err, domain.ErrPermissionDenied)
+	assert.Contains(t, err.Error(), "email not verified")
+
+	_, err = svc.CreateChat(context.Background(), 30, domain.ChatTypeGroup, []int64{20}, "g")
+	assert.ErrorIs(t, err, domain.ErrNotFound, "unknown creator")
+
+	users.err = errors.New("connection refused")
+	_, err = svc.CreateChat(context.Background(), 20, domain.ChatTypeGroup, []int64{10}, "g")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, domain.ErrNotFound, "lookup failures are not reported as missing users")
+	assert.Empty(t, repo.chats)
+}
+
+func TestValidateGroupInfo_AvatarPrefix(t *testing.T) {
+	own := "http://localhost:9000/chat-media/uploads/7/3/a.png"
+	other := "http://localhost:9000/chat-media/uploads/8/3/a.png"
+	empty := ""
+
+	assert.NoError(t, validateGroupInfo(7, "", domain.GroupInfoUpdate{AvatarURL: &own}))
+	assert.NoError(t, validateGroupInfo(7, "", domain.GroupInfoUpdate{AvatarURL: &empty}))
+	assert.ErrorIs(t, validateGroupInfo(7, "", domain.GroupInfoUpdate{AvatarURL: &other}), domain.ErrInvalidInput)
+}
+
+func TestValidateGroupInfo_AvatarBucket(t *testing.T) {
+	base := "http://localhost:9000/chat-media"
+	own := base + "/uploads/7/3/a.png"
+	key := "uploads/7/3/a.png"
+	foreign := "https://evil.example/chat-media/uploads/7/3/a.png"
+	otherBucket := "http://localhost:9000/other/uploads/7/3/a.png"
+	traversal := base + "/uploads/7/../8/3/a.png"
+
+	assert.NoError(t, validateGroupInfo(7, base, domain.GroupInfoUpdate{AvatarURL: &own}))
+	assert.NoError(t, validateGroupInfo(7, base, domain.GroupInfoUpdate{AvatarURL: &key}))
+	assert.ErrorIs(t, validateGroupInfo(7, base, domain.GroupInfoUpdate{AvatarURL: &foreign}), domain.ErrInvalidInput)
+	assert.ErrorIs(t, validateGroupInfo(7, base, domain.GroupInfoUpdate{AvatarURL: &otherBucket}), domain.ErrInvalidInput)
+	assert.ErrorIs(t, validateGroupInfo(7, base, domain.GroupInfoUpdate{AvatarURL: &traversal}), domain.ErrInvalidInput)
+}
+
+func TestGetChatDetails_MemberCountAndRole(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleAdmin, 30: domain.RoleMember})
+	repo.chats[1].Title = "team"
+	repo.chats[1].AvatarURL = "uploads/1/10/a.png"
+	svc := newTestService(repo)
+
+	details, err := svc.GetChatDetails(context.Background(), 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, "team", details.Title)
+	assert.Equal(t, "uploads/1/10/a.png", details.AvatarURL)
+	assert.Equal(t, int16(domain.ChatTypeGroup), details.Type)
+	assert.Equal(t, int64(3), details.MemberCount)
+	assert.Equal(t, domain.RoleAdmin, details.Role)
+
+	_, err = svc.GetChatDetails(context.Background(), 1, 99)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+}
+
+func TestGetMessagesByIDs_OmitsUnauthorized(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{20: domain.RoleOwner})
+	ctx := context.Background()
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "mine"}))
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 2, UserID: 20, Body: "theirs"}))
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "mine too"}))
+	svc := newTestService(repo)
+
+	msgs, err := svc.GetMessagesByIDs(ctx, 10, []int64{3, 2, 1, 3, 99})
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, int64(3), msgs[0].ID)
+	assert.Equal(t, int64(1), msgs[1].ID)
+}
+
+func TestCatchUp_PagesAfterID(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{20: domain.RoleOwner})
+	ctx := context.Background()
+	for i := 0; i < MaxCatchUpBatch+5; i++ {
+		require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	}
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 2, UserID: 20, Body: "elsewhere"}))
+	svc := newTestService(repo)
+
+	msgs, hasMore, err := svc.CatchUp(ctx, 1, 10, 0)
+	require.NoError(t, err)
+	assert.True(t, hasMore)
+	require.Len(t, msgs, MaxCatchUpBatch)
+	assert.Equal(t, int64(1), msgs[0].ID)
+
+	msgs, hasMore, err = svc.CatchUp(ctx, 1, 10, msgs[len(msgs)-1].ID)
+	require.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Len(t, msgs, 5)
+
+	_, _, err = svc.CatchUp(ctx, 2, 10, 0)
+	assert.Error(t, err)
+}
+
+func TestProcessMessage_SlowMode(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.chats[1].SlowModeSeconds = 30
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, &slowModeCache{held: map[[2]int64]bool{}}, &fakeBroker{})
+	ctx := context.Background()
+
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "first"}))
+	err := svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "too soon"})
+	var slowErr *domain.SlowModeError
+	require.ErrorAs(t, err, &slowErr)
+	assert.Equal(t, 30*time.Second, slowErr.RetryAfter)
+	assert.ErrorIs(t, err, domain.ErrRateLimited)
+
+	// Admins are exempt
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "one"}))
+	require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "two"}))
+	assert.Len(t, repo.messages, 3)
+}
+
+func TestPinMessage_LimitAndReplaceOldest(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	ctx := context.Background()
+	for i := 0; i <= domain.MaxPinnedMessages; i++ {
+		require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	}
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+
+	_, err := svc.PinMessage(ctx, 1, 1, 20, false)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+
+	for id := int64(1); id <= domain.MaxPinnedMessages; id++ {
+		_, err := svc.PinMessage(ctx, 1, id, 10, false)
+		require.NoError(t, err)
+	}
+	last := int64(domain.MaxPinnedMessages + 1)
+	_, err = svc.PinMessage(ctx, 1, last, 10, false)
+	assert.ErrorIs(t, err, ErrPinLimitReached)
+
+	// Repinning an existing pin moves it to the top without hitting the limit
+	_, err = svc.PinMessage(ctx, 1, 1, 10, false)
+	require.NoError(t, err)
+
+	broker.published = nil
+	_, err = svc.PinMessage(ctx, 1, last, 10, true)
+	require.NoError(t, err)
+
+	pins, err := svc.GetPinnedMessages(ctx, 1, 20)
+	require.NoError(t, err)
+	require.Len(t, pins, domain.MaxPinnedMessages)
+	assert.Equal(t, last, pins[0].MessageID)
+	assert.Equal(t, int64(1), pins[1].MessageID)
+	for _, p := range pins {
+		assert.NotEqual(t, int64(2), p.MessageID, "oldest pin should have been replaced")
+	}
+
+	require.Len(t, broker.published, 2)
+	assert.Contains(t, string(broker.published[0]), `"type":"MessageUnpinned"`)
+	assert.Contains(t, string(broker.published[1]), `"type":"MessagePinned"`)
+}
+
+func TestReactions_ReturnSummary(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{30: domain.RoleOwner})
+	ctx := context.Background()
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}))
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+
+	_, err := svc.AddReaction(ctx, 1, 1, 10, "👍")
+	require.NoError(t, err)
+	summary, err := svc.AddReaction(ctx, 1, 1, 20, "👍")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReactionSummary{"👍": {10, 20}}, summary)
+
+	// A second reaction replaces the user's first one
+	summary, err = svc.AddReaction(ctx, 1, 1, 20, "🎉")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReactionSummary{"👍": {10}, "🎉": {20}}, summary)
+
+	summary, err = svc.RemoveReaction(ctx, 1, 1, 10, "👍")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReactionSummary{"🎉": {20}}, summary)
+
+	require.Len(t, broker.published, 4)
+	assert.Contains(t, string(broker.published[3]), `"type":"ReactionRemoved"`)
+	assert.Contains(t, string(broker.published[3]), `"reactions":{"🎉":[20]}`)
+
+	_, err = svc.AddReaction(ctx, 2, 1, 20, "👍")
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	// Reacting through another chat doesn't reach its messages
+	_, err = svc.AddReaction(ctx, 2, 1, 30, "👍")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestGetThreadReplies_ParentMustBelongToChat(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	ctx := context.Background()
+	parent := int64(1)
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "question"}))
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "answer", ReplyToID: &parent}))
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "unrelated"}))
+	svc := newTestService(repo)
+
+	replies, err := svc.GetThreadReplies(ctx, 1, parent, 20, 50)
+	require.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "answer", replies[0].Body)
+
+	_, err = svc.GetThreadReplies(ctx, 2, parent, 10, 50)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = svc.GetThreadReplies(ctx, 1, 99, 20, 50)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = svc.GetThreadReplies(ctx, 2, parent, 20, 50)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+}
+
+func TestForwardMessage(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleMember})
+	repo.addChat(3, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleMember})
+	repo.addChat(4, domain.ChatTypeGroup, map[int64]domain.Role{20: domain.RoleOwner})
+	ctx := context.Background()
+	require.NoError(t, repo.CreateMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "look", MediaURL: "https://cdn/x.png"}))
+	svc := newTestService(repo)
+
+	_, err := svc.ForwardMessage(ctx, 1, 1, []int64{2, 4}, 10)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+	assert.Len(t, repo.messages, 1, "nothing is forwarded when a target is off limits")
+
+	forwarded, err := svc.ForwardMessage(ctx, 1, 1, []int64{3, 2, 3}, 10)
+	require.NoError(t, err)
+	require.Len(t, forwarded, 2)
+	for i, chatID := range []int64{2, 3} {
+		assert.Equal(t, chatID, forwarded[i].ChatID)
+		assert.Equal(t, int64(10), forwarded[i].UserID)
+		assert.Equal(t, "look", forwarded[i].Body)
+		assert.Equal(t, "https://cdn/x.png", forwarded[i].MediaURL)
+		assert.Equal(t, &domain.ForwardedFrom{ChatID: 1, MsgID: 1}, forwarded[i].ForwardedFrom)
+	}
+
+	// Forwarding a forward still points at the original
+	again, err := svc.ForwardMessage(ctx, 2, forwarded[0].ID, []int64{3}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.ForwardedFrom{ChatID: 1, MsgID: 1}, again[0].ForwardedFrom)
+
+	now := time.Now()
+	repo.messages[0].DeletedAt = &now
+	_, err = svc.ForwardMessage(ctx, 1, 1, []int64{2}, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestGetUnreadSummary(t *testing.T) {
+	repo := newFakeChatRepo()
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	summary, err := svc.GetUnreadSummary(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.UnreadSummary{Chats: []domain.ChatUnread{}}, summary)
+
+	repo.unread = []domain.ChatUnread{{ChatID: 1, Count: 3}, {ChatID: 4, Count: 7}}
+	summary, err = svc.GetUnreadSummary(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), summary.Total)
+	assert.Equal(t, repo.unread, summary.Chats)
+}
+
+func TestIsMemberCached(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	ok, err := svc.IsMemberCached(ctx, 1, 20)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = svc.IsMemberCached(ctx, 1, 30)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemberCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newMemberCache(2, time.Minute)
+	c.set(1, []int64{10})
+	c.set(2, []int64{20})
+	_, _ = c.get(1)
+	c.set(3, []int64{30})
+
+	_, ok := c.get(2)
+	assert.False(t, ok)
+	members, ok := c.get(1)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{10}, members)
+	_, ok = c.get(3)
+	assert.True(t, ok)
+}
+
+func TestMemberCache_ExpiresAndInvalidates(t *testing.T) {
+	c := newMemberCache(10, time.Millisecond)
+	c.set(1, []int64{10})
+	time.Sleep(5 * time.Millisecond)
+	_, ok := c.get(1)
+	assert.False(t, ok)
+
+	c = newMemberCache(10, time.Minute)
+	c.set(1, []int64{10})
+	c.invalidate(1)
+	_, ok = c.get(1)
+	assert.False(t, ok)
+}
+
+// downCache fails every Redis member-set call, as during an outage
+type downCache struct {
+	fakeCache
+}
+
+func (downCache) GetGroupMembers(ctx context.Context, chatID int64) ([]int64, error) {
+	return nil, fmt.Errorf("redis: connection refused")
+}
+
+func (downCache) AddGroupMembers(ctx context.Context, chatID int64, userIDs []int64) error {
+	return fmt.Errorf("redis: connection refused")
+}
+
+// countingChatRepo counts member list loads from the database
+type countingChatRepo struct {
+	*fakeChatRepo
+	memberLoads int
+}
+
+func (r *countingChatRepo) GetChatMembers(ctx context.Context, chatID int64) ([]domain.ChatMember, error) {
+	r.memberLoads++
+	return r.fakeChatRepo.GetChatMembers(ctx, chatID)
+}
+
+func TestIsMemberCached_RedisDownUsesLocalTier(t *testing.T) {
+	repo := &countingChatRepo{fakeChatRepo: newFakeChatRepo()}
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, downCache{}, &fakeBroker{})
+	ctx := context.Background()
+
+	for range 3 {
+		ok, err := svc.IsMemberCached(ctx, 1, 20)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 1, repo.memberLoads)
+
+	// Membership changes drop the local entry even though Redis can't be updated
+	require.NoError(t, svc.AddMember(ctx, 1, 30))
+	ok, err := svc.IsMemberCached(ctx, 1, 30)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestPresenceRecipients_OnlyContactsExcludingSubject(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleMember, 30: domain.RoleMember})
+	repo.addChat(3, domain.ChatTypeGroup, map[int64]domain.Role{40: domain.RoleOwner, 50: domain.RoleMember})
+	svc := newTestService(repo)
+
+	// 40 and 50 share no chat with 10, and 10 never hears its own presence
+	recipients, err := svc.PresenceRecipients(context.Background(), 10, []int64{10, 20, 30, 40, 50})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{20, 30}, recipients)
+
+	// Blocked users stop seeing their blocker
+	svc = NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{blocks: map[int64][]int64{10: {30}}}, fakeCache{}, &fakeBroker{})
+	recipients, err = svc.PresenceRecipients(context.Background(), 10, []int64{20, 30})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20}, recipients)
+}
+
+func TestFolders_ValidationAndOwnership(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{30: domain.RoleOwner})
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	folder, err := svc.CreateFolder(ctx, 10, "  Work ")
+	require.NoError(t, err)
+	assert.Equal(t, "Work", folder.Name)
+
+	_, err = svc.CreateFolder(ctx, 10, "Work")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	_, err = svc.CreateFolder(ctx, 10, " ")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	// Another user may reuse the name but can't see or use the first user's folder
+	_, err = svc.CreateFolder(ctx, 20, "Work")
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.AddChatToFolder(ctx, 20, folder.ID, 1), domain.ErrNotFound)
+	_, _, err = svc.ListUserChats(ctx, 20, domain.ChatListOptions{FolderID: folder.ID})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	// Only chats the owner belongs to can be filed
+	require.NoError(t, svc.AddChatToFolder(ctx, 10, folder.ID, 1))
+	assert.Error(t, svc.AddChatToFolder(ctx, 10, folder.ID, 2))
+}
+
+func TestCreateFolder_Limit(t *testing.T) {
+	svc := newTestService(newFakeChatRepo())
+	ctx := context.Background()
+
+	for i := range domain.MaxFoldersPerUser {
+		_, err := svc.CreateFolder(ctx, 10, fmt.Sprintf("Folder %d", i))
+		require.NoError(t, err)
+	}
+	_, err := svc.CreateFolder(ctx, 10, "One too many")
+	assert.ErrorIs(t, err, ErrFolderLimitReached)
+}
+
+func TestProcessMessage_ReplySnippet(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	parent := &domain.Message{ChatID: 1, UserID: 20, Body: strings.Repeat("a", domain.MaxReplySnippetLen+10)}
+	require.NoError(t, svc.ProcessMessage(ctx, parent))
+	other := &domain.Message{ChatID: 2, UserID: 10, Body: "elsewhere"}
+	require.NoError(t, svc.ProcessMessage(ctx, other))
+
+	// Without a quote the delivered snippet falls back to the start of the parent
+	reply := &domain.Message{ChatID: 1, UserID: 10, Body: "yes", ReplyToID: &parent.ID}
+	require.NoError(t, svc.ProcessMessage(ctx, reply))
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[len(broker.published)-1], &event))
+	assert.Equal(t, strings.Repeat("a", domain.MaxReplySnippetLen), event["reply_snippet"])
+	assert.Empty(t, repo.messages[reply.ID-1].ReplySnippet, "only quoted snippets are stored")
+
+	quoted := &domain.Message{ChatID: 1, UserID: 10, Body: "yes", ReplyToID: &parent.ID, ReplySnippet: "aaa"}
+	require.NoError(t, svc.ProcessMessage(ctx, quoted))
+	assert.Equal(t, "aaa", repo.messages[quoted.ID-1].ReplySnippet)
+
+	tooLong := &domain.Message{ChatID: 1, UserID: 10, Body: "yes", ReplyToID: &parent.ID, ReplySnippet: strings.Repeat("b", domain.MaxReplySnippetLen+1)}
+	assert.ErrorIs(t, svc.ProcessMessage(ctx, tooLong), domain.ErrInvalidInput)
+
+	crossChat := &domain.Message{ChatID: 1, UserID: 10, Body: "yes", ReplyToID: &other.ID}
+	assert.ErrorIs(t, svc.ProcessMessage(ctx, crossChat), domain.ErrInvalidInput)
+
+	orphanQuote := &domain.Message{ChatID: 1, UserID: 10, Body: "yes", ReplySnippet: "aaa"}
+	assert.ErrorIs(t, svc.ProcessMessage(ctx, orphanQuote), domain.ErrInvalidInput)
+}
+
+// presenceCache reports a fixed set of users online
+type presenceCache struct {
+	fakeCache
+	online map[int64]bool
+}
+
+func (c presenceCache) GetPresences(ctx context.Context, userIDs []int64) (map[int64]domain.Presence, error) {
+	presences := make(map[int64]domain.Presence, len(userIDs))
+	for _, uid := range userIDs {
+		presences[uid] = domain.Presence{Online: c.online[uid]}
+	}
+	return presences, nil
+}
+
+func TestOnlineMembers_RespectsLastSeenPrivacy(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{
+		10: domain.RoleOwner, 20: domain.RoleMember, 30: domain.RoleMember, 40: domain.RoleMember,
+	})
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10, ShowLastSeen: false},
+		20: {ID: 20, ShowLastSeen: true},
+		30: {ID: 30, ShowLastSeen: false},
+		40: {ID: 40, ShowLastSeen: true},
+	}}
+	cache := presenceCache{online: map[int64]bool{10: true, 20: true, 30: true}}
+	svc := NewService(repo, users, &fakeBlockRepo{}, cache, &fakeBroker{})
+	ctx := context.Background()
+
+	// 30 hides their status, 40 is offline; the caller always sees themselves
+	online, err := svc.OnlineMembers(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 20}, online)
+
+	online, err = svc.OnlineMembers(ctx, 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20}, online)
+
+	_, err = svc.OnlineMembers(ctx, 1, 99)
+	assert.Error(t, err)
+}
+
+func TestPublishPresence_HidesLastSeen(t *testing.T) {
+	deactivated := time.Now()
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		10: {ID: 10, ShowLastSeen: true},
+		20: {ID: 20, ShowLastSeen: false},
+		30: {ID: 30, ShowLastSeen: true, DeactivatedAt: &deactivated},
+	}}
+	broker := &fakeBroker{}
+	svc := NewService(newFakeChatRepo(), users, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	require.NoError(t, svc.PublishPresence(ctx, 10, true))
+	require.NoError(t, svc.PublishPresence(ctx, 20, false))
+	require.NoError(t, svc.PublishPresence(ctx, 30, true))
+	require.Len(t, broker.published, 2)
+
+	var visible, hidden map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &visible))
+	require.NoError(t, json.Unmarshal(broker.published[1], &hidden))
+	assert.Equal(t, "Presence", visible["type"])
+	assert.Equal(t, true, visible["online"])
+	assert.NotZero(t, visible["lastSeen"])
+	assert.Equal(t, false, hidden["online"])
+	assert.Zero(t, hidden["lastSeen"])
+
+	// Going offline persists last seen, even for users hiding it
+	assert.Nil(t, users.users[10].LastSeenAt)
+	assert.NotNil(t, users.users[20].LastSeenAt)
+
+	assert.ErrorIs(t, svc.PublishPresence(ctx, 99, true), domain.ErrNotFound)
+}
+
+// purgeRepo hands out expired messages in batches
+type purgeRepo struct {
+	*fakeChatRepo
+	remaining int
+	calls     int
+}
+
+func (r *purgeRepo) PurgeExpiredMessages(ctx context.Context, defaultDays, limit int) (int64, []string, error) {
+	r.calls++
+	n := min(r.remaining, limit)
+	r.remaining -= n
+	return int64(n), []string{fmt.Sprintf("uploads/1/10/batch-%d.jpg", r.calls)}, nil
+}
+
+// mediaQueueCache records media queued for cleanup
+type mediaQueueCache struct {
+	fakeCache
+	queued *[]string
+}
+
+func (c mediaQueueCache) ScheduleMediaCleanup(ctx context.Context, mediaURL string, deletedAt time.Time) error {
+	*c.queued = append(*c.queued, mediaURL)
+	return nil
+}
+
+func TestProcessMessage_MediaMustBeSendersUpload(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	var queued []string
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, mediaQueueCache{queued: &queued}, &fakeBroker{})
+	svc.SetMediaBaseURL("http://localhost:9000/chat-media")
+	ctx := context.Background()
+
+	for _, url := range []string{
+		"http://localhost:9000/chat-media/uploads/1/10/theirs.png", // another member's upload
+		"http://localhost:9000/chat-media/uploads/2/20/a.png",      // the sender's upload to another chat
+		"https://evil.example/chat-media/uploads/1/20/a.png",       // another host
+		"http://localhost:9000/chat-media/uploads/1/20/../10/a.png",
+		"http://localhost:9000/chat-media/users/20/avatar.png",
+	} {
+		err := svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "pic", MediaURL: url})
+		assert.ErrorIs(t, err, domain.ErrInvalidInput, url)
+	}
+	assert.Empty(t, repo.messages)
+
+	own := &domain.Message{ChatID: 1, UserID: 20, Body: "pic", MediaURL: "http://localhost:9000/chat-media/uploads/1/20/a.png"}
+	require.NoError(t, svc.ProcessMessage(ctx, own))
+	assert.Equal(t, "uploads/1/20/a.png", repo.messages[0].MediaKey)
+
+	forwarded, err := svc.ForwardMessage(ctx, 1, own.ID, []int64{2}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "uploads/1/20/a.png", forwarded[0].MediaKey, "forwards keep the source's key")
+
+	require.NoError(t, svc.DeleteMessage(ctx, 1, own.ID, 20))
+	assert.Equal(t, []string{"uploads/1/20/a.png"}, queued, "cleanup is queued by key")
+}
+
+func TestPurgeExpiredMessages_DrainsInBatches(t *testing.T) {
+	repo := &purgeRepo{fakeChatRepo: newFakeChatRepo(), remaining: 2*retentionBatchSize + 5}
+	var queued []string
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, mediaQueueCache{queued: &queued}, &fakeBroker{})
+
+	purged, err := svc.PurgeExpiredMessages(context.Background(), 30)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2*retentionBatchSize+5, purged)
+	assert.Equal(t, 3, repo.calls)
+	assert.Len(t, queued, 3)
+}
+
+func TestEditMessage(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	msg := &domain.Message{ChatID: 1, UserID: 10, Body: "helo", CreatedAt: time.Now()}
+	require.NoError(t, svc.ProcessMessage(ctx, msg))
+	published := len(broker.published)
+
+	edited, err := svc.EditMessage(ctx, 1, msg.ID, 10, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", repo.messages[msg.ID-1].Body)
+	require.NotNil(t, edited.EditedAt)
+
+	// The edit event plus a preview refresh, since it is the newest message
+	require.Len(t, broker.published, published+2)
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[published], &event))
+	assert.Equal(t, "MessageEdited", event["type"])
+	assert.Equal(t, "hello", event["body"])
+
+	_, err = svc.EditMessage(ctx, 1, msg.ID, 20, "hijacked")
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied)
+
+	svc.SetEditWindow(time.Nanosecond)
+	_, err = svc.EditMessage(ctx, 1, msg.ID, 10, "too late")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestDeleteMessage_AuthorOrGroupAdmin(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember, 30: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	first := &domain.Message{ChatID: 1, UserID: 20, Body: "wrong chat"}
+	require.NoError(t, svc.ProcessMessage(ctx, first))
+	second := &domain.Message{ChatID: 1, UserID: 20, Body: "spam"}
+	require.NoError(t, svc.ProcessMessage(ctx, second))
+
+	// Other members can't delete, the author and admins can
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, 1, first.ID, 30), domain.ErrPermissionDenied)
+	require.NoError(t, svc.DeleteMessage(ctx, 1, first.ID, 20))
+	require.NoError(t, svc.DeleteMessage(ctx, 1, second.ID, 10))
+	assert.NotNil(t, repo.messages[second.ID-1].DeletedAt)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[len(broker.published)-2], &event))
+	assert.Equal(t, "MessageDeleted", event["type"])
+	assert.EqualValues(t, second.ID, event["id"])
+
+	// Deleted messages are gone for everyone, including a second delete
+	assert.ErrorIs(t, svc.DeleteMessage(ctx, 1, first.ID, 20), domain.ErrNotFound)
+	_, err := svc.GetMessage(ctx, 1, first.ID, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestGetMessages_PagesWithBeforeID(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := newTestService(repo)
+	ctx := context.Background()
+	for i := range 5 {
+		require.NoError(t, svc.ProcessMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: fmt.Sprint(i)}))
+	}
+
+	page, cursor, err := svc.GetMessages(ctx, 1, 10, 0, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{5, 4}, messageIDs(page))
+	assert.EqualValues(t, 4, cursor)
+	assert.EqualValues(t, domain.ReceiptStatusSent, page[0].Status, "status is still computed per page")
+
+	page, cursor, err = svc.GetMessages(ctx, 1, 10, cursor, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, messageIDs(page))
+
+	page, cursor, err = svc.GetMessages(ctx, 1, 10, cursor, 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, messageIDs(page))
+	assert.Zero(t, cursor, "no cursor on the oldest page")
+}
+
+func messageIDs(msgs []domain.Message) []int64 {
+	ids := make([]int64, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestDisplayName_Cached(t *testing.T) {
+	users := &fakeUserRepo{users: map[int64]*domain.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Email: "bob@example.com"},
+	}}
+	svc := newTestServiceWithUsers(newFakeChatRepo(), users)
+	ctx := context.Background()
+
+	name, err := svc.DisplayName(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", name)
+
+	// A rename shows up only once the cached entry expires
+	users.users[1].Username = "alicia"
+	name, _ = svc.DisplayName(ctx, 1)
+	assert.Equal(t, "alice", name)
+
+	name, _ = svc.DisplayName(ctx, 2)
+	assert.Equal(t, "bob@example.com", name)
+
+	_, err = svc.DisplayName(ctx, 3)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func (r *fakeChatRepo) UpdateChat(ctx context.Context, chat *domain.Chat) error {
+	r.chats[chat.ID] = chat
+	return nil
+}
+
+// expiryRepo hands out prepared expired messages once
+type expiryRepo struct {
+	*fakeChatRepo
+	expired []domain.Message
+}
+
+func (r *expiryRepo) DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) ([]domain.Message, error) {
+	batch := r.expired[:min(limit, len(r.expired))]
+	r.expired = r.expired[len(batch):]
+	return batch, nil
+}
+
+func TestSetMessageTTL(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	repo.addChat(2, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleMember, 20: domain.RoleMember})
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, broker)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, svc.SetMessageTTL(ctx, 1, 20, 60), domain.ErrPermissionDenied, "group members need to be admins")
+	assert.ErrorIs(t, svc.SetMessageTTL(ctx, 1, 10, domain.MaxMessageTTLSeconds+1), domain.ErrInvalidInput)
+	assert.ErrorIs(t, svc.SetMessageTTL(ctx, 2, 30, 60), domain.ErrPermissionDenied)
+
+	require.NoError(t, svc.SetMessageTTL(ctx, 2, 20, 60))
+	assert.Equal(t, 60, repo.chats[2].MessageTTLSeconds)
+	require.Len(t, broker.published, 1)
+	assert.JSONEq(t, `{"type":"ChatUpdated","chatId":2,"messageTtlSeconds":60}`, string(broker.published[0]))
+
+	require.NoError(t, svc.SetMessageTTL(ctx, 2, 10, 60))
+	assert.Len(t, broker.published, 1, "an unchanged TTL isn't broadcast")
+}
+
+func TestProcessMessage_SetsExpiry(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeDirect, map[int64]domain.Role{10: domain.RoleMember, 20: domain.RoleMember})
+	repo.chats[1].MessageTTLSeconds = 30
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	before := time.Now()
+	msg := &domain.Message{ChatID: 1, UserID: 10, Body: "secret"}
+	require.NoError(t, svc.ProcessMessage(ctx, msg))
+	require.NotNil(t, msg.ExpiresAt)
+	assert.WithinDuration(t, before.Add(30*time.Second), *msg.ExpiresAt, time.Second)
+
+	repo.chats[1].MessageTTLSeconds = 0
+	plain := &domain.Message{ChatID: 1, UserID: 10, Body: "plain"}
+	require.NoError(t, svc.ProcessMessage(ctx, plain))
+	assert.Nil(t, plain.ExpiresAt)
+}
+
+func TestDeleteExpiredMessages(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Minute)
+	repo := &expiryRepo{fakeChatRepo: newFakeChatRepo(), expired: []domain.Message{
+		{ID: 1, ChatID: 7, MediaURL: "uploads/7/10/a.png", MediaKey: "uploads/7/10/a.png"},
+		{ID: 2, ChatID: 7},
+		{ID: 3, ChatID: 7, DeletedAt: &deletedAt}, // deleted by hand; already announced
+	}}
+	var queued []string
+	broker := &fakeBroker{}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, mediaQueueCache{queued: &queued}, broker)
+
+	deleted, err := svc.DeleteExpiredMessages(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, deleted)
+	assert.Equal(t, []string{"uploads/7/10/a.png"}, queued)
+
+	var types []string
+	var ids []float64
+	for _, payload := range broker.published {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal(payload, &event))
+		types = append(types, event["type"].(string))
+		if event["type"] == "MessageDeleted" {
+			ids = append(ids, event["id"].(float64))
+			assert.Equal(t, true, event["expired"])
+		}
+	}
+	assert.Equal(t, []float64{1, 2}, ids)
+	assert.Equal(t, []string{"MessageDeleted", "MessageDeleted", "ChatPreviewUpdated"}, types)
+}
+
+// scheduleRepo keeps scheduled messages in memory
+type scheduleRepo struct {
+	*fakeChatRepo
+	scheduled []domain.ScheduledMessage
+	nextID    int64
+}
+
+func (r *scheduleRepo) CreateScheduledMessage(ctx context.Context, sm *domain.ScheduledMessage) error {
+	if sm.ID == 0 {
+		r.nextID++
+		sm.ID = r.nextID
+	}
+	r.scheduled = append(r.scheduled, *sm)
+	return nil
+}
+
+func (r *scheduleRepo) ListScheduledMessages(ctx context.Context, chatID, userID int64) ([]domain.ScheduledMessage, error) {
+	var out []domain.ScheduledMessage
+	for _, sm := range r.scheduled {
+		if sm.ChatID == chatID && sm.UserID == userID {
+			out = append(out, sm)
+		}
+	}
+	return out, nil
+}
+
+func (r *scheduleRepo) DeleteScheduledMessage(ctx context.Context, chatID, userID, id int64) (bool, error) {
+	for i, sm := range r.scheduled {
+		if sm.ID == id && sm.ChatID == chatID && sm.UserID == userID {
+			r.scheduled = append(r.scheduled[:i], r.scheduled[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *scheduleRepo) ClaimDueScheduledMessages(ctx context.Context, now time.Time, limit int) ([]domain.ScheduledMessage, error) {
+	var due, pending []domain.ScheduledMessage
+	for _, sm := range r.scheduled {
+		if !sm.SendAt.After(now) && len(due) < limit {
+			due = append(due, sm)
+		} else {
+			pending = append(pending, sm)
+		}
+	}
+	r.scheduled = pending
+	return due, nil
+}
+
+func TestScheduleMessage(t *testing.T) {
+	repo := &scheduleRepo{fakeChatRepo: newFakeChatRepo()}
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, &fakeBroker{})
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+
+	_, err := svc.ScheduleMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}, time.Now().Add(-time.Minute))
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "past times are rejected")
+	_, err = svc.ScheduleMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}, time.Now().Add(domain.MaxScheduleAhead+time.Hour))
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "too far ahead")
+	_, err = svc.ScheduleMessage(ctx, &domain.Message{ChatID: 1, UserID: 30, Body: "hi"}, later)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied, "non-members can't schedule")
+
+	repo.chats[1].PostPolicy = domain.PostPolicyAdmins
+	_, err = svc.ScheduleMessage(ctx, &domain.Message{ChatID: 1, UserID: 20, Body: "hi"}, later)
+	assert.ErrorIs(t, err, domain.ErrPermissionDenied, "post policy applies when scheduling")
+
+	sm, err := svc.ScheduleMessage(ctx, &domain.Message{ChatID: 1, UserID: 10, Body: "hi"}, later)
+	require.NoError(t, err)
+	assert.NotZero(t, sm.ID)
+	assert.Empty(t, repo.messages, "nothing is sent yet")
+
+	listed, err := svc.ListScheduledMessages(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "hi", listed[0].Body)
+
+	assert.ErrorIs(t, svc.CancelScheduledMessage(ctx, 1, 20, sm.ID), domain.ErrNotFound, "only the author can cancel")
+	require.NoError(t, svc.CancelScheduledMessage(ctx, 1, 10, sm.ID))
+	assert.Empty(t, repo.scheduled)
+}
+
+func TestDispatchDueMessages(t *testing.T) {
+	repo := &scheduleRepo{fakeChatRepo: newFakeChatRepo()}
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	now := time.Now()
+	repo.scheduled = []domain.ScheduledMessage{
+		{ID: 1, ChatID: 1, UserID: 10, Body: "due", SendAt: now.Add(-time.Second)},
+		{ID: 2, ChatID: 1, UserID: 30, Body: "sender left", SendAt: now.Add(-time.Second)},
+		{ID: 3, ChatID: 1, UserID: 20, Body: "later", SendAt: now.Add(time.Hour)},
+	}
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, &fakeBroker{})
+
+	sent, err := svc.DispatchDueMessages(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, repo.messages, 1)
+	assert.Equal(t, "due", repo.messages[0].Body)
+	require.Len(t, repo.scheduled, 1, "the dropped message isn't put back")
+	assert.EqualValues(t, 3, repo.scheduled[0].ID)
+}
+
+// hashedMembersRepo returns members whose users carry a password hash
+type hashedMembersRepo struct {
+	*fakeChatRepo
+}
+
+func (r *hashedMembersRepo) GetChatMembers(ctx context.Context, chatID int64) ([]domain.ChatMember, error) {
+	members, err := r.fakeChatRepo.GetChatMembers(ctx, chatID)
+	for i := range members {
+		members[i].User.PasswordHash = "$2a$10$secret"
+	}
+	return members, err
+}
+
+func TestGetChatMembers_NoPasswordInJSON(t *testing.T) {
+	repo := &hashedMembersRepo{newFakeChatRepo()}
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner, 20: domain.RoleMember})
+	svc := NewService(repo, &fakeUserRepo{}, &fakeBlockRepo{}, fakeCache{}, &fakeBroker{})
+
+	members, err := svc.GetChatMembers(context.Background(), 1, 10)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+
+	body, err := json.Marshal(members)
+	require.NoError(t, err)
+	assert.NotContains(t, strings.ToLower(string(body)), "password")
+	assert.NotContains(t, string(body), "secret")
+}
+
+func TestSetNotificationLevel_RejectsUnknownLevel(t *testing.T) {
+	svc := newTestService(newFakeChatRepo())
+
+	err := svc.SetNotificationLevel(context.Background(), 1, 10, domain.NotificationLevel("loud"))
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestMissingChatOrMessage_NotFound(t *testing.T) {
+	repo := newFakeChatRepo()
+	repo.addChat(1, domain.ChatTypeGroup, map[int64]domain.Role{10: domain.RoleOwner})
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	_, err := svc.GetChatDetails(ctx, 99, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = svc.GetChatMembers(ctx, 99, 10)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, _, err = svc.GetMessages(ctx, 99, 10, 0, 50, false)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.ErrorIs(t, svc.AddMember(ctx, 99, 20), domain.ErrNotFound)
+
+	_, err = svc.EditMessage(ctx, 1, 99, 10, "edited")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = svc.PinMessage(ctx, 1, 99, 10, false)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func (r *fakeChatRepo) AddDeviceToken(ctx context.Context, token *domain.DeviceToken) (bool, error) {
+	for i, t := range r.devices {
+		if t.UserID == token.UserID && t.Token == token.Token {
+			r.devices[i].Platform = token.Platform
+			return false, nil
+		}
+	}
+	r.devices = append(r.devices, *token)
+	return true, nil
+}
+
+func TestRegisterDevice_Idempotent(t *testing.T) {
+	repo := newFakeChatRepo()
+	svc := newTestService(repo)
+	ctx := context.Background()
+
+	created, err := svc.RegisterDevice(ctx, 10, "tok", "android")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = svc.RegisterDevice(ctx, 10, "tok", "ios")
+	require.NoError(t, err)
+	assert.False(t, created, "re-registering a known token")
+	assert.Equal(t, []domain.DeviceToken{{UserID: 10, Token: "tok", Platform: "ios"}}, repo.devices)
+
+	created, err = svc.RegisterDevice(ctx, 20, "tok", "ios")
+	require.NoError(t, err)
+	assert.True(t, created, "the same token for another user is a new registration")
+}
@@ -0,0 +1,180 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+)
+
+// S3 multipart limits. Every part but the last must be at least MinPartSize.
+const (
+	MinPartSize = 5 << 20 // 5 MiB
+	MaxPartSize = 5 << 30 // 5 GiB
+	MaxParts    = 10000
+)
+
+// MultipartUpload is a started multipart upload. The client uploads PartCount
+// parts of PartSize bytes (the last may be smaller), numbered from 1.
+type MultipartUpload struct {
+	UploadID  string
+	ObjectKey string
+	PartSize  int64
+	PartCount int
+}
+
+// PartURL is a presigned PUT for one part
+type PartURL struct {
+	Number    int32
+	URL       string
+	Method    string
+	Headers   map[string]string
+	ExpiresAt time.Time
+}
+
+// InitiateMultipartUpload starts a resumable upload of a size-byte file for
+// userID, keyed and authorized like GetUploadURL
+func (s *Service) InitiateMultipartUpload(ctx context.Context, userID, chatID int64, filename, contentType string, size int64) (*MultipartUpload, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("size must be positive: %w", domain.ErrInvalidInput)
+	}
+	if s.cfg.MaxUploadSize > 0 && size > s.cfg.MaxUploadSize {
+		return nil, fmt.Errorf("file exceeds the %d byte upload limit: %w", s.cfg.MaxUploadSize, domain.ErrInvalidInput)
+	}
+
+	objectName, err := s.newObjectName(ctx, userID, chatID, filename, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID, err := s.repo.InitiateMultipartUpload(ctx, objectName, contentType)
+	if err != nil {
+		return nil, err
+	}
+	s.recordContentType(ctx, objectName, contentType)
+
+	partSize := partSizeFor(size)
+	return &MultipartUpload{
+		UploadID:  uploadID,
+		ObjectKey: objectName,
+		PartSize:  partSize,
+		PartCount: int((size + partSize - 1) / partSize),
+	}, nil
+}
+
+// PresignUploadParts presigns the given part numbers of userID's upload.
+// Requesting a part again lets the client retry just that part.
+func (s *Service) PresignUploadParts(ctx context.Context, userID int64, objectKey, uploadID string, partNumbers []int32) ([]PartURL, error) {
+	if !ownsObject(userID, objectKey) {
+		return nil, fmt.Errorf("upload %s: %w", uploadID, domain.ErrNotFound)
+	}
+
+	expiresAt := time.Now().Add(s.cfg.URLExpiry)
+	urls := make([]PartURL, 0, len(partNumbers))
+	for _, n := range partNumbers {
+		if n < 1 || n > MaxParts {
+			return nil, fmt.Errorf("part number %d out of range 1-%d: %w", n, MaxParts, domain.ErrInvalidInput)
+		}
+		req, err := s.repo.PresignUploadPart(ctx, objectKey, uploadID, n, s.cfg.URLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, PartURL{Number: n, URL: req.URL, Method: req.Method, Headers: req.Headers, ExpiresAt: expiresAt})
+	}
+	return urls, nil
+}
+
+// CompleteMultipartUpload assembles userID's upload from parts after checking
+// them against what storage actually received. An upload that breaks the size
+// limits is aborted so its parts don't linger in the bucket.
+func (s *Service) CompleteMultipartUpload(ctx context.Context, userID int64, objectKey, uploadID string, parts []domain.UploadPart) error {
+	if !ownsObject(userID, objectKey) {
+		return fmt.Errorf("upload %s: %w", uploadID, domain.ErrNotFound)
+	}
+
+	stored, err := s.repo.ListUploadedParts(ctx, objectKey, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := validateParts(parts, stored, s.cfg.MaxUploadSize); err != nil {
+		if errors.Is(err, errUploadTooLarge) || errors.Is(err, errPartTooSmall) {
+			_ = s.repo.AbortMultipartUpload(ctx, objectKey, uploadID)
+		}
+		return fmt.Errorf("%w: %w", err, domain.ErrInvalidInput)
+	}
+
+	return s.repo.CompleteMultipartUpload(ctx, objectKey, uploadID, parts)
+}
+
+// AbortMultipartUpload discards userID's upload and its stored parts
+func (s *Service) AbortMultipartUpload(ctx context.Context, userID int64, objectKey, uploadID string) error {
+	if !ownsObject(userID, objectKey) {
+		return fmt.Errorf("upload %s: %w", uploadID, domain.ErrNotFound)
+	}
+	return s.repo.AbortMultipartUpload(ctx, objectKey, uploadID)
+}
+
+// Part validation failures. Size violations abort the upload; the others can
+// be fixed by uploading the missing parts and completing again.
+var (
+	errNoParts        = errors.New("no parts to complete")
+	errPartSequence   = errors.New("parts must be numbered 1, 2, 3, ... without gaps")
+	errPartMissing    = errors.New("part has not been uploaded")
+	errPartTooSmall   = errors.New("every part but the last must be at least 5 MiB")
+	errUploadTooLarge = errors.New("upload exceeds the size limit")
+)
+
+// validateParts checks the parts a client wants to complete against the parts
+// stored for the upload: consecutive numbers from 1, matching ETags, the S3
+// minimum part size, and maxSize (0 for no limit) for the total
+func validateParts(parts, stored []domain.UploadPart, maxSize int64) error {
+	if len(parts) == 0 {
+		return errNoParts
+	}
+
+	byNumber := make(map[int32]domain.UploadPart, len(stored))
+	for _, p := range stored {
+		byNumber[p.Number] = p
+	}
+
+	var total int64
+	for i, p := range parts {
+		if p.Number != int32(i+1) {
+			return errPartSequence
+		}
+		got, ok := byNumber[p.Number]
+		if !ok || strings.Trim(got.ETag, `"`) != strings.Trim(p.ETag, `"`) {
+			return fmt.Errorf("part %d: %w", p.Number, errPartMissing)
+		}
+		if got.Size < MinPartSize && i < len(parts)-1 {
+			return errPartTooSmall
+		}
+		total += got.Size
+	}
+	if maxSize > 0 && total > maxSize {
+		return errUploadTooLarge
+	}
+	return nil
+}
+
+// partSizeFor picks the smallest part size that fits size into MaxParts parts
+func partSizeFor(size int64) int64 {
+	partSize := int64(MinPartSize)
+	if need := (size + MaxParts - 1) / MaxParts; need > partSize {
+		partSize = need
+	}
+	return min(partSize, MaxPartSize)
+}
+
+// ownsObject reports whether objectKey was issued to userID by newObjectName
+func ownsObject(userID int64, objectKey string) bool {
+	if strings.HasPrefix(objectKey, fmt.Sprintf("users/%d/", userID)) {
+		return true
+	}
+	// uploads/{chatID}/{userID}/{file}
+	parts := strings.Split(objectKey, "/")
+	return len(parts) == 4 && parts[0] == "uploads" && parts[2] == fmt.Sprint(userID)
+}
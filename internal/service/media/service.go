@@ -3,34 +3,283 @@ package media
 import (
 	"context"
 	"fmt"
+	"mime"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
 	"github.com/google/uuid"
 )
 
+// cleanupBatchSize bounds how many queued objects one cleanup pass handles
+const cleanupBatchSize = 100
+
+// contentTypeTTL is how long the content type of a presigned upload is kept for
+// checking the media metadata of the message that attaches it
+const contentTypeTTL = 24 * time.Hour
+
+// Config tunes upload URLs and media cleanup
+type Config struct {
+	// URLExpiry is the lifetime of presigned upload URLs
+	URLExpiry time.Duration
+	// DownloadURLExpiry is the lifetime of presigned download URLs
+	DownloadURLExpiry time.Duration
+	// CleanupGrace delays deleting media of deleted messages, giving forwards time to be recorded
+	CleanupGrace time.Duration
+	// UploadsPerMinute caps presigned upload URLs per user; 0 disables the limit
+	UploadsPerMinute int
+	// MaxUploadSize caps the total size of a multipart upload in bytes; 0 disables the limit
+	MaxUploadSize int64
+	// MaxFileSize caps single-request uploads in bytes; 0 disables the limit
+	MaxFileSize int64
+	// AllowedContentTypes lists the content types that may be uploaded. An entry
+	// like "image/*" allows every subtype; an empty list allows any type.
+	AllowedContentTypes []string
+	// PublicURL is the browser-facing URL of the bucket (endpoint/bucket) that
+	// download URLs are built from
+	PublicURL string
+}
+
 type Service struct {
-	repo domain.MediaRepository
+	repo      domain.MediaRepository
+	chatRepo  domain.ChatRepository
+	cacheRepo domain.CacheRepository
+	cfg       Config
 }
 
-func NewService(repo domain.MediaRepository) *Service {
-	return &Service{repo: repo}
+func NewService(repo domain.MediaRepository, chatRepo domain.ChatRepository, cacheRepo domain.CacheRepository, cfg Config) *Service {
+	return &Service{
+		repo:      repo,
+		chatRepo:  chatRepo,
+		cacheRepo: cacheRepo,
+		cfg:       cfg,
+	}
+}
+
+// UploadURL describes how a client must upload an object directly to storage
+type UploadURL struct {
+	URL       string
+	ObjectKey string
+	Method    string
+	Headers   map[string]string
+	ExpiresAt time.Time
+	// DownloadURL is where the object can be read once uploaded; it is the
+	// value to send as a message's media URL
+	DownloadURL string
 }
 
-func (s *Service) GetUploadURL(ctx context.Context, userID int64, filename string, contentType string) (string, string, error) {
-	// Generate unique object name: uploads/{userID}/{uuid}{ext}
-	ext := filepath.Ext(filename)
-	if ext == "" {
-		return "", "", fmt.Errorf("filename must have an extension")
+// GetUploadURL presigns an upload of a size-byte file for userID. Chat attachments
+// (chatID != 0) are keyed as uploads/{chatID}/{userID}/{uuid}{ext} and require
+// membership; user-scoped files such as avatars (chatID == 0) go under
+// users/{userID}/{uuid}{ext}.
+func (s *Service) GetUploadURL(ctx context.Context, userID, chatID int64, filename string, contentType string, size int64) (*UploadURL, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("size must be positive: %w", domain.ErrInvalidInput)
+	}
+	if s.cfg.MaxFileSize > 0 && size > s.cfg.MaxFileSize {
+		return nil, fmt.Errorf("file exceeds the %d byte upload limit: %w", s.cfg.MaxFileSize, domain.ErrInvalidInput)
 	}
 
-	objectName := fmt.Sprintf("uploads/%d/%s%s", userID, uuid.New().String(), ext)
+	objectName, err := s.newObjectName(ctx, userID, chatID, filename, contentType)
+	if err != nil {
+		return nil, err
+	}
 
-	// Generate presigned URL (valid for 15 minutes)
-	url, err := s.repo.GeneratePresignedURL(ctx, objectName, contentType, 900)
+	req, err := s.repo.GeneratePresignedURL(ctx, objectName, contentType, size, s.cfg.URLExpiry)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	s.recordContentType(ctx, objectName, contentType)
+
+	return &UploadURL{
+		URL:         req.URL,
+		ObjectKey:   objectName,
+		Method:      req.Method,
+		Headers:     req.Headers,
+		ExpiresAt:   time.Now().Add(s.cfg.URLExpiry),
+		DownloadURL: s.downloadURL(objectName),
+	}, nil
+}
+
+// downloadURL is the canonical public URL of objectName
+func (s *Service) downloadURL(objectName string) string {
+	if s.cfg.PublicURL == "" {
+		return objectName
 	}
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + objectName
+}
 
-	return url, objectName, nil
+// recordContentType remembers the content type an upload was presigned with.
+// Without the record the sender's media metadata is accepted as is, so a cache
+// failure doesn't fail the upload.
+func (s *Service) recordContentType(ctx context.Context, objectName, contentType string) {
+	if err := s.cacheRepo.SetUploadContentType(ctx, objectName, contentType, contentTypeTTL); err != nil {
+		telemetry.Logger(ctx).Warn().Err(err).Str("object_key", objectName).Msg("failed to record upload content type")
+	}
+}
+
+// DownloadURL is a presigned GET of a private object
+type DownloadURL struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// GetDownloadURL presigns a download of objectKey for userID. Users may read
+// their own uploads and the media of messages in chats they belong to, matched
+// by the key validated when the message was sent; any other object is reported
+// as not found so its existence isn't revealed.
+func (s *Service) GetDownloadURL(ctx context.Context, userID int64, objectKey string) (*DownloadURL, error) {
+	if objectKey == "" || strings.Contains(objectKey, "..") {
+		return nil, fmt.Errorf("invalid object key: %w", domain.ErrInvalidInput)
+	}
+
+	if !ownsObject(userID, objectKey) {
+		if !strings.HasPrefix(objectKey, "uploads/") {
+			return nil, fmt.Errorf("object %s: %w", objectKey, domain.ErrNotFound)
+		}
+		ok, err := s.chatRepo.CanAccessMedia(ctx, userID, objectKey)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("object %s: %w", objectKey, domain.ErrNotFound)
+		}
+	}
+
+	req, err := s.repo.GeneratePresignedGetURL(ctx, objectKey, s.cfg.DownloadURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &DownloadURL{
+		URL:       req.URL,
+		ExpiresAt: time.Now().Add(s.cfg.DownloadURLExpiry),
+	}, nil
+}
+
+// newObjectName checks the content type against the allowlist, applies the
+// upload rate limit and chat membership check, then returns a fresh object key
+// for filename as described on GetUploadURL
+func (s *Service) newObjectName(ctx context.Context, userID, chatID int64, filename, contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %w", contentType, domain.ErrInvalidInput)
+	}
+	if !contentTypeAllowed(s.cfg.AllowedContentTypes, mediaType) {
+		return "", fmt.Errorf("content type %q is not allowed: %w", mediaType, domain.ErrInvalidInput)
+	}
+	ext, err := uploadExtension(filename, mediaType)
+	if err != nil {
+		return "", err
+	}
+
+	if s.cfg.UploadsPerMinute > 0 {
+		allowed, retryAfter, err := s.cacheRepo.TakeToken(ctx, fmt.Sprintf("upload:%d", userID), s.cfg.UploadsPerMinute, time.Minute)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			return "", &domain.RateLimitError{RetryAfter: retryAfter}
+		}
+	}
+
+	if chatID == 0 {
+		return fmt.Sprintf("users/%d/%s%s", userID, uuid.New().String(), ext), nil
+	}
+
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !isMember {
+		return "", fmt.Errorf("user is not a member of this chat: %w", domain.ErrPermissionDenied)
+	}
+	return fmt.Sprintf("uploads/%d/%d/%s%s", chatID, userID, uuid.New().String(), ext), nil
+}
+
+// contentTypeAllowed reports whether mediaType (lower case, without parameters)
+// matches an entry of allowed
+func contentTypeAllowed(allowed []string, mediaType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if a == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// extPattern matches the extensions kept from client filenames
+var extPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// uploadExtension returns the extension for an object key. The filename's own is
+// used when it is short and alphanumeric, otherwise one registered for mediaType.
+func uploadExtension(filename, mediaType string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if extPattern.MatchString(ext) {
+		return ext, nil
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0], nil
+	}
+	return "", fmt.Errorf("filename must have an extension: %w", domain.ErrInvalidInput)
+}
+
+// RunCleanup deletes queued media objects every interval until ctx is cancelled
+func (s *Service) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.CleanupDeleted(ctx); err != nil {
+				telemetry.Logger(ctx).Error().Err(err).Msg("media cleanup failed")
+			}
+		}
+	}
+}
+
+// CleanupDeleted removes the objects of messages deleted more than the grace period
+// ago. An object is kept while any remaining message still references it.
+func (s *Service) CleanupDeleted(ctx context.Context) error {
+	keys, err := s.cacheRepo.ClaimMediaCleanups(ctx, time.Now().Add(-s.cfg.CleanupGrace), cleanupBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		// Only chat attachments are cleaned up; entries queued as URLs by older
+		// versions are skipped rather than parsed
+		if !strings.HasPrefix(key, "uploads/") {
+			telemetry.Logger(ctx).Warn().Str("object_key", key).Msg("skipping cleanup of media outside the uploads prefix")
+			continue
+		}
+		refs, err := s.chatRepo.CountMessagesWithMedia(ctx, key)
+		if err != nil {
+			// Requeue so the object is retried on the next pass
+			_ = s.cacheRepo.ScheduleMediaCleanup(ctx, key, time.Now().Add(-s.cfg.CleanupGrace))
+			telemetry.Logger(ctx).Error().Err(err).Str("object_key", key).Msg("failed to count media references")
+			continue
+		}
+		if refs > 0 {
+			continue
+		}
+
+		if err := s.repo.DeleteObject(ctx, key); err != nil {
+			telemetry.Logger(ctx).Error().Err(err).Str("object_key", key).Msg("failed to delete media object")
+		}
+	}
+	return nil
 }
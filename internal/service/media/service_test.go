@@ -0,0 +1,175 @@
+package media
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cleanupCache hands out a fixed cleanup queue
+type cleanupCache struct {
+	domain.CacheRepository
+	queued []string
+}
+
+func (c *cleanupCache) ClaimMediaCleanups(ctx context.Context, deletedBefore time.Time, limit int64) ([]string, error) {
+	claimed := c.queued
+	c.queued = nil
+	return claimed, nil
+}
+
+// refRepo counts media references per object key
+type refRepo struct {
+	domain.ChatRepository
+	refs map[string]int64
+}
+
+func (r refRepo) CountMessagesWithMedia(ctx context.Context, objectKey string) (int64, error) {
+	return r.refs[objectKey], nil
+}
+
+// deleteRepo records deleted objects
+type deleteRepo struct {
+	domain.MediaRepository
+	deleted []string
+}
+
+func (r *deleteRepo) DeleteObject(ctx context.Context, objectName string) error {
+	r.deleted = append(r.deleted, objectName)
+	return nil
+}
+
+func TestCleanupDeleted(t *testing.T) {
+	cache := &cleanupCache{queued: []string{
+		"uploads/7/3/gone.png",
+		"uploads/7/3/forwarded.png",
+		"http://localhost:9000/chat-media/uploads/7/4/legacy.png", // queued as a URL by an older version
+		"users/3/avatar.png",
+	}}
+	media := &deleteRepo{}
+	s := NewService(media, refRepo{refs: map[string]int64{"uploads/7/3/forwarded.png": 1}}, cache, Config{})
+
+	require.NoError(t, s.CleanupDeleted(context.Background()))
+	assert.Equal(t, []string{"uploads/7/3/gone.png"}, media.deleted)
+}
+
+func TestValidateParts(t *testing.T) {
+	stored := []domain.UploadPart{
+		{Number: 1, ETag: `"a"`, Size: MinPartSize},
+		{Number: 2, ETag: `"b"`, Size: MinPartSize},
+		{Number: 3, ETag: `"c"`, Size: 100},
+	}
+	all := []domain.UploadPart{{Number: 1, ETag: "a"}, {Number: 2, ETag: "b"}, {Number: 3, ETag: "c"}}
+
+	assert.NoError(t, validateParts(all, stored, 0))
+	assert.ErrorIs(t, validateParts(nil, stored, 0), errNoParts)
+	assert.ErrorIs(t, validateParts(all[1:], stored, 0), errPartSequence)
+	assert.ErrorIs(t, validateParts([]domain.UploadPart{{Number: 1, ETag: "x"}}, stored, 0), errPartMissing)
+	assert.ErrorIs(t, validateParts(all, stored, 2*MinPartSize), errUploadTooLarge)
+
+	small := []domain.UploadPart{{Number: 1, ETag: `"a"`, Size: 100}, {Number: 2, ETag: `"b"`, Size: 100}}
+	assert.ErrorIs(t, validateParts(all[:2], small, 0), errPartTooSmall)
+}
+
+func TestPartSizeFor(t *testing.T) {
+	assert.Equal(t, int64(MinPartSize), partSizeFor(1))
+	assert.Equal(t, int64(MinPartSize), partSizeFor(MinPartSize*MaxParts))
+	assert.Equal(t, int64(MinPartSize+1), partSizeFor(MinPartSize*MaxParts+1))
+}
+
+func TestOwnsObject(t *testing.T) {
+	assert.True(t, ownsObject(3, "users/3/abc.png"))
+	assert.True(t, ownsObject(3, "uploads/7/3/abc.mp4"))
+	assert.False(t, ownsObject(3, "uploads/7/4/abc.mp4"))
+	assert.False(t, ownsObject(3, "users/30/abc.png"))
+	assert.False(t, ownsObject(3, "uploads/7/3/../4/abc.mp4"))
+}
+
+func TestDownloadURL(t *testing.T) {
+	s := &Service{cfg: Config{PublicURL: "http://localhost:9000/chat-media/"}}
+	assert.Equal(t, "http://localhost:9000/chat-media/uploads/7/3/abc.png", s.downloadURL("uploads/7/3/abc.png"))
+
+	bare := &Service{}
+	assert.Equal(t, "uploads/7/3/abc.png", bare.downloadURL("uploads/7/3/abc.png"))
+}
+
+// accessRepo grants media access per object key
+type accessRepo struct {
+	domain.ChatRepository
+	visible map[string]bool
+}
+
+func (r accessRepo) CanAccessMedia(ctx context.Context, userID int64, objectKey string) (bool, error) {
+	return r.visible[objectKey], nil
+}
+
+// presignRepo signs every object by echoing its key
+type presignRepo struct {
+	domain.MediaRepository
+}
+
+func (presignRepo) GeneratePresignedGetURL(ctx context.Context, objectName string, expiry time.Duration) (*domain.PresignedRequest, error) {
+	return &domain.PresignedRequest{URL: "signed/" + objectName, Method: "GET"}, nil
+}
+
+func TestGetDownloadURL(t *testing.T) {
+	chats := accessRepo{visible: map[string]bool{"uploads/7/4/shared.png": true}}
+	s := NewService(presignRepo{}, chats, nil, Config{DownloadURLExpiry: time.Hour})
+	ctx := context.Background()
+
+	own, err := s.GetDownloadURL(ctx, 3, "uploads/7/3/mine.png")
+	require.NoError(t, err)
+	assert.Equal(t, "signed/uploads/7/3/mine.png", own.URL)
+
+	shared, err := s.GetDownloadURL(ctx, 3, "uploads/7/4/shared.png")
+	require.NoError(t, err)
+	assert.Equal(t, "signed/uploads/7/4/shared.png", shared.URL)
+
+	_, err = s.GetDownloadURL(ctx, 3, "uploads/7/4/private.png")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = s.GetDownloadURL(ctx, 3, "users/4/avatar.png")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = s.GetDownloadURL(ctx, 3, "users/3/../4/avatar.png")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestContentTypeAllowed(t *testing.T) {
+	allowed := []string{"image/*", "video/mp4", " Application/PDF "}
+
+	assert.True(t, contentTypeAllowed(allowed, "image/png"))
+	assert.True(t, contentTypeAllowed(allowed, "video/mp4"))
+	assert.True(t, contentTypeAllowed(allowed, "application/pdf"))
+	assert.False(t, contentTypeAllowed(allowed, "video/webm"))
+	assert.False(t, contentTypeAllowed(allowed, "application/x-msdownload"))
+	assert.False(t, contentTypeAllowed(allowed, "imagex/png"))
+	assert.True(t, contentTypeAllowed(nil, "application/x-msdownload"), "an empty list allows any type")
+}
+
+func TestUploadExtension(t *testing.T) {
+	ext, err := uploadExtension("Holiday.JPG", "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, ".jpg", ext)
+
+	ext, err = uploadExtension("report.pdf%00.exe/..", "application/pdf")
+	require.NoError(t, err)
+	assert.Equal(t, ".pdf", ext, "unsafe extensions fall back to the content type's")
+
+	_, err = uploadExtension("noext", "application/x-unknown-type")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestGetUploadURL_Validation(t *testing.T) {
+	s := NewService(presignRepo{}, accessRepo{}, nil, Config{MaxFileSize: 1024, AllowedContentTypes: []string{"image/*"}})
+	ctx := context.Background()
+
+	_, err := s.GetUploadURL(ctx, 3, 0, "a.png", "image/png", 2048)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "too large")
+	_, err = s.GetUploadURL(ctx, 3, 0, "a.exe", "application/x-msdownload", 10)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput, "disallowed type")
+	_, err = s.GetUploadURL(ctx, 3, 0, "a.png", "not a type", 10)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
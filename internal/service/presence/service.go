@@ -4,17 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
 	"github.com/rs/zerolog/log"
 )
 
-// ReadReceiptBatch represents a batch of read receipts
+// ReadReceiptBatch represents a batch of read receipts. Status is
+// domain.ReceiptStatusRead or, for delivered receipts, ReceiptStatusDelivered.
 type ReadReceiptBatch struct {
 	ChatID int64
 	UserID int64
 	MsgID  int64
+	Status int16
 }
 
 // Service handles presence and read receipt processing
@@ -75,6 +78,16 @@ func (s *Service) RunReadReceiptWorker(ctx context.Context, workerID int, consum
 
 // ProcessReadReceipt handles a single read receipt message
 func (s *Service) ProcessReadReceipt(ctx context.Context, payload []byte) error {
+	return s.enqueueReceipt(ctx, payload, domain.ReceiptStatusRead)
+}
+
+// ProcessDeliveredReceipt handles a client's report that a message reached
+// one of its devices. It shares the read receipt batches.
+func (s *Service) ProcessDeliveredReceipt(ctx context.Context, payload []byte) error {
+	return s.enqueueReceipt(ctx, payload, domain.ReceiptStatusDelivered)
+}
+
+func (s *Service) enqueueReceipt(ctx context.Context, payload []byte, status int16) error {
 	var data struct {
 		ChatID int64 `json:"chatId"`
 		UserID int64 `json:"userId"`
@@ -82,7 +95,7 @@ func (s *Service) ProcessReadReceipt(ctx context.Context, payload []byte) error
 	}
 
 	if err := json.Unmarshal(payload, &data); err != nil {
-		return fmt.Errorf("failed to parse read receipt: %w", err)
+		return fmt.Errorf("failed to parse receipt: %w", err)
 	}
 
 	// Add to batch channel
@@ -91,6 +104,7 @@ func (s *Service) ProcessReadReceipt(ctx context.Context, payload []byte) error
 		ChatID: data.ChatID,
 		UserID: data.UserID,
 		MsgID:  data.MsgID,
+		Status: status,
 	}:
 		return nil
 	case <-ctx.Done():
@@ -133,7 +147,17 @@ func (s *Service) processBatch(ctx context.Context, receipts []ReadReceiptBatch)
 	logger := log.With().Int("batch_size", len(receipts)).Logger()
 	start := time.Now()
 
-	for _, receipt := range receipts {
+	authorized := s.authorizedReceipts(ctx, receipts)
+	if rejected := len(receipts) - len(authorized); rejected > 0 {
+		logger.Warn().Int("rejected", rejected).Msg("dropped read receipts for foreign chats or messages")
+	}
+
+	for _, receipt := range authorized {
+		if receipt.Status == domain.ReceiptStatusDelivered {
+			s.processDelivered(ctx, receipt)
+			continue
+		}
+
 		// Update receipt status
 		r := &domain.Receipt{
 			MsgID:  receipt.MsgID,
@@ -149,6 +173,7 @@ func (s *Service) processBatch(ctx context.Context, receipts []ReadReceiptBatch)
 		if err := s.chatRepo.UpdateLastReadMessage(ctx, receipt.ChatID, receipt.UserID, receipt.MsgID); err != nil {
 			logger.Warn().Err(err).Msg("failed to update last read message")
 		}
+		_ = s.cacheRepo.InvalidateUnreadSummaries(ctx, []int64{receipt.UserID})
 
 		// Broadcast
 		payload, _ := json.Marshal(map[string]any{
@@ -177,6 +202,74 @@ func (s *Service) processBatch(ctx context.Context, receipts []ReadReceiptBatch)
 	logger.Info().Dur("duration_ms", time.Since(start)).Msg("batch processed")
 }
 
+// processDelivered records a delivered receipt and tells the chat, so the
+// sender's devices can show the message as delivered
+func (s *Service) processDelivered(ctx context.Context, receipt ReadReceiptBatch) {
+	if err := s.chatRepo.MarkDelivered(ctx, receipt.ChatID, receipt.UserID, receipt.MsgID); err != nil {
+		log.Warn().Err(err).Int64("msg_id", receipt.MsgID).Msg("failed to mark message delivered")
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]any{
+		"type":   "DeliveryReceipt",
+		"chatId": receipt.ChatID,
+		"userId": receipt.UserID,
+		"msgId":  receipt.MsgID,
+	})
+	if err := s.broker.PublishToDeliveryExchange(ctx, receipt.ChatID, payload); err != nil {
+		log.Warn().Err(err).Msg("failed to broadcast delivered receipt")
+	}
+}
+
+// authorizedReceipts keeps the receipts whose user is a member of the chat and
+// whose message belongs to that chat. Receipts originate from clients, so
+// neither is trusted. Lookups are shared across the batch.
+func (s *Service) authorizedReceipts(ctx context.Context, receipts []ReadReceiptBatch) []ReadReceiptBatch {
+	msgIDs := make([]int64, len(receipts))
+	for i, receipt := range receipts {
+		msgIDs[i] = receipt.MsgID
+	}
+	msgs, err := s.chatRepo.GetMessagesByIDs(ctx, msgIDs)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load messages for read receipts")
+		return nil
+	}
+	msgChat := make(map[int64]int64, len(msgs))
+	for _, m := range msgs {
+		msgChat[m.ID] = m.ChatID
+	}
+
+	members := make(map[int64][]int64) // chatID -> cached member IDs
+	authorized := make([]ReadReceiptBatch, 0, len(receipts))
+	for _, receipt := range receipts {
+		if chatID, ok := msgChat[receipt.MsgID]; !ok || chatID != receipt.ChatID {
+			continue
+		}
+		if !s.isMember(ctx, members, receipt.ChatID, receipt.UserID) {
+			continue
+		}
+		authorized = append(authorized, receipt)
+	}
+	return authorized
+}
+
+// isMember checks membership against the Redis group set, loaded once per chat
+// into members, and falls back to the database when the set misses the user
+func (s *Service) isMember(ctx context.Context, members map[int64][]int64, chatID, userID int64) bool {
+	ids, ok := members[chatID]
+	if !ok {
+		ids, _ = s.cacheRepo.GetGroupMembers(ctx, chatID)
+		members[chatID] = ids
+	}
+	if slices.Contains(ids, userID) {
+		return true
+	}
+
+	// The cached set may be missing or stale; the database is authoritative
+	isMember, err := s.chatRepo.IsMember(ctx, chatID, userID)
+	return err == nil && isMember
+}
+
 // UpdatePresence updates user presence
 func (s *Service) UpdatePresence(ctx context.Context, userID int64, online bool) error {
 	ttl := 60 * time.Second
@@ -0,0 +1,104 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChatRepo knows a fixed set of messages and chat members
+type fakeChatRepo struct {
+	domain.ChatRepository
+	messages map[int64]int64          // msgID -> chatID
+	members  map[int64]map[int64]bool // chatID -> userIDs
+
+	delivered []ReadReceiptBatch
+}
+
+func (r *fakeChatRepo) GetMessagesByIDs(ctx context.Context, ids []int64) ([]domain.Message, error) {
+	var msgs []domain.Message
+	for _, id := range ids {
+		if chatID, ok := r.messages[id]; ok {
+			msgs = append(msgs, domain.Message{ID: id, ChatID: chatID})
+		}
+	}
+	return msgs, nil
+}
+
+func (r *fakeChatRepo) IsMember(ctx context.Context, chatID, userID int64) (bool, error) {
+	return r.members[chatID][userID], nil
+}
+
+func (r *fakeChatRepo) MarkDelivered(ctx context.Context, chatID, userID, msgID int64) error {
+	r.delivered = append(r.delivered, ReadReceiptBatch{ChatID: chatID, UserID: userID, MsgID: msgID, Status: domain.ReceiptStatusDelivered})
+	return nil
+}
+
+// fakeBroker records what is published to chats
+type fakeBroker struct {
+	domain.MessageBroker
+	published [][]byte
+}
+
+func (b *fakeBroker) PublishToDeliveryExchange(ctx context.Context, chatID int64, payload []byte) error {
+	b.published = append(b.published, payload)
+	return nil
+}
+
+// emptyCache has no cached group members, so every check hits the repository
+type emptyCache struct {
+	domain.CacheRepository
+}
+
+func (emptyCache) GetGroupMembers(ctx context.Context, chatID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (emptyCache) InvalidateUnreadSummaries(ctx context.Context, userIDs []int64) error {
+	return nil
+}
+
+func TestAuthorizedReceipts(t *testing.T) {
+	repo := &fakeChatRepo{
+		messages: map[int64]int64{100: 1, 200: 2},
+		members:  map[int64]map[int64]bool{1: {10: true}, 2: {20: true}},
+	}
+	svc := NewService(repo, emptyCache{}, nil)
+
+	got := svc.authorizedReceipts(context.Background(), []ReadReceiptBatch{
+		{ChatID: 1, UserID: 10, MsgID: 100}, // ok
+		{ChatID: 1, UserID: 20, MsgID: 100}, // not a member
+		{ChatID: 1, UserID: 10, MsgID: 200}, // message from another chat
+		{ChatID: 1, UserID: 10, MsgID: 999}, // unknown message
+		{ChatID: 2, UserID: 20, MsgID: 200}, // ok
+	})
+
+	assert.Equal(t, []ReadReceiptBatch{
+		{ChatID: 1, UserID: 10, MsgID: 100},
+		{ChatID: 2, UserID: 20, MsgID: 200},
+	}, got)
+}
+
+func TestProcessBatch_Delivered(t *testing.T) {
+	repo := &fakeChatRepo{
+		messages: map[int64]int64{100: 1},
+		members:  map[int64]map[int64]bool{1: {10: true}},
+	}
+	broker := &fakeBroker{}
+	svc := NewService(repo, emptyCache{}, broker)
+	ctx := context.Background()
+
+	require.NoError(t, svc.ProcessDeliveredReceipt(ctx, []byte(`{"chatId":1,"userId":10,"msgId":100}`)))
+	svc.processBatch(ctx, []ReadReceiptBatch{<-svc.batch})
+
+	assert.Equal(t, []ReadReceiptBatch{{ChatID: 1, UserID: 10, MsgID: 100, Status: domain.ReceiptStatusDelivered}}, repo.delivered)
+	require.Len(t, broker.published, 1)
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(broker.published[0], &event))
+	assert.Equal(t, "DeliveryReceipt", event["type"])
+	assert.Equal(t, float64(100), event["msgId"])
+}
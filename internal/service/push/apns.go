@@ -0,0 +1,173 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	apnsEndpoint        = "https://api.push.apple.com"
+	apnsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+
+	// Apple rejects provider tokens older than an hour and refreshes more
+	// often than every 20 minutes
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+// APNSConfig holds the token-based credentials of an APNS client
+type APNSConfig struct {
+	KeyPath string // .p8 signing key from the Apple developer account
+	KeyID   string
+	TeamID  string
+	Topic   string // app bundle ID
+	Sandbox bool   // use the development environment
+}
+
+// APNSClient sends pushes to iOS devices through the APNS HTTP/2 API
+type APNSClient struct {
+	keyID      string
+	teamID     string
+	topic      string
+	key        *ecdsa.PrivateKey
+	endpoint   string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	jwtToken string
+	issuedAt time.Time
+}
+
+// NewAPNSClient loads the p8 signing key described by cfg
+func NewAPNSClient(cfg APNSConfig) (*APNSClient, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, errors.New("APNS requires a key ID, team ID and topic")
+	}
+
+	data, err := os.ReadFile(cfg.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read APNS key: %w", err)
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse APNS key: %w", err)
+	}
+
+	endpoint := apnsEndpoint
+	if cfg.Sandbox {
+		endpoint = apnsSandboxEndpoint
+	}
+
+	return &APNSClient{
+		keyID:      cfg.KeyID,
+		teamID:     cfg.TeamID,
+		topic:      cfg.Topic,
+		key:        key,
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: 10 * time.Second}, // the default transport negotiates HTTP/2
+	}, nil
+}
+
+type apnsAps struct {
+	Alert apnsAlert `json:"alert"`
+	Badge int       `json:"badge"`
+	Sound string    `json:"sound,omitempty"`
+}
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body"`
+}
+
+// Send delivers n to a single iOS token. It returns ErrTokenUnregistered when
+// APNS rejects the token as bad or unregistered.
+func (c *APNSClient) Send(ctx context.Context, token string, n Notification) error {
+	authToken, err := c.token()
+	if err != nil {
+		return err
+	}
+
+	// Custom data keys sit next to aps at the top level of the payload
+	payload := map[string]any{
+		"aps": apnsAps{
+			Alert: apnsAlert{Title: n.Title, Body: n.Body},
+			Badge: n.Badge,
+			Sound: "default",
+		},
+	}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+authToken)
+	req.Header.Set("apns-topic", c.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("apns send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(raw, &apnsErr)
+
+	switch apnsErr.Reason {
+	case "BadDeviceToken", "Unregistered":
+		return ErrTokenUnregistered
+	}
+	return fmt.Errorf("apns send: status %d: %s", resp.StatusCode, apnsErr.Reason)
+}
+
+// token returns the cached provider token, signing a new one when it nears
+// Apple's one hour limit
+func (c *APNSClient) token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.jwtToken != "" && now.Sub(c.issuedAt) < apnsTokenLifetime {
+		return c.jwtToken, nil
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": c.teamID,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = c.keyID
+	signed, err := t.SignedString(c.key)
+	if err != nil {
+		return "", fmt.Errorf("sign APNS token: %w", err)
+	}
+
+	c.jwtToken = signed
+	c.issuedAt = now
+	return signed, nil
+}
@@ -0,0 +1,37 @@
+package push
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrTokenUnregistered reports that the provider no longer knows a device
+// token, typically because the app was uninstalled
+var ErrTokenUnregistered = errors.New("device token unregistered")
+
+// Notification is the content of a push, independent of the provider
+type Notification struct {
+	Title string
+	Body  string
+	Badge int // recipient's unread count; only APNS shows it
+	Data  map[string]string
+}
+
+// Sender delivers a notification to a single device token
+type Sender interface {
+	Send(ctx context.Context, token string, n Notification) error
+}
+
+// logSender stands in for a provider when none is configured
+type logSender struct{}
+
+func (logSender) Send(_ context.Context, token string, n Notification) error {
+	log.Info().
+		Str("token", token).
+		Str("title", n.Title).
+		Str("body", n.Body).
+		Msg("Sending push notification")
+	return nil
+}
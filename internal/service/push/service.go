@@ -3,22 +3,52 @@ package push
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
 )
 
+var pushSends = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "push_sends_total",
+	Help: "Push notifications handed to a provider by platform and result",
+}, []string{"platform", "result"})
+
 // Service handles push notifications
 type Service struct {
 	chatRepo  domain.ChatRepository
+	blockRepo domain.BlockRepository
 	cacheRepo domain.CacheRepository
+	senders   map[string]Sender // provider per device platform
 }
 
-// NewService creates a new push service
-func NewService(chatRepo domain.ChatRepository, cacheRepo domain.CacheRepository) *Service {
+// NewService creates a new push service. Android and web tokens go through
+// fcm and iOS tokens through apns; a nil provider only logs the pushes it
+// would send.
+func NewService(chatRepo domain.ChatRepository, blockRepo domain.BlockRepository, cacheRepo domain.CacheRepository, fcm, apns Sender) *Service {
+	if fcm == nil {
+		fcm = logSender{}
+	}
+	if apns == nil {
+		apns = logSender{}
+	}
 	return &Service{
 		chatRepo:  chatRepo,
+		blockRepo: blockRepo,
 		cacheRepo: cacheRepo,
+		senders: map[string]Sender{
+			"android": fcm,
+			"web":     fcm,
+			"ios":     apns,
+		},
 	}
 }
 
@@ -29,6 +59,11 @@ func (s *Service) ProcessPushNotification(ctx context.Context, payload []byte) e
 		return err
 	}
 
+	// System messages (joins, renames, ...) are informational and never pushed
+	if kind, _ := msg["kind"].(string); kind == string(domain.MessageKindSystem) {
+		return nil
+	}
+
 	chatID, _ := msg["chatId"].(float64)
 	senderID, _ := msg["userId"].(float64)
 	body, _ := msg["body"].(string)
@@ -41,6 +76,14 @@ func (s *Service) ProcessPushNotification(ctx context.Context, payload []byte) e
 
 	log.Info().Int64("chat_id", int64(chatID)).Msg("Processing message for push")
 
+	notification := s.buildNotification(ctx, int64(chatID), int64(senderID), members, body)
+
+	// Members who blocked the sender don't hear from them
+	blockers, err := s.blockRepo.GetBlockerIDs(ctx, int64(senderID))
+	if err != nil {
+		return err
+	}
+
 	for _, member := range members {
 		memberID := member.UserID
 		// Skip sender
@@ -48,6 +91,17 @@ func (s *Service) ProcessPushNotification(ctx context.Context, payload []byte) e
 			continue
 		}
 
+		if member.IsMuted(time.Now()) || slices.Contains(blockers, memberID) {
+			continue
+		}
+		if !shouldNotify(member, body) {
+			continue
+		}
+		if inQuietHours(member, body, time.Now()) {
+			log.Debug().Int64("user_id", memberID).Msg("Push suppressed by quiet hours")
+			continue
+		}
+
 		// Check presence
 		online, _, err := s.cacheRepo.GetPresence(ctx, memberID)
 		if err != nil {
@@ -66,17 +120,148 @@ func (s *Service) ProcessPushNotification(ctx context.Context, payload []byte) e
 			}
 
 			log.Info().Int64("user_id", memberID).Int("token_count", len(tokens)).Msg("Found device tokens")
+			if len(tokens) == 0 {
+				continue
+			}
 
-			for _, token := range tokens {
-				// In a real implementation, we would call APNS/FCM here
-				log.Info().
-					Int64("user_id", memberID).
-					Str("token", token).
-					Str("body", body).
-					Msg("Sending push notification")
+			n := notification
+			unread, err := s.chatRepo.CountUnreadMessages(ctx, memberID)
+			if err != nil {
+				log.Error().Err(err).Int64("user_id", memberID).Msg("failed to count unread messages")
 			}
+			n.Badge = int(unread)
+
+			s.sendToDevices(ctx, memberID, tokens, n)
 		}
 	}
 
 	return nil
 }
+
+// buildNotification titles a push with the chat title, or the sender's name
+// in a direct chat, and prefixes group message bodies with the sender's name
+func (s *Service) buildNotification(ctx context.Context, chatID, senderID int64, members []domain.ChatMember, body string) Notification {
+	sender := "Someone"
+	for _, m := range members {
+		if m.UserID == senderID && m.User != nil {
+			sender = displayName(m.User)
+			break
+		}
+	}
+
+	n := Notification{
+		Title: sender,
+		Body:  body,
+		Data:  map[string]string{"chatId": strconv.FormatInt(chatID, 10)},
+	}
+
+	chat, err := s.chatRepo.GetChat(ctx, chatID)
+	if err != nil {
+		log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to load chat for push")
+		return n
+	}
+	if chat.Type == domain.ChatTypeGroup {
+		n.Title = chat.Title
+		n.Body = sender + ": " + body
+	}
+	return n
+}
+
+// sendToDevices groups a user's tokens by platform and hands each group to
+// that platform's provider. Tokens the provider reports as unregistered are
+// deleted so we stop pushing to them.
+func (s *Service) sendToDevices(ctx context.Context, userID int64, tokens []domain.DeviceToken, n Notification) {
+	byPlatform := make(map[string][]string)
+	for _, t := range tokens {
+		byPlatform[t.Platform] = append(byPlatform[t.Platform], t.Token)
+	}
+
+	for platform, platformTokens := range byPlatform {
+		sender, ok := s.senders[platform]
+		if !ok {
+			log.Debug().Int64("user_id", userID).Str("platform", platform).Msg("No push provider for platform")
+			continue
+		}
+
+		for _, token := range platformTokens {
+			err := sender.Send(ctx, token, n)
+			if err == nil {
+				pushSends.WithLabelValues(platform, "success").Inc()
+				continue
+			}
+			pushSends.WithLabelValues(platform, "failure").Inc()
+
+			if errors.Is(err, ErrTokenUnregistered) {
+				log.Info().Int64("user_id", userID).Str("platform", platform).Msg("Removing unregistered device token")
+				if err := s.chatRepo.RemoveDeviceToken(ctx, token); err != nil {
+					log.Error().Err(err).Int64("user_id", userID).Msg("failed to remove device token")
+				}
+				continue
+			}
+			log.Error().Err(err).Int64("user_id", userID).Str("platform", platform).Msg("failed to send push notification")
+		}
+	}
+}
+
+// displayName is the name a push shows for user
+func displayName(user *domain.User) string {
+	switch {
+	case user.IsDeactivated():
+		return domain.DeletedAccountName
+	case user.Username != "":
+		return user.Username
+	default:
+		return user.Email
+	}
+}
+
+// shouldNotify applies the member's notification level to a message body
+func shouldNotify(member domain.ChatMember, body string) bool {
+	switch member.NotificationLevel {
+	case domain.NotificationNone:
+		return false
+	case domain.NotificationMentionsOnly:
+		return member.User != nil && isMentioned(body, member.User.Username)
+	default:
+		return true
+	}
+}
+
+// inQuietHours reports whether the member's do-not-disturb window suppresses a
+// push for body at now. Mentions get through if the member allows them.
+func inQuietHours(member domain.ChatMember, body string, now time.Time) bool {
+	if member.User == nil || !member.User.InQuietHours(now) {
+		return false
+	}
+	return !member.User.DNDAllowMentions || !isMentioned(body, member.User.Username)
+}
+
+// isMentioned reports whether body contains an @username mention for username
+func isMentioned(body, username string) bool {
+	if username == "" {
+		return false
+	}
+
+	lowerBody := strings.ToLower(body)
+	mention := "@" + strings.ToLower(username)
+	for i := 0; ; {
+		idx := strings.Index(lowerBody[i:], mention)
+		if idx < 0 {
+			return false
+		}
+		start := i + idx
+		end := start + len(mention)
+		// The mention must sit between word boundaries so @bob matches neither
+		// @bobby nor foo@bob
+		before, _ := utf8.DecodeLastRuneInString(lowerBody[:start])
+		after, _ := utf8.DecodeRuneInString(lowerBody[end:])
+		if (start == 0 || !isUsernameRune(before)) && (end == len(lowerBody) || !isUsernameRune(after)) {
+			return true
+		}
+		i = end
+	}
+}
+
+func isUsernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
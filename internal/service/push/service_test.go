@@ -0,0 +1,206 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInQuietHours(t *testing.T) {
+	user := &domain.User{Username: "bob", Timezone: "Europe/Berlin", DNDStart: "22:00", DNDEnd: "07:00", DNDAllowMentions: true}
+	member := domain.ChatMember{UserID: 1, User: user}
+
+	// 21:30 UTC is 23:30 in Berlin during summer time, inside the window that wraps midnight
+	night := time.Date(2024, 7, 1, 21, 30, 0, 0, time.UTC)
+	day := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, inQuietHours(member, "hello", night))
+	assert.False(t, inQuietHours(member, "hey @bob", night), "mentions bypass when allowed")
+	assert.False(t, inQuietHours(member, "hello", day))
+
+	user.DNDAllowMentions = false
+	assert.True(t, inQuietHours(member, "hey @bob", night))
+
+	user.DNDStart, user.DNDEnd = "", ""
+	assert.False(t, inQuietHours(member, "hello", night))
+}
+
+func TestIsMentioned(t *testing.T) {
+	for _, tc := range []struct {
+		body string
+		want bool
+	}{
+		{"@bob", true},
+		{"hey @bob!", true},
+		{"hey @BOB, look", true},
+		{"(@bob)", true},
+		{"@bobby", false},
+		{"foo@bob", false},
+		{"mail bob@bob.com", false},
+		{"é@bob", false},
+		{"@bob_", false},
+		{"foo@bob then @bob", true},
+		{"bob", false},
+	} {
+		assert.Equal(t, tc.want, isMentioned(tc.body, "bob"), tc.body)
+	}
+	assert.False(t, isMentioned("@", ""), "no username, no mention")
+}
+
+func TestProcessPushNotification_SkipsSystemMessages(t *testing.T) {
+	// A nil repository would panic if the message went any further
+	svc := NewService(nil, nil, nil, nil, nil)
+	assert.NoError(t, svc.ProcessPushNotification(context.Background(), []byte(`{"chatId":1,"userId":10,"body":"Alice joined","kind":"system"}`)))
+}
+
+func TestValidateQuietHours(t *testing.T) {
+	valid := &domain.User{Timezone: "America/New_York", DNDStart: "23:00", DNDEnd: "06:30"}
+	assert.NoError(t, valid.ValidateQuietHours())
+
+	for _, u := range []*domain.User{
+		{Timezone: "Mars/Olympus"},
+		{DNDStart: "22:00"},
+		{DNDStart: "25:00", DNDEnd: "07:00"},
+	} {
+		assert.ErrorIs(t, u.ValidateQuietHours(), domain.ErrInvalidInput)
+	}
+}
+
+type tokenRepo struct {
+	domain.ChatRepository
+	removed []string
+}
+
+func (r *tokenRepo) RemoveDeviceToken(_ context.Context, token string) error {
+	r.removed = append(r.removed, token)
+	return nil
+}
+
+type fakeSender struct {
+	sent []string
+	gone map[string]bool
+}
+
+func (f *fakeSender) Send(_ context.Context, token string, _ Notification) error {
+	if f.gone[token] {
+		return ErrTokenUnregistered
+	}
+	f.sent = append(f.sent, token)
+	return nil
+}
+
+func TestSendToDevices_RoutesByPlatformAndPrunesUnregistered(t *testing.T) {
+	repo := &tokenRepo{}
+	fcm := &fakeSender{gone: map[string]bool{"stale": true}}
+	apns := &fakeSender{}
+	svc := NewService(repo, nil, nil, fcm, apns)
+
+	svc.sendToDevices(context.Background(), 1, []domain.DeviceToken{
+		{Token: "phone", Platform: "android"},
+		{Token: "browser", Platform: "web"},
+		{Token: "iphone", Platform: "ios"},
+		{Token: "stale", Platform: "android"},
+	}, Notification{Body: "hi"})
+
+	assert.ElementsMatch(t, []string{"phone", "browser"}, fcm.sent)
+	assert.Equal(t, []string{"iphone"}, apns.sent)
+	assert.Equal(t, []string{"stale"}, repo.removed)
+}
+
+func TestFCMClient_Send(t *testing.T) {
+	var got fcmRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+		w.Write([]byte(`{"access_token":"abc","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/projects/proj/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		if got.Message.Token == "stale" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	creds, _ := json.Marshal(map[string]string{
+		"project_id":   "proj",
+		"client_email": "push@proj.iam.gserviceaccount.com",
+		"private_key":  string(pemKey),
+		"token_uri":    server.URL + "/token",
+	})
+	path := filepath.Join(t.TempDir(), "fcm.json")
+	require.NoError(t, os.WriteFile(path, creds, 0o600))
+
+	client, err := NewFCMClient(path)
+	require.NoError(t, err)
+	client.endpoint = server.URL
+
+	n := Notification{Title: "Team", Body: "alice: hi", Data: map[string]string{"chatId": "7"}}
+	require.NoError(t, client.Send(context.Background(), "phone", n))
+	assert.Equal(t, "phone", got.Message.Token)
+	assert.Equal(t, "Team", got.Message.Notification.Title)
+	assert.Equal(t, "7", got.Message.Data["chatId"])
+
+	assert.ErrorIs(t, client.Send(context.Background(), "stale", n), ErrTokenUnregistered)
+}
+
+func TestAPNSClient_Send(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "com.example.chat", r.Header.Get("apns-topic"))
+		assert.Contains(t, r.Header.Get("Authorization"), "bearer ")
+		switch r.URL.Path {
+		case "/3/device/iphone":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		case "/3/device/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		default:
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		}
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "AuthKey.p8")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	client, err := NewAPNSClient(APNSConfig{KeyPath: path, KeyID: "KEY", TeamID: "TEAM", Topic: "com.example.chat"})
+	require.NoError(t, err)
+	client.endpoint = server.URL
+
+	n := Notification{Title: "Team", Body: "alice: hi", Badge: 3, Data: map[string]string{"chatId": "7"}}
+	require.NoError(t, client.Send(context.Background(), "iphone", n))
+	aps := got["aps"].(map[string]any)
+	assert.Equal(t, float64(3), aps["badge"])
+	assert.Equal(t, "Team", aps["alert"].(map[string]any)["title"])
+	assert.Equal(t, "7", got["chatId"])
+
+	assert.ErrorIs(t, client.Send(context.Background(), "bad", n), ErrTokenUnregistered)
+	assert.ErrorIs(t, client.Send(context.Background(), "gone", n), ErrTokenUnregistered)
+}
@@ -0,0 +1,212 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/ambarg/mini-telegram/internal/telemetry"
+	"gorm.io/gorm"
+)
+
+// Service handles user account logic
+type Service struct {
+	userRepo  domain.UserRepository
+	chatRepo  domain.ChatRepository
+	blockRepo domain.BlockRepository
+	cacheRepo domain.CacheRepository
+}
+
+func NewService(userRepo domain.UserRepository, chatRepo domain.ChatRepository, blockRepo domain.BlockRepository, cacheRepo domain.CacheRepository) *Service {
+	return &Service{
+		userRepo:  userRepo,
+		chatRepo:  chatRepo,
+		blockRepo: blockRepo,
+		cacheRepo: cacheRepo,
+	}
+}
+
+// GetPublicProfile returns userID's profile as requesterID may see it.
+// Deactivated accounts are anonymized, and a user who blocked requesterID
+// appears not to exist.
+func (s *Service) GetPublicProfile(ctx context.Context, requesterID, userID int64) (*domain.PublicProfile, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %d: %w", userID, domain.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blocked, err := s.blockRepo.IsBlocked(ctx, userID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, fmt.Errorf("user %d: %w", userID, domain.ErrNotFound)
+	}
+
+	if user.IsDeactivated() {
+		user = user.Anonymized()
+	}
+	profile := user.PublicProfile()
+	return &profile, nil
+}
+
+// User search paging
+const (
+	MinSearchQueryLength = 3 // shorter queries find nothing, so prefixes can't be enumerated cheaply
+	DefaultSearchLimit   = 20
+	MaxSearchLimit       = 50
+)
+
+// SearchUsers returns a page of users whose username starts with query, for
+// requesterID. afterID is the last ID of the previous page (0 for the first);
+// hasMore reports whether another page follows. Only public profile fields are
+// returned, and users blocked either way are left out.
+func (s *Service) SearchUsers(ctx context.Context, requesterID int64, query string, limit int, afterID int64) (profiles []domain.PublicProfile, hasMore bool, err error) {
+	if afterID < 0 {
+		return nil, false, fmt.Errorf("afterId must not be negative: %w", domain.ErrInvalidInput)
+	}
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < MinSearchQueryLength {
+		return []domain.PublicProfile{}, false, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	// One extra row tells whether there is a next page
+	users, err := s.userRepo.SearchUsers(ctx, requesterID, query, limit+1, afterID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(users) > limit {
+		users, hasMore = users[:limit], true
+	}
+
+	profiles = make([]domain.PublicProfile, len(users))
+	for i := range users {
+		profiles[i] = users[i].PublicProfile()
+	}
+	return profiles, hasMore, nil
+}
+
+// MaxPresenceBatch caps the number of users in one batch presence lookup
+const MaxPresenceBatch = 100
+
+// GetPresence returns a user's presence as requesterID sees it, hiding
+// last-seen if they opted out
+func (s *Service) GetPresence(ctx context.Context, requesterID, userID int64) (domain.Presence, error) {
+	presences, err := s.GetPresences(ctx, requesterID, []int64{userID})
+	if err != nil {
+		return domain.Presence{}, err
+	}
+	p, ok := presences[userID]
+	if !ok {
+		return domain.Presence{}, domain.ErrNotFound
+	}
+	return p, nil
+}
+
+// GetPresences returns presence for up to MaxPresenceBatch users in one round trip.
+// Unknown user IDs are omitted from the result, and users who blocked
+// requesterID always appear offline.
+func (s *Service) GetPresences(ctx context.Context, requesterID int64, userIDs []int64) (map[int64]domain.Presence, error) {
+	if len(userIDs) > MaxPresenceBatch {
+		return nil, fmt.Errorf("at most %d user IDs per request: %w", MaxPresenceBatch, domain.ErrInvalidInput)
+	}
+
+	blockers, err := s.blockRepo.GetBlockerIDs(ctx, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.userRepo.GetByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	presences, err := s.cacheRepo.GetPresences(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		p := presences[u.ID]
+		// Without a Redis entry, fall back to when the user last went offline
+		if !p.Online && p.LastSeen == 0 && u.LastSeenAt != nil {
+			p.LastSeen = u.LastSeenAt.Unix()
+		}
+		if u.IsDeactivated() || slices.Contains(blockers, u.ID) {
+			p = domain.Presence{}
+		} else if !u.ShowLastSeen {
+			p.LastSeen = 0
+		}
+		presences[u.ID] = p
+	}
+	return presences, nil
+}
+
+// DeactivateAccount soft-deletes a user. The row is kept so messages and
+// memberships stay valid, but the user's tokens are revoked and pushes stop.
+func (s *Service) DeactivateAccount(ctx context.Context, userID int64) error {
+	now := time.Now().UTC()
+	if err := s.userRepo.SetDeactivatedAt(ctx, userID, &now); err != nil {
+		return fmt.Errorf("failed to deactivate user: %w", err)
+	}
+
+	// Sign the account out everywhere; logging in again issues fresh tokens
+	version, err := s.userRepo.IncrTokenVersion(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	if err := s.cacheRepo.SetTokenVersion(ctx, userID, version, domain.TokenVersionCacheTTL); err != nil {
+		return err
+	}
+
+	if err := s.chatRepo.RemoveUserDeviceTokens(ctx, userID); err != nil {
+		telemetry.Logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("failed to remove device tokens")
+	}
+
+	if err := s.cacheRepo.SetPresence(ctx, userID, false, 0); err != nil {
+		telemetry.Logger(ctx).Error().Err(err).Int64("user_id", userID).Msg("failed to set presence offline")
+	}
+
+	return nil
+}
+
+// BlockUser stops blockedID from messaging blockerID directly or seeing their presence
+func (s *Service) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	if blockerID == blockedID {
+		return fmt.Errorf("users cannot block themselves: %w", domain.ErrInvalidInput)
+	}
+	if _, err := s.userRepo.GetByID(ctx, blockedID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("user %d not found: %w", blockedID, domain.ErrNotFound)
+		}
+		return err
+	}
+	return s.blockRepo.Block(ctx, blockerID, blockedID)
+}
+
+// UnblockUser lifts a block; unblocking a user who isn't blocked is a no-op
+func (s *Service) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	return s.blockRepo.Unblock(ctx, blockerID, blockedID)
+}
+
+// ListBlocks returns the users blockerID has blocked
+func (s *Service) ListBlocks(ctx context.Context, blockerID int64) ([]domain.Block, error) {
+	return s.blockRepo.ListBlocks(ctx, blockerID)
+}
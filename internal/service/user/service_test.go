@@ -0,0 +1,233 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ambarg/mini-telegram/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeUserRepo searches a fixed list of users, in ID order
+type fakeUserRepo struct {
+	domain.UserRepository
+	users []domain.User
+
+	searchLimit int
+}
+
+func (r *fakeUserRepo) SearchUsers(ctx context.Context, requesterID int64, query string, limit int, afterID int64) ([]domain.User, error) {
+	r.searchLimit = limit
+	var found []domain.User
+	for _, u := range r.users {
+		if u.ID > afterID && u.ID != requesterID && strings.HasPrefix(u.Username, query) && len(found) < limit {
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+func TestSearchUsers(t *testing.T) {
+	repo := &fakeUserRepo{}
+	for id := int64(1); id <= 5; id++ {
+		repo.users = append(repo.users, domain.User{ID: id, Username: fmt.Sprintf("alice%d", id), Email: "a@example.com", PasswordHash: "x"})
+	}
+	svc := NewService(repo, nil, nil, nil)
+	ctx := context.Background()
+
+	profiles, hasMore, err := svc.SearchUsers(ctx, 1, "al", 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, profiles, "queries below the minimum length find nothing")
+	assert.False(t, hasMore)
+
+	profiles, hasMore, err = svc.SearchUsers(ctx, 1, " ali ", 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.PublicProfile{{ID: 2, Username: "alice2"}, {ID: 3, Username: "alice3"}}, profiles)
+	assert.True(t, hasMore)
+
+	profiles, hasMore, err = svc.SearchUsers(ctx, 1, "ali", 2, 3)
+	require.NoError(t, err)
+	assert.Len(t, profiles, 2)
+	assert.False(t, hasMore, "the last page has no more")
+
+	_, _, err = svc.SearchUsers(ctx, 1, "ali", 1000, 0)
+	require.NoError(t, err)
+	assert.Equal(t, MaxSearchLimit+1, repo.searchLimit, "the limit is clamped")
+
+	_, _, err = svc.SearchUsers(ctx, 1, "ali", 0, -1)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	for i := range r.users {
+		if r.users[i].ID == id {
+			u := r.users[i]
+			return &u, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// fakeBlockRepo holds blocks as blockerID -> blocked IDs
+type fakeBlockRepo struct {
+	domain.BlockRepository
+	blocks map[int64][]int64
+}
+
+func (r *fakeBlockRepo) IsBlocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	return slices.Contains(r.blocks[blockerID], blockedID), nil
+}
+
+func TestGetPublicProfile(t *testing.T) {
+	deactivatedAt := time.Now()
+	repo := &fakeUserRepo{users: []domain.User{
+		{ID: 1, Username: "alice", Email: "alice@example.com", Bio: "hi", PasswordHash: "x"},
+		{ID: 2, Username: "bob", Email: "bob@example.com"},
+		{ID: 3, Username: "carol", Bio: "gone", DeactivatedAt: &deactivatedAt},
+	}}
+	blocks := &fakeBlockRepo{blocks: map[int64][]int64{2: {1}}}
+	svc := NewService(repo, nil, blocks, nil)
+	ctx := context.Background()
+
+	profile, err := svc.GetPublicProfile(ctx, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PublicProfile{ID: 1, Username: "alice", Bio: "hi"}, *profile)
+
+	_, err = svc.GetPublicProfile(ctx, 1, 2)
+	assert.ErrorIs(t, err, domain.ErrNotFound, "bob blocked alice")
+	_, err = svc.GetPublicProfile(ctx, 1, 99)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	profile, err = svc.GetPublicProfile(ctx, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PublicProfile{ID: 3, Username: domain.DeletedAccountName}, *profile)
+}
+
+func (r *fakeUserRepo) SetDeactivatedAt(ctx context.Context, id int64, at *time.Time) error {
+	for i := range r.users {
+		if r.users[i].ID == id {
+			r.users[i].DeactivatedAt = at
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) IncrTokenVersion(ctx context.Context, id int64) (int64, error) {
+	for i := range r.users {
+		if r.users[i].ID == id {
+			r.users[i].TokenVersion++
+			return r.users[i].TokenVersion, nil
+		}
+	}
+	return 0, gorm.ErrRecordNotFound
+}
+
+type fakeChatRepo struct {
+	domain.ChatRepository
+	tokensRemoved []int64
+}
+
+func (r *fakeChatRepo) RemoveUserDeviceTokens(ctx context.Context, userID int64) error {
+	r.tokensRemoved = append(r.tokensRemoved, userID)
+	return nil
+}
+
+// fakeCache records presence and token version writes
+type fakeCache struct {
+	domain.CacheRepository
+	online        map[int64]bool
+	tokenVersions map[int64]int64
+}
+
+func (c *fakeCache) SetPresence(ctx context.Context, userID int64, online bool, ttl time.Duration) error {
+	c.online[userID] = online
+	return nil
+}
+
+func (c *fakeCache) SetTokenVersion(ctx context.Context, userID, version int64, ttl time.Duration) error {
+	c.tokenVersions[userID] = max(c.tokenVersions[userID], version)
+	return nil
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	repo := &fakeUserRepo{users: []domain.User{{ID: 1, Username: "alice", TokenVersion: 4}}}
+	chats := &fakeChatRepo{}
+	cache := &fakeCache{online: map[int64]bool{1: true}, tokenVersions: map[int64]int64{1: 4}}
+	svc := NewService(repo, chats, nil, cache)
+
+	require.NoError(t, svc.DeactivateAccount(context.Background(), 1))
+
+	assert.True(t, repo.users[0].IsDeactivated())
+	assert.Equal(t, int64(5), repo.users[0].TokenVersion, "tokens issued before deactivation are revoked")
+	assert.Equal(t, int64(5), cache.tokenVersions[1], "the cached version is updated so the middleware sees the bump")
+	assert.Equal(t, []int64{1}, chats.tokensRemoved)
+	assert.False(t, cache.online[1])
+
+	assert.Error(t, svc.DeactivateAccount(context.Background(), 99))
+}
+
+func (r *fakeUserRepo) GetByIDs(ctx context.Context, ids []int64) ([]domain.User, error) {
+	var found []domain.User
+	for _, u := range r.users {
+		if slices.Contains(ids, u.ID) {
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeBlockRepo) GetBlockerIDs(ctx context.Context, blockedID int64) ([]int64, error) {
+	var blockers []int64
+	for blocker, blocked := range r.blocks {
+		if slices.Contains(blocked, blockedID) {
+			blockers = append(blockers, blocker)
+		}
+	}
+	return blockers, nil
+}
+
+func (c *fakeCache) GetPresences(ctx context.Context, userIDs []int64) (map[int64]domain.Presence, error) {
+	presences := make(map[int64]domain.Presence, len(userIDs))
+	for _, id := range userIDs {
+		if online, ok := c.online[id]; ok {
+			presences[id] = domain.Presence{Online: online, LastSeen: 1000}
+		}
+	}
+	return presences, nil
+}
+
+func TestGetPresences(t *testing.T) {
+	lastSeen := time.Unix(500, 0)
+	deactivatedAt := time.Now()
+	repo := &fakeUserRepo{users: []domain.User{
+		{ID: 2, ShowLastSeen: true},
+		{ID: 3, ShowLastSeen: true, LastSeenAt: &lastSeen},
+		{ID: 4, ShowLastSeen: false},
+		{ID: 5, ShowLastSeen: true},
+		{ID: 6, ShowLastSeen: true, DeactivatedAt: &deactivatedAt},
+	}}
+	blocks := &fakeBlockRepo{blocks: map[int64][]int64{5: {1}}}
+	cache := &fakeCache{online: map[int64]bool{2: true, 4: false, 5: true, 6: true}}
+	svc := NewService(repo, nil, blocks, cache)
+	ctx := context.Background()
+
+	presences, err := svc.GetPresences(ctx, 1, []int64{2, 3, 4, 5, 6, 99})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]domain.Presence{
+		2: {Online: true, LastSeen: 1000},
+		3: {LastSeen: 500}, // no cache entry, so the stored last seen is used
+		4: {},              // hides last seen
+		5: {},              // blocked the requester
+		6: {},              // deactivated
+	}, presences, "unknown IDs are omitted")
+
+	_, err = svc.GetPresences(ctx, 1, make([]int64, MaxPresenceBatch+1))
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
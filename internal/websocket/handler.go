@@ -3,8 +3,11 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,8 +25,21 @@ type Handler struct {
 	pingTimer *time.Timer
 	ctx       context.Context
 	cancel    context.CancelFunc
+
+	// Latency tracking, measured from transport ping/pong frames
+	pingSentAt  atomic.Int64 // unix nanos of the last ping written
+	lastRTT     atomic.Int64 // nanoseconds
+	lastAppPing time.Time    // guarded by mu, used to rate-limit application pings
+
+	// compressMin is the smallest frame compressed with permessage-deflate; -1 disables
+	compressMin int
+	// readLimit is the largest inbound message accepted, in bytes; 0 means unlimited
+	readLimit int64
 }
 
+// errMessageTooLarge is returned by readMessage when a message exceeds readLimit
+var errMessageTooLarge = errors.New("websocket message exceeds read limit")
+
 // NewHandler creates a new WebSocket handler
 func NewHandler(conn *websocket.Conn, userID int64, device string, logger zerolog.Logger) *Handler {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -36,11 +52,49 @@ func NewHandler(conn *websocket.Conn, userID int64, device string, logger zerolo
 			Int64("user_id", userID).
 			Str("device", device).
 			Logger(),
-		ctx:    ctx,
-		cancel: cancel,
+		ctx:         ctx,
+		cancel:      cancel,
+		compressMin: -1,
 	}
 }
 
+// SetCompressionThreshold compresses outgoing frames of at least minBytes when
+// permessage-deflate was negotiated; a negative value disables compression.
+// Must be called before WritePump starts.
+func (h *Handler) SetCompressionThreshold(minBytes int) {
+	h.compressMin = minBytes
+}
+
+// SetReadLimit caps the size of inbound messages. A client exceeding it is
+// disconnected with a policy-violation close frame. Must be called before ReadPump starts.
+func (h *Handler) SetReadLimit(maxBytes int64) {
+	h.readLimit = maxBytes
+}
+
+// readMessage reads the next message, buffering at most readLimit+1 bytes.
+// The limit is applied to the decompressed stream rather than via
+// conn.SetReadLimit, which only bounds wire bytes and always closes with
+// 1009 Message Too Big.
+func (h *Handler) readMessage() (int, []byte, error) {
+	messageType, r, err := h.conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	if h.readLimit <= 0 {
+		message, err := io.ReadAll(r)
+		return messageType, message, err
+	}
+
+	message, err := io.ReadAll(io.LimitReader(r, h.readLimit+1))
+	if err != nil {
+		return messageType, nil, err
+	}
+	if int64(len(message)) > h.readLimit {
+		return messageType, nil, errMessageTooLarge
+	}
+	return messageType, message, nil
+}
+
 // ReadPump reads messages from the WebSocket connection
 func (h *Handler) ReadPump(onMessage func([]byte) error) {
 	defer func() {
@@ -51,11 +105,22 @@ func (h *Handler) ReadPump(onMessage func([]byte) error) {
 	h.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	h.conn.SetPongHandler(func(string) error {
 		h.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		if sent := h.pingSentAt.Load(); sent != 0 {
+			rtt := time.Since(time.Unix(0, sent))
+			h.lastRTT.Store(int64(rtt))
+			rttHistogram.Observe(rtt.Seconds())
+		}
 		return nil
 	})
 
 	for {
-		messageType, message, err := h.conn.ReadMessage()
+		messageType, message, err := h.readMessage()
+		if errors.Is(err, errMessageTooLarge) {
+			h.logger.Warn().Int64("limit", h.readLimit).Msg("websocket message too large, closing connection")
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "message too large")
+			_ = h.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			break
+		}
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				h.logger.Error().Err(err).Msg("websocket read error")
@@ -89,6 +154,10 @@ func (h *Handler) WritePump(pingInterval time.Duration) {
 				return
 			}
 
+			// Small frames barely shrink and cost a deflate pass, so only compress large ones
+			if h.compressMin >= 0 {
+				h.conn.EnableWriteCompression(len(message) >= h.compressMin)
+			}
 			if err := h.conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
 				h.logger.Error().Err(err).Msg("failed to write message")
 				return
@@ -96,6 +165,7 @@ func (h *Handler) WritePump(pingInterval time.Duration) {
 
 		case <-ticker.C:
 			h.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			h.pingSentAt.Store(time.Now().UnixNano())
 			if err := h.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				h.logger.Error().Err(err).Msg("failed to write ping")
 				return
@@ -135,6 +205,17 @@ func (h *Handler) Close() error {
 	return h.conn.Close()
 }
 
+// ShutdownReason is the close frame reason sent to clients when the server drains connections
+const ShutdownReason = "ServerShutdown"
+
+// Shutdown asks the client to disconnect with a going-away close frame carrying
+// ShutdownReason. The connection stays up until the client answers, which ends
+// ReadPump, or it is closed.
+func (h *Handler) Shutdown() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, ShutdownReason)
+	return h.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
 // UserID returns the user ID
 func (h *Handler) UserID() int64 {
 	return h.userID
@@ -145,6 +226,25 @@ func (h *Handler) Device() string {
 	return h.device
 }
 
+// RTT returns the most recently measured transport round-trip time
+func (h *Handler) RTT() time.Duration {
+	return time.Duration(h.lastRTT.Load())
+}
+
+// AllowPing reports whether an application-level Ping may be answered,
+// allowing at most one per minInterval so clients can't use it to amplify load
+func (h *Handler) AllowPing(minInterval time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.lastAppPing) < minInterval {
+		return false
+	}
+	h.lastAppPing = now
+	return true
+}
+
 // Context returns the handler context
 func (h *Handler) Context() context.Context {
 	return h.ctx
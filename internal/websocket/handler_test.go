@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandler_ReadPump(t *testing.T) {
@@ -88,3 +90,289 @@ func TestHandler_Send(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Test", msg["type"])
 }
+
+func TestHandler_AllowPing(t *testing.T) {
+	handler := NewHandler(nil, 1, "test-device", zerolog.Nop())
+
+	assert.True(t, handler.AllowPing(time.Hour))
+	assert.False(t, handler.AllowPing(time.Hour), "second ping within interval should be dropped")
+	assert.True(t, handler.AllowPing(0))
+}
+
+func TestHandler_ReadLimit(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		handler := NewHandler(conn, 1, "test-device", zerolog.Nop())
+		handler.SetReadLimit(64)
+		go handler.WritePump(time.Second)
+		handler.ReadPump(func(msg []byte) error {
+			return handler.Send(msg)
+		})
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// A message at the limit is accepted
+	small := []byte(strings.Repeat("a", 64))
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, small))
+	_, received, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, small, received)
+
+	// One byte over closes the connection with a policy violation
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 65))))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "got %v", err)
+}
+
+func TestHandler_CompressionKeepsControlFrames(t *testing.T) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	done := make(chan *Handler, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		handler := NewHandler(conn, 1, "test-device", zerolog.Nop())
+		handler.SetCompressionThreshold(0)
+		go handler.WritePump(20 * time.Millisecond)
+		handler.ReadPump(func(msg []byte) error {
+			return handler.Send(msg)
+		})
+		done <- handler
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, resp, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Contains(t, resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// A compressed echo arrives intact
+	large := []byte(strings.Repeat(`{"type":"Message","body":"hello"}`, 100))
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, large))
+	_, received, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, large, received)
+
+	// Control frames are only handled while reading
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("no ping received with compression enabled")
+	}
+
+	// The pong was measured and a close frame still ends the read loop
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	select {
+	case handler := <-done:
+		assert.Greater(t, handler.RTT(), time.Duration(0))
+	case <-time.After(time.Second):
+		t.Fatal("server kept reading after the close frame")
+	}
+}
+
+func TestHub_Stats(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	hub.Register(NewHandler(nil, 1, "web", zerolog.Nop()))
+	hub.Register(NewHandler(nil, 1, "ios", zerolog.Nop()))
+	hub.Register(NewHandler(nil, 2, "web", zerolog.Nop()))
+	hub.Subscribe(1, 100)
+	hub.Subscribe(2, 100)
+	hub.Subscribe(1, 200)
+
+	stats := hub.Stats(1)
+	assert.Equal(t, 3, stats.Connections)
+	assert.Equal(t, 2, stats.Users)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, stats.UsersByDevices)
+	assert.Equal(t, 2, stats.SubscribedChats)
+	assert.Equal(t, 3, stats.Subscriptions)
+	assert.Equal(t, []ChatSubscribers{{ChatID: 100, Subscribers: 2}}, stats.BusiestChats)
+}
+
+func TestHub_DrainClosesRemainingConnections(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	registered := make(chan struct{})
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		handler := NewHandler(conn, 1, "test-device", zerolog.Nop())
+		hub.Register(handler)
+		close(registered)
+
+		go handler.WritePump(time.Second)
+		handler.ReadPump(func(msg []byte) error { return nil })
+		hub.Unregister(handler)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	<-registered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	hub.Drain(ctx)
+
+	assert.Equal(t, 0, hub.connectionCount())
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestHub_DrainSendsShutdownFrame(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	registered := make(chan struct{})
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		handler := NewHandler(conn, 1, "test-device", zerolog.Nop())
+		hub.Register(handler)
+		close(registered)
+
+		go handler.WritePump(time.Second)
+		handler.ReadPump(func(msg []byte) error { return nil })
+		hub.Unregister(handler)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	<-registered
+
+	// The client answers the close frame, so draining finishes well before the timeout
+	closeErr := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		closeErr <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	hub.Drain(ctx)
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 0, hub.connectionCount())
+	var ce *websocket.CloseError
+	if assert.ErrorAs(t, <-closeErr, &ce) {
+		assert.Equal(t, websocket.CloseGoingAway, ce.Code)
+		assert.Equal(t, ShutdownReason, ce.Text)
+	}
+}
+
+// connectedHandler returns a handler for the server side of a live connection
+func connectedHandler(t *testing.T, userID int64, device string) *Handler {
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return NewHandler(<-conns, userID, device, zerolog.Nop())
+}
+
+func TestHub_UnregisterDropsSubscriptions(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	web, ios := connectedHandler(t, 1, "web"), connectedHandler(t, 1, "ios")
+	hub.Register(web)
+	hub.Register(ios)
+	hub.Register(connectedHandler(t, 2, "web"))
+	hub.Subscribe(1, 100)
+	hub.Subscribe(2, 100)
+	hub.Subscribe(1, 200)
+
+	hub.Unregister(web)
+	assert.Equal(t, 3, hub.Stats(10).Subscriptions, "subscriptions stay while the user has a connection")
+
+	hub.Unregister(ios)
+	stats := hub.Stats(10)
+	assert.Equal(t, 1, stats.SubscribedChats)
+	assert.Equal(t, []ChatSubscribers{{ChatID: 100, Subscribers: 1}}, stats.BusiestChats)
+	assert.NotContains(t, hub.userChats, int64(1))
+
+	hub.Unsubscribe(2, 100)
+	assert.Zero(t, hub.Stats(10).SubscribedChats)
+}
+
+func TestHub_ReconnectSurvivesOldCleanup(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	old := connectedHandler(t, 1, "web")
+	hub.Register(old)
+	hub.Subscribe(1, 100)
+
+	// The same device reconnects before the old connection's cleanup runs
+	current := connectedHandler(t, 1, "web")
+	hub.Register(current)
+	hub.Unregister(old)
+
+	got, ok := hub.Get(1, "web")
+	require.True(t, ok)
+	assert.Same(t, current, got)
+	assert.Equal(t, 1, hub.Stats(10).Subscriptions)
+
+	hub.Unregister(current)
+	assert.Zero(t, hub.connectionCount())
+	assert.Zero(t, hub.Stats(10).Subscriptions)
+}
+
+func TestHub_SendToUserExcept(t *testing.T) {
+	hub := NewHub(zerolog.Nop())
+	hub.Register(connectedHandler(t, 1, "web"))
+	hub.Register(connectedHandler(t, 1, "ios"))
+
+	assert.Equal(t, 1, hub.SendToUserExcept(1, []byte(`{}`), "web"))
+	assert.Equal(t, 2, hub.SendToUserExcept(1, []byte(`{}`)))
+	assert.Zero(t, hub.SendToUserExcept(2, []byte(`{}`)))
+}
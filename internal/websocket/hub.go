@@ -1,7 +1,11 @@
 package websocket
 
 import (
+	"context"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -10,6 +14,7 @@ import (
 type Hub struct {
 	connections map[int64]map[string]*Handler // userID -> device -> handler
 	chatSubs    map[int64]map[int64]bool      // chatID -> userID -> true
+	userChats   map[int64]map[int64]bool      // userID -> chatID -> true, the inverse of chatSubs
 	mu          sync.RWMutex
 	logger      zerolog.Logger
 }
@@ -19,6 +24,7 @@ func NewHub(logger zerolog.Logger) *Hub {
 	return &Hub{
 		connections: make(map[int64]map[string]*Handler),
 		chatSubs:    make(map[int64]map[int64]bool),
+		userChats:   make(map[int64]map[int64]bool),
 		logger:      logger,
 	}
 }
@@ -36,11 +42,13 @@ func (h *Hub) Register(handler *Handler) {
 	}
 
 	// Close existing connection for same device
+	before := len(h.connections[userID])
 	if existing, ok := h.connections[userID][device]; ok {
 		existing.Close()
 	}
 
 	h.connections[userID][device] = handler
+	h.recordConnections(before, len(h.connections[userID]))
 	h.logger.Info().
 		Int64("user_id", userID).
 		Str("device", device).
@@ -48,27 +56,37 @@ func (h *Hub) Register(handler *Handler) {
 		Msg("connection registered")
 }
 
-// Unregister removes a connection from the hub
-func (h *Hub) Unregister(userID int64, device string) {
+// Unregister removes a connection from the hub. It does nothing if a newer
+// connection already replaced handler on its device, so a reconnect survives
+// the old connection's cleanup. A user's chat subscriptions go with their last
+// connection; the next connection subscribes again.
+func (h *Hub) Unregister(handler *Handler) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if devices, ok := h.connections[userID]; ok {
-		if handler, ok := devices[device]; ok {
-			handler.Close()
-			delete(devices, device)
-
-			if len(devices) == 0 {
-				delete(h.connections, userID)
-			}
+	userID := handler.UserID()
+	device := handler.Device()
 
-			h.logger.Info().
-				Int64("user_id", userID).
-				Str("device", device).
-				Int("total_connections", h.Count()).
-				Msg("connection unregistered")
+	devices, ok := h.connections[userID]
+	if !ok || devices[device] != handler {
+		return
+	}
+	handler.Close()
+	delete(devices, device)
+	h.recordConnections(len(devices)+1, len(devices))
+
+	if len(devices) == 0 {
+		delete(h.connections, userID)
+		for chatID := range h.userChats[userID] {
+			h.unsubscribe(userID, chatID)
 		}
 	}
+
+	h.logger.Info().
+		Int64("user_id", userID).
+		Str("device", device).
+		Int("total_connections", h.Count()).
+		Msg("connection unregistered")
 }
 
 // Get retrieves a handler for a user's device
@@ -129,6 +147,24 @@ func (h *Hub) SendToUser(userID int64, message []byte) int {
 	return sent
 }
 
+// SendToUserExcept sends a message to the devices of a user other than
+// excludeDevices, e.g. to skip the device an event originated from
+func (h *Hub) SendToUserExcept(userID int64, message []byte, excludeDevices ...string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sent := 0
+	for device, handler := range h.connections[userID] {
+		if slices.Contains(excludeDevices, device) {
+			continue
+		}
+		if err := handler.Send(message); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
 // Broadcast sends a message to multiple users
 func (h *Hub) Broadcast(userIDs []int64, message []byte) int {
 	sent := 0
@@ -158,16 +194,34 @@ func (h *Hub) Subscribe(userID, chatID int64) {
 	if h.chatSubs[chatID] == nil {
 		h.chatSubs[chatID] = make(map[int64]bool)
 	}
+	if h.userChats[userID] == nil {
+		h.userChats[userID] = make(map[int64]bool)
+	}
+	before := len(h.chatSubs[chatID])
 	h.chatSubs[chatID][userID] = true
+	h.userChats[userID][chatID] = true
+	h.recordSubscribers(before, len(h.chatSubs[chatID]))
 }
 
 // Unsubscribe removes a user from a chat subscription
 func (h *Hub) Unsubscribe(userID, chatID int64) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	h.unsubscribe(userID, chatID)
+}
 
+// unsubscribe removes userID from chatID's subscribers. Caller must hold h.mu.
+func (h *Hub) unsubscribe(userID, chatID int64) {
+	if chats, ok := h.userChats[userID]; ok {
+		delete(chats, chatID)
+		if len(chats) == 0 {
+			delete(h.userChats, userID)
+		}
+	}
 	if subs, ok := h.chatSubs[chatID]; ok {
+		before := len(subs)
 		delete(subs, userID)
+		h.recordSubscribers(before, len(subs))
 		if len(subs) == 0 {
 			delete(h.chatSubs, chatID)
 		}
@@ -176,6 +230,12 @@ func (h *Hub) Unsubscribe(userID, chatID int64) {
 
 // BroadcastToChat sends a message to all connected members of a chat
 func (h *Hub) BroadcastToChat(chatID int64, message []byte) int {
+	return h.BroadcastToChatExcept(chatID, message)
+}
+
+// BroadcastToChatExcept sends a message to all connected members of a chat
+// other than excludeUserIDs, e.g. to avoid echoing an event to its sender
+func (h *Hub) BroadcastToChatExcept(chatID int64, message []byte, excludeUserIDs ...int64) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -186,6 +246,9 @@ func (h *Hub) BroadcastToChat(chatID int64, message []byte) int {
 
 	sent := 0
 	for userID := range subs {
+		if slices.Contains(excludeUserIDs, userID) {
+			continue
+		}
 		// Send to all devices of this user
 		if devices, ok := h.connections[userID]; ok {
 			for _, handler := range devices {
@@ -197,3 +260,144 @@ func (h *Hub) BroadcastToChat(chatID int64, message []byte) int {
 	}
 	return sent
 }
+
+// recordConnections updates connection gauges after a user's device count
+// changed from before to after. Caller must hold h.mu.
+func (h *Hub) recordConnections(before, after int) {
+	if before == after {
+		return
+	}
+	connectionsGauge.Add(float64(after - before))
+	switch {
+	case before == 0:
+		connectedUsersGauge.Inc()
+	case after == 0:
+		connectedUsersGauge.Dec()
+	}
+	moveBucket(usersByDevicesGauge, devicesLabel, before, after)
+}
+
+// recordSubscribers updates subscription gauges after a chat's subscriber
+// count changed from before to after. Caller must hold h.mu.
+func (h *Hub) recordSubscribers(before, after int) {
+	if before == after {
+		return
+	}
+	chatSubscriptionsGauge.Add(float64(after - before))
+	switch {
+	case before == 0:
+		subscribedChatsGauge.Inc()
+	case after == 0:
+		subscribedChatsGauge.Dec()
+	}
+	moveBucket(chatsBySubscribersGauge, subscribersLabel, before, after)
+}
+
+// HubStats summarizes the hub's connections and subscriptions
+type HubStats struct {
+	Connections     int               `json:"connections"`
+	Users           int               `json:"users"`
+	UsersByDevices  map[string]int    `json:"usersByDevices"`
+	SubscribedChats int               `json:"subscribedChats"`
+	Subscriptions   int               `json:"subscriptions"`
+	BusiestChats    []ChatSubscribers `json:"busiestChats"`
+}
+
+// ChatSubscribers is a chat and how many users on this gateway subscribe to it
+type ChatSubscribers struct {
+	ChatID      int64 `json:"chatId"`
+	Subscribers int   `json:"subscribers"`
+}
+
+// Stats returns a snapshot of the hub, including the topChats chats with the most subscribers
+func (h *Hub) Stats(topChats int) HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := HubStats{
+		Users:           len(h.connections),
+		UsersByDevices:  make(map[string]int),
+		SubscribedChats: len(h.chatSubs),
+	}
+	for _, devices := range h.connections {
+		stats.Connections += len(devices)
+		stats.UsersByDevices[devicesLabel(len(devices))]++
+	}
+
+	chats := make([]ChatSubscribers, 0, len(h.chatSubs))
+	for chatID, subs := range h.chatSubs {
+		stats.Subscriptions += len(subs)
+		chats = append(chats, ChatSubscribers{ChatID: chatID, Subscribers: len(subs)})
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		if chats[i].Subscribers != chats[j].Subscribers {
+			return chats[i].Subscribers > chats[j].Subscribers
+		}
+		return chats[i].ChatID < chats[j].ChatID
+	})
+	if len(chats) > topChats {
+		chats = chats[:topChats]
+	}
+	stats.BusiestChats = chats
+	return stats
+}
+
+// drainPollInterval is how often Drain checks whether connections have closed
+const drainPollInterval = 100 * time.Millisecond
+
+// Drain sends every client a ServerShutdown close frame and waits until their
+// connections have been unregistered or ctx is done, then unregisters, and so
+// closes, the connections still open
+func (h *Hub) Drain(ctx context.Context) {
+	h.mu.RLock()
+	var handlers []*Handler
+	for _, devices := range h.connections {
+		for _, handler := range devices {
+			handlers = append(handlers, handler)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler.Shutdown(); err != nil {
+			h.logger.Debug().Err(err).Int64("user_id", handler.UserID()).Msg("failed to send shutdown frame")
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for h.connectionCount() > 0 {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connectionCount is Count for callers not holding the lock
+func (h *Hub) connectionCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.Count()
+}
+
+// closeAll unregisters every connection. The handlers' own cleanup then finds
+// them gone, so nothing is closed twice.
+func (h *Hub) closeAll() {
+	h.mu.RLock()
+	var handlers []*Handler
+	for _, devices := range h.connections {
+		for _, handler := range devices {
+			handlers = append(handlers, handler)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, handler := range handlers {
+		h.Unregister(handler)
+	}
+	h.logger.Info().Int("closed", len(handlers)).Msg("closed remaining connections")
+}
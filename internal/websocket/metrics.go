@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var rttHistogram = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "gateway_ws_rtt_seconds",
+	Help:    "Round-trip time of WebSocket transport pings",
+	Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+})
+
+var deliveryLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "gateway_delivery_duration_seconds",
+	Help:    "Time from a message being sent to its broadcast by this gateway",
+	Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+})
+
+// ObserveDeliveryLatency records the delivery latency of a message sent at sentAt
+func ObserveDeliveryLatency(sentAt time.Time) {
+	deliveryLatency.Observe(time.Since(sentAt).Seconds())
+}
+
+var (
+	connectionsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_ws_connections",
+		Help: "Open WebSocket connections on this gateway",
+	})
+	connectedUsersGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_ws_connected_users",
+		Help: "Users with at least one open WebSocket connection on this gateway",
+	})
+	usersByDevicesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_ws_users_by_devices",
+		Help: "Connected users grouped by how many devices they have connected",
+	}, []string{"devices"})
+	subscribedChatsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_ws_subscribed_chats",
+		Help: "Chats with at least one subscriber on this gateway",
+	})
+	chatSubscriptionsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_ws_chat_subscriptions",
+		Help: "User-to-chat subscriptions on this gateway",
+	})
+	chatsBySubscribersGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_ws_chats_by_subscribers",
+		Help: "Subscribed chats grouped by their number of subscribers on this gateway",
+	}, []string{"subscribers"})
+)
+
+// devicesLabel buckets a user's connection count for usersByDevicesGauge
+func devicesLabel(n int) string {
+	if n >= 4 {
+		return "4+"
+	}
+	return string(rune('0' + n))
+}
+
+// subscribersLabel buckets a chat's subscriber count for chatsBySubscribersGauge
+func subscribersLabel(n int) string {
+	switch {
+	case n <= 1:
+		return "1"
+	case n <= 10:
+		return "2-10"
+	case n <= 100:
+		return "11-100"
+	case n <= 1000:
+		return "101-1000"
+	default:
+		return "1000+"
+	}
+}
+
+// moveBucket shifts one item from the bucket for count from to the bucket for
+// count to, where a count of 0 means the item is not tracked
+func moveBucket(vec *prometheus.GaugeVec, label func(int) string, from, to int) {
+	if from > 0 {
+		vec.WithLabelValues(label(from)).Dec()
+	}
+	if to > 0 {
+		vec.WithLabelValues(label(to)).Inc()
+	}
+}
@@ -95,7 +95,7 @@ export const ProfileSettings = ({ isOpen, onClose }: ProfileSettingsProps) => {
         // Upload to MinIO
         setIsUploading(true);
         try {
-            const { uploadUrl, objectKey } = await chatApi.getPresignedUrl(file.name, file.type || 'image/jpeg');
+            const { uploadUrl, objectKey } = await chatApi.getPresignedUrl(file.name, file.type || 'image/jpeg', file.size);
             await chatApi.uploadFileToUrl(uploadUrl, file, file.type || 'image/jpeg');
             const publicUrl = `http://localhost:9000/chat-media/${objectKey}`;
             updateMutation.mutate({ avatar_url: publicUrl });
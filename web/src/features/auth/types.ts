@@ -2,12 +2,21 @@ export interface User {
     id: number;
     username?: string;
     email: string;
+    email_verified?: boolean;
     avatar_url?: string;
     bio?: string;
     created_at?: string;
 }
 
 
+// What search and other users' profiles expose; never the email
+export interface PublicProfile {
+    id: number;
+    username: string;
+    avatar_url?: string;
+    bio?: string;
+}
+
 export interface AuthResponse {
     accessToken: string;
     refreshToken: string;
@@ -1,16 +1,43 @@
 import { api } from '@/shared/api/client';
-import type { Chat, Message, CreateChatRequest, ChatMember } from './types';
-import type { User } from '@/features/auth/types';
+import type { Chat, ChatDetails, Message, CreateChatRequest, ChatMember } from './types';
+import type { PublicProfile } from '@/features/auth/types';
+
+export interface PresignedUpload {
+    uploadUrl: string;
+    objectKey: string;
+    method: string;
+    headers: Record<string, string>; // Must be sent exactly or the signature check fails
+    expiresAt: string;
+}
+
+export interface MessagePage {
+    messages: Message[]; // Newest first
+    nextCursor?: number; // beforeId of the next, older page; missing on the oldest page
+}
 
 export const chatApi = {
+    // Follows nextCursor until the server has returned every chat
     getChats: async (): Promise<Chat[]> => {
-        const response = await api.get<Chat[]>('/chats');
+        const chats: Chat[] = [];
+        let cursor: string | undefined;
+        do {
+            const response = await api.get<{ chats: Chat[]; nextCursor?: string }>('/chats', {
+                params: { limit: 100, cursor },
+            });
+            chats.push(...response.data.chats);
+            cursor = response.data.nextCursor;
+        } while (cursor);
+        return chats;
+    },
+
+    getChat: async (chatId: number): Promise<ChatDetails> => {
+        const response = await api.get<ChatDetails>(`/chats/${chatId}`);
         return response.data;
     },
 
-    getMessages: async (chatId: number, limit = 50): Promise<Message[]> => {
-        const response = await api.get<Message[]>(`/chats/${chatId}/messages`, {
-            params: { limit },
+    getMessages: async (chatId: number, limit = 50, beforeId?: number): Promise<MessagePage> => {
+        const response = await api.get<MessagePage>(`/chats/${chatId}/messages`, {
+            params: { limit, beforeId },
         });
         return response.data;
     },
@@ -29,10 +56,12 @@ export const chatApi = {
         return response.data;
     },
 
-    getPresignedUrl: async (filename: string, contentType: string): Promise<{ uploadUrl: string; objectKey: string }> => {
-        const response = await api.post<{ uploadUrl: string; objectKey: string }>('/uploads/presigned', {
+    getPresignedUrl: async (filename: string, contentType: string, size: number, chatId?: number): Promise<PresignedUpload> => {
+        const response = await api.post<PresignedUpload>('/uploads/presigned', {
             filename,
             contentType,
+            size,
+            chatId,
         });
         return response.data;
     },
@@ -47,11 +76,12 @@ export const chatApi = {
         });
     },
 
-    searchUsers: async (query: string): Promise<User[]> => {
-        const response = await api.get<User[]>('/users', {
-            params: { q: query },
+    // First page of matches; pass a page's nextCursor as afterId for the next
+    searchUsers: async (query: string, afterId?: number): Promise<PublicProfile[]> => {
+        const response = await api.get<{ users: PublicProfile[]; hasMore: boolean; nextCursor?: number }>('/users', {
+            params: { q: query, afterId },
         });
-        return response.data;
+        return response.data.users;
     },
 
     getChatMembers: async (chatId: number): Promise<ChatMember[]> => {
@@ -5,7 +5,7 @@ import { Modal } from '@/shared/components/Modal';
 import { Button } from '@/shared/components/Button';
 import { chatApi } from '../api';
 import type { Chat } from '../types';
-import type { User } from '@/features/auth/types';
+import type { PublicProfile } from '@/features/auth/types';
 import { useAuthStore } from '@/features/auth/store';
 import { clsx } from 'clsx';
 
@@ -22,7 +22,7 @@ export const ChatInfoModal = ({ isOpen, onClose, chat }: ChatInfoModalProps) =>
     const [isEditingTitle, setIsEditingTitle] = useState(false);
     const [title, setTitle] = useState(chat.title || chat.name || '');
     const [inviteQuery, setInviteQuery] = useState('');
-    const [inviteResults, setInviteResults] = useState<User[]>([]);
+    const [inviteResults, setInviteResults] = useState<PublicProfile[]>([]);
 
     useEffect(() => {
         setTitle(chat.title || chat.name || '');
@@ -147,9 +147,9 @@ export const ChatInfoModal = ({ isOpen, onClose, chat }: ChatInfoModalProps) =>
                                     <div key={user.id} className="flex items-center justify-between p-2 hover:bg-background/50">
                                         <div className="flex items-center gap-2">
                                             <div className="w-8 h-8 rounded-full bg-brand-primary/10 flex items-center justify-center text-brand-primary text-xs font-medium">
-                                                {user.email[0].toUpperCase()}
+                                                {user.username[0].toUpperCase()}
                                             </div>
-                                            <span className="text-sm text-text-primary">{user.email}</span>
+                                            <span className="text-sm text-text-primary">{user.username}</span>
                                         </div>
                                         <Button size="sm" variant="ghost" onClick={() => inviteMutation.mutate(user.id)}>Add</Button>
                                     </div>
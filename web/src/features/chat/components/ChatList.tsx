@@ -3,7 +3,7 @@ import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
 import { Search, Plus, UserPlus, Settings, MessageCircle } from 'lucide-react';
 import { useChatStore } from '../stores/chatStore';
 import { chatApi } from '../api';
-import type { User } from '@/features/auth/types';
+import type { PublicProfile } from '@/features/auth/types';
 import { clsx } from 'clsx';
 import { Button } from '@/shared/components/Button';
 import { Avatar } from '@/shared/components/Avatar';
@@ -50,7 +50,7 @@ export const ChatList = () => {
         },
     });
 
-    const handleUserSelect = async (user: User) => {
+    const handleUserSelect = async (user: PublicProfile) => {
         try {
             await createChatMutation.mutateAsync({
                 type: 1,
@@ -217,7 +217,7 @@ export const ChatList = () => {
                                     Global Search
                                 </div>
                                 {userResults
-                                    .filter(u => u.id !== currentUser?.id && !filteredChats.some(c => c.type === 1 && c.name === (u.username || u.email.split('@')[0])))
+                                    .filter(u => u.id !== currentUser?.id && !filteredChats.some(c => c.type === 1 && c.name === u.username))
                                     .map(user => (
                                         <div
                                             key={user.id}
@@ -225,16 +225,14 @@ export const ChatList = () => {
                                             className="flex items-center gap-3 px-4 py-3 cursor-pointer transition-all duration-150 hover:bg-bg-elevated group"
                                         >
                                             <Avatar
-                                                name={user.username || user.email}
+                                                name={user.username}
+                                                src={user.avatar_url}
                                                 size="lg"
                                             />
                                             <div className="flex-1 min-w-0">
                                                 <h3 className="text-body font-medium text-text-primary truncate">
-                                                    {user.username || user.email.split('@')[0]}
+                                                    {user.username}
                                                 </h3>
-                                                <p className="text-body-sm text-text-secondary truncate">
-                                                    {user.email}
-                                                </p>
                                             </div>
                                             <Button
                                                 size="icon-sm"
@@ -102,12 +102,42 @@ export const ChatWindow = () => {
     const fileInputRef = useRef<HTMLInputElement>(null);
     const textareaRef = useRef<HTMLTextAreaElement>(null);
 
-    // Fetch messages
+    // Fetch the newest page of messages; older pages load on scrolling up
+    const [olderCursors, setOlderCursors] = useState<Record<number, number | undefined>>({});
+    const [isLoadingOlder, setIsLoadingOlder] = useState(false);
     const { data: messages, isLoading } = useQuery({
         queryKey: ['messages', activeChat?.id],
-        queryFn: () => chatApi.getMessages(activeChat!.id),
+        queryFn: async () => {
+            const chatId = activeChat!.id;
+            const page = await chatApi.getMessages(chatId);
+            setOlderCursors((cursors) => ({ ...cursors, [chatId]: page.nextCursor }));
+            return page.messages;
+        },
         enabled: !!activeChat,
     });
+    const olderCursor = activeChat ? olderCursors[activeChat.id] : undefined;
+
+    const loadOlderMessages = useCallback(async () => {
+        if (!activeChat || !olderCursor || isLoadingOlder) return;
+        const chatId = activeChat.id;
+        const container = messagesContainerRef.current;
+        const previousHeight = container?.scrollHeight ?? 0;
+
+        setIsLoadingOlder(true);
+        try {
+            const page = await chatApi.getMessages(chatId, 50, olderCursor);
+            queryClient.setQueryData<Message[]>(['messages', chatId], (old) => [...(old || []), ...page.messages]);
+            setOlderCursors((cursors) => ({ ...cursors, [chatId]: page.nextCursor }));
+            // Keep the message the user was looking at in place
+            requestAnimationFrame(() => {
+                if (container) container.scrollTop += container.scrollHeight - previousHeight;
+            });
+        } catch (error) {
+            console.error('Failed to load older messages:', error);
+        } finally {
+            setIsLoadingOlder(false);
+        }
+    }, [activeChat, olderCursor, isLoadingOlder, queryClient]);
 
     // Group messages
     const groupedMessages = useMemo(() => groupMessages(messages || []), [messages]);
@@ -157,7 +187,10 @@ export const ChatWindow = () => {
         const { scrollTop, scrollHeight, clientHeight } = messagesContainerRef.current;
         const isNearBottom = scrollHeight - scrollTop - clientHeight < 200;
         setShowScrollButton(!isNearBottom);
-    }, []);
+        if (scrollTop < 200) {
+            loadOlderMessages();
+        }
+    }, [loadOlderMessages]);
 
     const scrollToBottom = useCallback((smooth = true) => {
         messagesEndRef.current?.scrollIntoView({
@@ -205,7 +238,7 @@ export const ChatWindow = () => {
         if (!file) return;
 
         try {
-            const { uploadUrl, objectKey } = await chatApi.getPresignedUrl(file.name, file.type || 'application/octet-stream');
+            const { uploadUrl, objectKey } = await chatApi.getPresignedUrl(file.name, file.type || 'application/octet-stream', file.size, activeChat!.id);
             await chatApi.uploadFileToUrl(uploadUrl, file, file.type || 'application/octet-stream');
             const publicUrl = `http://localhost:9000/chat-media/${objectKey}`;
             sendMessageMutation.mutate({ text: file.name, mediaUrl: publicUrl, replyToId: replyingTo?.id });
@@ -327,6 +360,11 @@ export const ChatWindow = () => {
                                         </div>
                                     </div>
                                 )}
+                                {msg.kind === 'system' ? (
+                                    <div className="flex items-center justify-center my-2">
+                                        <span className="text-caption text-text-tertiary">{msg.body}</span>
+                                    </div>
+                                ) : (
                                 <MessageBubble
                                     message={msg}
                                     onReply={handleReply}
@@ -339,6 +377,7 @@ export const ChatWindow = () => {
                                         }
                                     }}
                                 />
+                                )}
                             </div>
                         ))}
                     </div>
@@ -4,7 +4,7 @@ import { Search, Loader2, UserPlus } from 'lucide-react';
 import { Modal } from '@/shared/components/Modal';
 import { Button } from '@/shared/components/Button';
 import { chatApi } from '../api';
-import type { User } from '@/features/auth/types';
+import type { PublicProfile } from '@/features/auth/types';
 import { useAuthStore } from '@/features/auth/store';
 import { useWebSocketContext } from '@/shared/providers/WebSocketProvider';
 
@@ -21,12 +21,12 @@ export const CreateChatModal = ({ isOpen, onClose }: CreateChatModalProps) => {
     const [mode, setMode] = useState<'private' | 'group'>('private');
     const [query, setQuery] = useState('');
     const [debouncedQuery, setDebouncedQuery] = useState('');
-    const [searchResults, setSearchResults] = useState<User[]>([]);
+    const [searchResults, setSearchResults] = useState<PublicProfile[]>([]);
     const [isSearching, setIsSearching] = useState(false);
 
     // Group states
     const [groupName, setGroupName] = useState('');
-    const [selectedUsers, setSelectedUsers] = useState<User[]>([]);
+    const [selectedUsers, setSelectedUsers] = useState<PublicProfile[]>([]);
 
     const currentUser = useAuthStore((state) => state.user);
     const { sendJson } = useWebSocketContext();
@@ -99,7 +99,7 @@ export const CreateChatModal = ({ isOpen, onClose }: CreateChatModalProps) => {
         }
     };
 
-    const toggleUserSelection = (user: User) => {
+    const toggleUserSelection = (user: PublicProfile) => {
         if (selectedUsers.find(u => u.id === user.id)) {
             setSelectedUsers(selectedUsers.filter(u => u.id !== user.id));
         } else {
@@ -144,7 +144,7 @@ export const CreateChatModal = ({ isOpen, onClose }: CreateChatModalProps) => {
                     <div className="flex flex-wrap gap-2">
                         {selectedUsers.map(u => (
                             <div key={u.id} className="flex items-center gap-1 pl-2 pr-1 py-1 bg-brand-primary/10 text-brand-primary rounded-full text-xs font-medium">
-                                {u.email}
+                                {u.username}
                                 <button onClick={() => toggleUserSelection(u)} className="p-0.5 hover:bg-brand-primary/20 rounded-full">
                                     <div className="w-3 h-3 flex items-center justify-center">×</div>
                                 </button>
@@ -158,7 +158,7 @@ export const CreateChatModal = ({ isOpen, onClose }: CreateChatModalProps) => {
                     <Search className="absolute left-3 top-1/2 -translate-y-1/2 w-4 h-4 text-text-tertiary" />
                     <input
                         type="text"
-                        placeholder={mode === 'group' ? "Add members..." : "Search users by email..."}
+                        placeholder={mode === 'group' ? "Add members..." : "Search users by username..."}
                         className="w-full pl-10 pr-4 py-2 bg-app border border-border-subtle rounded-lg text-sm text-text-primary focus:outline-none focus:border-brand-primary transition-colors"
                         value={query}
                         onChange={(e) => setQuery(e.target.value)}
@@ -185,14 +185,11 @@ export const CreateChatModal = ({ isOpen, onClose }: CreateChatModalProps) => {
                                         >
                                             <div className="flex items-center gap-3">
                                                 <div className="w-10 h-10 rounded-full bg-brand-primary/10 flex items-center justify-center text-brand-primary font-medium">
-                                                    {user.username ? user.username.charAt(0).toUpperCase() : user.email.charAt(0).toUpperCase()}
+                                                    {user.username.charAt(0).toUpperCase()}
                                                 </div>
                                                 <div>
                                                     <p className="text-sm font-medium text-text-primary">
-                                                        {user.username || user.email.split('@')[0]}
-                                                    </p>
-                                                    <p className="text-xs text-text-secondary">
-                                                        {user.email}
+                                                        {user.username}
                                                     </p>
                                                 </div>
                                             </div>
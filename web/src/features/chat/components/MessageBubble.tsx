@@ -172,7 +172,7 @@ export const MessageBubble = ({
                             : "bg-bg-elevated border-brand-500/50 text-text-secondary"
                     )}>
                         <CornerUpLeft className="w-3 h-3 inline mr-1.5 opacity-70" />
-                        <span className="truncate">Replying to message</span>
+                        <span className="truncate">{message.reply_snippet || 'Replying to message'}</span>
                     </div>
                 )}
 
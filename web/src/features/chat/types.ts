@@ -13,20 +13,32 @@ export interface Message {
     chat_id: number;
     user_id: number;
     body: string;
+    kind?: 'user' | 'system'; // system = generated group event (join, leave, rename...)
+    meta?: Record<string, unknown>; // Structured payload for system messages
     media_url?: string;
     media_type?: string; // image, video, etc.
+    media_meta?: { mime: string; size: number; width?: number; height?: number; name?: string };
     reply_to_id?: number;
+    reply_snippet?: string; // Quoted parent text, kept even if the parent is deleted
+    forwarded_from?: { chat_id: number; msg_id: number }; // Original of a forwarded copy
     reactions?: Reaction[];
     created_at: string; // ISO string
+    edited_at?: string; // Set once the author edits the body
+    deleted_at?: string; // Only present on deleted messages listed by admins
+    expires_at?: string; // Disappearing message: removed at this time
     status?: number; // 1=Sent, 2=Delivered, 3=Read
     user?: User; // Sender details
     reply_count?: number; // Computed: how many replies this message has
+    last_reply_at?: string; // Computed: when the latest reply was sent
+    self?: boolean; // Set on the WebSocket copy delivered to the author's own devices (not the sending one unless WS_ECHO_TO_ORIGIN is on)
+    muted?: boolean; // Set on copies delivered to members who muted the chat
 }
 
 export interface Chat {
     id: number;
     type: number; // 1 = private, 2 = group
     title?: string;
+    message_ttl_seconds?: number; // New messages disappear this long after sending
     created_at: string;
     // Computed/Client-side props
     name?: string;
@@ -35,6 +47,22 @@ export interface Chat {
     unreadCount?: number;
 }
 
+export interface PinnedMessage {
+    chatId: number;
+    messageId: number;
+    pinnedBy: number;
+    pinnedAt: string;
+    message?: Message;
+}
+
+export interface ChatDetails extends Chat {
+    lastReadMsgId: number;
+    firstUnreadMsgId?: number; // Scroll anchor; absent when everything is read
+    pinnedMessage?: PinnedMessage; // Most recent pin, shown as the chat banner
+    memberCount: number;
+    role: 'owner' | 'admin' | 'member'; // The caller's role
+}
+
 export interface CreateChatRequest {
     type: number; // 1 = private, 2 = group
     title?: string;
@@ -52,7 +52,8 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
                     const activeChat = useChatStore.getState().activeChat;
                     const isHidden = document.hidden;
 
-                    if (isHidden || activeChat?.id !== message.chat_id) {
+                    // Messages we sent from another device or in muted chats don't notify
+                    if (!message.self && !message.muted && (isHidden || activeChat?.id !== message.chat_id)) {
                         const chats = queryClient.getQueryData<Chat[]>(['chats']);
                         const chat = chats?.find(c => c.id === message.chat_id);
                         const title = chat?.name || 'New Message';
@@ -84,6 +85,18 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
 
                     // Invalidate chats to update last message preview
                     queryClient.invalidateQueries({ queryKey: ['chats'] });
+
+                    // Tell the sender the message reached this device
+                    if (!message.self && message.kind !== 'system') {
+                        ws.send(JSON.stringify({ type: 'DeliveryReceipt', chatId: message.chat_id, msgId: message.id }));
+                    }
+                } else if (data.type === 'DeliveryReceipt') {
+                    // Another member's device received messages up to msgId
+                    const { chatId, msgId } = data;
+                    queryClient.setQueryData(['messages', chatId], (old: Message[] | undefined) => {
+                        if (!old) return old;
+                        return old.map(msg => (msg.id <= msgId && (msg.status ?? 1) < 2 ? { ...msg, status: 2 } : msg));
+                    });
                 } else if (data.type === 'ReadReceipt') {
                     const { chatId, msgId } = data;
                     console.log('WS: Read receipt for chat', chatId, 'up to', msgId);